@@ -0,0 +1,111 @@
+package go_stomp_websocket
+
+import (
+	"fmt"
+	"strconv"
+)
+
+const (
+	Version   = "version"
+	MessageId = "message-id"
+	Requeue   = "requeue"
+)
+
+type NackOption func(*nackOptions)
+
+type nackOptions struct {
+	requeue *bool
+}
+
+// WithRequeue adds the requeue header to the NACK frame. Brokers like RabbitMQ use it to decide between
+// redelivering and dead-lettering the message.
+func WithRequeue(requeue bool) NackOption {
+	return func(options *nackOptions) {
+		options.requeue = &requeue
+	}
+}
+
+// Ack sends an ACK frame for a received MESSAGE frame and waits until it is written to the connection.
+// The message is identified the same way as by Nack; STOMP 1.0 identifies it by its message-id header.
+func (stompClient StompClient) Ack(frame *Frame) error {
+	ackFrame, err := createAckFrame(ACK, stompClient.version, frame)
+	if err != nil {
+		return err
+	}
+	return stompClient.write(writeRequest{Frame: ackFrame})
+}
+
+// Nack sends a NACK frame for a received MESSAGE frame and waits until it is written to the connection.
+// STOMP 1.2 identifies the message by its ack header, STOMP 1.1 by the message-id and subscription headers.
+// Frames without them and connections that negotiated STOMP 1.0, which has no NACK, are reported as errors.
+func (stompClient StompClient) Nack(frame *Frame, opts ...NackOption) error {
+	nackFrame, err := createNackFrame(stompClient.version, frame, opts...)
+	if err != nil {
+		return err
+	}
+	return stompClient.write(writeRequest{Frame: nackFrame})
+}
+
+func createNackFrame(version string, frame *Frame, opts ...NackOption) (*Frame, error) {
+	options := &nackOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	if version != "1.2" && version != "1.1" {
+		return nil, fmt.Errorf("%w: STOMP %s", ErrNackNotSupported, version)
+	}
+	builder, err := ackBuilder(NACK, version, frame)
+	if err != nil {
+		return nil, err
+	}
+	if options.requeue != nil {
+		builder.WithHeader(Requeue, strconv.FormatBool(*options.requeue))
+	}
+	return builder.Build()
+}
+
+func createAckFrame(command, version string, frame *Frame) (*Frame, error) {
+	builder, err := ackBuilder(command, version, frame)
+	if err != nil {
+		return nil, err
+	}
+	return builder.Build()
+}
+
+// ackBuilder starts an ACK or NACK frame with the headers that identify frame in the protocol version.
+func ackBuilder(command, version string, frame *Frame) (*FrameBuilder, error) {
+	builder := NewFrame(command)
+	switch version {
+	case "1.2":
+		ack, ok := frame.Contains(Ack)
+		if !ok {
+			return nil, fmt.Errorf("can't %s %s frame without %s header", command, frame.Command, Ack)
+		}
+		builder.WithHeader(Id, ack)
+	case "1.1":
+		messageId, ok := frame.Contains(MessageId)
+		if !ok {
+			return nil, fmt.Errorf("can't %s %s frame without %s header", command, frame.Command, MessageId)
+		}
+		subscription, ok := frame.Contains(Subscription_h)
+		if !ok {
+			return nil, fmt.Errorf("can't %s %s frame without %s header", command, frame.Command, Subscription_h)
+		}
+		builder.WithHeader(MessageId, messageId).WithHeader(Subscription_h, subscription)
+	default:
+		messageId, ok := frame.Contains(MessageId)
+		if !ok {
+			return nil, fmt.Errorf("can't %s %s frame without %s header", command, frame.Command, MessageId)
+		}
+		builder.WithHeader(MessageId, messageId)
+	}
+	return builder, nil
+}
+
+// negotiatedVersion returns the protocol version of a CONNECTED frame. Brokers that omit the header speak STOMP 1.0.
+func negotiatedVersion(connected *Frame) string {
+	if version, ok := connected.Contains(Version); ok {
+		return version
+	}
+	return "1.0"
+}
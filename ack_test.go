@@ -0,0 +1,121 @@
+package go_stomp_websocket
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateNackFrame(t *testing.T) {
+	message := createTestFrame(MESSAGE, []string{"subscription:sub-1", "message-id:msg-1", "ack:ack-1", "destination:/queue/a"}, "body")
+	tests := []struct {
+		name    string
+		version string
+		frame   *Frame
+		opts    []NackOption
+		want    *Frame
+		wantErr string
+	}{
+		{
+			name:    "STOMP 1.2",
+			version: "1.2",
+			frame:   message,
+			want:    createTestFrame(NACK, []string{"id:ack-1"}, ""),
+		},
+		{
+			name:    "STOMP 1.1",
+			version: "1.1",
+			frame:   message,
+			want:    createTestFrame(NACK, []string{"message-id:msg-1", "subscription:sub-1"}, ""),
+		},
+		{
+			name:    "STOMP 1.2 with requeue",
+			version: "1.2",
+			frame:   message,
+			opts:    []NackOption{WithRequeue(false)},
+			want:    createTestFrame(NACK, []string{"id:ack-1", "requeue:false"}, ""),
+		},
+		{
+			name:    "STOMP 1.2 without ack header",
+			version: "1.2",
+			frame:   createTestFrame(MESSAGE, []string{"subscription:sub-1", "message-id:msg-1"}, ""),
+			wantErr: "can't NACK MESSAGE frame without ack header",
+		},
+		{
+			name:    "STOMP 1.1 without subscription header",
+			version: "1.1",
+			frame:   createTestFrame(MESSAGE, []string{"message-id:msg-1"}, ""),
+			wantErr: "can't NACK MESSAGE frame without subscription header",
+		},
+		{
+			name:    "STOMP 1.0",
+			version: "1.0",
+			frame:   message,
+			wantErr: "NACK is not supported by the negotiated STOMP version: STOMP 1.0",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			frame, err := createNackFrame(tt.version, tt.frame, tt.opts...)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, frame)
+		})
+	}
+}
+
+func TestCreateAckFrame(t *testing.T) {
+	message := createTestFrame(MESSAGE, []string{"subscription:sub-1", "message-id:msg-1", "ack:ack-1"}, "body")
+	tests := []struct {
+		version string
+		frame   *Frame
+		want    *Frame
+		wantErr string
+	}{
+		{version: "1.2", frame: message, want: createTestFrame(ACK, []string{"id:ack-1"}, "")},
+		{version: "1.1", frame: message, want: createTestFrame(ACK, []string{"message-id:msg-1", "subscription:sub-1"}, "")},
+		{version: "1.0", frame: message, want: createTestFrame(ACK, []string{"message-id:msg-1"}, "")},
+		{version: "1.0", frame: createTestFrame(MESSAGE, nil, ""), wantErr: "can't ACK MESSAGE frame without message-id header"},
+	}
+	for _, tt := range tests {
+		t.Run("STOMP "+tt.version, func(t *testing.T) {
+			frame, err := createAckFrame(ACK, tt.version, tt.frame)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, frame)
+		})
+	}
+}
+
+func TestNack_QueuesFrame(t *testing.T) {
+	client := &StompClient{
+		writeCh: make(chan writeRequest, 1),
+		version: "1.1",
+	}
+	go func() {
+		req := <-client.writeCh
+		assert.Equal(t, "NACK\nmessage-id:msg-1\nsubscription:sub-1\nrequeue:true\n\n\x00", string(req.Frame.rawBytes()))
+		req.Err <- nil
+	}()
+	message := createTestFrame(MESSAGE, []string{"subscription:sub-1", "message-id:msg-1"}, "")
+	assert.NoError(t, client.Nack(message, WithRequeue(true)))
+}
+
+func TestNegotiatedVersion(t *testing.T) {
+	assert.Equal(t, "1.2", negotiatedVersion(createTestFrame(CONNECTED, []string{"version:1.2"}, "")))
+	assert.Equal(t, "1.0", negotiatedVersion(createTestFrame(CONNECTED, nil, "")))
+}
+
+func TestConnect_StoresNegotiatedVersion(t *testing.T) {
+	ts, _ := startTestWSServer(t)
+	defer ts.Close()
+	client := connectTestClient(t, ts)
+	defer client.connection.Close()
+	assert.Equal(t, "1.2", client.version)
+}
@@ -0,0 +1,62 @@
+package go_stomp_websocket
+
+import (
+	"net/http"
+	"strings"
+)
+
+// WithAffinityCookies sends cookies with the upgrade request, so a load balancer can route the connection to the
+// same backend as before. Pass the Cookies of an earlier client of the same logical session, such as a JSESSIONID.
+// A later cookie replaces an earlier one of the same name. Ignored with WithCookieJar, since the dialer keeps
+// response cookies in the jar by itself.
+func WithAffinityCookies(cookies []*http.Cookie) ConnectOption {
+	return func(options *connectOptions) {
+		options.affinityCookies = mergeCookies(options.affinityCookies, cookies)
+	}
+}
+
+// Cookies returns the cookies the server set on the upgrade response.
+func (stompClient StompClient) Cookies() []*http.Cookie {
+	return append([]*http.Cookie(nil), stompClient.cookies...)
+}
+
+// applyAffinityCookies adds the affinity cookies to the Cookie header of the upgrade request.
+func (options *connectOptions) applyAffinityCookies(requestHeaders http.Header) {
+	if len(options.affinityCookies) == 0 || options.cookieJar != nil {
+		return
+	}
+	parts := make([]string, 0, len(options.affinityCookies)+1)
+	if existing := requestHeaders.Get("Cookie"); existing != "" {
+		parts = append(parts, existing)
+	}
+	for _, cookie := range options.affinityCookies {
+		parts = append(parts, (&http.Cookie{Name: cookie.Name, Value: cookie.Value}).String())
+	}
+	requestHeaders.Set("Cookie", strings.Join(parts, "; "))
+}
+
+// captureCookies remembers the cookies of an upgrade response, which may also be a failed one.
+func (options *connectOptions) captureCookies(resp *http.Response) {
+	if resp != nil {
+		options.responseCookies = mergeCookies(options.responseCookies, resp.Cookies())
+	}
+}
+
+func mergeCookies(cookies, updates []*http.Cookie) []*http.Cookie {
+	result := make([]*http.Cookie, 0, len(cookies)+len(updates))
+	for _, cookie := range cookies {
+		if !containsCookie(updates, cookie.Name) {
+			result = append(result, cookie)
+		}
+	}
+	return append(result, updates...)
+}
+
+func containsCookie(cookies []*http.Cookie, name string) bool {
+	for _, cookie := range cookies {
+		if cookie.Name == name {
+			return true
+		}
+	}
+	return false
+}
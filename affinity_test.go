@@ -0,0 +1,102 @@
+package go_stomp_websocket
+
+import (
+	"context"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+// startAffinityWSServer starts a test server that sets a JSESSIONID cookie on the upgrade response
+// and passes every upgrade request to check
+func startAffinityWSServer(t *testing.T, check func(r *http.Request)) *httptest.Server {
+	t.Helper()
+	upgrader := websocket.Upgrader{
+		CheckOrigin: func(r *http.Request) bool { return true },
+	}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		check(r)
+		c, err := upgrader.Upgrade(w, r, http.Header{"Set-Cookie": []string{"JSESSIONID=pod-b; Path=/"}})
+		if err != nil {
+			t.Errorf("upgrade error: %v", err)
+			return
+		}
+		defer c.Close()
+		if _, _, err = c.ReadMessage(); err != nil {
+			return
+		}
+		_ = c.WriteMessage(websocket.TextMessage, []byte("o"))
+		_ = c.WriteMessage(websocket.TextMessage, []byte(connectedTestFrame))
+		_, _, _ = c.ReadMessage()
+	}))
+}
+
+func TestAffinityCookies_CapturedAndReplayed(t *testing.T) {
+	cookieHeaders := make(chan string, 2)
+	ts := startAffinityWSServer(t, func(r *http.Request) {
+		cookieHeaders <- r.Header.Get("Cookie")
+	})
+	defer ts.Close()
+
+	first := connectTestClient(t, ts)
+	defer first.connection.Close()
+	assert.Equal(t, "", <-cookieHeaders)
+	cookies := first.Cookies()
+	if assert.Len(t, cookies, 1) {
+		assert.Equal(t, "JSESSIONID", cookies[0].Name)
+		assert.Equal(t, "pod-b", cookies[0].Value)
+	}
+
+	second := connectTestClient(t, ts,
+		WithUpgradeHeaders(http.Header{"Cookie": []string{"tenant=a"}}),
+		WithAffinityCookies(cookies))
+	defer second.connection.Close()
+	assert.Equal(t, "tenant=a; JSESSIONID=pod-b", <-cookieHeaders)
+}
+
+func TestConnectWithRetry_KeepsAffinityCookies(t *testing.T) {
+	attempts := &atomic.Int32{}
+	cookieHeaders := make(chan string, 2)
+	backend := startAffinityWSServer(t, func(r *http.Request) {})
+	defer backend.Close()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cookieHeaders <- r.Header.Get("Cookie")
+		if attempts.Add(1) == 1 {
+			http.SetCookie(w, &http.Cookie{Name: "JSESSIONID", Value: "pod-c"})
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		backend.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	client, err := ConnectWithRetry(context.Background(), wsURL(ts), websocket.Dialer{}, "token",
+		RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond})
+	assert.NoError(t, err)
+	defer client.connection.Close()
+	assert.Equal(t, "", <-cookieHeaders)
+	assert.Equal(t, "JSESSIONID=pod-c", <-cookieHeaders)
+}
+
+func TestApplyAffinityCookies(t *testing.T) {
+	cookies := []*http.Cookie{{Name: "JSESSIONID", Value: "old"}, {Name: "route", Value: "r1"}}
+	options := newConnectOptions([]ConnectOption{
+		WithAffinityCookies(cookies),
+		WithAffinityCookies([]*http.Cookie{{Name: "JSESSIONID", Value: "new"}}),
+	})
+	headers := http.Header{}
+	options.applyAffinityCookies(headers)
+	assert.Equal(t, "route=r1; JSESSIONID=new", headers.Get("Cookie"))
+
+	jar, _ := cookiejar.New(nil)
+	options = newConnectOptions([]ConnectOption{WithCookieJar(jar), WithAffinityCookies(cookies)})
+	headers = http.Header{}
+	options.applyAffinityCookies(headers)
+	assert.Empty(t, headers.Get("Cookie"))
+}
@@ -0,0 +1,107 @@
+package go_stomp_websocket
+
+import (
+	"strconv"
+	"strings"
+)
+
+// DestinationAlias is the header that carries the alias of a long destination, see WithDestinationAliases.
+const DestinationAlias = "x-dest-alias"
+
+// WithDestinationAliases makes the client shorten long destinations on the raw transport. The first SEND frame to a
+// destination of at least minLength bytes carries the destination and a short x-dest-alias header, the later ones
+// only the alias. Received frames with the header get their destination back before they are delivered, and a
+// frame with an alias the connection has not seen is dropped as an AnomalyUnknownDestinationAlias.
+// Each direction of a connection maps at most maxAliases destinations; the mapping starts empty on every connect.
+// Both ends must run this library with aliases enabled, so they are disabled by default and without
+// WithRawTransport.
+func WithDestinationAliases(minLength, maxAliases int) ConnectOption {
+	return func(options *connectOptions) {
+		options.aliasMinLength = minLength
+		options.maxAliases = maxAliases
+	}
+}
+
+// destinationAliases maps the long destinations of a connection to their aliases. The sent aliases are owned by the
+// writer goroutine and the received ones by the read loop. A nil *destinationAliases leaves frames unchanged.
+type destinationAliases struct {
+	minLength  int
+	maxAliases int
+	sent       map[string]string // destination to alias
+	received   map[string]string // alias to destination
+}
+
+// newDestinationAliases returns the aliases of a connection, nil unless WithDestinationAliases enabled them on the
+// raw transport.
+func newDestinationAliases(options *connectOptions) *destinationAliases {
+	if !options.rawTransport || options.maxAliases <= 0 {
+		return nil
+	}
+	return &destinationAliases{
+		minLength:  options.aliasMinLength,
+		maxAliases: options.maxAliases,
+		sent:       make(map[string]string),
+		received:   make(map[string]string),
+	}
+}
+
+// shorten returns the SEND frame to write in place of frame: with the alias in addition to a long destination the
+// first time, in place of it afterwards. Other frames and destinations that get no alias are returned as they are.
+// It must be called in the order the frames are written.
+func (aliases *destinationAliases) shorten(frame *Frame) *Frame {
+	if aliases == nil || frame.Command != SEND {
+		return frame
+	}
+	i, destination := headerIndex(frame, Destination)
+	if i < 0 || len(destination) < aliases.minLength {
+		return frame
+	}
+	shortened := *frame
+	if alias, ok := aliases.sent[destination]; ok {
+		shortened.Headers = append([]string(nil), frame.Headers...)
+		shortened.Headers[i] = DestinationAlias + ":" + alias
+		return &shortened
+	}
+	if len(aliases.sent) >= aliases.maxAliases {
+		return frame
+	}
+	alias := strconv.FormatInt(int64(len(aliases.sent)), 36)
+	aliases.sent[destination] = alias
+	shortened.Headers = append(append(make([]string, 0, len(frame.Headers)+1), frame.Headers...), DestinationAlias+":"+alias)
+	return &shortened
+}
+
+// expand puts the destination of the alias header of a received frame back in place of the header and learns the
+// aliases that come with their destination. It returns false for an alias it does not know.
+func (aliases *destinationAliases) expand(frame *Frame) bool {
+	if aliases == nil {
+		return true
+	}
+	i, alias := headerIndex(frame, DestinationAlias)
+	if i < 0 {
+		return true
+	}
+	if _, destination := headerIndex(frame, Destination); destination != "" {
+		if _, ok := aliases.received[alias]; ok || len(aliases.received) < aliases.maxAliases {
+			aliases.received[alias] = destination
+		}
+		frame.Headers = append(frame.Headers[:i:i], frame.Headers[i+1:]...)
+		return true
+	}
+	destination, ok := aliases.received[alias]
+	if !ok {
+		return false
+	}
+	frame.Headers[i] = Destination + ":" + destination
+	return true
+}
+
+// headerIndex returns the index and value of the first header with key, or -1 when the frame has none.
+func headerIndex(frame *Frame, key string) (int, string) {
+	for i, header := range frame.Headers {
+		if k, value, ok := strings.Cut(header, ":"); ok && k == key {
+			return i, value
+		}
+	}
+	return -1, ""
+}
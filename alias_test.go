@@ -0,0 +1,171 @@
+package go_stomp_websocket
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewDestinationAliases(t *testing.T) {
+	assert.Nil(t, newDestinationAliases(newConnectOptions(nil)))
+	assert.Nil(t, newDestinationAliases(newConnectOptions([]ConnectOption{WithDestinationAliases(8, 4)})), "SockJS")
+	assert.Nil(t, newDestinationAliases(newConnectOptions([]ConnectOption{WithRawTransport(), WithDestinationAliases(8, 0)})))
+	assert.NotNil(t, newDestinationAliases(newConnectOptions([]ConnectOption{WithRawTransport(), WithDestinationAliases(8, 4)})))
+}
+
+func TestDestinationAliases_Shorten(t *testing.T) {
+	long := "/topic/" + strings.Repeat("x", 20)
+	other := "/topic/" + strings.Repeat("y", 20)
+	aliases := newDestinationAliases(newConnectOptions([]ConnectOption{WithRawTransport(), WithDestinationAliases(16, 1)}))
+	tests := []struct {
+		name     string
+		frame    *Frame
+		expected []string
+	}{
+		{name: "first send", frame: createTestFrame(SEND, []string{"destination:" + long, "content-type:text/plain"}, "a"),
+			expected: []string{"destination:" + long, "content-type:text/plain", "x-dest-alias:0"}},
+		{name: "later send", frame: createTestFrame(SEND, []string{"destination:" + long, "content-type:text/plain"}, "b"),
+			expected: []string{"x-dest-alias:0", "content-type:text/plain"}},
+		{name: "short destination", frame: createTestFrame(SEND, []string{"destination:/topic/a"}, "c"),
+			expected: []string{"destination:/topic/a"}},
+		{name: "no alias left", frame: createTestFrame(SEND, []string{"destination:" + other}, "d"),
+			expected: []string{"destination:" + other}},
+		{name: "not a SEND", frame: createTestFrame(SUBSCRIBE, []string{"id:1", "destination:" + long}, ""),
+			expected: []string{"id:1", "destination:" + long}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			headers := append([]string(nil), tt.frame.Headers...)
+			shortened := aliases.shorten(tt.frame)
+			assert.Equal(t, tt.expected, shortened.Headers)
+			assert.Equal(t, tt.frame.Body(), shortened.Body())
+			assert.Equal(t, headers, tt.frame.Headers, "the queued frame is left as it is")
+		})
+	}
+	var disabled *destinationAliases
+	frame := createTestFrame(SEND, []string{"destination:" + long}, "")
+	assert.Same(t, frame, disabled.shorten(frame))
+}
+
+func TestDestinationAliases_Expand(t *testing.T) {
+	long := "/topic/" + strings.Repeat("x", 20)
+	aliases := newDestinationAliases(newConnectOptions([]ConnectOption{WithRawTransport(), WithDestinationAliases(16, 1)}))
+	tests := []struct {
+		name     string
+		headers  []string
+		expected []string
+		known    bool
+	}{
+		{name: "no alias", headers: []string{"subscription:1", "destination:/topic/a"},
+			expected: []string{"subscription:1", "destination:/topic/a"}, known: true},
+		{name: "unknown alias", headers: []string{"subscription:1", "x-dest-alias:0"},
+			expected: []string{"subscription:1", "x-dest-alias:0"}},
+		{name: "alias with its destination", headers: []string{"subscription:1", "destination:" + long, "x-dest-alias:0"},
+			expected: []string{"subscription:1", "destination:" + long}, known: true},
+		{name: "known alias", headers: []string{"subscription:1", "x-dest-alias:0", "message-id:2"},
+			expected: []string{"subscription:1", "destination:" + long, "message-id:2"}, known: true},
+		{name: "no alias left", headers: []string{"subscription:1", "destination:/topic/b", "x-dest-alias:1"},
+			expected: []string{"subscription:1", "destination:/topic/b"}, known: true},
+		{name: "alias over the limit", headers: []string{"subscription:1", "x-dest-alias:1"},
+			expected: []string{"subscription:1", "x-dest-alias:1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			frame := createTestFrame(MESSAGE, tt.headers, "body")
+			assert.Equal(t, tt.known, aliases.expand(frame))
+			assert.Equal(t, tt.expected, frame.Headers)
+		})
+	}
+}
+
+func TestRoute_UnknownDestinationAlias(t *testing.T) {
+	client := &StompClient{
+		aliases:   newDestinationAliases(newConnectOptions([]ConnectOption{WithRawTransport(), WithDestinationAliases(16, 4)})),
+		anomalies: make(chan ProtocolAnomaly, 1),
+		logger:    NopLogger(),
+		metrics:   nopMetrics{},
+		rawRoutes: newRawRoutes(false, nopMetrics{}),
+	}
+	frame := createTestFrame(MESSAGE, []string{"subscription:1", "x-dest-alias:7"}, "body")
+	client.route(frame)
+	anomaly := <-client.Anomalies()
+	assert.Equal(t, AnomalyUnknownDestinationAlias, anomaly.Kind)
+	assert.Same(t, frame, anomaly.Frame)
+	assert.Equal(t, ErrorKindProtocolUnknownDestinationAlias, AnomalyUnknownDestinationAlias.errorKind())
+}
+
+func TestWithDestinationAliases_RoundTrip(t *testing.T) {
+	long := "/topic/" + strings.Repeat("tenant-entity-", 10)
+	other := "/topic/" + strings.Repeat("other-entity-", 10)
+	upgrader := websocket.Upgrader{CheckOrigin: func(r *http.Request) bool { return true }}
+	sent := make(chan []string, 4)
+	// the server echoes every SEND frame to the subscription with the destination headers as it got them
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("upgrade error: %v", err)
+			return
+		}
+		defer c.Close()
+		var id string
+		for {
+			_, msg, err := c.ReadMessage()
+			if err != nil {
+				return
+			}
+			frames, _, _ := (&rawFrameSplitter{}).Feed(msg)
+			for _, frame := range frames {
+				switch frame.Command {
+				case CONNECT:
+					_ = c.WriteMessage(websocket.TextMessage, []byte("CONNECTED\nversion:1.2\n\n\x00"))
+				case SUBSCRIBE:
+					id, _ = frame.Contains(Id)
+				case SEND:
+					sent <- frame.Headers
+					headers := []string{Subscription_h + ":" + id}
+					for _, header := range frame.Headers {
+						if strings.HasPrefix(header, Destination+":") || strings.HasPrefix(header, DestinationAlias+":") {
+							headers = append(headers, header)
+						}
+					}
+					_ = c.WriteMessage(websocket.TextMessage, createTestFrame(MESSAGE, headers, frame.BodyString()).rawBytes())
+				}
+			}
+		}
+	}))
+	defer ts.Close()
+
+	client := connectTestClient(t, ts, WithRawTransport(), WithDestinationAliases(64, 1))
+	defer client.connection.Close()
+	sub, err := client.Subscribe("/topic/all")
+	if !assert.NoError(t, err) {
+		return
+	}
+	expected := []struct {
+		destination string
+		headers     []string
+	}{
+		{destination: long, headers: []string{"destination:" + long, "x-dest-alias:0"}},
+		{destination: long, headers: []string{"x-dest-alias:0"}},
+		{destination: other, headers: []string{"destination:" + other}},
+		{destination: "/topic/a", headers: []string{"destination:/topic/a"}},
+	}
+	for _, e := range expected {
+		assert.NoError(t, client.Send(e.destination, "", []byte("x")))
+		assert.Equal(t, e.headers, <-sent)
+		select {
+		case frame := <-sub.FrameCh:
+			destination, _ := frame.Contains(Destination)
+			assert.Equal(t, e.destination, destination)
+			_, aliased := frame.Contains(DestinationAlias)
+			assert.False(t, aliased)
+		case <-time.After(2 * time.Second):
+			t.Fatalf("no MESSAGE for %s", e.destination)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package go_stomp_websocket
+
+// anomalyBuffer is the capacity of the client anomaly channel.
+const anomalyBuffer = 16
+
+// AnomalyKind classifies a ProtocolAnomaly.
+type AnomalyKind string
+
+const (
+	// AnomalyHandshakeFrame is a CONNECTED, CONNECT or STOMP frame received after the handshake.
+	AnomalyHandshakeFrame AnomalyKind = "handshake_frame"
+	// AnomalyUnknownReceipt is a RECEIPT frame for a receipt id the client did not ask for or no longer waits on.
+	AnomalyUnknownReceipt AnomalyKind = "unknown_receipt"
+	// AnomalyMessageWithoutSubscription is a MESSAGE frame without a subscription header.
+	AnomalyMessageWithoutSubscription AnomalyKind = "message_without_subscription"
+	// AnomalyMalformedFrame is a websocket message that could not be parsed and was dropped under SkipFrame.
+	AnomalyMalformedFrame AnomalyKind = "malformed_frame"
+	// AnomalyUnknownDestinationAlias is a frame with a destination alias the connection has not seen, see
+	// WithDestinationAliases.
+	AnomalyUnknownDestinationAlias AnomalyKind = "unknown_destination_alias"
+)
+
+// ProtocolAnomaly is a frame the broker should not have sent at this point of the session, or a malformed
+// message dropped under SkipFrame. Such frames are never routed to subscriptions.
+type ProtocolAnomaly struct {
+	Kind  AnomalyKind
+	Frame *Frame           // nil for AnomalyMalformedFrame
+	Err   *FrameParseError // set for AnomalyMalformedFrame only
+}
+
+// errorKind is the MetricsCollector error kind counting the anomaly, one of the ErrorKindProtocol constants.
+func (kind AnomalyKind) errorKind() string {
+	return "protocol_" + string(kind)
+}
+
+// Anomalies returns the channel that receives the protocol anomalies of the connection. Anomalies are dropped
+// when nobody reads the channel and its buffer is full; the metrics still count them.
+// The channel is not closed when the connection ends.
+func (stompClient StompClient) Anomalies() <-chan ProtocolAnomaly {
+	return stompClient.anomalies
+}
+
+// reportAnomaly logs, counts and publishes an anomaly without blocking.
+func (stompClient *StompClient) reportAnomaly(kind AnomalyKind, frame *Frame) {
+	stompClient.logger.Errorf("protocol anomaly %s: unexpected %s frame", kind, frame.Command)
+	stompClient.metrics.ErrorOccurred(kind.errorKind())
+	select {
+	case stompClient.anomalies <- ProtocolAnomaly{Kind: kind, Frame: frame}:
+	default:
+	}
+}
+
+func isHandshakeFrame(frame *Frame) bool {
+	switch frame.Command {
+	case CONNECTED, CONNECT, STOMP:
+		return true
+	}
+	return false
+}
+
+// handshakeFrame handles a handshake frame received mid-session. With WithHeartbeatRenegotiation a CONNECTED
+// frame that changes whether the broker sends heart-beats updates the frame splitter.
+// It must only be called from the read loop, which owns the splitter.
+func (stompClient *StompClient) handshakeFrame(frame *Frame) {
+	stompClient.reportAnomaly(AnomalyHandshakeFrame, frame)
+	if frame.Command != CONNECTED || !stompClient.renegotiateHeartbeats {
+		return
+	}
+	if heartbeating := brokerSendsHeartbeats(frame); heartbeating != stompClient.splitter.heartbeating {
+		stompClient.logger.Infof("[%s] renegotiated heart-beats, broker heart-beats enabled: %t", roleReadLoop, heartbeating)
+		stompClient.splitter.heartbeating = heartbeating
+	}
+}
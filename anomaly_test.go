@@ -0,0 +1,103 @@
+package go_stomp_websocket
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProtocolAnomalies(t *testing.T) {
+	ts := startScriptedWSServer(t, func(c *websocket.Conn) {
+		for {
+			_, msg, err := c.ReadMessage()
+			if err != nil {
+				return
+			}
+			frame := ReadFrame(append([]byte("a"), msg...))
+			if frame.Command != SUBSCRIBE {
+				continue
+			}
+			id, _ := frame.Contains(Id)
+			for _, f := range []*Frame{
+				CreateFrame(CONNECTED, []string{"version:1.2", "heart-beat:5000,0"}),
+				CreateFrame(RECEIPT, []string{ReceiptId + ":never-issued"}),
+				CreateFrame(MESSAGE, []string{Destination + ":/topic/test"}),
+				CreateFrame(MESSAGE, []string{Subscription_h + ":" + id, Destination + ":/topic/test"}),
+			} {
+				if err := c.WriteMessage(websocket.TextMessage, append([]byte("a"), f.Bytes()...)); err != nil {
+					return
+				}
+			}
+		}
+	})
+	defer ts.Close()
+	metrics := NewCounterMetrics()
+	client := connectTestClient(t, ts, WithMetrics(metrics))
+	defer client.connection.Close()
+	sub, err := client.Subscribe("/topic/test")
+	assert.NoError(t, err)
+
+	select {
+	case frame := <-sub.FrameCh:
+		assert.Equal(t, MESSAGE, frame.Command)
+		id, _ := frame.Contains(Subscription_h)
+		assert.Equal(t, sub.Id().String(), id)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting on the subscription")
+	}
+
+	expected := []AnomalyKind{AnomalyHandshakeFrame, AnomalyUnknownReceipt, AnomalyMessageWithoutSubscription}
+	for _, kind := range expected {
+		select {
+		case anomaly := <-client.Anomalies():
+			assert.Equal(t, kind, anomaly.Kind)
+			assert.NotNil(t, anomaly.Frame)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting on anomaly %s", kind)
+		}
+	}
+	errorCounts := metrics.Snapshot().Errors
+	assert.Equal(t, uint64(1), errorCounts[ErrorKindProtocolHandshakeFrame])
+	assert.Equal(t, uint64(1), errorCounts[ErrorKindProtocolUnknownReceipt])
+	assert.Equal(t, uint64(1), errorCounts[ErrorKindProtocolMessageWithoutSubscription])
+	select {
+	case frame := <-sub.FrameCh:
+		t.Fatalf("unexpected %s frame routed to the subscription", frame.Command)
+	default:
+	}
+}
+
+func TestHandshakeFrame_HeartbeatRenegotiation(t *testing.T) {
+	tests := []struct {
+		name        string
+		renegotiate bool
+		frame       *Frame
+		expected    bool
+	}{
+		{"renegotiated", true, CreateFrame(CONNECTED, []string{"heart-beat:5000,0"}), true},
+		{"not configured", false, CreateFrame(CONNECTED, []string{"heart-beat:5000,0"}), false},
+		{"not CONNECTED", true, CreateFrame(CONNECT, []string{"heart-beat:5000,0"}), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &StompClient{
+				splitter:              &rawFrameSplitter{},
+				anomalies:             make(chan ProtocolAnomaly, 1),
+				logger:                NopLogger(),
+				metrics:               nopMetrics{},
+				renegotiateHeartbeats: tt.renegotiate,
+			}
+			client.handshakeFrame(tt.frame)
+			assert.Equal(t, tt.expected, client.splitter.heartbeating)
+			assert.Equal(t, AnomalyHandshakeFrame, (<-client.Anomalies()).Kind)
+		})
+	}
+}
+
+func TestAnomalyKind_ErrorKind(t *testing.T) {
+	assert.Equal(t, ErrorKindProtocolHandshakeFrame, AnomalyHandshakeFrame.errorKind())
+	assert.Equal(t, ErrorKindProtocolUnknownReceipt, AnomalyUnknownReceipt.errorKind())
+	assert.Equal(t, ErrorKindProtocolMessageWithoutSubscription, AnomalyMessageWithoutSubscription.errorKind())
+}
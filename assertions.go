@@ -0,0 +1,50 @@
+package go_stomp_websocket
+
+import (
+	"fmt"
+	"runtime/debug"
+	"sync"
+)
+
+// The lifecycle assertions catch misuse of the client that otherwise goes unnoticed or fails far from its
+// cause. They only run in builds with the stompdebug tag; in other builds assertionsEnabled is a false
+// constant and the compiler drops them.
+
+// frameReaders holds the stack of the goroutine that reads the frames of a subscription through the client, per
+// subscription.
+var frameReaders sync.Map
+
+// claimReader records that the calling goroutine reads the frames of sub until the returned release function is
+// called, and panics if another goroutine reads them through the client already.
+func claimReader(sub *Subscription) (release func()) {
+	if !assertionsEnabled {
+		return func() {}
+	}
+	stack := string(debug.Stack())
+	if reader, loaded := frameReaders.LoadOrStore(sub, stack); loaded {
+		panic(fmt.Sprintf("go_stomp_websocket: frames of subscription %s read by two goroutines\nfirst reader:\n%s\nsecond reader:\n%s", sub.id, reader, stack))
+	}
+	return func() { frameReaders.CompareAndDelete(sub, stack) }
+}
+
+// recordDisconnect remembers where Disconnect was called, for the panic of a later use of the client.
+func (state *terminalState) recordDisconnect() {
+	if !assertionsEnabled {
+		return
+	}
+	stack := string(debug.Stack())
+	state.disconnectedAt.CompareAndSwap(nil, &stack)
+}
+
+// enqueueRefused reports a request the client refused because it is closed. The request is logged with the caller
+// stack, and it panics if Disconnect was called before, unless frame is the DISCONNECT frame itself.
+func (stompClient StompClient) enqueueRefused(frame *Frame) {
+	if !assertionsEnabled || frame == nil || frame.Command == DISCONNECT {
+		return
+	}
+	stack := debug.Stack()
+	if at := stompClient.terminal.disconnectedAt.Load(); at != nil {
+		panic(fmt.Sprintf("go_stomp_websocket: %s frame written after Disconnect\nDisconnect was called at:\n%s\nwritten at:\n%s", frame.Command, *at, stack))
+	}
+	stompClient.logger.Errorf("%s frame written after the connection closed, at:\n%s", frame.Command, stack)
+}
@@ -0,0 +1,6 @@
+//go:build !stompdebug
+
+package go_stomp_websocket
+
+// assertionsEnabled is false without the stompdebug build tag, which compiles the lifecycle assertions out.
+const assertionsEnabled = false
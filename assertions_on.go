@@ -0,0 +1,6 @@
+//go:build stompdebug
+
+package go_stomp_websocket
+
+// assertionsEnabled turns on the lifecycle assertions of the stompdebug build tag.
+const assertionsEnabled = true
@@ -0,0 +1,90 @@
+//go:build stompdebug
+
+package go_stomp_websocket
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// panicMessage returns the panic value of fn as a string, or "" if fn did not panic.
+func panicMessage(fn func()) (message string) {
+	defer func() {
+		if r := recover(); r != nil {
+			message = fmt.Sprint(r)
+		}
+	}()
+	fn()
+	return ""
+}
+
+func TestAssertions_WriteAfterDisconnect(t *testing.T) {
+	ts, _ := startTestWSServer(t)
+	defer ts.Close()
+	client := connectTestClient(t, ts, WithLogger(NopLogger()))
+	assert.NoError(t, client.Disconnect())
+
+	message := panicMessage(func() { _ = client.Send("/queue/a", "text/plain", []byte("x")) })
+	assert.Contains(t, message, "SEND frame written after Disconnect")
+	assert.Contains(t, message, "Disconnect was called at:")
+	assert.Contains(t, message, "TestAssertions_WriteAfterDisconnect")
+	assert.Empty(t, panicMessage(func() { assert.NoError(t, client.Disconnect()) }))
+}
+
+func TestAssertions_WriteAfterConnectionLoss(t *testing.T) {
+	ts, _ := startTestWSServer(t)
+	defer ts.Close()
+	client := connectTestClient(t, ts, WithLogger(NopLogger()))
+	_ = client.connection.Close()
+	<-client.done
+
+	assert.Empty(t, panicMessage(func() {
+		assert.ErrorIs(t, client.Send("/queue/a", "text/plain", []byte("x")), ErrClientClosed)
+	}))
+}
+
+func TestAssertions_TwoReaders(t *testing.T) {
+	ts, _ := startTestWSServer(t)
+	defer ts.Close()
+	client := connectTestClient(t, ts, WithLogger(NopLogger()))
+	defer client.connection.Close()
+	sub, err := client.Subscribe("/topic/a")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	read := make(chan error)
+	go func() { read <- sub.ReadJSONContext(ctx, new(any)) }()
+	assert.Eventually(t, func() bool {
+		_, ok := frameReaders.Load(sub)
+		return ok
+	}, 5*time.Second, time.Millisecond)
+
+	message := panicMessage(func() { _ = sub.ReadJSONContext(context.Background(), new(any)) })
+	assert.Contains(t, message, "read by two goroutines")
+	assert.Contains(t, message, "first reader:")
+	message = panicMessage(func() { client.Supervise(sub, func(*Frame) error { return nil }) })
+	assert.Contains(t, message, "read by two goroutines")
+
+	cancel()
+	assert.ErrorIs(t, <-read, context.Canceled)
+	supervisor := client.Supervise(sub, func(*Frame) error { return nil })
+	supervisor.Stop()
+	<-supervisor.Done()
+	_, claimed := frameReaders.Load(sub)
+	assert.False(t, claimed)
+}
+
+func TestAssertions_BufferPoisoning(t *testing.T) {
+	ts, _ := startTestWSServer(t)
+	defer ts.Close()
+	client := connectTestClient(t, ts, WithLogger(NopLogger()))
+	defer client.connection.Close()
+	// TestSubscribeRaw_BufferPoisoning covers what poisoning does to a retained body
+	assert.True(t, client.rawRoutes.poison, "SubscribeRaw bodies are poisoned without WithBufferPoisoning")
+}
@@ -0,0 +1,85 @@
+package go_stomp_websocket
+
+import (
+	"bytes"
+)
+
+// WithWriteBatching makes the writer send the frames that are already queued when it takes one off the write
+// queue as one SockJS array message, up to maxFrames frames and maxBytes bytes per message, fewer when
+// WithMaxOutboundMessageSize is lower. Every request of a batch gets the result of the batch write, and
+// receipts are matched per frame as before. Frames of SendReader are always sent on their own. The raw
+// transport sends one frame per message regardless; maxFrames below 2 disables batching.
+func WithWriteBatching(maxFrames, maxBytes int) ConnectOption {
+	return func(options *connectOptions) {
+		options.batchFrames = maxFrames
+		options.batchBytes = maxBytes
+	}
+}
+
+// nextBatch appends first and the requests queued behind it that fit the batch limits to batch. A queued request
+// that could not join the batch is returned as next with more set; it must be written after the batch.
+func (stompClient *StompClient) nextBatch(batch []writeRequest, first writeRequest) (_ []writeRequest, next writeRequest, more bool) {
+	batch = append(batch, first)
+	if stompClient.batchFrames < 2 || stompClient.rawTransport || first.Stream != nil || first.Frame == nil {
+		return batch, next, false
+	}
+	budget := stompClient.batchBytes
+	if limit := stompClient.maxOutboundMessageSize; limit > 0 && (budget <= 0 || limit < budget) {
+		budget = limit
+	}
+	size := first.Frame.encodedSize(false)
+	for len(batch) < stompClient.batchFrames {
+		select {
+		case req := <-stompClient.writeCh:
+			if req.Frame == nil {
+				// a Flush marker reports once the batch is written
+				return batch, req, true
+			}
+			// the batch is a little smaller than the sum, a frame loses its brackets and gains a comma
+			size += req.Frame.encodedSize(false)
+			if req.Stream != nil || budget > 0 && size > budget {
+				return batch, req, true
+			}
+			batch = append(batch, req)
+		default:
+			return batch, next, false
+		}
+	}
+	return batch, next, false
+}
+
+// writeRequests writes the frames of the requests, several of them as one SockJS array message.
+func (stompClient *StompClient) writeRequests(batch []writeRequest) error {
+	switch {
+	case batch[0].Frame == nil:
+		return nil
+	case batch[0].Stream != nil:
+		return stompClient.writeStream(batch[0].Frame, batch[0].Stream)
+	case len(batch) == 1:
+		return stompClient.writeFrame(batch[0].Frame)
+	}
+	buf := frameBuffers.Get().(*bytes.Buffer)
+	defer frameBuffers.Put(buf)
+	buf.Reset()
+	buf.WriteByte('[')
+	for i, req := range batch {
+		stompClient.traceFrame(">>>", req.Frame)
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		stompClient.escapeFrame(req.Frame).writeSockJSElement(buf)
+	}
+	buf.WriteByte(']')
+	err := stompClient.writeMessage(buf.Bytes())
+	switch {
+	case err == nil:
+		for _, req := range batch {
+			stompClient.metrics.FrameSent(req.Frame.Command, req.Frame.size())
+		}
+	case isTimeout(err):
+		stompClient.metrics.ErrorOccurred(ErrorKindWriteTimeout)
+	default:
+		stompClient.metrics.ErrorOccurred(ErrorKindWrite)
+	}
+	return err
+}
@@ -0,0 +1,270 @@
+package go_stomp_websocket
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNextBatch(t *testing.T) {
+	send := func(body string) writeRequest {
+		return writeRequest{Frame: createTestFrame(SEND, []string{"destination:/queue/a"}, body)}
+	}
+	frameSize := send("x").Frame.encodedSize(false)
+	tests := []struct {
+		name          string
+		client        StompClient
+		queued        []writeRequest
+		batch         int
+		next          bool
+		leftInQueue   int
+		firstIsStream bool
+		flushNext     bool
+	}{
+		{name: "disabled", client: StompClient{}, queued: []writeRequest{send("x")}, batch: 1, leftInQueue: 1},
+		{name: "raw transport", client: StompClient{batchFrames: 10, rawTransport: true}, queued: []writeRequest{send("x")}, batch: 1, leftInQueue: 1},
+		{name: "queue drained", client: StompClient{batchFrames: 10}, queued: []writeRequest{send("x"), send("x")}, batch: 3},
+		{name: "frame limit", client: StompClient{batchFrames: 2}, queued: []writeRequest{send("x"), send("x")}, batch: 2, leftInQueue: 1},
+		{name: "byte limit", client: StompClient{batchFrames: 10, batchBytes: 2 * frameSize}, queued: []writeRequest{send("x"), send("x")}, batch: 2, next: true},
+		{name: "outbound limit", client: StompClient{batchFrames: 10, maxOutboundMessageSize: 2 * frameSize}, queued: []writeRequest{send("x"), send("x")}, batch: 2, next: true},
+		{name: "stream ends batch", client: StompClient{batchFrames: 10},
+			queued: []writeRequest{{Frame: createTestFrame(SEND, nil, ""), Stream: &streamBody{}}, send("x")}, batch: 1, next: true, leftInQueue: 1},
+		{name: "flush ends batch", client: StompClient{batchFrames: 10},
+			queued: []writeRequest{send("x"), {}, send("x")}, batch: 2, next: true, leftInQueue: 1, flushNext: true},
+		{name: "stream first", client: StompClient{batchFrames: 10}, firstIsStream: true, queued: []writeRequest{send("x")}, batch: 1, leftInQueue: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := tt.client
+			client.writeCh = make(chan writeRequest, len(tt.queued))
+			for _, req := range tt.queued {
+				client.writeCh <- req
+			}
+			first := send("x")
+			if tt.firstIsStream {
+				first.Stream = &streamBody{}
+			}
+			batch, next, more := client.nextBatch(nil, first)
+			assert.Len(t, batch, tt.batch)
+			assert.Equal(t, tt.next, more)
+			if more {
+				assert.Equal(t, tt.flushNext, next.Frame == nil)
+			}
+			assert.Len(t, client.writeCh, tt.leftInQueue)
+		})
+	}
+}
+
+func TestWriteRequests_OneMessagePerBatch(t *testing.T) {
+	messages := make(chan []byte, 1)
+	ts := startScriptedWSServer(t, func(c *websocket.Conn) {
+		_, data, err := c.ReadMessage()
+		if err == nil {
+			messages <- data
+		}
+	})
+	defer ts.Close()
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http"), nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer conn.Close()
+	_ = conn.WriteMessage(websocket.TextMessage, []byte(`["CONNECT\n\n\u0000"]`))
+	_, _, _ = conn.ReadMessage() // open frame
+	_, _, _ = conn.ReadMessage() // CONNECTED
+	client := &StompClient{connection: conn, logger: NopLogger(), metrics: nopMetrics{}}
+
+	assert.NoError(t, client.writeRequests([]writeRequest{
+		{Frame: createTestFrame(SEND, []string{"destination:/queue/a"}, "one")},
+		{Frame: createTestFrame(SUBSCRIBE, []string{"id:1", "destination:/topic/b"}, "")},
+		{Frame: createTestFrame(DISCONNECT, []string{"receipt:r1"}, "")},
+	}))
+	select {
+	case data := <-messages:
+		var elements []string
+		assert.NoError(t, json.Unmarshal(data, &elements))
+		assert.Equal(t, []string{
+			"SEND\ndestination:/queue/a\n\none\x00",
+			"SUBSCRIBE\nid:1\ndestination:/topic/b\n\n\x00",
+			"DISCONNECT\nreceipt:r1\n\n\x00",
+		}, elements)
+	case <-time.After(2 * time.Second):
+		t.Fatal("no message received")
+	}
+}
+
+// startCountingWSServer starts a test server that counts the websocket messages and STOMP frames the client
+// sends after CONNECT and answers receipts.
+func startCountingWSServer(t testing.TB) (*httptest.Server, func() (messages, frames int64)) {
+	var messageCount, frameCount atomic.Int64
+	ts := startScriptedWSServer(t, func(c *websocket.Conn) {
+		for {
+			_, data, err := c.ReadMessage()
+			if err != nil {
+				return
+			}
+			var elements []string
+			if err := json.Unmarshal(data, &elements); err != nil {
+				t.Errorf("invalid SockJS message %q: %v", data, err)
+				return
+			}
+			messageCount.Add(1)
+			frameCount.Add(int64(len(elements)))
+			for _, element := range elements {
+				if receipt, ok := ReadFrame([]byte(`a["` + element + `"]`)).Contains(Receipt); ok {
+					_ = c.WriteMessage(websocket.TextMessage, []byte(`a["RECEIPT\nreceipt-id:`+receipt+`\n\n\u0000"]`))
+				}
+			}
+		}
+	})
+	return ts, func() (int64, int64) {
+		return messageCount.Load(), frameCount.Load()
+	}
+}
+
+func TestWriteBatching_ConcurrentSends(t *testing.T) {
+	ts, counts := startCountingWSServer(t)
+	defer ts.Close()
+	client, err := ConnectWithToken(wsURL(ts), websocket.Dialer{}, "token", WithWriteBatching(64, 0), WithWriteQueueSize(64))
+	if !assert.NoError(t, err) {
+		return
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				assert.NoError(t, client.Send("/queue/test", "", []byte(strconv.Itoa(j))))
+			}
+		}()
+	}
+	wg.Wait()
+	// the receipt of DISCONNECT is matched also when it is batched
+	assert.NoError(t, client.Disconnect())
+	messages, frames := counts()
+	assert.Equal(t, int64(801), frames)
+	assert.LessOrEqual(t, messages, frames)
+}
+
+func BenchmarkPublish(b *testing.B) {
+	for _, bench := range []struct {
+		name string
+		opts []ConnectOption
+	}{
+		{name: "unbatched"},
+		{name: "batched", opts: []ConnectOption{WithWriteBatching(128, 64<<10)}},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			ts, counts := startCountingWSServer(b)
+			defer ts.Close()
+			client, err := ConnectWithToken(wsURL(ts), websocket.Dialer{}, "token", append(bench.opts, WithWriteQueueSize(1024))...)
+			if err != nil {
+				b.Fatal(err)
+			}
+			body := []byte("price=42")
+			const publishers = 16
+			const framesPerOp = 10000
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				var wg sync.WaitGroup
+				for p := 0; p < publishers; p++ {
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						for j := 0; j < framesPerOp/publishers; j++ {
+							// bursty publishers queue without waiting and only block while the queue is full
+							err := client.TrySend("/topic/prices", "text/plain", body)
+							if errors.Is(err, ErrWriteQueueFull) {
+								err = client.Send("/topic/prices", "text/plain", body)
+							}
+							if err != nil {
+								b.Error(err)
+								return
+							}
+						}
+					}()
+				}
+				wg.Wait()
+			}
+			b.StopTimer()
+			_ = client.Disconnect()
+			messages, frames := counts()
+			b.ReportMetric(float64(messages)/float64(b.N), "messages/op")
+			b.ReportMetric(float64(frames)/float64(messages), "frames/message")
+		})
+	}
+}
+
+func TestFlush(t *testing.T) {
+	messages := make(chan string, 16)
+	ts := startRecordingWSServer(t, messages)
+	client := connectTestClient(t, ts, WithLogger(NopLogger()), WithWriteQueueSize(8))
+	<-messages // CONNECT
+	for _, body := range []string{"1", "2", "3"} {
+		assert.NoError(t, client.TrySend("/queue/a", "", []byte(body)))
+	}
+	assert.NoError(t, client.Flush(context.Background()))
+	assert.Len(t, client.writeCh, 0)
+	for _, body := range []string{"1", "2", "3"} {
+		assert.Equal(t, body, ReadFrame(append([]byte("a"), receiveMessage(t, messages)...)).BodyString())
+	}
+	assert.NoError(t, client.Disconnect())
+	assert.ErrorIs(t, client.Flush(context.Background()), ErrClientClosed)
+}
+
+func TestFlush_ContextDone(t *testing.T) {
+	client := StompClient{writeCh: make(chan writeRequest, 1)}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, client.Flush(ctx), context.Canceled)
+}
+
+func TestWriteOrder_AcrossProducers(t *testing.T) {
+	const producers, perProducer = 4, 50
+	messages := make(chan string, producers*perProducer+2)
+	ts := startRecordingWSServer(t, messages)
+	client := connectTestClient(t, ts, WithLogger(NopLogger()), WithWriteBatching(16, 0), WithWriteQueueSize(16))
+	<-messages // CONNECT
+	var wg sync.WaitGroup
+	for p := 0; p < producers; p++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < perProducer; j++ {
+				destination := "/queue/" + strconv.Itoa(p)
+				if j%2 == 0 {
+					assert.NoError(t, client.Send(destination, "", []byte(strconv.Itoa(j))))
+				} else if err := client.TrySend(destination, "", []byte(strconv.Itoa(j))); errors.Is(err, ErrWriteQueueFull) {
+					assert.NoError(t, client.Send(destination, "", []byte(strconv.Itoa(j))))
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	assert.NoError(t, client.Flush(context.Background()))
+
+	next := make(map[string]int)
+	for received := 0; received < producers*perProducer; {
+		var elements []string
+		assert.NoError(t, json.Unmarshal([]byte(receiveMessage(t, messages)), &elements))
+		for _, element := range elements {
+			frame := ReadFrame([]byte(`a["` + element + `"]`))
+			destination, _ := frame.Contains(Destination)
+			assert.Equal(t, strconv.Itoa(next[destination]), frame.BodyString(), destination)
+			next[destination]++
+			received++
+		}
+	}
+	assert.NoError(t, client.Disconnect())
+}
@@ -0,0 +1,49 @@
+package go_stomp_websocket
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"strings"
+)
+
+// Bind decodes the JSON body of the frame into v. An ERROR frame is returned as a *BrokerError without
+// decoding, and a content-type other than JSON is reported as an error. A frame without content-type is
+// decoded as JSON.
+func (frame *Frame) Bind(v interface{}) error {
+	if frame.Command == ERROR {
+		return newBrokerError(frame, defaultErrorRules)
+	}
+	if value, ok := frame.Contains(ContentType); ok && !isJSONContentType(value) {
+		return fmt.Errorf("can't bind %s frame with content-type %q as JSON", frame.Command, value)
+	}
+	if err := json.Unmarshal(frame.body, v); err != nil {
+		return fmt.Errorf("can't decode %s frame body: %w", frame.Command, err)
+	}
+	return nil
+}
+
+func isJSONContentType(value string) bool {
+	mediaType, _, err := mime.ParseMediaType(value)
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// ReadJSON waits for the next MESSAGE frame of the subscription and decodes its body into v with Frame.Bind.
+func (s *Subscription) ReadJSON(v interface{}) error {
+	return s.ReadJSONContext(context.Background(), v)
+}
+
+// ReadJSONContext is ReadJSON that reads with Read, so it fails with ctx.Err() when ctx is done and with
+// ErrSubscriptionClosed once the subscription is unsubscribed or the client is closed.
+func (s *Subscription) ReadJSONContext(ctx context.Context, v interface{}) error {
+	defer claimReader(s)()
+	frame, err := s.Read(ctx)
+	if err != nil {
+		return err
+	}
+	return frame.Bind(v)
+}
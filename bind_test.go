@@ -0,0 +1,100 @@
+package go_stomp_websocket
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type bindTestPayload struct {
+	Name string `json:"name"`
+}
+
+func TestFrame_Bind(t *testing.T) {
+	tests := []struct {
+		name     string
+		frame    *Frame
+		expected bindTestPayload
+		wantErr  string
+	}{
+		{
+			name:     "no content-type",
+			frame:    createTestFrame(MESSAGE, nil, `{"name":"a"}`),
+			expected: bindTestPayload{Name: "a"},
+		},
+		{
+			name:     "json with charset",
+			frame:    createTestFrame(MESSAGE, []string{"content-type:application/json;charset=utf-8"}, `{"name":"a"}`),
+			expected: bindTestPayload{Name: "a"},
+		},
+		{
+			name:     "json suffix",
+			frame:    createTestFrame(MESSAGE, []string{"content-type:application/vnd.tenant+json"}, `{"name":"a"}`),
+			expected: bindTestPayload{Name: "a"},
+		},
+		{
+			name:    "not json",
+			frame:   createTestFrame(MESSAGE, []string{"content-type:text/plain"}, `{"name":"a"}`),
+			wantErr: `can't bind MESSAGE frame with content-type "text/plain" as JSON`,
+		},
+		{
+			name:    "bad json",
+			frame:   createTestFrame(MESSAGE, nil, `{"name":`),
+			wantErr: "can't decode MESSAGE frame body: unexpected end of JSON input",
+		},
+		{
+			name:    "error frame",
+			frame:   createTestFrame(ERROR, []string{"message:access denied"}, ""),
+			wantErr: "broker error: access denied",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var payload bindTestPayload
+			err := tt.frame.Bind(&payload)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, payload)
+		})
+	}
+}
+
+func TestSubscription_ReadJSONWithErrorInTheMiddle(t *testing.T) {
+	ch := make(chan *Frame, 4)
+	sub := &Subscription{FrameCh: ch, stompClient: StompClient{done: make(chan struct{})}}
+	ch <- createTestFrame(MESSAGE, []string{"content-type:application/json"}, `{"name":"first"}`)
+	ch <- createTestFrame(ERROR, []string{"message:queue deleted"}, "details")
+	ch <- createTestFrame(MESSAGE, []string{"content-type:application/json"}, `{"name":"second"}`)
+
+	var payload bindTestPayload
+	assert.NoError(t, sub.ReadJSON(&payload))
+	assert.Equal(t, "first", payload.Name)
+
+	err := sub.ReadJSON(&payload)
+	var brokerErr *BrokerError
+	assert.True(t, errors.As(err, &brokerErr))
+	assert.Equal(t, "queue deleted", brokerErr.Message)
+	assert.Equal(t, "first", payload.Name)
+
+	assert.NoError(t, sub.ReadJSON(&payload))
+	assert.Equal(t, "second", payload.Name)
+}
+
+func TestSubscription_ReadJSONContext(t *testing.T) {
+	done := make(chan struct{})
+	sub := &Subscription{FrameCh: make(chan *Frame), stompClient: StompClient{done: done}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	var payload bindTestPayload
+	assert.ErrorIs(t, sub.ReadJSONContext(ctx, &payload), context.DeadlineExceeded)
+
+	close(done)
+	assert.ErrorIs(t, sub.ReadJSON(&payload), ErrSubscriptionClosed)
+}
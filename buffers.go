@@ -0,0 +1,160 @@
+package go_stomp_websocket
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	defaultBufferSizerWindow = 1024
+	defaultMinBufferSize     = 1024
+	defaultMaxBufferSize     = 1 << 20
+)
+
+// BufferSizer picks the websocket buffer sizes of new connections from the message sizes seen on earlier ones.
+// Share one BufferSizer between the connects of a client, for example over ConnectWithRetry attempts or when
+// connecting again after a failure. The sizes apply only at connect time, since gorilla buffers are fixed per
+// connection.
+type BufferSizer struct {
+	min, max int
+
+	mutex   sync.Mutex
+	read    sizeWindow
+	written sizeWindow
+}
+
+// BufferSizerConfig configures a BufferSizer. Zero values select the defaults.
+type BufferSizerConfig struct {
+	Min    int // smallest buffer size, 1KB by default
+	Max    int // largest buffer size, 1MB by default
+	Window int // number of recent messages the sizes are taken from, 1024 by default
+}
+
+// SizeDistribution describes the recent message sizes of one direction.
+type SizeDistribution struct {
+	Samples int
+	P50     int
+	P95     int
+	Max     int
+}
+
+func NewBufferSizer(config BufferSizerConfig) *BufferSizer {
+	if config.Min <= 0 {
+		config.Min = defaultMinBufferSize
+	}
+	if config.Max <= 0 {
+		config.Max = defaultMaxBufferSize
+	}
+	if config.Max < config.Min {
+		config.Max = config.Min
+	}
+	if config.Window <= 0 {
+		config.Window = defaultBufferSizerWindow
+	}
+	return &BufferSizer{
+		min:     config.Min,
+		max:     config.Max,
+		read:    sizeWindow{sizes: make([]int, 0, config.Window)},
+		written: sizeWindow{sizes: make([]int, 0, config.Window)},
+	}
+}
+
+// WithBufferSizer makes the client record its message sizes in sizer and take the dialer buffer sizes from it.
+func WithBufferSizer(sizer *BufferSizer) ConnectOption {
+	return func(options *connectOptions) {
+		options.bufferSizer = sizer
+	}
+}
+
+// ReadDistribution returns the distribution of the recent incoming message sizes.
+func (sizer *BufferSizer) ReadDistribution() SizeDistribution {
+	sizer.mutex.Lock()
+	defer sizer.mutex.Unlock()
+	return sizer.read.distribution()
+}
+
+// WriteDistribution returns the distribution of the recent outgoing message sizes.
+func (sizer *BufferSizer) WriteDistribution() SizeDistribution {
+	sizer.mutex.Lock()
+	defer sizer.mutex.Unlock()
+	return sizer.written.distribution()
+}
+
+func (sizer *BufferSizer) recordRead(size int) {
+	sizer.mutex.Lock()
+	sizer.read.add(size)
+	sizer.mutex.Unlock()
+}
+
+func (sizer *BufferSizer) recordWrite(size int) {
+	sizer.mutex.Lock()
+	sizer.written.add(size)
+	sizer.mutex.Unlock()
+}
+
+// bufferSizes returns the read and write buffer sizes for a new connection: the p95 of the recent message sizes
+// bounded by the configured min and max. It reports false while nothing has been recorded in a direction.
+func (sizer *BufferSizer) bufferSizes() (read, write int, ok bool) {
+	sizer.mutex.Lock()
+	readSizes, writeSizes := sizer.read.distribution(), sizer.written.distribution()
+	sizer.mutex.Unlock()
+	if readSizes.Samples == 0 || writeSizes.Samples == 0 {
+		return 0, 0, false
+	}
+	return sizer.bound(readSizes.P95), sizer.bound(writeSizes.P95), true
+}
+
+func (sizer *BufferSizer) bound(size int) int {
+	if size < sizer.min {
+		return sizer.min
+	}
+	if size > sizer.max {
+		return sizer.max
+	}
+	return size
+}
+
+// apply sets the buffer sizes of dialer when there are enough observations.
+func (sizer *BufferSizer) apply(dialer *websocket.Dialer, logger Logger) {
+	read, write, ok := sizer.bufferSizes()
+	if !ok {
+		return
+	}
+	dialer.ReadBufferSize = read
+	dialer.WriteBufferSize = write
+	logger.Infof("using websocket buffer sizes read=%d write=%d from observed message sizes", read, write)
+}
+
+// sizeWindow keeps the last cap(sizes) sizes in a ring.
+type sizeWindow struct {
+	sizes []int
+	next  int
+}
+
+func (window *sizeWindow) add(size int) {
+	if len(window.sizes) < cap(window.sizes) {
+		window.sizes = append(window.sizes, size)
+		return
+	}
+	window.sizes[window.next] = size
+	window.next = (window.next + 1) % len(window.sizes)
+}
+
+func (window *sizeWindow) distribution() SizeDistribution {
+	if len(window.sizes) == 0 {
+		return SizeDistribution{}
+	}
+	sorted := append([]int(nil), window.sizes...)
+	sort.Ints(sorted)
+	percentile := func(p int) int {
+		return sorted[(len(sorted)-1)*p/100]
+	}
+	return SizeDistribution{
+		Samples: len(sorted),
+		P50:     percentile(50),
+		P95:     percentile(95),
+		Max:     sorted[len(sorted)-1],
+	}
+}
@@ -0,0 +1,108 @@
+package go_stomp_websocket
+
+import (
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBufferSizer_Sizes(t *testing.T) {
+	tests := []struct {
+		name          string
+		config        BufferSizerConfig
+		read, written []int
+		wantRead      int
+		wantWrite     int
+	}{
+		{
+			name:      "p95 within bounds",
+			config:    BufferSizerConfig{Min: 100, Max: 10000},
+			read:      repeatSizes(map[int]int{200: 95, 5000: 5}),
+			written:   repeatSizes(map[int]int{300: 100}),
+			wantRead:  200,
+			wantWrite: 300,
+		},
+		{
+			name:      "p95 picks the large tail",
+			config:    BufferSizerConfig{Min: 100, Max: 10000},
+			read:      repeatSizes(map[int]int{200: 90, 5000: 10}),
+			written:   repeatSizes(map[int]int{300: 100}),
+			wantRead:  5000,
+			wantWrite: 300,
+		},
+		{
+			name:      "bounded by min and max",
+			config:    BufferSizerConfig{Min: 1000, Max: 2000},
+			read:      repeatSizes(map[int]int{50000: 100}),
+			written:   repeatSizes(map[int]int{10: 100}),
+			wantRead:  2000,
+			wantWrite: 1000,
+		},
+		{
+			name:      "window keeps recent sizes only",
+			config:    BufferSizerConfig{Min: 1, Max: 100000, Window: 10},
+			read:      append(repeatSizes(map[int]int{90000: 50}), repeatSizes(map[int]int{10: 10})...),
+			written:   repeatSizes(map[int]int{10: 1}),
+			wantRead:  10,
+			wantWrite: 10,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sizer := NewBufferSizer(tt.config)
+			for _, size := range tt.read {
+				sizer.recordRead(size)
+			}
+			for _, size := range tt.written {
+				sizer.recordWrite(size)
+			}
+			read, write, ok := sizer.bufferSizes()
+			assert.True(t, ok)
+			assert.Equal(t, tt.wantRead, read)
+			assert.Equal(t, tt.wantWrite, write)
+		})
+	}
+}
+
+func repeatSizes(counts map[int]int) []int {
+	var sizes []int
+	for size, count := range counts {
+		for i := 0; i < count; i++ {
+			sizes = append(sizes, size)
+		}
+	}
+	return sizes
+}
+
+func TestBufferSizer_NoObservations(t *testing.T) {
+	sizer := NewBufferSizer(BufferSizerConfig{})
+	dialer := websocket.Dialer{ReadBufferSize: 4096}
+	sizer.apply(&dialer, NopLogger())
+	assert.Equal(t, 4096, dialer.ReadBufferSize)
+	assert.Equal(t, SizeDistribution{}, sizer.ReadDistribution())
+}
+
+func TestSizeWindow_Distribution(t *testing.T) {
+	window := sizeWindow{sizes: make([]int, 0, 100)}
+	for i := 1; i <= 100; i++ {
+		window.add(i)
+	}
+	assert.Equal(t, SizeDistribution{Samples: 100, P50: 50, P95: 95, Max: 100}, window.distribution())
+}
+
+func TestWithBufferSizer_AppliesOnNextConnect(t *testing.T) {
+	ts, _ := startTestWSServer(t)
+	defer ts.Close()
+	sizer := NewBufferSizer(BufferSizerConfig{Min: 16})
+	client := connectTestClient(t, ts, WithBufferSizer(sizer))
+	assert.NoError(t, client.Send("/topic/a", "", []byte("hello")))
+	assert.NoError(t, client.Disconnect())
+	assert.Positive(t, sizer.ReadDistribution().Samples)
+	assert.Positive(t, sizer.WriteDistribution().Samples)
+
+	l := &recordingLogger{}
+	client = connectTestClient(t, ts, WithBufferSizer(sizer), WithLogger(l))
+	defer client.connection.Close()
+	assert.True(t, l.contains("INFO using websocket buffer sizes"))
+}
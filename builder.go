@@ -0,0 +1,99 @@
+package go_stomp_websocket
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	Destination = "destination"
+	ContentType = "content-type"
+	Ack         = "ack"
+)
+
+var knownCommands = map[string]bool{
+	CONNECT: true, STOMP: true, CONNECTED: true,
+	SEND: true, SUBSCRIBE: true, UNSUBSCRIBE: true, ACK: true, NACK: true,
+	BEGIN: true, COMMIT: true, ABORT: true, DISCONNECT: true,
+	MESSAGE: true, RECEIPT: true, ERROR: true,
+}
+
+// FrameBuilder builds a Frame and validates the command and headers on the way.
+// The first validation error is kept and returned by Build.
+type FrameBuilder struct {
+	frame *Frame
+	err   error
+}
+
+// NewFrame starts building a frame with the given command, which must be a STOMP command.
+func NewFrame(command string) *FrameBuilder {
+	builder := &FrameBuilder{frame: &Frame{Command: command}}
+	if !knownCommands[command] {
+		builder.err = fmt.Errorf("unknown STOMP command %q", command)
+	}
+	return builder
+}
+
+// WithHeader adds a header. The key must be non-empty, must not contain ':' or line breaks and must not repeat;
+// the value must not contain line breaks.
+func (builder *FrameBuilder) WithHeader(key, value string) *FrameBuilder {
+	if builder.err != nil {
+		return builder
+	}
+	switch {
+	case key == "":
+		builder.err = fmt.Errorf("empty header key in %s frame", builder.frame.Command)
+	case strings.ContainsAny(key, ":\r\n"):
+		builder.err = fmt.Errorf("header key %q in %s frame must not contain ':' or line breaks", key, builder.frame.Command)
+	case strings.ContainsAny(value, "\r\n"):
+		builder.err = fmt.Errorf("value of header %q in %s frame must not contain line breaks", key, builder.frame.Command)
+	default:
+		if _, found := builder.frame.Contains(key); found {
+			builder.err = fmt.Errorf("duplicate header %q in %s frame", key, builder.frame.Command)
+			return builder
+		}
+		builder.frame.Headers = append(builder.frame.Headers, key+":"+value)
+	}
+	return builder
+}
+
+// WithBody sets the frame body without copying it.
+func (builder *FrameBuilder) WithBody(body []byte) *FrameBuilder {
+	builder.frame.SetBody(body)
+	return builder
+}
+
+// Build returns the frame or the first validation error.
+func (builder *FrameBuilder) Build() (*Frame, error) {
+	if builder.err != nil {
+		return nil, builder.err
+	}
+	return builder.frame, nil
+}
+
+// NewSendFrame builds a SEND frame for dest.
+func NewSendFrame(dest string, body []byte) (*Frame, error) {
+	return NewFrame(SEND).WithHeader(Destination, dest).WithBody(body).Build()
+}
+
+// NewSubscribeFrame builds a SUBSCRIBE frame. The ack header is left out when ack is empty.
+func NewSubscribeFrame(id, dest, ack string) (*Frame, error) {
+	builder := NewFrame(SUBSCRIBE).WithHeader(Id, id).WithHeader(Destination, dest)
+	if ack != "" {
+		builder.WithHeader(Ack, ack)
+	}
+	return builder.Build()
+}
+
+// newErrorFrame builds the ERROR frame the client hands to subscribers on local failures. The message header
+// is message on one line, truncated like the messages newBrokerError takes from the body; the body keeps the
+// whole message when the header had to change it.
+func newErrorFrame(message string) *Frame {
+	header := truncateMessage(strings.Join(strings.Fields(message), " "))
+	builder := NewFrame(ERROR).WithHeader(Message, header)
+	if header != message {
+		builder.WithBody([]byte(message))
+	}
+	frame, _ := builder.Build()
+	return frame
+}
@@ -0,0 +1,109 @@
+package go_stomp_websocket
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFrameBuilder(t *testing.T) {
+	tests := []struct {
+		name    string
+		build   func() (*Frame, error)
+		headers []string
+		wantErr string
+	}{
+		{
+			name: "valid frame",
+			build: func() (*Frame, error) {
+				return NewFrame(SEND).WithHeader(Destination, "/topic/a").WithHeader(ContentType, "text/plain").Build()
+			},
+			headers: []string{"destination:/topic/a", "content-type:text/plain"},
+		},
+		{
+			name:    "unknown command",
+			build:   func() (*Frame, error) { return NewFrame("PUBLISH").Build() },
+			wantErr: `unknown STOMP command "PUBLISH"`,
+		},
+		{
+			name:    "empty key",
+			build:   func() (*Frame, error) { return NewFrame(SEND).WithHeader("", "x").Build() },
+			wantErr: "empty header key in SEND frame",
+		},
+		{
+			name:    "colon in key",
+			build:   func() (*Frame, error) { return NewFrame(SEND).WithHeader("a:b", "x").Build() },
+			wantErr: `header key "a:b" in SEND frame must not contain ':' or line breaks`,
+		},
+		{
+			name:    "newline in value",
+			build:   func() (*Frame, error) { return NewFrame(SEND).WithHeader(Destination, "/a\n/b").Build() },
+			wantErr: `value of header "destination" in SEND frame must not contain line breaks`,
+		},
+		{
+			name: "duplicate key",
+			build: func() (*Frame, error) {
+				return NewFrame(SEND).WithHeader(Destination, "/a").WithHeader(Destination, "/b").Build()
+			},
+			wantErr: `duplicate header "destination" in SEND frame`,
+		},
+		{
+			name: "first error wins",
+			build: func() (*Frame, error) {
+				return NewFrame(SEND).WithHeader("", "x").WithHeader("a:b", "x").Build()
+			},
+			wantErr: "empty header key in SEND frame",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			frame, err := tt.build()
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				assert.Nil(t, frame)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.headers, frame.Headers)
+		})
+	}
+}
+
+func TestNewSendFrame(t *testing.T) {
+	frame, err := NewSendFrame("/topic/a", []byte("hello"))
+	assert.NoError(t, err)
+	assert.Equal(t, SEND, frame.Command)
+	assert.Equal(t, []string{"destination:/topic/a"}, frame.Headers)
+	assert.Equal(t, "hello", frame.BodyString())
+}
+
+func TestNewSubscribeFrame(t *testing.T) {
+	frame, err := NewSubscribeFrame("sub-1", "/topic/a", "client")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"id:sub-1", "destination:/topic/a", "ack:client"}, frame.Headers)
+
+	frame, err = NewSubscribeFrame("sub-1", "/topic/a", "")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"id:sub-1", "destination:/topic/a"}, frame.Headers)
+
+	_, err = NewSubscribeFrame("sub-1", "/topic/a\n", "")
+	assert.Error(t, err)
+}
+
+func TestSendRejectsInvalidDestination(t *testing.T) {
+	ts, _ := startTestWSServer(t)
+	client := connectTestClient(t, ts)
+	assert.Error(t, client.Send("/topic/a\nevil:header", "", nil))
+	assert.Error(t, client.TrySend("/topic/a\nevil:header", "", nil))
+}
+
+func TestNewErrorFrameFlattensLineBreaks(t *testing.T) {
+	frame := newErrorFrame("read failed\nconnection reset")
+	value, found := frame.Contains(Message)
+	assert.True(t, found)
+	assert.Equal(t, "read failed connection reset", value)
+	assert.Equal(t, "read failed\nconnection reset", frame.BodyString())
+
+	frame = newErrorFrame("read failed")
+	assert.Empty(t, frame.BodyString())
+}
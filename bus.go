@@ -0,0 +1,275 @@
+package go_stomp_websocket
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// OverflowPolicy decides what a Bus or a subscription does with a frame for a consumer whose buffer is full.
+type OverflowPolicy int
+
+const (
+	// OverflowBlock waits until the consumer has room. It holds up the whole client dispatcher meanwhile.
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropNewest drops the frame that does not fit.
+	OverflowDropNewest
+	// OverflowDropOldest drops the oldest buffered frame to make room.
+	OverflowDropOldest
+)
+
+const defaultBusBuffer = 64
+
+type BusOption func(*busOptions)
+
+type busOptions struct {
+	buffer   int
+	overflow OverflowPolicy
+}
+
+// WithBusBuffer sets the capacity of the local subscriber channel. The default is 64.
+func WithBusBuffer(size int) BusOption {
+	return func(options *busOptions) {
+		options.buffer = size
+	}
+}
+
+// WithOverflowPolicy sets what happens when the local subscriber channel is full. The default is OverflowBlock.
+func WithOverflowPolicy(policy OverflowPolicy) BusOption {
+	return func(options *busOptions) {
+		options.overflow = policy
+	}
+}
+
+// Bus shares one client between in-process consumers. It keeps one broker subscription per topic and
+// broadcasts its frames to every local subscriber of the topic. The broker subscription is made by the first
+// local subscriber and dropped when the last one unsubscribes. Frames are shared between the local
+// subscribers and must not be modified. Broker subscriptions use the auto ack mode: no local subscriber can
+// acknowledge a frame for the others, so the Bus does not offer client ack or AutoCumulativeAck. Consumers
+// that need them subscribe with Subscribe instead.
+type Bus struct {
+	client *StompClient
+	mutex  sync.Mutex
+	topics map[string]*busTopic
+}
+
+type busTopic struct {
+	name         string
+	ready        chan struct{} // closed when the broker subscription is made or has failed
+	err          error         // set before ready is closed
+	subscription *Subscription // set before ready is closed
+	done         chan struct{} // closed after the broker subscription is dropped
+	subscribers  map[*BusSubscription]struct{}
+}
+
+// BusSubscription is a local subscriber of a Bus topic.
+type BusSubscription struct {
+	// C receives the frames of the topic. It is closed by Unsubscribe and when the client connection ends,
+	// after the ERROR frame.
+	C       <-chan *Frame
+	Topic   string
+	ch      chan *Frame
+	bus     *Bus
+	topic   *busTopic
+	policy  OverflowPolicy
+	dropped atomic.Uint64
+
+	mutex     sync.Mutex
+	closed    bool
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func NewBus(client *StompClient) *Bus {
+	return &Bus{
+		client: client,
+		topics: make(map[string]*busTopic),
+	}
+}
+
+// Subscribe adds a local subscriber to topic, subscribing to the broker if it is the first one.
+func (bus *Bus) Subscribe(topic string, opts ...BusOption) (*BusSubscription, error) {
+	options := &busOptions{buffer: defaultBusBuffer}
+	for _, opt := range opts {
+		opt(options)
+	}
+	ch := make(chan *Frame, options.buffer)
+	subscriber := &BusSubscription{
+		C:      ch,
+		Topic:  topic,
+		ch:     ch,
+		bus:    bus,
+		policy: options.overflow,
+		done:   make(chan struct{}),
+	}
+
+	bus.mutex.Lock()
+	t, found := bus.topics[topic]
+	if !found {
+		t = &busTopic{
+			name:        topic,
+			ready:       make(chan struct{}),
+			done:        make(chan struct{}),
+			subscribers: make(map[*BusSubscription]struct{}),
+		}
+		bus.topics[topic] = t
+	}
+	t.subscribers[subscriber] = struct{}{}
+	subscriber.topic = t
+	bus.mutex.Unlock()
+
+	if !found {
+		// never call the client with the mutex held: the dispatcher may be waiting for fanOut, which needs it
+		t.subscription, t.err = bus.client.Subscribe(topic)
+		close(t.ready)
+		if t.err == nil {
+			bus.client.goroutines.goRole(roleBusFanOut, func() { bus.fanOut(t) })
+		}
+	} else {
+		<-t.ready
+	}
+	if t.err != nil {
+		bus.remove(subscriber)
+		return nil, t.err
+	}
+	return subscriber, nil
+}
+
+// Unsubscribe removes the subscriber and closes its channel. The broker subscription is dropped
+// when it was the last subscriber of the topic.
+func (s *BusSubscription) Unsubscribe() {
+	s.close()
+	if last := s.bus.remove(s); last {
+		t := s.topic
+		<-t.ready
+		if t.err == nil {
+			// fanOut keeps reading until the dispatcher has dropped the subscription
+			if err := t.subscription.unsubscribe(); err != nil {
+				s.bus.client.logger.Errorf("Can't unsubscribe %s: %v", t.name, err)
+			}
+			close(t.done)
+		}
+	}
+}
+
+// Dropped returns how many frames were dropped by the overflow policy.
+func (s *BusSubscription) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+// Close unsubscribes every local subscriber.
+func (bus *Bus) Close() {
+	bus.mutex.Lock()
+	var subscribers []*BusSubscription
+	for _, t := range bus.topics {
+		for subscriber := range t.subscribers {
+			subscribers = append(subscribers, subscriber)
+		}
+	}
+	bus.mutex.Unlock()
+	for _, subscriber := range subscribers {
+		subscriber.Unsubscribe()
+	}
+}
+
+// remove drops the subscriber from its topic and reports whether it was the last one.
+func (bus *Bus) remove(subscriber *BusSubscription) bool {
+	bus.mutex.Lock()
+	defer bus.mutex.Unlock()
+	t := subscriber.topic
+	if _, ok := t.subscribers[subscriber]; !ok {
+		return false
+	}
+	delete(t.subscribers, subscriber)
+	if len(t.subscribers) > 0 {
+		return false
+	}
+	if bus.topics[t.name] == t {
+		delete(bus.topics, t.name)
+	}
+	return true
+}
+
+func (bus *Bus) subscribersOf(t *busTopic) []*BusSubscription {
+	bus.mutex.Lock()
+	defer bus.mutex.Unlock()
+	result := make([]*BusSubscription, 0, len(t.subscribers))
+	for subscriber := range t.subscribers {
+		result = append(result, subscriber)
+	}
+	return result
+}
+
+// fanOut broadcasts the frames of the broker subscription of t until it is dropped or the client connection ends.
+func (bus *Bus) fanOut(t *busTopic) {
+	for {
+		select {
+		case frame, ok := <-t.subscription.FrameCh:
+			if !ok {
+				bus.mutex.Lock()
+				if bus.topics[t.name] == t {
+					delete(bus.topics, t.name)
+				}
+				subscribers := make([]*BusSubscription, 0, len(t.subscribers))
+				for subscriber := range t.subscribers {
+					subscribers = append(subscribers, subscriber)
+				}
+				t.subscribers = map[*BusSubscription]struct{}{}
+				bus.mutex.Unlock()
+				for _, subscriber := range subscribers {
+					subscriber.close()
+				}
+				return
+			}
+			for _, subscriber := range bus.subscribersOf(t) {
+				subscriber.deliver(frame)
+			}
+		case <-t.done:
+			return
+		}
+	}
+}
+
+func (s *BusSubscription) deliver(frame *Frame) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closed {
+		return
+	}
+	switch s.policy {
+	case OverflowDropNewest:
+		select {
+		case s.ch <- frame:
+		default:
+			s.dropped.Add(1)
+		}
+	case OverflowDropOldest:
+		for {
+			select {
+			case s.ch <- frame:
+				return
+			default:
+			}
+			select {
+			case <-s.ch:
+				s.dropped.Add(1)
+			default:
+			}
+		}
+	default:
+		select {
+		case s.ch <- frame:
+		case <-s.done:
+		}
+	}
+}
+
+func (s *BusSubscription) close() {
+	s.closeOnce.Do(func() {
+		// unblock deliver before waiting for its lock
+		close(s.done)
+		s.mutex.Lock()
+		s.closed = true
+		close(s.ch)
+		s.mutex.Unlock()
+	})
+}
@@ -0,0 +1,227 @@
+package go_stomp_websocket
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+// testBroker is a minimal SockJS STOMP broker: SEND frames are delivered with their headers to the subscriptions
+// of their destination.
+type testBroker struct {
+	mutex         sync.Mutex
+	subscriptions map[string]string // id -> destination
+	subscribes    int
+	unsubscribes  int
+}
+
+func startTestBroker(t *testing.T) (*httptest.Server, *testBroker) {
+	t.Helper()
+	broker := &testBroker{subscriptions: make(map[string]string)}
+	upgrader := websocket.Upgrader{
+		CheckOrigin: func(r *http.Request) bool { return true },
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("upgrade error: %v", err)
+			return
+		}
+		defer c.Close()
+		if _, _, err = c.ReadMessage(); err != nil {
+			return
+		}
+		_ = c.WriteMessage(websocket.TextMessage, []byte("o"))
+		_ = c.WriteMessage(websocket.TextMessage, []byte(connectedTestFrame))
+		for {
+			_, msg, err := c.ReadMessage()
+			if err != nil {
+				return
+			}
+			for _, message := range broker.handle(ReadFrame(append([]byte("a"), msg...))) {
+				if err := c.WriteMessage(websocket.TextMessage, append([]byte("a"), message.Bytes()...)); err != nil {
+					return
+				}
+			}
+		}
+	}))
+	return ts, broker
+}
+
+func (broker *testBroker) handle(frame *Frame) []*Frame {
+	broker.mutex.Lock()
+	defer broker.mutex.Unlock()
+	id, _ := frame.Contains(Id)
+	destination, _ := frame.Contains(Destination)
+	switch frame.Command {
+	case SUBSCRIBE:
+		broker.subscribes++
+		broker.subscriptions[id] = destination
+	case UNSUBSCRIBE:
+		broker.unsubscribes++
+		delete(broker.subscriptions, id)
+	case SEND:
+		var messages []*Frame
+		for subscriptionId, subscribed := range broker.subscriptions {
+			if subscribed == destination {
+				message := CreateFrame(MESSAGE, append([]string{Subscription_h + ":" + subscriptionId}, frame.Headers...))
+				message.SetBody(frame.Body())
+				messages = append(messages, message)
+			}
+		}
+		return messages
+	}
+	return nil
+}
+
+func (broker *testBroker) counts() (subscribes, unsubscribes, active int) {
+	broker.mutex.Lock()
+	defer broker.mutex.Unlock()
+	return broker.subscribes, broker.unsubscribes, len(broker.subscriptions)
+}
+
+func receiveBusFrame(t *testing.T, subscriber *BusSubscription) *Frame {
+	t.Helper()
+	select {
+	case frame := <-subscriber.C:
+		return frame
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a bus frame")
+		return nil
+	}
+}
+
+func TestBus_SharesOneBrokerSubscription(t *testing.T) {
+	ts, broker := startTestBroker(t)
+	defer ts.Close()
+	client := connectTestClient(t, ts)
+	defer client.connection.Close()
+	bus := NewBus(client)
+
+	first, err := bus.Subscribe("/topic/a")
+	assert.NoError(t, err)
+	second, err := bus.Subscribe("/topic/a")
+	assert.NoError(t, err)
+	other, err := bus.Subscribe("/topic/b")
+	assert.NoError(t, err)
+
+	assert.NoError(t, client.Send("/topic/a", "", []byte("hello")))
+	assert.Equal(t, "hello", receiveBusFrame(t, first).BodyString())
+	assert.Equal(t, "hello", receiveBusFrame(t, second).BodyString())
+	subscribes, _, _ := broker.counts()
+	assert.Equal(t, 2, subscribes)
+	infos := client.Subscriptions()
+	assert.Len(t, infos, 2)
+	for _, info := range infos {
+		assert.Equal(t, "auto", info.AckMode)
+	}
+
+	first.Unsubscribe()
+	_, ok := <-first.C
+	assert.False(t, ok)
+	_, unsubscribes, _ := broker.counts()
+	assert.Equal(t, 0, unsubscribes)
+
+	assert.NoError(t, client.Send("/topic/a", "", []byte("again")))
+	assert.Equal(t, "again", receiveBusFrame(t, second).BodyString())
+
+	second.Unsubscribe()
+	other.Unsubscribe()
+	assert.Eventually(t, func() bool {
+		_, unsubscribes, active := broker.counts()
+		return unsubscribes == 2 && active == 0
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestBus_OverflowPolicies(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   OverflowPolicy
+		expected []string
+	}{
+		{name: "drop newest", policy: OverflowDropNewest, expected: []string{"0", "1"}},
+		{name: "drop oldest", policy: OverflowDropOldest, expected: []string{"3", "4"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts, _ := startTestBroker(t)
+			defer ts.Close()
+			client := connectTestClient(t, ts)
+			defer client.connection.Close()
+			bus := NewBus(client)
+
+			slow, err := bus.Subscribe("/topic/a", WithBusBuffer(2), WithOverflowPolicy(tt.policy))
+			assert.NoError(t, err)
+			for i := 0; i < 5; i++ {
+				assert.NoError(t, client.Send("/topic/a", "", []byte(strconv.Itoa(i))))
+			}
+			// the last frame has passed the fan-out once three are dropped
+			assert.Eventually(t, func() bool { return slow.Dropped() == 3 }, 5*time.Second, time.Millisecond)
+			var got []string
+			for len(slow.C) > 0 {
+				got = append(got, (<-slow.C).BodyString())
+			}
+			assert.Equal(t, tt.expected, got)
+		})
+	}
+}
+
+func TestBus_ConcurrentFirstSubscribeAndLastUnsubscribe(t *testing.T) {
+	ts, broker := startTestBroker(t)
+	defer ts.Close()
+	client := connectTestClient(t, ts)
+	defer client.connection.Close()
+	bus := NewBus(client)
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				subscriber, err := bus.Subscribe("/topic/a", WithOverflowPolicy(OverflowDropNewest))
+				if !assert.NoError(t, err) {
+					return
+				}
+				subscriber.Unsubscribe()
+			}
+		}()
+	}
+	wg.Wait()
+
+	bus.mutex.Lock()
+	assert.Empty(t, bus.topics)
+	bus.mutex.Unlock()
+	assert.Eventually(t, func() bool {
+		subscribes, unsubscribes, active := broker.counts()
+		return subscribes > 0 && subscribes == unsubscribes && active == 0
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestBus_ClosesSubscribersWhenConnectionEnds(t *testing.T) {
+	ts := startScriptedWSServer(t, func(c *websocket.Conn) {
+		_, _, _ = c.ReadMessage() // SUBSCRIBE
+		_ = c.WriteMessage(websocket.TextMessage, []byte(`a["ERROR\nmessage:bye\n\n\u0000"]`))
+		_, _, _ = c.ReadMessage()
+	})
+	defer ts.Close()
+	client := connectTestClient(t, ts)
+	defer client.connection.Close()
+	bus := NewBus(client)
+
+	subscriber, err := bus.Subscribe("/topic/a")
+	assert.NoError(t, err)
+	assert.Equal(t, ERROR, receiveBusFrame(t, subscriber).Command)
+	select {
+	case _, ok := <-subscriber.C:
+		assert.False(t, ok)
+	case <-time.After(5 * time.Second):
+		t.Fatal("subscriber channel was not closed")
+	}
+}
@@ -0,0 +1,200 @@
+package go_stomp_websocket
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// ChunkId, ChunkIndex and ChunkCount mark the frames of a body that WithChunking split.
+	ChunkId    = "x-chunk-id"
+	ChunkIndex = "x-chunk-index"
+	ChunkCount = "x-chunk-count"
+)
+
+// encodedSize returns the length of the websocket message the frame is written as.
+func (frame *Frame) encodedSize(raw bool) int {
+	if raw {
+		return frame.size()
+	}
+	// ["COMMAND\n header\n ... \n body\u0000"] with the command, headers and body JSON escaped
+	size := 2 + jsonStringLen(frame.Command) + 2 + 2 + jsonStringLen(frame.body) + 8
+	for _, header := range frame.Headers {
+		size += jsonStringLen(header) + 2
+	}
+	return size
+}
+
+// outboundFrames returns the frames to write for frame: the frame itself when it fits the outbound message limit,
+// its chunks when chunking is enabled and ErrFrameTooLargeForTransport otherwise. On SockJS a frame that is not
+// valid UTF-8 is rejected with ErrInvalidUTF8.
+func (stompClient StompClient) outboundFrames(frame *Frame, chunk bool) ([]*Frame, error) {
+	if !stompClient.rawTransport && !frame.validUTF8() {
+		return nil, fmt.Errorf("%w: %s frame", ErrInvalidUTF8, frame.Command)
+	}
+	limit := stompClient.maxOutboundMessageSize
+	size := frame.encodedSize(stompClient.rawTransport)
+	if limit <= 0 || size <= limit {
+		return []*Frame{frame}, nil
+	}
+	tooLarge := fmt.Errorf("%w: %s frame of %d bytes, the limit is %d bytes", ErrFrameTooLargeForTransport, frame.Command, size, limit)
+	if !chunk || stompClient.chunkTimeout <= 0 {
+		return nil, tooLarge
+	}
+	body := frame.body
+	id := stompClient.newID()
+	// the chunk headers of the largest chunk, with values at least as wide as the real ones
+	header := CreateFrame(frame.Command, append(append([]string(nil), frame.Headers...),
+		ChunkId+":"+id, ChunkIndex+":"+strconv.Itoa(len(body)), ChunkCount+":"+strconv.Itoa(len(body)),
+		contentLength+":"+strconv.Itoa(len(body))))
+	chunkSize := limit - header.encodedSize(stompClient.rawTransport)
+	if chunkSize <= 0 {
+		return nil, tooLarge
+	}
+	parts := splitBody(body, chunkSize, !stompClient.rawTransport)
+	count := len(parts)
+	frames := make([]*Frame, 0, count)
+	for i, part := range parts {
+		chunk := CreateFrame(frame.Command, append(append([]string(nil), frame.Headers...),
+			ChunkId+":"+id, ChunkIndex+":"+strconv.Itoa(i), ChunkCount+":"+strconv.Itoa(count),
+			contentLength+":"+strconv.Itoa(len(part))))
+		chunk.SetBody(part)
+		frames = append(frames, chunk)
+	}
+	return frames, nil
+}
+
+// splitBody splits body into parts of at most size bytes. For SockJS the size counts the JSON escaped part and
+// parts end at rune boundaries, so that no part holds half a multibyte character that the escaping would replace.
+func splitBody(body []byte, size int, sockJS bool) [][]byte {
+	var parts [][]byte
+	for len(body) > 0 {
+		n := min(size, len(body))
+		if sockJS {
+			n = 0
+			for escaped := 0; n < len(body); {
+				_, width := utf8.DecodeRune(body[n:])
+				if escaped += jsonStringLen(body[n : n+width]); escaped > size && n > 0 {
+					break
+				}
+				n += width
+			}
+		}
+		parts = append(parts, body[:n])
+		body = body[n:]
+	}
+	return parts
+}
+
+type chunkKey struct {
+	subscription SubscriptionID
+	id           string
+}
+
+type partialMessage struct {
+	first    *Frame
+	chunks   [][]byte
+	received int
+	deadline time.Time
+}
+
+// chunkAssembler joins the chunks of MESSAGE frames. It is only used by processLoop.
+type chunkAssembler struct {
+	timeout  time.Duration
+	partials map[chunkKey]*partialMessage
+}
+
+func newChunkAssembler(timeout time.Duration) *chunkAssembler {
+	return &chunkAssembler{timeout: timeout, partials: make(map[chunkKey]*partialMessage)}
+}
+
+// add takes a MESSAGE frame of subscription. It returns the frame itself unless it is a chunk, nil while chunks
+// are missing and the joined frame after the last chunk.
+func (assembler *chunkAssembler) add(subscription SubscriptionID, frame *Frame, now time.Time) *Frame {
+	id, ok := frame.Contains(ChunkId)
+	if !ok {
+		return frame
+	}
+	index, indexErr := headerInt(frame, ChunkIndex)
+	count, countErr := headerInt(frame, ChunkCount)
+	if indexErr != nil || countErr != nil || count <= 0 || index < 0 || index >= count {
+		return frame
+	}
+	key := chunkKey{subscription: subscription, id: id}
+	partial, ok := assembler.partials[key]
+	if !ok {
+		partial = &partialMessage{chunks: make([][]byte, count), deadline: now.Add(assembler.timeout)}
+		assembler.partials[key] = partial
+	}
+	if len(partial.chunks) != count || partial.chunks[index] != nil {
+		return nil // a duplicate or a chunk of another split with the same id
+	}
+	if index == 0 {
+		partial.first = frame
+	}
+	partial.chunks[index] = append([]byte{}, frame.body...)
+	partial.received++
+	if partial.received < count {
+		return nil
+	}
+	delete(assembler.partials, key)
+	var size int
+	for _, chunk := range partial.chunks {
+		size += len(chunk)
+	}
+	body := make([]byte, 0, size)
+	for _, chunk := range partial.chunks {
+		body = append(body, chunk...)
+	}
+	joined := CreateFrame(partial.first.Command, withoutHeaders(partial.first.Headers, ChunkId, ChunkIndex, ChunkCount, contentLength))
+	joined.SetBody(body)
+	return joined
+}
+
+// expire drops the messages whose chunks did not all arrive within the timeout and returns their keys.
+func (assembler *chunkAssembler) expire(now time.Time) []chunkKey {
+	var expired []chunkKey
+	for key, partial := range assembler.partials {
+		if now.After(partial.deadline) {
+			delete(assembler.partials, key)
+			expired = append(expired, key)
+		}
+	}
+	return expired
+}
+
+func headerInt(frame *Frame, header string) (int, error) {
+	value, _ := frame.Contains(header)
+	return strconv.Atoi(value)
+}
+
+func withoutHeaders(headers []string, keys ...string) []string {
+	result := make([]string, 0, len(headers))
+	for _, header := range headers {
+		key, _, _ := strings.Cut(header, ":")
+		drop := false
+		for _, k := range keys {
+			drop = drop || key == k
+		}
+		if !drop {
+			result = append(result, header)
+		}
+	}
+	return result
+}
+
+// chunkTimedOut reports a message dropped by the chunk assembler.
+func (stompClient *StompClient) chunkTimedOut(handler *subscriptionHandler, key chunkKey) {
+	stompClient.metrics.ErrorOccurred(ErrorKindChunkTimeout)
+	stompClient.logger.Errorf("[%s] dropped chunked message %s of subscription %s: not all chunks arrived within %s", roleProcessLoop, key.id, key.subscription, stompClient.chunkTimeout)
+	if handler == nil {
+		return
+	}
+	select {
+	case handler.errorCh <- fmt.Errorf("%w: message %s", ErrChunkTimeout, key.id):
+	default:
+	}
+}
@@ -0,0 +1,190 @@
+package go_stomp_websocket
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFrame_EncodedSize(t *testing.T) {
+	frame := createTestFrame(SEND, []string{"destination:/topic/test", "content-type:text/plain"}, "body \"quoted\"\n\x01\u2028\xff")
+	assert.Equal(t, len(frame.Bytes()), frame.encodedSize(false))
+	assert.Equal(t, len(frame.rawBytes()), frame.encodedSize(true))
+}
+
+func TestOutboundFrames(t *testing.T) {
+	body := bytes.Repeat([]byte("0123\"5678é\n"), 500)
+	frame := createTestFrame(SEND, []string{"destination:/topic/test"}, string(body))
+	for _, raw := range []bool{false, true} {
+		t.Run("raw="+strconv.FormatBool(raw), func(t *testing.T) {
+			client := StompClient{maxOutboundMessageSize: 512, rawTransport: raw}
+			_, err := client.outboundFrames(frame, true)
+			assert.ErrorIs(t, err, ErrFrameTooLargeForTransport)
+			assert.ErrorContains(t, err, "512 bytes")
+
+			client.chunkTimeout = time.Second
+			frames, err := client.outboundFrames(frame, true)
+			assert.NoError(t, err)
+			assert.Greater(t, len(frames), 1)
+			var joined []byte
+			for i, chunk := range frames {
+				assert.LessOrEqual(t, chunk.encodedSize(raw), 512)
+				if !raw {
+					assert.LessOrEqual(t, len(chunk.Bytes()), 512)
+					assert.True(t, utf8.Valid(chunk.Body()), "chunks end at rune boundaries")
+				}
+				index, _ := chunk.Contains(ChunkIndex)
+				assert.Equal(t, strconv.Itoa(i), index)
+				joined = append(joined, chunk.Body()...)
+			}
+			assert.Equal(t, body, joined)
+
+			_, err = client.outboundFrames(frame, false)
+			assert.ErrorIs(t, err, ErrFrameTooLargeForTransport, "TrySend does not chunk")
+		})
+	}
+
+	small, err := StompClient{maxOutboundMessageSize: 512}.outboundFrames(createTestFrame(SEND, nil, "x"), false)
+	assert.NoError(t, err)
+	assert.Len(t, small, 1)
+}
+
+func TestOutboundFrames_InvalidUTF8(t *testing.T) {
+	tests := []struct {
+		name  string
+		frame *Frame
+	}{
+		{name: "body", frame: createTestFrame(SEND, []string{"destination:/topic/test"}, "\x00\x01\xff")},
+		{name: "truncated body", frame: createTestFrame(SEND, []string{"destination:/topic/test"}, "caf\xc3")},
+		{name: "header", frame: createTestFrame(SEND, []string{"destination:/topic/\xff"}, "body")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := StompClient{}.outboundFrames(tt.frame, true)
+			assert.ErrorIs(t, err, ErrInvalidUTF8)
+			frames, err := StompClient{rawTransport: true}.outboundFrames(tt.frame, true)
+			assert.NoError(t, err, "the raw transport writes the bytes as they are")
+			assert.Equal(t, []*Frame{tt.frame}, frames)
+		})
+	}
+}
+
+func TestChunkAssembler(t *testing.T) {
+	client := StompClient{maxOutboundMessageSize: 200, chunkTimeout: time.Second}
+	frames, err := client.outboundFrames(createTestFrame(SEND, []string{"destination:/topic/test", "x-trace:1"}, strings.Repeat("ab", 300)), true)
+	assert.NoError(t, err)
+	assert.Greater(t, len(frames), 2)
+
+	now := time.Now()
+	assembler := newChunkAssembler(time.Second)
+	plain := createTestFrame(MESSAGE, []string{"subscription:1"}, "plain")
+	assert.Same(t, plain, assembler.add("1", plain, now))
+
+	// delivered in reverse order, with a duplicate
+	var joined *Frame
+	for i := len(frames) - 1; i >= 0; i-- {
+		assert.Nil(t, joined, "joined before the last chunk")
+		chunk := CreateFrame(MESSAGE, frames[i].Headers)
+		chunk.SetBody(frames[i].Body())
+		joined = assembler.add("1", chunk, now)
+		if i == len(frames)-1 {
+			assert.Nil(t, assembler.add("1", chunk, now))
+		}
+	}
+	if assert.NotNil(t, joined) {
+		assert.Equal(t, strings.Repeat("ab", 300), joined.BodyString())
+		assert.Equal(t, []string{"destination:/topic/test", "x-trace:1"}, joined.Headers)
+	}
+	assert.Empty(t, assembler.partials)
+
+	assert.Nil(t, assembler.add("1", frames[0], now))
+	assert.Nil(t, assembler.add("2", frames[1], now), "chunks are kept per subscription")
+	assert.Empty(t, assembler.expire(now.Add(time.Second)))
+	assert.Len(t, assembler.expire(now.Add(2*time.Second)), 2)
+	assert.Empty(t, assembler.partials)
+}
+
+func TestSend_FrameTooLargeForTransport(t *testing.T) {
+	ts, _ := startTestBroker(t)
+	defer ts.Close()
+	client := connectTestClient(t, ts, WithMaxOutboundMessageSize(1024))
+	defer client.connection.Close()
+
+	err := client.Send("/topic/test", "text/plain", make([]byte, 5000))
+	assert.ErrorIs(t, err, ErrFrameTooLargeForTransport)
+	assert.ErrorIs(t, client.TrySend("/topic/test", "text/plain", make([]byte, 5000)), ErrFrameTooLargeForTransport)
+	assert.NoError(t, client.Send("/topic/test", "text/plain", make([]byte, 100)))
+}
+
+func TestSend_Chunking(t *testing.T) {
+	ts, _ := startTestBroker(t)
+	defer ts.Close()
+	client := connectTestClient(t, ts, WithMaxOutboundMessageSize(1024), WithChunking(time.Second))
+	defer client.connection.Close()
+	sub, err := client.Subscribe("/topic/test")
+	assert.NoError(t, err)
+
+	body := bytes.Repeat([]byte("chunk"), 2000)
+	go func() {
+		assert.NoError(t, client.Send("/topic/test", "text/plain", body))
+	}()
+	select {
+	case frame := <-sub.FrameCh:
+		assert.Equal(t, body, frame.Body())
+		contentType, _ := frame.Contains(ContentType)
+		assert.Equal(t, "text/plain", contentType)
+		_, chunked := frame.Contains(ChunkId)
+		assert.False(t, chunked)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting on the joined message")
+	}
+}
+
+func TestChunking_LostChunkTimesOut(t *testing.T) {
+	ts := startScriptedWSServer(t, func(c *websocket.Conn) {
+		for {
+			_, msg, err := c.ReadMessage()
+			if err != nil {
+				return
+			}
+			frame := ReadFrame(append([]byte("a"), msg...))
+			if frame.Command != SUBSCRIBE {
+				continue
+			}
+			id, _ := frame.Contains(Id)
+			// chunk 1 of 0..2 is lost
+			for _, index := range []string{"0", "2"} {
+				chunk := CreateFrame(MESSAGE, []string{Subscription_h + ":" + id, ChunkId + ":c1", ChunkIndex + ":" + index, ChunkCount + ":3"})
+				chunk.SetBody([]byte("part"))
+				if err := c.WriteMessage(websocket.TextMessage, append([]byte("a"), chunk.Bytes()...)); err != nil {
+					return
+				}
+			}
+		}
+	})
+	defer ts.Close()
+	metrics := NewCounterMetrics()
+	client := connectTestClient(t, ts, WithChunking(50*time.Millisecond), WithMetrics(metrics))
+	defer client.connection.Close()
+	sub, err := client.Subscribe("/topic/test")
+	assert.NoError(t, err)
+
+	select {
+	case err := <-sub.Errors():
+		assert.True(t, errors.Is(err, ErrChunkTimeout))
+		assert.ErrorContains(t, err, "c1")
+	case frame := <-sub.FrameCh:
+		t.Fatalf("incomplete message delivered: %s", frame.BodyString())
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting on the chunk timeout")
+	}
+	assert.Equal(t, uint64(1), metrics.Snapshot().Errors[ErrorKindChunkTimeout])
+	assert.Equal(t, 0, sub.Pending())
+}
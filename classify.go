@@ -0,0 +1,58 @@
+package go_stomp_websocket
+
+import (
+	"regexp"
+)
+
+// ErrorCategory classifies a broker ERROR frame.
+type ErrorCategory string
+
+const (
+	// CategoryUnknown is an ERROR frame no rule matched.
+	CategoryUnknown ErrorCategory = ""
+	// CategoryQuotaExceeded is a broker limit, such as the number of subscriptions per connection.
+	CategoryQuotaExceeded ErrorCategory = "quota_exceeded"
+	// CategoryAccessDenied is a missing permission for the destination or a rejected login.
+	CategoryAccessDenied ErrorCategory = "access_denied"
+	// CategoryDestinationNotFound is a queue or topic the broker does not have.
+	CategoryDestinationNotFound ErrorCategory = "destination_not_found"
+	// CategoryTransient is a condition that goes away, such as a broker restart. It is the only category
+	// ConnectWithRetry retries.
+	CategoryTransient ErrorCategory = "transient"
+)
+
+// ErrorRule assigns Category to the broker errors whose message header or body matches Pattern.
+type ErrorRule struct {
+	Pattern  *regexp.Regexp
+	Category ErrorCategory
+}
+
+var defaultErrorRules = []ErrorRule{
+	{regexp.MustCompile(`(?i)subscription limit exceeded|quota exceeded|max(imum)?[ _-]?(number of )?(subscriptions|consumers|connections)|resource_limit|AMQ229(110|119)`), CategoryQuotaExceeded},
+	{regexp.MustCompile(`(?i)access_refused|access refused|not authori[sz]ed|permission denied|does not have permission|forbidden|AMQ229(031|032|213)`), CategoryAccessDenied},
+	{regexp.MustCompile(`(?i)not_found|no queue|no exchange|does not exist|unknown destination|invalid destination|AMQ229017`), CategoryDestinationNotFound},
+	{regexp.MustCompile(`(?i)shutting down|temporarily unavailable|try again|timed out|connection_forced|resource_error|AMQ219014|AMQ229205`), CategoryTransient},
+}
+
+// DefaultErrorRules returns the rules for the error texts of RabbitMQ and ActiveMQ Artemis that a client uses unless
+// WithErrorRules replaces them. The rules are tried in order and the first match wins.
+func DefaultErrorRules() []ErrorRule {
+	return append([]ErrorRule(nil), defaultErrorRules...)
+}
+
+// WithErrorRules replaces the rules that classify broker ERROR frames. Append to DefaultErrorRules to keep them.
+func WithErrorRules(rules ...ErrorRule) ConnectOption {
+	return func(options *connectOptions) {
+		options.errorRules = rules
+	}
+}
+
+// classify returns the category of the first rule matching the message or body of the error.
+func classify(rules []ErrorRule, message, body string) ErrorCategory {
+	for _, rule := range rules {
+		if rule.Pattern.MatchString(message) || rule.Pattern.MatchString(body) {
+			return rule.Category
+		}
+	}
+	return CategoryUnknown
+}
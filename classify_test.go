@@ -0,0 +1,58 @@
+package go_stomp_websocket
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassify_DefaultRules(t *testing.T) {
+	tests := []struct {
+		name     string
+		message  string
+		body     string
+		expected ErrorCategory
+	}{
+		{"subscription quota", "subscription limit exceeded", "", CategoryQuotaExceeded},
+		{"rabbitmq consumer limit", "Bad CMD", "maximum number of consumers reached", CategoryQuotaExceeded},
+		{"artemis address full", "AMQ229119: Disk Capacity is Low", "", CategoryQuotaExceeded},
+		{"rabbitmq access refused", "access_refused", "ACCESS_REFUSED - access to queue 'q' in vhost '/' refused for user 'u'", CategoryAccessDenied},
+		{"artemis permission", "AMQ229032: User: u does not have permission='CONSUME' on address a", "", CategoryAccessDenied},
+		{"rabbitmq not found", "not_found", "NOT_FOUND - no queue 'q' in vhost '/'", CategoryDestinationNotFound},
+		{"artemis queue missing", "AMQ229017: Queue q does not exist", "", CategoryDestinationNotFound},
+		{"rabbitmq shutdown", "connection_forced", "broker forced connection closure with reason 'shutdown'", CategoryTransient},
+		{"artemis timeout", "AMQ219014: Timed out after waiting 30000 ms for response", "", CategoryTransient},
+		{"unknown", "bad credentials", "", CategoryUnknown},
+		{"empty", "", "", CategoryUnknown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, classify(defaultErrorRules, tt.message, tt.body))
+		})
+	}
+}
+
+func TestClassify_CustomRules(t *testing.T) {
+	rules := append([]ErrorRule{{Pattern: regexp.MustCompile(`tenant suspended`), Category: CategoryAccessDenied}}, DefaultErrorRules()...)
+	assert.Equal(t, CategoryAccessDenied, classify(rules, "tenant suspended", ""))
+	assert.Equal(t, CategoryDestinationNotFound, classify(rules, "not_found", ""))
+	assert.Equal(t, CategoryUnknown, classify(nil, "not_found", ""))
+
+	options := newConnectOptions([]ConnectOption{WithErrorRules(rules[:1]...)})
+	assert.Len(t, options.errorRules, 1)
+}
+
+func TestBrokerError_Category(t *testing.T) {
+	frame := CreateFrame(ERROR, []string{Message + ":subscription limit exceeded"})
+	assert.Equal(t, CategoryQuotaExceeded, newBrokerError(frame, defaultErrorRules).Category)
+	assert.Equal(t, CategoryQuotaExceeded, frame.Bind(&struct{}{}).(*BrokerError).Category)
+}
+
+func TestRetryable_BrokerErrorCategory(t *testing.T) {
+	assert.True(t, retryable(&BrokerError{Category: CategoryTransient}))
+	assert.False(t, retryable(&BrokerError{Category: CategoryQuotaExceeded}))
+	assert.False(t, retryable(&ConnectionError{Cause: &BrokerError{}}))
+	assert.False(t, retryable(&ConnectRejectedError{Broker: &BrokerError{Category: CategoryAccessDenied}}))
+	assert.True(t, retryable(&ConnectRejectedError{Broker: &BrokerError{Category: CategoryTransient}}))
+}
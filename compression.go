@@ -0,0 +1,44 @@
+package go_stomp_websocket
+
+import (
+	"net/http"
+	"strings"
+)
+
+type compression struct {
+	enabled bool
+	level   int
+}
+
+// WithCompression sets EnableCompression on the dialer, so that permessage-deflate is offered on the upgrade,
+// and the compression level of the messages the client writes, from -2 to 9 as in compress/flate. The server
+// may still decline, CompressionNegotiated reports whether it accepted. Without the option the dialer is used
+// as given.
+func WithCompression(enabled bool, level int) ConnectOption {
+	return func(options *connectOptions) {
+		options.compression = &compression{enabled: enabled, level: level}
+	}
+}
+
+// CompressionNegotiated tells whether the server accepted permessage-deflate on the upgrade.
+func (stompClient StompClient) CompressionNegotiated() bool {
+	return stompClient.compressed
+}
+
+// captureCompression remembers whether the upgrade response accepted permessage-deflate, which gorilla/websocket
+// only uses when the dialer offered it.
+func (options *connectOptions) captureCompression(resp *http.Response) {
+	options.compressionNegotiated = false
+	if resp == nil || !options.offeredCompression {
+		return
+	}
+	for _, value := range resp.Header.Values("Sec-WebSocket-Extensions") {
+		for _, extension := range strings.Split(value, ",") {
+			name, _, _ := strings.Cut(extension, ";")
+			if strings.EqualFold(strings.TrimSpace(name), "permessage-deflate") {
+				options.compressionNegotiated = true
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package go_stomp_websocket
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+// startEchoWSServer starts a test server that answers every SEND frame with a MESSAGE frame of the same body for
+// the last subscription, with compression enabled on the upgrader as given. offered receives the extensions the
+// client offered.
+func startEchoWSServer(t *testing.T, compression bool, offered chan<- string) *httptest.Server {
+	t.Helper()
+	upgrader := websocket.Upgrader{
+		CheckOrigin:       func(r *http.Request) bool { return true },
+		EnableCompression: compression,
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		offered <- r.Header.Get("Sec-WebSocket-Extensions")
+		c, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("upgrade error: %v", err)
+			return
+		}
+		defer c.Close()
+		if _, _, err = c.ReadMessage(); err != nil {
+			return
+		}
+		_ = c.WriteMessage(websocket.TextMessage, []byte("o"))
+		_ = c.WriteMessage(websocket.TextMessage, []byte(connectedTestFrame))
+		var id string
+		for {
+			_, data, err := c.ReadMessage()
+			if err != nil {
+				return
+			}
+			frame := ReadFrame(append([]byte("a"), data...))
+			switch frame.Command {
+			case SUBSCRIBE:
+				id, _ = frame.Contains(Id)
+			case SEND:
+				message := CreateFrame(MESSAGE, []string{Subscription_h + ":" + id})
+				message.SetBody(frame.body)
+				_ = c.WriteMessage(websocket.TextMessage, append([]byte("a"), message.Bytes()...))
+			}
+			if receipt, ok := frame.Contains(Receipt); ok {
+				_ = c.WriteMessage(websocket.TextMessage, []byte(`a["RECEIPT\nreceipt-id:`+receipt+`\n\n\u0000"]`))
+			}
+		}
+	}))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func TestWithCompression(t *testing.T) {
+	tests := []struct {
+		name       string
+		opts       []ConnectOption
+		server     bool
+		offered    bool
+		negotiated bool
+	}{
+		{name: "negotiated", opts: []ConnectOption{WithCompression(true, 6)}, server: true, offered: true, negotiated: true},
+		{name: "declined by the server", opts: []ConnectOption{WithCompression(true, 6)}, offered: true},
+		{name: "disabled", opts: []ConnectOption{WithCompression(false, 6)}, server: true},
+		{name: "not set", server: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			offered := make(chan string, 1)
+			ts := startEchoWSServer(t, tt.server, offered)
+			client := connectTestClient(t, ts, tt.opts...)
+			defer client.Disconnect()
+			assert.Equal(t, tt.offered, strings.Contains(<-offered, "permessage-deflate"))
+			assert.Equal(t, tt.negotiated, client.CompressionNegotiated())
+			assert.Equal(t, tt.offered, client.RequestedConfig().Compression)
+			assert.Equal(t, tt.negotiated, client.EffectiveConfig().Compression)
+
+			subscription, err := client.Subscribe("/topic/a", WithBufferSize(1))
+			if !assert.NoError(t, err) {
+				return
+			}
+			body := strings.Repeat("tenantId=7a6c1c4e;status=ACTIVE;", 100)
+			assert.NoError(t, client.Send("/queue/a", "text/plain", []byte(body)))
+			select {
+			case frame := <-subscription.FrameCh:
+				assert.Equal(t, body, frame.BodyString())
+			case <-time.After(5 * time.Second):
+				t.Fatal("no echo received")
+			}
+		})
+	}
+}
+
+func TestWithCompression_InvalidLevel(t *testing.T) {
+	ts := startEchoWSServer(t, true, make(chan string, 1))
+	u := wsURL(ts)
+	client, err := ConnectWithToken(u, websocket.Dialer{}, "token", WithCompression(true, 10))
+	assert.Nil(t, client)
+	assert.Error(t, err)
+}
@@ -0,0 +1,169 @@
+package go_stomp_websocket
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	requestedHeartBeat = "10000,10000"
+
+	// defaultWebsocketBufferSize is the buffer size gorilla/websocket uses when the dialer leaves it at 0.
+	defaultWebsocketBufferSize = 4096
+)
+
+// ClientConfig is a snapshot of the settings of a client, with credentials redacted. It can be serialized to JSON.
+// Durations are in nanoseconds and zero means disabled.
+type ClientConfig struct {
+	URL               string        `json:"url"`
+	Transport         string        `json:"transport"` // "sockjs" or "raw"
+	TokenTransport    string        `json:"tokenTransport,omitempty"`
+	Subprotocol       string        `json:"subprotocol"` // offered subprotocols when requested, the selected one when effective
+	Version           string        `json:"version"`     // accepted versions when requested, the selected one when effective
+	HeartBeat         string        `json:"heartBeat"`   // "outgoing,incoming" in milliseconds
+	WriteQueueSize    int           `json:"writeQueueSize"`
+	ReadBufferSize    int           `json:"readBufferSize"`
+	WriteBufferSize   int           `json:"writeBufferSize"`
+	MaxFrameSize      int64         `json:"maxFrameSize"`
+	MaxOutboundSize   int           `json:"maxOutboundMessageSize"`
+	ReadTimeout       time.Duration `json:"readTimeout"`
+	WriteTimeout      time.Duration `json:"writeTimeout"`
+	DisconnectTimeout time.Duration `json:"disconnectTimeout"`
+	PingInterval      time.Duration `json:"pingInterval"`
+	Compression       bool          `json:"compression"` // offered when requested, negotiated when effective
+}
+
+// ConfigDifference is a setting whose effective value is not the requested one.
+type ConfigDifference struct {
+	Setting   string `json:"setting"`
+	Requested string `json:"requested"`
+	Effective string `json:"effective"`
+}
+
+// RequestedConfig returns the settings the client asked for: the connect options, the dialer buffer sizes and
+// the CONNECT frame headers.
+func (stompClient StompClient) RequestedConfig() ClientConfig {
+	return stompClient.requestedConfig
+}
+
+// EffectiveConfig returns the settings the client runs with after the defaults are resolved and the broker
+// has answered CONNECT.
+func (stompClient StompClient) EffectiveConfig() ClientConfig {
+	return stompClient.effectiveConfig
+}
+
+// Diff returns the settings of config that differ from requested, in field order.
+func (config ClientConfig) Diff(requested ClientConfig) []ConfigDifference {
+	var differences []ConfigDifference
+	effective := config.settings()
+	for i, setting := range requested.settings() {
+		if setting[1] != effective[i][1] {
+			differences = append(differences, ConfigDifference{Setting: setting[0], Requested: setting[1], Effective: effective[i][1]})
+		}
+	}
+	return differences
+}
+
+func (config ClientConfig) settings() [][2]string {
+	return [][2]string{
+		{"url", config.URL},
+		{"transport", config.Transport},
+		{"tokenTransport", config.TokenTransport},
+		{"subprotocol", config.Subprotocol},
+		{"version", config.Version},
+		{"heartBeat", config.HeartBeat},
+		{"writeQueueSize", strconv.Itoa(config.WriteQueueSize)},
+		{"readBufferSize", strconv.Itoa(config.ReadBufferSize)},
+		{"writeBufferSize", strconv.Itoa(config.WriteBufferSize)},
+		{"maxFrameSize", strconv.FormatInt(config.MaxFrameSize, 10)},
+		{"maxOutboundMessageSize", strconv.Itoa(config.MaxOutboundSize)},
+		{"readTimeout", config.ReadTimeout.String()},
+		{"writeTimeout", config.WriteTimeout.String()},
+		{"disconnectTimeout", config.DisconnectTimeout.String()},
+		{"pingInterval", config.PingInterval.String()},
+		{"compression", strconv.FormatBool(config.Compression)},
+	}
+}
+
+// recordDialer remembers the dialer buffer sizes before and after the options changed them.
+func (options *connectOptions) recordDialer(requested, effective websocket.Dialer) {
+	options.requestedBuffers = [2]int{requested.ReadBufferSize, requested.WriteBufferSize}
+	options.effectiveBuffers = [2]int{effective.ReadBufferSize, effective.WriteBufferSize}
+}
+
+// requestedConfig returns the settings the options ask for when dialing webSocketURL.
+func (options *connectOptions) requestedConfig(webSocketURL string) ClientConfig {
+	config := ClientConfig{
+		URL:               webSocketURL,
+		Transport:         "sockjs",
+		Subprotocol:       strings.Join(options.offeredSubprotocols, ","),
+		Version:           strings.Join(options.offeredVersions(), ","),
+		HeartBeat:         requestedHeartBeat,
+		WriteQueueSize:    options.writeQueueSize,
+		ReadBufferSize:    options.requestedBuffers[0],
+		WriteBufferSize:   options.requestedBuffers[1],
+		MaxFrameSize:      options.maxFrameSize,
+		MaxOutboundSize:   options.maxOutboundMessageSize,
+		ReadTimeout:       options.readTimeout,
+		WriteTimeout:      options.writeTimeout,
+		DisconnectTimeout: options.disconnectTimeout,
+		PingInterval:      options.pingInterval,
+		Compression:       options.offeredCompression,
+	}
+	if options.rawTransport {
+		config.Transport = "raw"
+	}
+	if options.tokenConnect {
+		config.TokenTransport = "header"
+		if options.tokenTransport == TokenInQuery {
+			config.TokenTransport = "query"
+		}
+	}
+	return config
+}
+
+// effectiveConfig resolves the requested config with the dialer defaults and the CONNECTED frame of the broker.
+func (options *connectOptions) effectiveConfig(requested ClientConfig, connected *Frame, subprotocol string) ClientConfig {
+	config := requested
+	config.ReadBufferSize = resolveBufferSize(options.effectiveBuffers[0])
+	config.WriteBufferSize = resolveBufferSize(options.effectiveBuffers[1])
+	config.Version = negotiatedVersion(connected)
+	config.Subprotocol = subprotocol
+	config.Compression = options.compressionNegotiated
+	serverHeartBeat, _ := connected.Contains("heart-beat")
+	config.HeartBeat = negotiateHeartBeat(requested.HeartBeat, serverHeartBeat)
+	return config
+}
+
+func resolveBufferSize(size int) int {
+	if size == 0 {
+		return defaultWebsocketBufferSize
+	}
+	return size
+}
+
+// negotiateHeartBeat applies the STOMP heart-beat rules to the client and server headers. A side sends
+// heart-beats only if it can and the peer wants them, at the slower of the two intervals.
+func negotiateHeartBeat(client, server string) string {
+	cx, cy := parseHeartBeat(client)
+	sx, sy := parseHeartBeat(server)
+	return fmt.Sprintf("%d,%d", heartBeatInterval(cx, sy), heartBeatInterval(sx, cy))
+}
+
+func heartBeatInterval(can, want int) int {
+	if can == 0 || want == 0 {
+		return 0
+	}
+	return max(can, want)
+}
+
+func parseHeartBeat(value string) (x, y int) {
+	sx, sy, _ := strings.Cut(value, ",")
+	x, _ = strconv.Atoi(strings.TrimSpace(sx))
+	y, _ = strconv.Atoi(strings.TrimSpace(sy))
+	return max(x, 0), max(y, 0)
+}
@@ -0,0 +1,73 @@
+package go_stomp_websocket
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNegotiateHeartBeat(t *testing.T) {
+	tests := []struct {
+		client   string
+		server   string
+		expected string
+	}{
+		{"10000,10000", "0,0", "0,0"},
+		{"10000,10000", "", "0,0"},
+		{"10000,10000", "5000,20000", "20000,10000"},
+		{"10000,0", "5000,5000", "10000,0"},
+		{"0,10000", "30000,5000", "0,30000"},
+		{"10000,10000", "bad,-1", "0,0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.client+"/"+tt.server, func(t *testing.T) {
+			assert.Equal(t, tt.expected, negotiateHeartBeat(tt.client, tt.server))
+		})
+	}
+}
+
+func TestClientConfig_Diff(t *testing.T) {
+	requested := ClientConfig{Version: "1.2,1.1,1.0", HeartBeat: "10000,10000", PingInterval: time.Second}
+	effective := requested
+	assert.Empty(t, effective.Diff(requested))
+
+	effective.Version = "1.2"
+	effective.ReadBufferSize = 4096
+	assert.Equal(t, []ConfigDifference{
+		{Setting: "version", Requested: "1.2,1.1,1.0", Effective: "1.2"},
+		{Setting: "readBufferSize", Requested: "0", Effective: "4096"},
+	}, effective.Diff(requested))
+}
+
+func TestEffectiveConfig(t *testing.T) {
+	ts, _ := startTestWSServer(t)
+	defer ts.Close()
+	client := connectTestClient(t, ts,
+		WithTokenTransport(TokenInQuery),
+		WithWriteQueueSize(8),
+		WithPingInterval(time.Minute))
+	defer client.connection.Close()
+
+	requested := client.RequestedConfig()
+	effective := client.EffectiveConfig()
+	assert.Equal(t, "sockjs", effective.Transport)
+	assert.Equal(t, "query", effective.TokenTransport)
+	assert.Equal(t, 8, effective.WriteQueueSize)
+	assert.Equal(t, time.Minute, effective.PingInterval)
+	assert.Equal(t, defaultDisconnectTimeout, effective.DisconnectTimeout)
+	assert.Equal(t, []ConfigDifference{
+		{Setting: "subprotocol", Requested: "v12.stomp,v11.stomp,v10.stomp", Effective: ""},
+		{Setting: "version", Requested: "1.2,1.1,1.0", Effective: "1.2"},
+		{Setting: "heartBeat", Requested: "10000,10000", Effective: "0,0"},
+		{Setting: "readBufferSize", Requested: "0", Effective: "4096"},
+		{Setting: "writeBufferSize", Requested: "0", Effective: "4096"},
+	}, effective.Diff(requested))
+
+	data, err := json.Marshal(effective)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `"version":"1.2"`)
+	assert.Contains(t, string(data), "access_token=redacted")
+	assert.NotContains(t, string(data), "token-abc")
+}
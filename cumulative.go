@@ -0,0 +1,187 @@
+package go_stomp_websocket
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// AutoCumulativeAck subscribes in the client ack mode, in which an ACK frame acknowledges the message it names
+// and every message delivered before it. The client sends one ACK frame for the last message up to which every
+// delivered message is marked done with StompMessage.Done, every interval and as soon as maxPending more
+// messages are done; a message that is not done holds back the later ones. Zero turns off interval or
+// maxPending, not both.
+//
+// Unsubscribe and Detach send the last ACK for the messages that are done. When the connection is lost, the
+// broker redelivers the messages that were not acknowledged. Only the StompMessage values of ReadMessage and
+// Messages can be marked done, and the overflow policy must be OverflowBlock: a dropped message would be
+// acknowledged without being processed.
+func AutoCumulativeAck(interval time.Duration, maxPending int) SubscribeOption {
+	return func(options *subscribeOptions) {
+		options.cumulativeAck = &cumulativeAckOptions{interval: interval, maxPending: maxPending}
+	}
+}
+
+type cumulativeAckOptions struct {
+	interval   time.Duration
+	maxPending int
+}
+
+func (options *cumulativeAckOptions) check(overflow OverflowPolicy) error {
+	switch {
+	case options.interval <= 0 && options.maxPending <= 0:
+		return errors.New("AutoCumulativeAck needs an interval or a maxPending")
+	case overflow != OverflowBlock:
+		return errors.New("AutoCumulativeAck needs the OverflowBlock overflow policy")
+	}
+	return nil
+}
+
+type ackEntry struct {
+	frame *Frame
+	done  bool
+}
+
+// cumulativeAcker tracks the delivered MESSAGE frames of an AutoCumulativeAck subscription in delivery order
+// and acknowledges the frames before the first one that is not done.
+type cumulativeAcker struct {
+	mutex   sync.Mutex
+	queue   []*ackEntry // delivered and not acknowledged, in delivery order
+	entries map[*Frame]*ackEntry
+	last    *Frame // the frame an ACK would name, nil when there is nothing to acknowledge
+	ready   int    // frames done since the last ACK
+
+	sendMutex  sync.Mutex // orders the ACK frames as they are taken
+	closed     bool       // the last ACK frame is queued, guarded by sendMutex
+	interval   time.Duration
+	maxPending int
+	flush      chan struct{}
+	stop       chan struct{}
+	stopOnce   sync.Once
+}
+
+func newCumulativeAcker(options *cumulativeAckOptions) *cumulativeAcker {
+	return &cumulativeAcker{
+		entries:    make(map[*Frame]*ackEntry),
+		interval:   options.interval,
+		maxPending: options.maxPending,
+		flush:      make(chan struct{}, 1),
+		stop:       make(chan struct{}),
+	}
+}
+
+// middleware tracks the frames as they are delivered. It is the innermost middleware, so it only sees the frames
+// that reach FrameCh.
+func (acker *cumulativeAcker) middleware() Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(frame *Frame) error {
+			if frame.Command == MESSAGE {
+				acker.track(frame)
+			}
+			return next(frame)
+		}
+	}
+}
+
+func (acker *cumulativeAcker) track(frame *Frame) {
+	acker.mutex.Lock()
+	defer acker.mutex.Unlock()
+	entry := &ackEntry{frame: frame}
+	acker.queue = append(acker.queue, entry)
+	acker.entries[frame] = entry
+}
+
+// done marks frame processed and moves the acknowledgement past the frames that are done in delivery order.
+func (acker *cumulativeAcker) done(frame *Frame) {
+	acker.mutex.Lock()
+	entry, ok := acker.entries[frame]
+	if !ok || entry.done {
+		acker.mutex.Unlock()
+		return
+	}
+	entry.done = true
+	for len(acker.queue) > 0 && acker.queue[0].done {
+		acker.last = acker.queue[0].frame
+		delete(acker.entries, acker.last)
+		acker.queue[0] = nil
+		acker.queue = acker.queue[1:]
+		acker.ready++
+	}
+	full := acker.maxPending > 0 && acker.ready >= acker.maxPending
+	acker.mutex.Unlock()
+	if full {
+		select {
+		case acker.flush <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// take returns the frame the next ACK names and forgets it, nil if there is nothing new to acknowledge.
+func (acker *cumulativeAcker) take() *Frame {
+	acker.mutex.Lock()
+	defer acker.mutex.Unlock()
+	frame := acker.last
+	acker.last, acker.ready = nil, 0
+	return frame
+}
+
+// send queues the ACK frame for the frames that are done, if any. Nothing is sent after the last one.
+func (acker *cumulativeAcker) send(stompClient StompClient, last bool) {
+	acker.sendMutex.Lock()
+	defer acker.sendMutex.Unlock()
+	if acker.closed {
+		return
+	}
+	acker.closed = last
+	frame := acker.take()
+	if frame == nil {
+		return
+	}
+	ackFrame, err := createAckFrame(ACK, stompClient.version, frame)
+	if err == nil {
+		err = stompClient.enqueue(writeRequest{Frame: ackFrame})
+	}
+	if err != nil {
+		stompClient.logger.Errorf("Can't acknowledge messages: %v", err)
+	}
+}
+
+// run sends the ACK frames until close is called or the client is closed, which drops what is not acknowledged.
+func (acker *cumulativeAcker) run(stompClient StompClient) {
+	var tick <-chan time.Time
+	if acker.interval > 0 {
+		ticker := time.NewTicker(acker.interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-tick:
+		case <-acker.flush:
+		case <-acker.stop:
+			return
+		case <-stompClient.done:
+			return
+		}
+		acker.send(stompClient, false)
+	}
+}
+
+func (acker *cumulativeAcker) start(stompClient StompClient) {
+	run := func() { acker.run(stompClient) }
+	if stompClient.goroutines != nil {
+		stompClient.goroutines.goRole(roleAcker, run)
+	} else {
+		go run()
+	}
+}
+
+// close stops run and queues the last ACK frame, before the UNSUBSCRIBE frame of the caller.
+func (acker *cumulativeAcker) close(stompClient StompClient) {
+	if acker == nil {
+		return
+	}
+	acker.stopOnce.Do(func() { close(acker.stop) })
+	acker.send(stompClient, true)
+}
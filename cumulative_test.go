@@ -0,0 +1,160 @@
+package go_stomp_websocket
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCumulativeAcker_Contiguity(t *testing.T) {
+	tests := []struct {
+		name     string
+		done     []int
+		expected int // the frame the ACK names, -1 for none
+	}{
+		{name: "nothing done", expected: -1},
+		{name: "in order", done: []int{0, 1, 2}, expected: 2},
+		{name: "out of order", done: []int{2, 1, 0}, expected: 2},
+		{name: "first missing", done: []int{1, 2, 3}, expected: -1},
+		{name: "gap", done: []int{0, 1, 3, 4}, expected: 1},
+		{name: "gap filled", done: []int{0, 3, 2, 1}, expected: 3},
+		{name: "done twice", done: []int{1, 1, 0}, expected: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			acker := newCumulativeAcker(&cumulativeAckOptions{maxPending: 100})
+			frames := make([]*Frame, 5)
+			for i := range frames {
+				frames[i] = createTestFrame(MESSAGE, []string{"ack:" + strconv.Itoa(i)}, "")
+				acker.track(frames[i])
+			}
+			for _, i := range tt.done {
+				acker.done(frames[i])
+			}
+			if tt.expected < 0 {
+				assert.Nil(t, acker.take())
+			} else {
+				assert.Same(t, frames[tt.expected], acker.take())
+			}
+			assert.Nil(t, acker.take(), "a frame is acknowledged once")
+		})
+	}
+}
+
+func TestCumulativeAcker_FlushesAtMaxPending(t *testing.T) {
+	acker := newCumulativeAcker(&cumulativeAckOptions{maxPending: 2})
+	frames := []*Frame{createTestFrame(MESSAGE, nil, "0"), createTestFrame(MESSAGE, nil, "1"), createTestFrame(MESSAGE, nil, "2")}
+	for _, frame := range frames {
+		acker.track(frame)
+	}
+	acker.done(frames[1])
+	acker.done(frames[2])
+	assert.Len(t, acker.flush, 0, "nothing is contiguous yet")
+	acker.done(frames[0])
+	assert.Len(t, acker.flush, 1)
+	acker.done(createTestFrame(MESSAGE, nil, "untracked"))
+	assert.Same(t, frames[2], acker.take())
+}
+
+func TestAutoCumulativeAck_InvalidOptions(t *testing.T) {
+	client := StompClient{}
+	_, err := client.Subscribe("/queue/a", AutoCumulativeAck(0, 0))
+	assert.EqualError(t, err, "AutoCumulativeAck needs an interval or a maxPending")
+	_, err = client.Subscribe("/queue/a", AutoCumulativeAck(time.Second, 0), WithSubscriptionOverflow(OverflowDropNewest))
+	assert.EqualError(t, err, "AutoCumulativeAck needs the OverflowBlock overflow policy")
+}
+
+func TestAutoCumulativeAck(t *testing.T) {
+	frames := make(chan *Frame, 16)
+	ts := startScriptedWSServer(t, func(c *websocket.Conn) {
+		for {
+			_, data, err := c.ReadMessage()
+			if err != nil {
+				return
+			}
+			frame := ReadFrame(append([]byte("a"), data...))
+			frames <- frame
+			if frame.Command != SUBSCRIBE {
+				continue
+			}
+			id, _ := frame.Contains(Id)
+			for i := 0; i < 5; i++ {
+				message := createTestFrame(MESSAGE, []string{Subscription_h + ":" + id, "ack:" + strconv.Itoa(i)}, strconv.Itoa(i))
+				_ = c.WriteMessage(websocket.TextMessage, append([]byte("a"), message.Bytes()...))
+			}
+		}
+	})
+	defer ts.Close()
+	client := connectTestClient(t, ts, WithLogger(NopLogger()))
+	defer client.connection.Close()
+	sub, err := client.Subscribe("/queue/a", WithBufferSize(5), AutoCumulativeAck(time.Hour, 2))
+	if !assert.NoError(t, err) {
+		return
+	}
+	expectFrame := func(command, header, value string) {
+		t.Helper()
+		select {
+		case frame := <-frames:
+			assert.Equal(t, command, frame.Command)
+			actual, _ := frame.Contains(header)
+			assert.Equal(t, value, actual)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no %s frame", command)
+		}
+	}
+	expectFrame(SUBSCRIBE, Ack, "client")
+
+	messages := make([]*StompMessage, 5)
+	for i := range messages {
+		messages[i], err = sub.ReadMessage(context.Background())
+		if !assert.NoError(t, err) {
+			return
+		}
+	}
+	messages[1].Done()
+	messages[0].Done()
+	expectFrame(ACK, Id, "1")
+	messages[3].Done()
+	messages[2].Done()
+	expectFrame(ACK, Id, "3")
+	messages[4].Done()
+	select {
+	case frame := <-frames:
+		t.Fatalf("unexpected %s frame before maxPending", frame.Command)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	sub.Unsubscribe()
+	expectFrame(ACK, Id, "4")
+	expectFrame(UNSUBSCRIBE, Id, sub.Id().String())
+}
+
+func TestAutoCumulativeAck_Interval(t *testing.T) {
+	sub := &Subscription{id: "sub-1", FrameCh: make(chan *Frame, 1)}
+	acker := newCumulativeAcker(&cumulativeAckOptions{interval: time.Millisecond})
+	sub.acker = acker
+	client := StompClient{writeCh: make(chan writeRequest, 1), version: "1.2", done: make(chan struct{})}
+	defer close(client.done)
+	acker.start(client)
+
+	frame := createTestFrame(MESSAGE, []string{"ack:a-1"}, "")
+	acker.track(frame)
+	sub.FrameCh <- frame
+	message, err := sub.ReadMessage(context.Background())
+	if !assert.NoError(t, err) {
+		return
+	}
+	message.Done()
+	select {
+	case req := <-client.writeCh:
+		assert.Equal(t, "ACK\nid:a-1\n\n\x00", string(req.Frame.rawBytes()))
+	case <-time.After(5 * time.Second):
+		t.Fatal("no ACK frame")
+	}
+	acker.close(client)
+	assert.Len(t, client.writeCh, 0, "nothing left to acknowledge")
+}
@@ -0,0 +1,133 @@
+package go_stomp_websocket
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+const accessTokenParam = "access_token"
+
+// buildDialURL appends the SockJS session segments to the base URL path. The caller's query string is kept as is,
+// params are merged into it only for keys the caller has not supplied, and any fragment is dropped: it is never
+// sent to the server.
+func buildDialURL(base url.URL, serverID, sessionID string, params url.Values) url.URL {
+	dialURL := base
+	dialURL.Fragment = ""
+	dialURL.RawFragment = ""
+	dialURL.Path, dialURL.RawPath = appendPathSegments(base, serverID, sessionID, "websocket")
+	dialURL.RawQuery = mergeQuery(base.RawQuery, params)
+	return dialURL
+}
+
+// appendPathSegments returns the path and escaped path of base with segments appended. Trailing slashes of the
+// base path are dropped so that no empty segment appears, and the segments are percent-encoded, which only
+// matters for ids from a generator that validateSessionSegment has not checked.
+func appendPathSegments(base url.URL, segments ...string) (path, rawPath string) {
+	path = strings.TrimRight(base.Path, "/")
+	rawPath = strings.TrimRight(base.EscapedPath(), "/")
+	for _, segment := range segments {
+		path += "/" + segment
+		rawPath += "/" + url.PathEscape(segment)
+	}
+	if rawPath == path {
+		// url.URL keeps RawPath only when it differs from the default encoding of Path
+		rawPath = ""
+	}
+	return path, rawPath
+}
+
+// buildRawDialURL is buildDialURL for the raw transport, which dials the base URL without SockJS segments.
+func buildRawDialURL(base url.URL, params url.Values) url.URL {
+	dialURL := base
+	dialURL.Fragment = ""
+	dialURL.RawFragment = ""
+	dialURL.RawQuery = mergeQuery(base.RawQuery, params)
+	return dialURL
+}
+
+// SockJSSession holds the SockJS server and session ids of a connection.
+type SockJSSession struct {
+	ServerID  string
+	SessionID string
+}
+
+// dialURL returns the URL to dial and remembers the generated SockJS session in options.
+func (options *connectOptions) dialURL(base url.URL, params url.Values) (url.URL, error) {
+	if options.rawTransport {
+		return buildRawDialURL(base, params), nil
+	}
+	generator := options.sessionIDGenerator
+	if generator == nil {
+		generator = options.ids.SockJSSession
+	}
+	serverID, sessionID := generator()
+	if err := validateSessionSegment("server id", serverID); err != nil {
+		return url.URL{}, err
+	}
+	if err := validateSessionSegment("session id", sessionID); err != nil {
+		return url.URL{}, err
+	}
+	options.session = SockJSSession{ServerID: serverID, SessionID: sessionID}
+	return buildDialURL(base, serverID, sessionID, params), nil
+}
+
+// validateSessionSegment accepts the URL path safe characters SockJS allows in ids: letters, digits, '-', '_' and '~'.
+// Dots are not allowed by SockJS.
+func validateSessionSegment(name, value string) error {
+	if value == "" {
+		return fmt.Errorf("SockJS %s must not be empty", name)
+	}
+	for _, c := range value {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_', c == '~':
+		default:
+			return fmt.Errorf("SockJS %s %q contains %q, only letters, digits, '-', '_' and '~' are allowed", name, value, c)
+		}
+	}
+	return nil
+}
+
+// checkReservedQuery reports a query parameter of the caller URL that the client sets itself, such as the
+// access_token of TokenInQuery, as an error instead of dropping the value of the client.
+func checkReservedQuery(base url.URL, reserved ...string) error {
+	query, _ := url.ParseQuery(base.RawQuery)
+	for _, key := range reserved {
+		if query.Has(key) {
+			return fmt.Errorf("%w: %s", errReservedQueryParam, key)
+		}
+	}
+	return nil
+}
+
+func mergeQuery(rawQuery string, params url.Values) string {
+	if len(params) == 0 {
+		return rawQuery
+	}
+	existing, _ := url.ParseQuery(rawQuery)
+	added := url.Values{}
+	for key, values := range params {
+		if _, ok := existing[key]; ok {
+			continue
+		}
+		added[key] = values
+	}
+	if len(added) == 0 {
+		return rawQuery
+	}
+	if rawQuery == "" {
+		return added.Encode()
+	}
+	return strings.TrimSuffix(rawQuery, "&") + "&" + added.Encode()
+}
+
+// redactedURL returns the URL string with the access token query parameter masked, for logging.
+func redactedURL(u url.URL) string {
+	query, err := url.ParseQuery(u.RawQuery)
+	if err != nil || !query.Has(accessTokenParam) {
+		return u.String()
+	}
+	query.Set(accessTokenParam, "redacted")
+	u.RawQuery = query.Encode()
+	return u.String()
+}
@@ -0,0 +1,236 @@
+package go_stomp_websocket
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildDialURL(t *testing.T) {
+	tests := []struct {
+		name     string
+		base     string
+		params   url.Values
+		expected string
+	}{
+		{
+			name:     "no query",
+			base:     "ws://localhost:8080/api/watch",
+			expected: "ws://localhost:8080/api/watch/123/session/websocket",
+		},
+		{
+			name:     "caller query preserved",
+			base:     "ws://localhost:8080/api/watch?x-version=2",
+			expected: "ws://localhost:8080/api/watch/123/session/websocket?x-version=2",
+		},
+		{
+			name:     "fragment dropped",
+			base:     "ws://localhost:8080/api/watch?x-version=2#section",
+			expected: "ws://localhost:8080/api/watch/123/session/websocket?x-version=2",
+		},
+		{
+			name:     "library param added to empty query",
+			base:     "ws://localhost:8080/api/watch",
+			params:   url.Values{accessTokenParam: []string{"token"}},
+			expected: "ws://localhost:8080/api/watch/123/session/websocket?access_token=token",
+		},
+		{
+			name:     "library param merged into caller query",
+			base:     "ws://localhost:8080/api/watch?x-version=2",
+			params:   url.Values{accessTokenParam: []string{"token"}},
+			expected: "ws://localhost:8080/api/watch/123/session/websocket?x-version=2&access_token=token",
+		},
+		{
+			name:     "caller param not clobbered",
+			base:     "ws://localhost:8080/api/watch?access_token=caller",
+			params:   url.Values{accessTokenParam: []string{"token"}},
+			expected: "ws://localhost:8080/api/watch/123/session/websocket?access_token=caller",
+		},
+		{
+			name:     "encoded caller values kept verbatim",
+			base:     "ws://localhost:8080/api/watch?tenant=a%2Fb%26c&name=x+y",
+			params:   url.Values{accessTokenParam: []string{"a b/c"}},
+			expected: "ws://localhost:8080/api/watch/123/session/websocket?tenant=a%2Fb%26c&name=x+y&access_token=a+b%2Fc",
+		},
+		{
+			name:     "trailing slash",
+			base:     "ws://localhost:8080/api/watch/",
+			expected: "ws://localhost:8080/api/watch/123/session/websocket",
+		},
+		{
+			name:     "trailing slash with query",
+			base:     "ws://localhost:8080/api/watch/?tenant=abc&access_token=caller",
+			params:   url.Values{accessTokenParam: []string{"token"}},
+			expected: "ws://localhost:8080/api/watch/123/session/websocket?tenant=abc&access_token=caller",
+		},
+		{
+			name:     "empty path",
+			base:     "ws://localhost:8080",
+			expected: "ws://localhost:8080/123/session/websocket",
+		},
+		{
+			name:     "empty path with query",
+			base:     "ws://localhost:8080?tenant=abc",
+			params:   url.Values{accessTokenParam: []string{"token"}},
+			expected: "ws://localhost:8080/123/session/websocket?tenant=abc&access_token=token",
+		},
+		{
+			name:     "root path",
+			base:     "ws://localhost:8080/",
+			expected: "ws://localhost:8080/123/session/websocket",
+		},
+		{
+			name:     "encoded base path kept",
+			base:     "ws://localhost:8080/api/a%2Fb/watch/",
+			expected: "ws://localhost:8080/api/a%2Fb/watch/123/session/websocket",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			base, err := url.Parse(tt.base)
+			assert.NoError(t, err)
+			result := buildDialURL(*base, "123", "session", tt.params)
+			assert.Equal(t, tt.expected, result.String())
+		})
+	}
+}
+
+func TestBuildDialURL_EncodesSessionSegments(t *testing.T) {
+	base, _ := url.Parse("ws://localhost:8080/api/watch?tenant=abc")
+	result := buildDialURL(*base, "1/2", "a b?c", nil)
+	assert.Equal(t, "ws://localhost:8080/api/watch/1%2F2/a%20b%3Fc/websocket?tenant=abc", result.String())
+	assert.Equal(t, "/api/watch/1/2/a b?c/websocket", result.Path)
+}
+
+func TestRedactedURL(t *testing.T) {
+	u, _ := url.Parse("ws://localhost/watch/1/s/websocket?access_token=secret")
+	assert.NotContains(t, redactedURL(*u), "secret")
+
+	u, _ = url.Parse("ws://localhost/watch/1/s/websocket?x-version=2")
+	assert.Equal(t, u.String(), redactedURL(*u))
+}
+
+func TestConnectWithToken_TokenTransports(t *testing.T) {
+	tests := []struct {
+		name          string
+		transport     TokenTransport
+		expectedQuery string
+		expectedAuth  string
+	}{
+		{
+			name:          "header transport",
+			transport:     TokenInHeader,
+			expectedQuery: "x-version=2&tenant=a%2Fb",
+			expectedAuth:  "Bearer token-abc",
+		},
+		{
+			name:          "query transport",
+			transport:     TokenInQuery,
+			expectedQuery: "x-version=2&tenant=a%2Fb&access_token=token-abc",
+			expectedAuth:  "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upgradeRequests := make(chan *http.Request, 1)
+			ts, done := startTestWSServerWithUpgradeCheck(t, func(r *http.Request) {
+				upgradeRequests <- r
+			})
+			defer ts.Close()
+
+			u, _ := url.Parse(ts.URL + "/watch?x-version=2&tenant=a%2Fb")
+			u.Scheme = "ws"
+
+			client, err := ConnectWithToken(*u, websocket.Dialer{}, "token-abc", WithTokenTransport(tt.transport))
+			if err != nil {
+				t.Fatalf("ConnectWithToken failed: %v", err)
+			}
+
+			r := <-upgradeRequests
+			assert.Equal(t, tt.expectedQuery, r.URL.RawQuery)
+			assert.Regexp(t, "^/watch/[0-9]{3}/[A-Za-z0-9]{16}/websocket$", r.URL.Path)
+			assert.Equal(t, tt.expectedAuth, r.Header.Get("Authorization"))
+
+			assert.NoError(t, client.Disconnect())
+			select {
+			case <-done:
+			case <-time.After(2 * time.Second):
+				t.Fatal("server did not finish in time")
+			}
+		})
+	}
+}
+
+func TestConnectWithToken_QueryTokenConflict(t *testing.T) {
+	ts, _ := startTestWSServer(t)
+	defer ts.Close()
+	u, _ := url.Parse(ts.URL + "/watch?access_token=caller")
+	u.Scheme = "ws"
+
+	client, err := ConnectWithToken(*u, websocket.Dialer{}, "token-abc", WithTokenTransport(TokenInQuery))
+	assert.Nil(t, client)
+	assert.ErrorIs(t, err, errReservedQueryParam)
+	assert.False(t, retryable(err))
+}
+
+func TestValidateSessionSegment(t *testing.T) {
+	tests := []struct {
+		value   string
+		wantErr bool
+	}{
+		{value: "pod-a_1~x"},
+		{value: "", wantErr: true},
+		{value: "a.b", wantErr: true},
+		{value: "a/b", wantErr: true},
+		{value: "a b", wantErr: true},
+		{value: "ü", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			err := validateSessionSegment("session id", tt.value)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestWithSessionIDGenerator(t *testing.T) {
+	paths := make(chan string, 1)
+	ts, _ := startTestWSServerWithUpgradeCheck(t, func(r *http.Request) {
+		paths <- r.URL.Path
+	})
+	defer ts.Close()
+
+	client := connectTestClient(t, ts, WithSessionIDGenerator(func() (string, string) {
+		return "pod-7", "session-42"
+	}))
+	defer client.connection.Close()
+	assert.Equal(t, "/pod-7/session-42/websocket", <-paths)
+	assert.Equal(t, SockJSSession{ServerID: "pod-7", SessionID: "session-42"}, client.SockJSSession())
+
+	u, _ := url.Parse(ts.URL)
+	u.Scheme = "ws"
+	_, err := ConnectWithToken(*u, websocket.Dialer{}, "token", WithSessionIDGenerator(func() (string, string) {
+		return "pod.7", "session"
+	}))
+	assert.EqualError(t, err, `SockJS server id "pod.7" contains '.', only letters, digits, '-', '_' and '~' are allowed`)
+}
+
+func TestSockJSSession_Random(t *testing.T) {
+	ts, _ := startTestWSServer(t)
+	defer ts.Close()
+	client := connectTestClient(t, ts)
+	defer client.connection.Close()
+	session := client.SockJSSession()
+	assert.Len(t, session.ServerID, 3)
+	assert.Len(t, session.SessionID, 16)
+}
@@ -0,0 +1,121 @@
+package go_stomp_websocket
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// drainPollInterval is how often Drain checks whether the consumers have received the buffered frames.
+const drainPollInterval = 10 * time.Millisecond
+
+// DrainError is returned by Drain when ctx was done before the consumers received every buffered frame.
+type DrainError struct {
+	Undelivered int   // frames left in the subscription channels
+	Cause       error // ctx.Err()
+}
+
+func (e *DrainError) Error() string {
+	return fmt.Sprintf("drain cut short with %d frames undelivered: %v", e.Undelivered, e.Cause)
+}
+
+func (e *DrainError) Unwrap() error {
+	return e.Cause
+}
+
+// Drain stops consuming and disconnects without dropping the frames the subscriptions buffered. It sends
+// UNSUBSCRIBE with a receipt for every subscription, after which no more MESSAGE frames are delivered, waits for
+// the receipts and until the consumers received every frame buffered in FrameCh, then disconnects like
+// Disconnect. Durable subscriptions are detached instead, so that the broker keeps them. Middleware and handlers
+// still running when FrameCh is empty are not waited for.
+//
+// When ctx is done first Drain disconnects right away and returns a *DrainError with the number of frames left
+// undelivered, joined with the error of Disconnect if there is one. From the start of Drain on, Subscribe and
+// Send and their variants fail with ErrDraining; acknowledging received frames still works. Calls after the
+// first one return ErrDraining.
+func (stompClient StompClient) Drain(ctx context.Context) error {
+	if stompClient.terminal == nil {
+		return ErrClientClosed
+	}
+	if !stompClient.terminal.draining.CompareAndSwap(false, true) {
+		return ErrDraining
+	}
+	subscriptions := stompClient.registry.subscriptions()
+	receipts := make([]chan *Frame, 0, len(subscriptions))
+	for _, s := range subscriptions {
+		if s.durable != "" {
+			if err := s.Detach(); err != nil {
+				stompClient.logger.Errorf("Can't detach %s: %v", s.id, err)
+			}
+			continue
+		}
+		receipt, err := s.unsubscribeWithReceipt()
+		if err != nil {
+			stompClient.logger.Errorf("Can't unsubscribe %s: %v", s.id, err)
+			continue
+		}
+		receipts = append(receipts, receipt)
+	}
+	drainErr := stompClient.awaitDrained(ctx, subscriptions, receipts)
+	return errors.Join(drainErr, stompClient.Disconnect())
+}
+
+// awaitDrained waits for the UNSUBSCRIBE receipts and then until the channels of subscriptions are empty.
+func (stompClient StompClient) awaitDrained(ctx context.Context, subscriptions []*Subscription, receipts []chan *Frame) error {
+	for _, receipt := range receipts {
+		select {
+		case <-receipt:
+		case <-stompClient.done:
+			// the buffered frames can still be received
+		case <-ctx.Done():
+			return &DrainError{Undelivered: undelivered(subscriptions), Cause: ctx.Err()}
+		}
+	}
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+	for {
+		if undelivered(subscriptions) == 0 {
+			return nil
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return &DrainError{Undelivered: undelivered(subscriptions), Cause: ctx.Err()}
+		}
+	}
+}
+
+// undelivered returns the number of frames buffered in the channels of subscriptions.
+func undelivered(subscriptions []*Subscription) int {
+	n := 0
+	for _, s := range subscriptions {
+		n += s.Pending()
+	}
+	return n
+}
+
+// unsubscribeWithReceipt is Unsubscribe with a receipt, which the returned channel receives.
+func (s *Subscription) unsubscribeWithReceipt() (chan *Frame, error) {
+	frame, err := s.unsubscribeFrame(s.stompClient.newID())
+	if err != nil {
+		return nil, err
+	}
+	s.stompClient.registry.remove(s.id)
+	s.unsubscribed.close()
+	s.acker.close(s.stompClient)
+	// buffered, so processLoop never blocks on the receipt once Drain stops waiting
+	receipt := make(chan *Frame, 1)
+	if err := s.stompClient.enqueue(writeRequest{Frame: frame, C: receipt}); err != nil {
+		return nil, err
+	}
+	return receipt, nil
+}
+
+// checkDraining returns ErrDraining once Drain started.
+func (stompClient StompClient) checkDraining() error {
+	if stompClient.terminal != nil && stompClient.terminal.draining.Load() {
+		return ErrDraining
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package go_stomp_websocket
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// bufferFrames pushes bodies and waits until the subscription has buffered them.
+func bufferFrames(t *testing.T, push chan<- string, subscription *Subscription, bodies ...string) {
+	t.Helper()
+	for _, body := range bodies {
+		push <- body
+	}
+	assert.Eventually(t, func() bool { return subscription.Pending() == len(bodies) }, 5*time.Second, time.Millisecond)
+}
+
+func TestDrain_DeliversBufferedFrames(t *testing.T) {
+	ts, push, subscribed := startTriggeredPushServer(t)
+	client := connectTestClient(t, ts, WithLogger(NopLogger()))
+	subscription, err := client.Subscribe("/topic/a", WithBufferSize(8))
+	if !assert.NoError(t, err) {
+		return
+	}
+	<-subscribed
+	bufferFrames(t, push, subscription, "1", "2", "3")
+
+	drained := make(chan error, 1)
+	go func() { drained <- client.Drain(context.Background()) }()
+	assert.Eventually(t, func() bool { return client.terminal.draining.Load() }, 5*time.Second, time.Millisecond)
+	assert.ErrorIs(t, client.Send("/queue/a", "", nil), ErrDraining)
+	_, err = client.Subscribe("/topic/b")
+	assert.ErrorIs(t, err, ErrDraining)
+	assert.Empty(t, client.Subscriptions())
+
+	for _, expected := range []string{"1", "2", "3"} {
+		frame, err := subscription.Read(context.Background())
+		if assert.NoError(t, err) {
+			assert.Equal(t, expected, frame.BodyString())
+		}
+	}
+	select {
+	case err := <-drained:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Drain did not return")
+	}
+	<-client.done
+	assert.ErrorIs(t, client.Drain(context.Background()), ErrDraining)
+}
+
+func TestDrain_ContextDone(t *testing.T) {
+	ts, push, subscribed := startTriggeredPushServer(t)
+	client := connectTestClient(t, ts, WithLogger(NopLogger()))
+	subscription, err := client.Subscribe("/topic/a", WithBufferSize(8))
+	if !assert.NoError(t, err) {
+		return
+	}
+	<-subscribed
+	bufferFrames(t, push, subscription, "1", "2")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err = client.Drain(ctx)
+	var drainErr *DrainError
+	if assert.ErrorAs(t, err, &drainErr) {
+		assert.Equal(t, 2, drainErr.Undelivered)
+	}
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.EqualError(t, err, "drain cut short with 2 frames undelivered: context deadline exceeded")
+	<-client.done
+	assert.Equal(t, 2, subscription.Pending())
+}
+
+func TestDrain_DetachesDurableSubscriptions(t *testing.T) {
+	messages := make(chan string, 8)
+	ts := startRecordingWSServer(t, messages)
+	client := connectTestClient(t, ts, WithLogger(NopLogger()), WithIDGenerator(&sequentialIDs{}), WithClientID("consumer-1"))
+	receiveMessage(t, messages) // CONNECT
+	_, err := client.Subscribe("/topic/orders", Durable("orders"))
+	assert.NoError(t, err)
+	_, err = client.Subscribe("/topic/a")
+	assert.NoError(t, err)
+	receiveMessage(t, messages)
+	receiveMessage(t, messages)
+
+	assert.NoError(t, client.Drain(context.Background()))
+	var commands []string
+	for _, message := range []string{receiveMessage(t, messages), receiveMessage(t, messages)} {
+		frame := ReadFrame([]byte("a" + message))
+		id, _ := frame.Contains(Id)
+		commands = append(commands, strings.TrimSpace(frame.Command+" "+id))
+	}
+	assert.Equal(t, []string{UNSUBSCRIBE + " id-3", DISCONNECT}, commands)
+}
+
+func TestDrain_ClosedClient(t *testing.T) {
+	assert.ErrorIs(t, StompClient{}.Drain(context.Background()), ErrClientClosed)
+}
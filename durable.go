@@ -0,0 +1,111 @@
+package go_stomp_websocket
+
+import "fmt"
+
+const ClientId = "client-id"
+
+// BrokerDialect adds the broker specific headers of durable subscriptions to SUBSCRIBE and UNSUBSCRIBE frames.
+type BrokerDialect interface {
+	// DurableSubscribe adds the headers that make a SUBSCRIBE frame durable under name.
+	DurableSubscribe(subscribe *FrameBuilder, name string)
+	// DurableUnsubscribe adds the headers that make an UNSUBSCRIBE frame remove the durable subscription name.
+	DurableUnsubscribe(unsubscribe *FrameBuilder, name string)
+}
+
+var (
+	// DialectActiveMQ names durable subscriptions with the activemq.subscriptionName header, which ActiveMQ
+	// Classic and ActiveMQ Artemis understand. Both need WithClientID.
+	DialectActiveMQ BrokerDialect = headerDialect{"activemq.subscriptionName"}
+	// DialectArtemis names durable subscriptions with the durable-subscription-name header of ActiveMQ Artemis.
+	DialectArtemis BrokerDialect = headerDialect{"durable-subscription-name"}
+	// DialectRabbitMQ makes the queue of a subscription durable. RabbitMQ names the queue after the subscription
+	// id, which is the durable subscription name.
+	DialectRabbitMQ BrokerDialect = rabbitMQDialect{}
+)
+
+// headerDialect sends the durable subscription name in a header of SUBSCRIBE and UNSUBSCRIBE.
+type headerDialect struct {
+	header string
+}
+
+func (d headerDialect) DurableSubscribe(subscribe *FrameBuilder, name string) {
+	subscribe.WithHeader(d.header, name)
+}
+
+func (d headerDialect) DurableUnsubscribe(unsubscribe *FrameBuilder, name string) {
+	unsubscribe.WithHeader(d.header, name)
+}
+
+type rabbitMQDialect struct{}
+
+func (rabbitMQDialect) DurableSubscribe(subscribe *FrameBuilder, _ string) {
+	subscribe.WithHeader("durable", "true").WithHeader("auto-delete", "false")
+}
+
+func (rabbitMQDialect) DurableUnsubscribe(unsubscribe *FrameBuilder, _ string) {
+	unsubscribe.WithHeader("durable", "true").WithHeader("auto-delete", "false")
+}
+
+// WithClientID adds the client-id header to the CONNECT frame. Brokers key durable subscriptions by it, so it
+// must stay the same across restarts of the consumer and be unique among the connected clients.
+func WithClientID(id string) ConnectOption {
+	return func(options *connectOptions) {
+		options.clientID = id
+	}
+}
+
+// WithBrokerDialect sets the headers Durable subscriptions are made with. The default is DialectActiveMQ.
+// A nil dialect keeps the default.
+func WithBrokerDialect(dialect BrokerDialect) ConnectOption {
+	return func(options *connectOptions) {
+		if dialect != nil {
+			options.dialect = dialect
+		}
+	}
+}
+
+// Durable makes the subscription a durable subscription called name, which the broker keeps while the client is
+// disconnected. The name is the id of the subscription, so a client can't have two subscriptions of one name.
+// Unsubscribe removes the durable subscription from the broker; Detach keeps it.
+func Durable(name string) SubscribeOption {
+	return func(options *subscribeOptions) {
+		options.durable = name
+	}
+}
+
+// unsubscribeFrame builds the UNSUBSCRIBE frame of the subscription, which removes a durable subscription. The
+// receipt header is left out when receipt is empty.
+func (s *Subscription) unsubscribeFrame(receipt string) (*Frame, error) {
+	builder := NewFrame(UNSUBSCRIBE).WithHeader(Id, s.id.String())
+	if receipt != "" {
+		builder.WithHeader(Receipt, receipt)
+	}
+	if s.durable != "" && s.stompClient.dialect != nil {
+		s.stompClient.dialect.DurableUnsubscribe(builder, s.durable)
+	}
+	return builder.Build()
+}
+
+// Detach stops the delivery of the subscription to FrameCh, like Unsubscribe, but sends no UNSUBSCRIBE frame, so
+// that the broker keeps a durable subscription. The broker goes on sending its messages until the connection is
+// closed; the client drops them, and in a client ack mode the broker redelivers them once the durable
+// subscription is resumed. Detach is meant for a consumer that stops before Disconnect. Frames buffered in
+// FrameCh are still received and FrameCh is not closed.
+func (s *Subscription) Detach() error {
+	s.stompClient.registry.remove(s.id)
+	s.unsubscribed.close()
+	s.acker.close(s.stompClient)
+	if s.stompClient.rawRoutes != nil {
+		s.stompClient.rawRoutes.remove(s.id)
+	}
+	req := swapRequest{Id: s.id, Detach: true, Result: make(chan swapResult, 1)}
+	select {
+	case s.stompClient.swapCh <- req:
+	case <-s.stompClient.done:
+		return ErrClientClosed
+	}
+	if result := <-req.Result; result.Err != nil {
+		return fmt.Errorf("can't detach %s: %w", s.id, result.Err)
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package go_stomp_websocket
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+// startRecordingWSServer starts a test server that sends every client message, the CONNECT frame included,
+// to messages and answers receipts.
+func startRecordingWSServer(t *testing.T, messages chan<- string) *httptest.Server {
+	t.Helper()
+	upgrader := websocket.Upgrader{CheckOrigin: func(r *http.Request) bool { return true }}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("upgrade error: %v", err)
+			return
+		}
+		defer c.Close()
+		for first := true; ; first = false {
+			_, data, err := c.ReadMessage()
+			if err != nil {
+				return
+			}
+			messages <- string(data)
+			if first {
+				_ = c.WriteMessage(websocket.TextMessage, []byte("o"))
+				_ = c.WriteMessage(websocket.TextMessage, []byte(connectedTestFrame))
+			} else if receipt, ok := ReadFrame(append([]byte("a"), data...)).Contains(Receipt); ok {
+				_ = c.WriteMessage(websocket.TextMessage, []byte(`a["RECEIPT\nreceipt-id:`+receipt+`\n\n\u0000"]`))
+			}
+		}
+	}))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func receiveMessage(t *testing.T, messages <-chan string) string {
+	t.Helper()
+	select {
+	case message := <-messages:
+		return message
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message received")
+		return ""
+	}
+}
+
+func TestDurable_Headers(t *testing.T) {
+	tests := []struct {
+		name        string
+		dialect     BrokerDialect
+		subscribe   string
+		unsubscribe string
+	}{
+		{
+			name:        "ActiveMQ",
+			subscribe:   `["SUBSCRIBE\nid:orders\ndestination:/topic/orders\nactivemq.subscriptionName:orders\n\n\u0000"]`,
+			unsubscribe: `["UNSUBSCRIBE\nid:orders\nactivemq.subscriptionName:orders\n\n\u0000"]`,
+		},
+		{
+			name:        "Artemis",
+			dialect:     DialectArtemis,
+			subscribe:   `["SUBSCRIBE\nid:orders\ndestination:/topic/orders\ndurable-subscription-name:orders\n\n\u0000"]`,
+			unsubscribe: `["UNSUBSCRIBE\nid:orders\ndurable-subscription-name:orders\n\n\u0000"]`,
+		},
+		{
+			name:        "RabbitMQ",
+			dialect:     DialectRabbitMQ,
+			subscribe:   `["SUBSCRIBE\nid:orders\ndestination:/topic/orders\ndurable:true\nauto-delete:false\n\n\u0000"]`,
+			unsubscribe: `["UNSUBSCRIBE\nid:orders\ndurable:true\nauto-delete:false\n\n\u0000"]`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			messages := make(chan string, 8)
+			ts := startRecordingWSServer(t, messages)
+			client := connectTestClient(t, ts, WithLogger(NopLogger()), WithClientID("billing-1"), WithBrokerDialect(tt.dialect))
+			assert.Equal(t, `["CONNECT\naccept-version:1.2,1.1,1.0\nheart-beat:10000,10000\nclient-id:billing-1\n\n\u0000"]`,
+				receiveMessage(t, messages))
+
+			sub, err := client.Subscribe("/topic/orders", Durable("orders"))
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.Equal(t, SubscriptionID("orders"), sub.Id())
+			assert.Equal(t, tt.subscribe, receiveMessage(t, messages))
+			sub.Unsubscribe()
+			assert.Equal(t, tt.unsubscribe, receiveMessage(t, messages))
+			assert.NoError(t, client.Disconnect())
+		})
+	}
+}
+
+func TestSubscribe_WithoutClientID(t *testing.T) {
+	messages := make(chan string, 8)
+	ts := startRecordingWSServer(t, messages)
+	client := connectTestClient(t, ts, WithLogger(NopLogger()), WithIDGenerator(&sequentialIDs{}))
+	assert.Equal(t, `["CONNECT\naccept-version:1.2,1.1,1.0\nheart-beat:10000,10000\n\n\u0000"]`, receiveMessage(t, messages))
+
+	sub, err := client.Subscribe("/topic/a")
+	assert.NoError(t, err)
+	assert.Equal(t, `["SUBSCRIBE\nid:id-3\ndestination:/topic/a\n\n\u0000"]`, receiveMessage(t, messages))
+	sub.Unsubscribe()
+	assert.Equal(t, `["UNSUBSCRIBE\nid:id-3\n\n\u0000"]`, receiveMessage(t, messages))
+	assert.NoError(t, client.Disconnect())
+}
+
+func TestDetach(t *testing.T) {
+	ts, push, subscribed := startTriggeredPushServer(t)
+	client := connectTestClient(t, ts, WithLogger(NopLogger()))
+	sub, err := client.Subscribe("/topic/a", Durable("a"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	<-subscribed
+	push <- "1"
+	push <- "2" // the dispatcher waits for the consumer of the unbuffered FrameCh
+	assert.Equal(t, "1", receiveBody(t, sub.FrameCh))
+
+	assert.NoError(t, sub.Detach())
+	_, ok := client.Subscription("a")
+	assert.False(t, ok)
+	push <- "3"
+	select {
+	case frame := <-sub.FrameCh:
+		t.Fatalf("frame %s delivered after Detach", frame.BodyString())
+	case <-time.After(50 * time.Millisecond):
+	}
+	assert.ErrorIs(t, sub.Detach(), ErrSubscriptionNotFound)
+
+	// the same durable subscription is resumed on the connection
+	resumed, err := client.Subscribe("/topic/a", Durable("a"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	push <- "4"
+	assert.Equal(t, "4", receiveBody(t, resumed.FrameCh))
+	assert.NoError(t, client.Disconnect())
+}
@@ -0,0 +1,136 @@
+package go_stomp_websocket
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/url"
+	"sync/atomic"
+
+	"github.com/gorilla/websocket"
+)
+
+// Endpoints is a list of websocket URLs of the same broker, for example one per availability zone, that
+// ConnectToEndpoints fails over between. It remembers the endpoint of the last successful connect and tries it
+// first the next time, so a reconnect stays on the same endpoint while it is reachable. An Endpoints may be
+// shared by concurrent connects.
+type Endpoints struct {
+	urls      []url.URL
+	shuffle   bool
+	preferred atomic.Int32 // index in urls plus one of the last endpoint connected to, 0 for none
+}
+
+type EndpointsOption func(*Endpoints)
+
+// WithShuffledEndpoints makes ConnectToEndpoints try the endpoints in random order instead of the given one,
+// which spreads clients over them. The endpoint connected to last is still tried first.
+func WithShuffledEndpoints() EndpointsOption {
+	return func(endpoints *Endpoints) {
+		endpoints.shuffle = true
+	}
+}
+
+// NewEndpoints returns the endpoints to try in the order of urls.
+func NewEndpoints(urls []url.URL, opts ...EndpointsOption) *Endpoints {
+	endpoints := &Endpoints{urls: append([]url.URL{}, urls...)}
+	for _, opt := range opts {
+		opt(endpoints)
+	}
+	return endpoints
+}
+
+// Preferred returns the endpoint of the last successful connect, false before the first one.
+func (endpoints *Endpoints) Preferred() (url.URL, bool) {
+	i := int(endpoints.preferred.Load()) - 1
+	if i < 0 {
+		return url.URL{}, false
+	}
+	return endpoints.urls[i], true
+}
+
+// order returns the indexes of the urls in the order of the next connect.
+func (endpoints *Endpoints) order() []int {
+	order := make([]int, 0, len(endpoints.urls))
+	preferred := int(endpoints.preferred.Load()) - 1
+	for i := range endpoints.urls {
+		if i != preferred {
+			order = append(order, i)
+		}
+	}
+	if endpoints.shuffle {
+		rand.Shuffle(len(order), func(i, j int) { order[i], order[j] = order[j], order[i] })
+	}
+	if preferred >= 0 {
+		order = append([]int{preferred}, order...)
+	}
+	return order
+}
+
+// EndpointError is the error of connecting to one endpoint of ConnectToEndpoints.
+type EndpointError struct {
+	Endpoint string // the URL, with an access_token query parameter redacted
+	Err      error
+}
+
+func (e *EndpointError) Error() string {
+	return fmt.Sprintf("endpoint %s: %v", e.Endpoint, e.Err)
+}
+
+func (e *EndpointError) Unwrap() error {
+	return e.Err
+}
+
+// ConnectToEndpoints works like ConnectWithTokenProvider and tries the endpoints one after the other until a
+// connect succeeds, starting with the one connected to last. tokenProvider is asked for a token for every
+// endpoint. When every endpoint fails the error joins an *EndpointError per endpoint with errors.Join.
+// Any failure of an endpoint, a rejected CONNECT or a SockJS server with the websocket transport disabled
+// among them, moves on to the next one. Only configuration errors, such as an invalid URL or a reserved
+// header, and the context being done stop the failover right away.
+func ConnectToEndpoints(ctx context.Context, endpoints *Endpoints, dialer websocket.Dialer, tokenProvider TokenProvider, opts ...ConnectOption) (*StompClient, error) {
+	if len(endpoints.urls) == 0 {
+		return nil, ErrNoEndpoints
+	}
+	options := newConnectOptions(opts)
+	if err := options.checkAcceptVersions(); err != nil {
+		return nil, err
+	}
+	log := options.logger
+	var errs []error
+	for _, i := range endpoints.order() {
+		endpoint := endpoints.urls[i]
+		client, err := connectWithTokenProvider(ctx, endpoint, dialer, tokenProvider, newConnectOptions(opts))
+		if err == nil {
+			endpoints.preferred.Store(int32(i + 1))
+			return client, nil
+		}
+		errs = append(errs, &EndpointError{Endpoint: redactedURL(endpoint), Err: err})
+		if stopsFailover(err) {
+			break
+		}
+		log.Infof("connect to %s failed, trying the next endpoint: %v", redactedURL(endpoint), err)
+	}
+	return nil, errors.Join(errs...)
+}
+
+// stopsFailover tells whether ConnectToEndpoints gives up after err instead of trying the next endpoint,
+// because the next one would fail the same way.
+func stopsFailover(err error) bool {
+	switch {
+	case errors.Is(err, ErrInvalidScheme),
+		errors.Is(err, errReservedUpgradeHeader),
+		errors.Is(err, errReservedQueryParam),
+		errors.Is(err, ErrReservedHeader),
+		errors.Is(err, context.Canceled),
+		errors.Is(err, context.DeadlineExceeded):
+		return true
+	}
+	return false
+}
+
+// ActiveEndpoint returns the URL the client connected to as it was passed to the connect function, before
+// the SockJS path and the token query parameter are added. With ConnectToEndpoints it tells which endpoint
+// the failover ended up on.
+func (stompClient StompClient) ActiveEndpoint() url.URL {
+	return stompClient.endpoint
+}
@@ -0,0 +1,143 @@
+package go_stomp_websocket
+
+import (
+	"context"
+	"net/url"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEndpoints_Order(t *testing.T) {
+	urls := []url.URL{{Host: "a"}, {Host: "b"}, {Host: "c"}}
+	tests := []struct {
+		name      string
+		opts      []EndpointsOption
+		preferred int32
+		expected  []int
+	}{
+		{name: "given order", expected: []int{0, 1, 2}},
+		{name: "preferred first", preferred: 2, expected: []int{1, 0, 2}},
+		{name: "last preferred", preferred: 3, expected: []int{2, 0, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			endpoints := NewEndpoints(urls, tt.opts...)
+			endpoints.preferred.Store(tt.preferred)
+			assert.Equal(t, tt.expected, endpoints.order())
+		})
+	}
+
+	shuffled := NewEndpoints(urls, WithShuffledEndpoints())
+	shuffled.preferred.Store(2)
+	for range 20 {
+		order := shuffled.order()
+		assert.Equal(t, 1, order[0])
+		assert.ElementsMatch(t, []int{0, 1, 2}, order)
+	}
+}
+
+func TestConnectToEndpoints(t *testing.T) {
+	down, downAttempts := startFlakyWSServer(t, 1<<30)
+	defer down.Close()
+	up, upAttempts := startFlakyWSServer(t, 0)
+	endpoints := NewEndpoints([]url.URL{wsURL(down), wsURL(up)})
+	_, ok := endpoints.Preferred()
+	assert.False(t, ok)
+
+	client, err := ConnectToEndpoints(context.Background(), endpoints, websocket.Dialer{}, StaticToken("token"), WithLogger(NopLogger()))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, wsURL(up), client.ActiveEndpoint())
+	preferred, ok := endpoints.Preferred()
+	assert.True(t, ok)
+	assert.Equal(t, wsURL(up), preferred)
+	assert.Equal(t, int32(1), downAttempts.Load())
+	client.connection.Close()
+
+	// reconnecting prefers the endpoint connected to last
+	client, err = ConnectToEndpoints(context.Background(), endpoints, websocket.Dialer{}, StaticToken("token"), WithLogger(NopLogger()))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, wsURL(up), client.ActiveEndpoint())
+	assert.Equal(t, int32(1), downAttempts.Load())
+	assert.Equal(t, int32(2), upAttempts.Load())
+	client.connection.Close()
+
+	up.Close()
+	_, err = ConnectToEndpoints(context.Background(), endpoints, websocket.Dialer{}, StaticToken("token"), WithLogger(NopLogger()))
+	assert.Equal(t, int32(2), downAttempts.Load())
+	assert.ErrorIs(t, err, websocket.ErrBadHandshake)
+	var joined interface{ Unwrap() []error }
+	if assert.ErrorAs(t, err, &joined) && assert.Len(t, joined.Unwrap(), 2) {
+		var endpointErr *EndpointError
+		if assert.ErrorAs(t, joined.Unwrap()[0], &endpointErr) {
+			assert.Equal(t, redactedURL(wsURL(up)), endpointErr.Endpoint)
+			assert.ErrorAs(t, endpointErr, new(*HandshakeError))
+		}
+		if assert.ErrorAs(t, joined.Unwrap()[1], &endpointErr) {
+			assert.Equal(t, redactedURL(wsURL(down)), endpointErr.Endpoint)
+		}
+	}
+}
+
+func TestConnectToEndpoints_StopsOnErrorsOfEveryEndpoint(t *testing.T) {
+	up, attempts := startFlakyWSServer(t, 0)
+	defer up.Close()
+	endpoints := NewEndpoints([]url.URL{{Scheme: "http", Host: "a"}, wsURL(up)})
+	_, err := ConnectToEndpoints(context.Background(), endpoints, websocket.Dialer{}, StaticToken("token"), WithLogger(NopLogger()))
+	assert.ErrorIs(t, err, ErrInvalidScheme)
+	assert.Zero(t, attempts.Load())
+
+	_, err = ConnectToEndpoints(context.Background(), NewEndpoints(nil), websocket.Dialer{}, StaticToken("token"))
+	assert.ErrorIs(t, err, ErrNoEndpoints)
+}
+
+func TestConnectToEndpoints_FailsOverOnEndpointErrors(t *testing.T) {
+	disabled, _, _ := startSockJSInfoServer(t, `{"websocket":false}`)
+	up, _, _ := startSockJSInfoServer(t, `{"websocket":true}`)
+	endpoints := NewEndpoints([]url.URL{wsURL(disabled), wsURL(up)})
+
+	client, err := ConnectToEndpoints(context.Background(), endpoints, websocket.Dialer{}, StaticToken("token"),
+		WithLogger(NopLogger()), WithSockJSInfoCheck(true))
+	if assert.NoError(t, err) {
+		assert.Equal(t, wsURL(up), client.ActiveEndpoint())
+		client.connection.Close()
+	}
+
+	_, err = ConnectToEndpoints(context.Background(), NewEndpoints([]url.URL{wsURL(disabled), wsURL(disabled)}),
+		websocket.Dialer{}, StaticToken("token"), WithLogger(NopLogger()), WithSockJSInfoCheck(true))
+	assert.ErrorIs(t, err, ErrWebSocketDisabled)
+	var joined interface{ Unwrap() []error }
+	if assert.ErrorAs(t, err, &joined) {
+		assert.Len(t, joined.Unwrap(), 2)
+	}
+}
+
+func TestConnectToEndpoints_StopsOnCanceledContext(t *testing.T) {
+	down, downAttempts := startFlakyWSServer(t, 1<<30)
+	defer down.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := ConnectToEndpoints(ctx, NewEndpoints([]url.URL{wsURL(down), wsURL(down)}), websocket.Dialer{},
+		StaticToken("token"), WithLogger(NopLogger()))
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Zero(t, downAttempts.Load())
+
+	_, err = ConnectToEndpoints(context.Background(), NewEndpoints([]url.URL{wsURL(down)}), websocket.Dialer{},
+		StaticToken("token"), WithAcceptVersions("2.0"))
+	assert.ErrorIs(t, err, ErrUnsupportedVersion)
+	assert.Zero(t, downAttempts.Load())
+}
+
+func TestActiveEndpoint(t *testing.T) {
+	ts, _ := startTestWSServer(t)
+	defer ts.Close()
+	client := connectTestClient(t, ts, WithLogger(NopLogger()), WithTokenTransport(TokenInQuery))
+	defer client.connection.Close()
+	assert.Equal(t, wsURL(ts), client.ActiveEndpoint())
+	assert.NotEqual(t, wsURL(ts), client.webSocketURL)
+}
@@ -0,0 +1,266 @@
+package go_stomp_websocket
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gorilla/websocket"
+)
+
+var (
+	// ErrTokenProvider wraps errors returned by a TokenProvider, so they can be told apart from dial errors.
+	ErrTokenProvider = errors.New("token provider failed")
+	// ErrWriteQueueFull is returned by TrySend when the write queue has no free slot.
+	ErrWriteQueueFull = errors.New("write queue is full")
+	// ErrInvalidScheme is returned by the token connect functions for URLs whose scheme is not ws or wss.
+	ErrInvalidScheme = errors.New("malformed ws or wss URL")
+	// ErrNotConnected matches the errors of operations on a client without a connection, ErrClientClosed among them.
+	ErrNotConnected = errors.New("client is not connected")
+	// ErrReceiptTimeout matches the errors of waits for a broker RECEIPT that did not arrive in time,
+	// ErrDisconnectTimeout among them.
+	ErrReceiptTimeout = errors.New("receipt timed out")
+	// ErrDisconnectTimeout is returned by Disconnect when the broker did not confirm DISCONNECT in time
+	// and the connection was closed without a clean shutdown. It matches ErrReceiptTimeout.
+	ErrDisconnectTimeout error = &narrowError{message: "disconnect receipt timed out", general: ErrReceiptTimeout}
+	// ErrClientClosed is returned by operations on a client whose connection has been torn down. It matches
+	// ErrNotConnected.
+	ErrClientClosed error = &narrowError{message: "client is closed", general: ErrNotConnected}
+	// ErrSubscriptionExists is returned by Subscribe when the IDGenerator returns the id of a subscription the
+	// client has already.
+	ErrSubscriptionExists = errors.New("subscription id is in use")
+	// ErrDraining is returned by Subscribe, Send and their variants once Drain started, and by Drain after the
+	// first call.
+	ErrDraining = errors.New("client is draining")
+	// ErrTooManyParseErrors matches the connection error of SkipFrame giving up after too many malformed
+	// messages in a row. The error also matches the *FrameParseError of the last one.
+	ErrTooManyParseErrors = errors.New("too many consecutive parse errors")
+	// ErrNoEndpoints is returned by ConnectToEndpoints for Endpoints without a URL.
+	ErrNoEndpoints = errors.New("no endpoints to connect to")
+	// ErrSubscriptionClosed is returned by Subscription.Read once the subscription is unsubscribed, its channel is
+	// closed or the client is closed.
+	ErrSubscriptionClosed = errors.New("subscription is closed")
+	// ErrSubscriptionNotFound is returned when the client has no subscription with the given id.
+	ErrSubscriptionNotFound = errors.New("subscription not found")
+	// ErrSwapChannelTooSmall is returned by SwapChannel when the new channel cannot take the buffered frames.
+	ErrSwapChannelTooSmall = errors.New("new channel has no room for the buffered frames")
+	// ErrNackNotSupported is returned by Nack when the connection negotiated STOMP 1.0, which has no NACK frame.
+	ErrNackNotSupported = errors.New("NACK is not supported by the negotiated STOMP version")
+	// ErrIntegrityCheckFailed is sent to the subscription Errors channel for frames whose body checksum does not match.
+	ErrIntegrityCheckFailed = errors.New("frame body integrity check failed")
+	// ErrFrameTooLarge is reported when an incoming message or frame is larger than WithMaxFrameSize allows.
+	ErrFrameTooLarge = errors.New("frame exceeds the maximum frame size")
+	// ErrFrameTooLargeForTransport is returned by the send functions for frames larger than WithMaxOutboundMessageSize.
+	ErrFrameTooLargeForTransport = errors.New("frame exceeds the maximum outbound message size")
+	// ErrInvalidUTF8 is returned by the send functions on the SockJS transport for frames that are not valid UTF-8,
+	// which a SockJS message, a JSON string, cannot carry unchanged. Binary bodies need WithRawTransport.
+	ErrInvalidUTF8 = errors.New("frame is not valid UTF-8")
+	// ErrChunkTimeout is sent to the subscription Errors channel when the chunks of a message did not all arrive in time.
+	ErrChunkTimeout = errors.New("chunked message timed out")
+	// ErrUnsupportedSubprotocol is returned by connect when the server selects a websocket subprotocol the client
+	// did not offer.
+	ErrUnsupportedSubprotocol = errors.New("unsupported websocket subprotocol")
+	// ErrUnsupportedVersion is returned by connect when WithAcceptVersions offers a STOMP version the client does
+	// not speak, or when the broker selects a version that was not offered.
+	ErrUnsupportedVersion = errors.New("unsupported STOMP version")
+	// ErrWebSocketDisabled is returned by connect with WithSockJSInfoCheck when the SockJS server answers that its
+	// websocket transport is disabled.
+	ErrWebSocketDisabled = errors.New("SockJS server has the websocket transport disabled")
+	// ErrHandshakeTimeout is returned by connect when the broker did not answer CONNECT within the HandshakeTimeout
+	// of the dialer.
+	ErrHandshakeTimeout = errors.New("STOMP handshake timed out")
+	// ErrReservedHeader is returned when a HeaderSupplier returns a header that STOMP or the client set themselves.
+	ErrReservedHeader = errors.New("header is reserved")
+	// ErrPongTimeout is reported when the server did not answer the websocket pings enabled by WithPingInterval.
+	ErrPongTimeout = errors.New("websocket pong timed out")
+	// ErrHeartbeatTimeout is reported when the broker sent nothing, not even a heart-beat, for longer than the
+	// negotiated heart-beat interval times the WithHeartbeatTolerance factor.
+	ErrHeartbeatTimeout = errors.New("heartbeat timeout")
+	// ErrBinaryMessage is reported when the server sends a binary websocket message over the SockJS transport.
+	ErrBinaryMessage = errors.New("binary websocket message on a SockJS connection")
+	// ErrTooManyRestarts is returned by Supervisor.Err when the consumer panicked more often than WithRestartLimit allows.
+	ErrTooManyRestarts = errors.New("consumer restarted too many times")
+	// ErrSecondarySend wraps the error of the secondary client returned by MigrationWrapper.Send in
+	// MigrationRequireBoth mode.
+	ErrSecondarySend = errors.New("send through the secondary client failed")
+)
+
+var (
+	errReservedUpgradeHeader = errors.New("upgrade header is set by the client and cannot be overridden")
+	errReservedQueryParam    = errors.New("query parameter is set by the client and cannot be overridden")
+)
+
+// narrowError is a sentinel error that also matches a more general sentinel with errors.Is.
+type narrowError struct {
+	message string
+	general error
+}
+
+func (e *narrowError) Error() string {
+	return e.message
+}
+
+func (e *narrowError) Unwrap() error {
+	return e.general
+}
+
+// ConnectionError is the terminal error of a client connection, sent on the client Errors channel.
+type ConnectionError struct {
+	Cause error // the websocket, parse or *BrokerError cause
+}
+
+func (e *ConnectionError) Error() string {
+	return "stomp connection failed: " + e.Cause.Error()
+}
+
+func (e *ConnectionError) Unwrap() error {
+	return e.Cause
+}
+
+// WebSocketClosedError is a close of the connection by the server: a websocket close frame, or a SockJS close
+// message on the SockJS transport.
+type WebSocketClosedError struct {
+	Code   int
+	Reason string
+	Cause  error // the *websocket.CloseError, or the SockJS close error
+}
+
+func (e *WebSocketClosedError) Error() string {
+	return e.Cause.Error()
+}
+
+func (e *WebSocketClosedError) Unwrap() error {
+	return e.Cause
+}
+
+// maxRawErrorBytes limits the part of a websocket message kept by a FrameParseError.
+const maxRawErrorBytes = 1024
+
+// FrameParseError is a websocket message the client could not read STOMP frames from.
+type FrameParseError struct {
+	Raw   []byte // the start of the message, at most 1 KiB
+	Cause error
+}
+
+func newFrameParseError(data []byte, cause error) *FrameParseError {
+	return &FrameParseError{Raw: bytes.Clone(data[:min(len(data), maxRawErrorBytes)]), Cause: cause}
+}
+
+func (e *FrameParseError) Error() string {
+	return e.Cause.Error()
+}
+
+func (e *FrameParseError) Unwrap() error {
+	return e.Cause
+}
+
+// HandshakeError is a failed websocket upgrade, for example a refused TCP connection, a failed TLS handshake or
+// an upgrade response with an error status.
+type HandshakeError struct {
+	Cause error
+}
+
+func (e *HandshakeError) Error() string {
+	return "websocket handshake failed: " + e.Cause.Error()
+}
+
+func (e *HandshakeError) Unwrap() error {
+	return e.Cause
+}
+
+// classifyCloseError returns a close of the connection by the server as *WebSocketClosedError, and other errors
+// as they are.
+func classifyCloseError(err error) error {
+	var closeErr *websocket.CloseError
+	var closed *WebSocketClosedError
+	if errors.As(err, &closeErr) && !errors.As(err, &closed) {
+		return &WebSocketClosedError{Code: closeErr.Code, Reason: closeErr.Text, Cause: err}
+	}
+	return err
+}
+
+// maxErrorMessageLength limits the length in bytes of error messages taken from the body of an ERROR frame
+// or flattened into the message header of a local one.
+const maxErrorMessageLength = 256
+
+// BrokerError is an ERROR frame sent by the broker.
+type BrokerError struct {
+	// Message is the message header, or the first line of the body, truncated, when the header is absent or empty
+	Message  string
+	Header   string // the message header as sent
+	Body     string
+	Frame    *Frame
+	Category ErrorCategory // set by the error rules of the client
+}
+
+func newBrokerError(frame *Frame, rules []ErrorRule) *BrokerError {
+	header, _ := frame.Contains(Message)
+	body := frame.BodyString()
+	return &BrokerError{
+		Message:  errorMessage(header, body),
+		Header:   header,
+		Body:     body,
+		Frame:    frame,
+		Category: classify(rules, header, body),
+	}
+}
+
+// errorMessage returns header, or the first non-blank line of body when header is blank. Some brokers send
+// ERROR frames with all the detail in the body.
+func errorMessage(header, body string) string {
+	if strings.TrimSpace(header) != "" {
+		return header
+	}
+	for _, line := range strings.Split(body, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			return truncateMessage(line)
+		}
+	}
+	return ""
+}
+
+// truncateMessage cuts message to maxErrorMessageLength bytes without splitting a UTF-8 sequence.
+func truncateMessage(message string) string {
+	if len(message) <= maxErrorMessageLength {
+		return message
+	}
+	end := maxErrorMessageLength
+	for end > 0 && !utf8.RuneStart(message[end]) {
+		end--
+	}
+	return message[:end]
+}
+
+// ConnectRejectedError is returned by connect when the broker answers CONNECT with an ERROR frame, for example
+// for an expired token or an unknown virtual host. It wraps the *BrokerError of the frame.
+type ConnectRejectedError struct {
+	Message     string // the message header
+	Body        string
+	ContentType string // the content-type header
+	Broker      *BrokerError
+}
+
+func newConnectRejectedError(brokerErr *BrokerError) *ConnectRejectedError {
+	contentType, _ := brokerErr.Frame.Contains(ContentType)
+	return &ConnectRejectedError{Message: brokerErr.Header, Body: brokerErr.Body, ContentType: contentType, Broker: brokerErr}
+}
+
+func (e *ConnectRejectedError) Error() string {
+	return "CONNECT rejected, " + e.Broker.Error()
+}
+
+func (e *ConnectRejectedError) Unwrap() error {
+	return e.Broker
+}
+
+func (e *BrokerError) Error() string {
+	switch {
+	case e.Body == "":
+		return "broker error: " + e.Message
+	case e.Header == "" && strings.HasPrefix(strings.TrimSpace(e.Body), e.Message):
+		// the message is taken from the body
+		return "broker error: " + e.Body
+	}
+	return "broker error: " + e.Message + "\n" + e.Body
+}
@@ -0,0 +1,64 @@
+package go_stomp_websocket
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewBrokerError(t *testing.T) {
+	long := strings.Repeat("é", maxErrorMessageLength)
+	tests := []struct {
+		name     string
+		headers  []string
+		body     string
+		message  string
+		header   string
+		errorMsg string
+	}{
+		{name: "header only", headers: []string{"message:Access denied"}, message: "Access denied",
+			header: "Access denied", errorMsg: "broker error: Access denied"},
+		{name: "body only", body: "AMQ229031: Unable to validate user\nfrom /10.0.0.1", message: "AMQ229031: Unable to validate user",
+			errorMsg: "broker error: AMQ229031: Unable to validate user\nfrom /10.0.0.1"},
+		{name: "empty header", headers: []string{"message:"}, body: "\n  queue not found  \n", message: "queue not found",
+			errorMsg: "broker error: \n  queue not found  \n"},
+		{name: "both", headers: []string{"message:Access denied"}, body: "missing scope", message: "Access denied",
+			header: "Access denied", errorMsg: "broker error: Access denied\nmissing scope"},
+		{name: "neither", errorMsg: "broker error: "},
+		{name: "long body line", body: long, message: long[:maxErrorMessageLength], errorMsg: "broker error: " + long},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := newBrokerError(createTestFrame(ERROR, tt.headers, tt.body), defaultErrorRules)
+			assert.Equal(t, tt.message, err.Message)
+			assert.Equal(t, tt.header, err.Header)
+			assert.Equal(t, tt.body, err.Body)
+			assert.Equal(t, tt.errorMsg, err.Error())
+		})
+	}
+}
+
+func TestNewBrokerError_ClassifiesBody(t *testing.T) {
+	frame := createTestFrame(ERROR, nil, "subscription limit exceeded")
+	assert.Equal(t, CategoryQuotaExceeded, newBrokerError(frame, defaultErrorRules).Category)
+}
+
+func TestSentinelErrors_MatchGeneralOnes(t *testing.T) {
+	tests := []struct {
+		err     error
+		general error
+	}{
+		{err: ErrClientClosed, general: ErrNotConnected},
+		{err: ErrDisconnectTimeout, general: ErrReceiptTimeout},
+	}
+	for _, tt := range tests {
+		t.Run(tt.err.Error(), func(t *testing.T) {
+			assert.ErrorIs(t, tt.err, tt.general)
+			assert.ErrorIs(t, fmt.Errorf("wrapped: %w", tt.err), tt.general)
+			assert.False(t, errors.Is(tt.general, tt.err))
+		})
+	}
+}
@@ -0,0 +1,235 @@
+package go_stomp_websocket
+
+import (
+	"bytes"
+	"sync"
+	"sync/atomic"
+)
+
+// RawHandler receives the destination and body of a MESSAGE frame of a SubscribeRaw subscription.
+// body is only valid until the handler returns, destination may be kept.
+type RawHandler func(destination string, body []byte)
+
+// poisonByte overwrites the bodies passed to a RawHandler once it returns when WithBufferPoisoning is set.
+const poisonByte = 0xDB
+
+var messagePrefix = []byte(MESSAGE + "\n")
+
+// readBuffers holds the buffers the read loop reads websocket messages into while SubscribeRaw subscriptions
+// exist. A buffer goes back once no frame refers to its message.
+var readBuffers = sync.Pool{New: func() any { return new(bytes.Buffer) }}
+
+type rawRoute struct {
+	topic string
+	fn    RawHandler
+}
+
+// rawRoutes holds the SubscribeRaw subscriptions of a client. The read loop calls their handlers for the MESSAGE
+// frames it reads instead of building frames for processLoop.
+type rawRoutes struct {
+	mutex   sync.RWMutex
+	routes  map[string]*rawRoute
+	count   atomic.Int32
+	poison  bool
+	escaped bool // the negotiated version escapes headers, set before the read loop starts
+	metrics MetricsCollector
+}
+
+func newRawRoutes(poison bool, metrics MetricsCollector) *rawRoutes {
+	return &rawRoutes{routes: make(map[string]*rawRoute), poison: poison, metrics: metrics}
+}
+
+func (routes *rawRoutes) add(id SubscriptionID, route *rawRoute) {
+	routes.mutex.Lock()
+	defer routes.mutex.Unlock()
+	routes.routes[string(id)] = route
+	routes.count.Store(int32(len(routes.routes)))
+}
+
+func (routes *rawRoutes) remove(id SubscriptionID) {
+	routes.mutex.Lock()
+	defer routes.mutex.Unlock()
+	delete(routes.routes, string(id))
+	routes.count.Store(int32(len(routes.routes)))
+}
+
+// active tells whether any SubscribeRaw subscription exists, without locking.
+func (routes *rawRoutes) active() bool {
+	return routes != nil && routes.count.Load() > 0
+}
+
+func (routes *rawRoutes) lookup(id []byte) *rawRoute {
+	routes.mutex.RLock()
+	defer routes.mutex.RUnlock()
+	return routes.routes[string(id)]
+}
+
+// dispatch calls the handler of the MESSAGE frame at the start of buf if it belongs to a SubscribeRaw subscription
+// and returns the number of bytes the frame occupies. It returns 0 for anything else, including incomplete and
+// invalid frames, which are left to parseRawFrame.
+func (routes *rawRoutes) dispatch(buf []byte, maxBodySize int64) int {
+	subscription, destination, body, n, ok := scanMessage(buf, maxBodySize)
+	if !ok {
+		return 0
+	}
+	route := routes.lookup(subscription)
+	if route == nil {
+		return 0
+	}
+	routes.metrics.FrameReceived(MESSAGE, n)
+	if routes.escaped && bytes.IndexByte(destination, '\\') >= 0 {
+		destination = []byte(unescapeHeader(string(destination)))
+	}
+	route.call(destination, body, routes.poison)
+	return n
+}
+
+// deliver calls the handler of a MESSAGE frame that dispatch did not see, which happens for SockJS messages
+// that are not valid JSON. It returns false if the frame does not belong to a SubscribeRaw subscription.
+func (routes *rawRoutes) deliver(frame *Frame) bool {
+	if !routes.active() || frame.Command != MESSAGE {
+		return false
+	}
+	id, _ := frame.Contains(Subscription_h)
+	route := routes.lookup([]byte(id))
+	if route == nil {
+		return false
+	}
+	destination, _ := frame.Contains("destination")
+	route.call([]byte(destination), frame.body, routes.poison)
+	return true
+}
+
+func (route *rawRoute) call(destination, body []byte, poison bool) {
+	if string(destination) == route.topic {
+		route.fn(route.topic, body)
+	} else {
+		route.fn(string(destination), body)
+	}
+	if poison {
+		for i := range body {
+			body[i] = poisonByte
+		}
+	}
+}
+
+// scanMessage reads the subscription and destination headers and the body of a complete MESSAGE frame at the
+// start of buf without allocating. ok is false if buf does not start with a complete valid MESSAGE frame.
+func scanMessage(buf []byte, maxBodySize int64) (subscription, destination, body []byte, n int, ok bool) {
+	if !bytes.HasPrefix(buf, messagePrefix) {
+		return nil, nil, nil, 0, false
+	}
+	pos := len(messagePrefix)
+	bodyLength := -1
+	var haveSubscription, haveDestination, haveLength bool
+	for {
+		end := bytes.IndexByte(buf[pos:], '\n')
+		if end < 0 {
+			return nil, nil, nil, 0, false
+		}
+		line := buf[pos : pos+end]
+		pos += end + 1
+		if len(line) > 0 && line[len(line)-1] == '\r' {
+			line = line[:len(line)-1]
+		}
+		if len(line) == 0 {
+			break
+		}
+		key, value, found := bytes.Cut(line, []byte(":"))
+		if !found {
+			continue
+		}
+		// the first occurrence of a header wins, as with Frame.Contains
+		switch {
+		case !haveSubscription && string(key) == Subscription_h:
+			subscription, haveSubscription = value, true
+		case !haveDestination && string(key) == "destination":
+			destination, haveDestination = value, true
+		case !haveLength && string(key) == contentLength:
+			if bodyLength, ok = parseLength(value); !ok || maxBodySize > 0 && int64(bodyLength) > maxBodySize {
+				return nil, nil, nil, 0, false
+			}
+			haveLength = true
+		}
+	}
+	if !haveSubscription {
+		return nil, nil, nil, 0, false
+	}
+	if bodyLength >= 0 {
+		if len(buf)-pos < bodyLength+1 || buf[pos+bodyLength] != 0 {
+			return nil, nil, nil, 0, false
+		}
+		return subscription, destination, buf[pos : pos+bodyLength], pos + bodyLength + 1, true
+	}
+	end := bytes.IndexByte(buf[pos:], 0)
+	if end < 0 || maxBodySize > 0 && int64(end) > maxBodySize {
+		return nil, nil, nil, 0, false
+	}
+	return subscription, destination, buf[pos : pos+end], pos + end + 1, true
+}
+
+// parseLength parses a content-length value the way strconv.Atoi does for non-negative numbers.
+func parseLength(value []byte) (int, bool) {
+	if len(value) == 0 || len(value) > 18 {
+		return 0, false
+	}
+	length := 0
+	for _, c := range value {
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+		length = length*10 + int(c-'0')
+	}
+	return length, true
+}
+
+// SubscribeRaw subscribes to topic and calls fn for every MESSAGE frame of the subscription, bypassing FrameCh.
+// fn runs in the read loop of the client and gets the body as a slice of the buffer the websocket message was
+// read into, without a Frame or a header map being built. The slice is only valid until fn returns and the
+// buffer is reused afterwards; fn must copy whatever it keeps. WithBufferPoisoning overwrites the body after
+// every call, so that a handler breaking this rule sees garbage in tests. fn blocks reading from the connection
+// while it runs, so it should be fast.
+//
+// The destination is the topic string itself when the frame is for the subscribed topic.
+// Subscription middleware, body checksums and chunk reassembly do not apply to raw subscriptions, and their
+// frames are not traced. FrameCh only receives the ERROR frame that closes the connection.
+func (stompClient StompClient) SubscribeRaw(topic string, fn RawHandler) (*Subscription, error) {
+	if stompClient.rawRoutes == nil {
+		return nil, ErrClientClosed
+	}
+	if err := stompClient.checkDraining(); err != nil {
+		return nil, err
+	}
+	subscriptionId := stompClient.newID()
+	frame, err := NewSubscribeFrame(subscriptionId, topic, "")
+	if err != nil {
+		return nil, err
+	}
+	id := SubscriptionID(subscriptionId)
+	// buffered, so that processLoop never waits to hand over the closing ERROR frame
+	ch := make(chan *Frame, 1)
+	subscription := &Subscription{
+		stompClient:    stompClient,
+		id:             id,
+		SubscriptionId: subscriptionId,
+		FrameCh:        ch,
+		Topic:          topic,
+		errorCh:        make(chan error, subscriptionErrorBuffer),
+		errors:         &atomic.Uint64{},
+		dropped:        &atomic.Uint64{},
+		unsubscribed:   newUnsubscribeSignal(),
+		messages:       &messageFeed{},
+	}
+	subscription.current.Store(&ch)
+	if err := stompClient.register(subscription, frame); err != nil {
+		return nil, err
+	}
+	stompClient.rawRoutes.add(id, &rawRoute{topic: topic, fn: fn})
+	if err := stompClient.enqueue(writeRequest{Frame: frame, C: ch}); err != nil {
+		stompClient.rawRoutes.remove(id)
+		stompClient.registry.remove(id)
+		return nil, err
+	}
+	stompClient.registered(id)
+	return subscription, nil
+}
@@ -0,0 +1,174 @@
+package go_stomp_websocket
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScanMessage(t *testing.T) {
+	tests := []struct {
+		name         string
+		input        string
+		maxBodySize  int64
+		ok           bool
+		subscription string
+		destination  string
+		body         string
+		rest         string
+	}{
+		{name: "nul terminated", input: "MESSAGE\nsubscription:s1\ndestination:/topic/a\n\nhello\x00rest", ok: true,
+			subscription: "s1", destination: "/topic/a", body: "hello", rest: "rest"},
+		{name: "content-length", input: "MESSAGE\ndestination:/topic/a\ncontent-length:3\nsubscription:s1\n\na\x00b\x00", ok: true,
+			subscription: "s1", destination: "/topic/a", body: "a\x00b"},
+		{name: "crlf", input: "MESSAGE\r\nsubscription:s1\r\n\r\nhi\x00", ok: false},
+		{name: "crlf headers", input: "MESSAGE\nsubscription:s1\r\ndestination:/d\r\n\r\nhi\x00", ok: true,
+			subscription: "s1", destination: "/d", body: "hi"},
+		{name: "first header wins", input: "MESSAGE\nsubscription:s1\nsubscription:s2\n\n\x00", ok: true,
+			subscription: "s1"},
+		{name: "incomplete headers", input: "MESSAGE\nsubscription:s1\n", ok: false},
+		{name: "incomplete body", input: "MESSAGE\nsubscription:s1\n\nhello", ok: false},
+		{name: "short content-length body", input: "MESSAGE\nsubscription:s1\ncontent-length:10\n\nhello\x00", ok: false},
+		{name: "invalid content-length", input: "MESSAGE\nsubscription:s1\ncontent-length:x\n\nhello\x00", ok: false},
+		{name: "content-length too large", input: "MESSAGE\nsubscription:s1\ncontent-length:5\n\nhello\x00", maxBodySize: 4, ok: false},
+		{name: "body too large", input: "MESSAGE\nsubscription:s1\n\nhello\x00", maxBodySize: 4, ok: false},
+		{name: "no subscription", input: "MESSAGE\ndestination:/topic/a\n\nhello\x00", ok: false},
+		{name: "other command", input: "RECEIPT\nreceipt-id:1\n\n\x00", ok: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := []byte(tt.input)
+			subscription, destination, body, n, ok := scanMessage(input, tt.maxBodySize)
+			assert.Equal(t, tt.ok, ok)
+			if !tt.ok {
+				return
+			}
+			assert.Equal(t, tt.subscription, string(subscription))
+			assert.Equal(t, tt.destination, string(destination))
+			assert.Equal(t, tt.body, string(body))
+			assert.Equal(t, tt.rest, string(input[n:]))
+		})
+	}
+}
+
+type rawDelivery struct {
+	destination string
+	body        string
+	retained    []byte
+}
+
+// startRawWSServer starts a test server that answers the first SUBSCRIBE with messages, a SockJS message
+// per element of messages, each built by the function from the subscription id
+func startRawWSServer(t *testing.T, messages ...func(id string) string) *httptest.Server {
+	t.Helper()
+	ts := startScriptedWSServer(t, func(c *websocket.Conn) {
+		_, data, err := c.ReadMessage()
+		if err != nil {
+			return
+		}
+		id, _ := ReadFrame(data).Contains(Id)
+		for _, message := range messages {
+			_ = c.WriteMessage(websocket.TextMessage, []byte(message(id)))
+		}
+		_, _, _ = c.ReadMessage()
+	})
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func receiveRawDeliveries(t *testing.T, ch chan rawDelivery, count int) []rawDelivery {
+	t.Helper()
+	var deliveries []rawDelivery
+	for len(deliveries) < count {
+		select {
+		case delivery := <-ch:
+			deliveries = append(deliveries, delivery)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("received %d raw deliveries, expected %d", len(deliveries), count)
+		}
+	}
+	return deliveries
+}
+
+func TestSubscribeRaw(t *testing.T) {
+	ts := startRawWSServer(t,
+		func(id string) string {
+			return `a["MESSAGE\nsubscription:` + id + `\ndestination:/topic/a\n\none\u0000",` +
+				`"MESSAGE\nsubscription:` + id + `\ndestination:/topic/a.b\ncontent-length:3\n\ntwo\u0000"]`
+		},
+		// invalid UTF-8, left to encoding/json and delivered by route
+		func(id string) string {
+			return `a["MESSAGE\nsubscription:` + id + `\ndestination:/topic/a\nx-note:a` + "\xff" + `b\n\nthree\u0000"]`
+		},
+	)
+	client, err := ConnectWithToken(wsURL(ts), websocket.Dialer{}, "token")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer client.Disconnect()
+	ch := make(chan rawDelivery, 3)
+	subscription, err := client.SubscribeRaw("/topic/a", func(destination string, body []byte) {
+		ch <- rawDelivery{destination: destination, body: string(body)}
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, []rawDelivery{
+		{destination: "/topic/a", body: "one"},
+		{destination: "/topic/a.b", body: "two"},
+		{destination: "/topic/a", body: "three"},
+	}, receiveRawDeliveries(t, ch, 3))
+	assert.Equal(t, 0, subscription.Pending())
+}
+
+func TestSubscribeRaw_BufferPoisoning(t *testing.T) {
+	for _, poison := range []bool{false, true} {
+		routes := newRawRoutes(poison, nopMetrics{})
+		var retained [][]byte
+		routes.add("s1", &rawRoute{topic: "/topic/a", fn: func(_ string, body []byte) {
+			// breaks the ownership rule on purpose
+			retained = append(retained, body)
+		}})
+		routes.dispatch([]byte("MESSAGE\nsubscription:s1\n\nsecret\x00"), 0)
+		routes.deliver(createTestFrame(MESSAGE, []string{"subscription:s1"}, "secret"))
+		expected := []byte("secret")
+		if poison {
+			expected = bytes.Repeat([]byte{poisonByte}, len("secret"))
+		}
+		assert.Equal(t, [][]byte{expected, expected}, retained)
+	}
+}
+
+func TestSubscribeRaw_IgnoredAfterUnsubscribe(t *testing.T) {
+	routes := newRawRoutes(false, nopMetrics{})
+	calls := 0
+	routes.add("s1", &rawRoute{topic: "/topic/a", fn: func(string, []byte) { calls++ }})
+	message := []byte("MESSAGE\nsubscription:s1\n\nbody\x00")
+	assert.Equal(t, len(message), routes.dispatch(message, 0))
+	routes.remove("s1")
+	assert.False(t, routes.active())
+	assert.Equal(t, 0, routes.dispatch(message, 0))
+	assert.Equal(t, 1, calls)
+}
+
+func BenchmarkParseFrame_Raw(b *testing.B) {
+	input := typical1KBMessage()
+	routes := newRawRoutes(false, nopMetrics{})
+	routes.add("7a6c1c4e-6b3f-4b9e-9f0e-1f5f0c6a2d11", &rawRoute{topic: "/topic/tenant-changed", fn: func(string, []byte) {}})
+	client := &StompClient{splitter: &rawFrameSplitter{routes: routes}, rawRoutes: routes}
+	data := make([]byte, len(input))
+	b.ReportAllocs()
+	b.SetBytes(int64(len(input)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		copy(data, input) // the read loop reads every message into a recycled buffer
+		frames, err := client.readFrames(data)
+		if err != nil || len(frames) != 0 {
+			b.Fatalf("readFrames returned %d frames, error %v", len(frames), err)
+		}
+	}
+}
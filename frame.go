@@ -1,7 +1,12 @@
 package go_stomp_websocket
 
 import (
+	"bytes"
+	"fmt"
+	"strconv"
 	"strings"
+	"sync"
+	"unicode/utf8"
 )
 
 const (
@@ -14,11 +19,19 @@ const (
 
 const (
 	// Connect commands.
-	CONNECT = "CONNECT"
+	CONNECT   = "CONNECT"
+	STOMP     = "STOMP"
+	CONNECTED = "CONNECTED"
 
 	// Client commands.
+	SEND        = "SEND"
 	SUBSCRIBE   = "SUBSCRIBE"
 	UNSUBSCRIBE = "UNSUBSCRIBE"
+	ACK         = "ACK"
+	NACK        = "NACK"
+	BEGIN       = "BEGIN"
+	COMMIT      = "COMMIT"
+	ABORT       = "ABORT"
 	DISCONNECT  = "DISCONNECT"
 
 	// Server commands.
@@ -27,10 +40,14 @@ const (
 	ERROR   = "ERROR"
 )
 
+// Frame is a STOMP frame.
+//
+// Breaking change: the body used to be the exported string field Body. It is stored as []byte now and is read
+// with Body or BodyString and written with SetBody.
 type Frame struct {
 	Command string
 	Headers []string
-	Body    string
+	body    []byte
 }
 
 func CreateFrame(command string, headers []string) *Frame {
@@ -41,45 +58,135 @@ func CreateFrame(command string, headers []string) *Frame {
 	return frame
 }
 
+// Body returns the frame body. The slice is shared with the frame, not copied.
+func (frame *Frame) Body() []byte {
+	return frame.body
+}
+
+// BodyString returns a copy of the frame body as a string.
+func (frame *Frame) BodyString() string {
+	return string(frame.body)
+}
+
+// SetBody sets the frame body without copying it.
+func (frame *Frame) SetBody(body []byte) {
+	if len(body) == 0 {
+		body = nil
+	}
+	frame.body = body
+}
+
 func ReadFrame(data []byte) *Frame {
 	frame := &Frame{}
-	s := string(data)[3 : len(data)-2]
-	s = strings.ReplaceAll(s, "\\"+"n", "\n")
-	s = strings.ReplaceAll(s, "\\"+"\"", "\"")
-	s = strings.ReplaceAll(s, "\\"+"u0000", "\u0000")
-	sArray := strings.Split(s, "\n")
-	frame.Command = sArray[0]
-	isBody := false
-	for i := 1; i < len(sArray); i++ {
-		//read headers
-		if sArray[i] != "" && !isBody {
-			frame.Headers = append(frame.Headers, sArray[i])
-		} else {
+	b := data[3 : len(data)-2]
+	b = bytes.ReplaceAll(b, []byte("\\"+"n"), []byte("\n"))
+	b = bytes.ReplaceAll(b, []byte("\\"+"\""), []byte("\""))
+	b = bytes.ReplaceAll(b, []byte("\\"+"u0000"), []byte("\u0000"))
+	line, rest, _ := bytes.Cut(b, []byte("\n"))
+	frame.Command = string(line)
+	for len(rest) > 0 {
+		line, next, found := bytes.Cut(rest, []byte("\n"))
+		if len(line) == 0 {
 			//read body
-			isBody = true
-			frame.Body = strings.Trim(sArray[i], "\u0000")
+			frame.SetBody(readBody(frame, next))
+			break
 		}
+		//read headers
+		frame.Headers = append(frame.Headers, string(line))
+		if !found {
+			break
+		}
+		rest = next
 	}
 	return frame
 }
 
+// readBody returns exactly content-length bytes when the header is valid, so that NULs inside the body survive,
+// and the bytes up to the first NUL otherwise, dropping any EOLs the server sent after it.
+func readBody(frame *Frame, rest []byte) []byte {
+	if value, ok := frame.Contains(contentLength); ok {
+		if length, err := strconv.Atoi(value); err == nil && length >= 0 && length <= len(rest) {
+			return rest[:length]
+		}
+	}
+	rest = bytes.TrimLeft(rest, "\u0000")
+	if end := bytes.IndexByte(rest, 0); end >= 0 {
+		return rest[:end]
+	}
+	return rest
+}
+
+// checkBodySize reports frames whose content-length header or body is larger than maxBodySize.
+// Zero means no limit.
+func checkBodySize(frame *Frame, maxBodySize int64) error {
+	if maxBodySize <= 0 {
+		return nil
+	}
+	if value, ok := frame.Contains(contentLength); ok {
+		if length, err := strconv.ParseInt(value, 10, 64); err == nil && length > maxBodySize {
+			return fmt.Errorf("%w: content-length %d of %s frame is larger than %d bytes", ErrFrameTooLarge, length, frame.Command, maxBodySize)
+		}
+	}
+	if int64(len(frame.body)) > maxBodySize {
+		return fmt.Errorf("%w: body of %s frame is %d bytes, larger than %d bytes", ErrFrameTooLarge, frame.Command, len(frame.body), maxBodySize)
+	}
+	return nil
+}
+
 func (frame *Frame) Bytes() []byte {
-	var resultSlice []string
-	resultSlice = append(resultSlice, "[\"")
-	resultSlice = append(resultSlice, frame.Command+"\\n")
+	var buf bytes.Buffer
+	frame.writeSockJS(&buf)
+	return buf.Bytes()
+}
+
+// writeSockJS writes the frame as the SockJS array message Bytes returns.
+func (frame *Frame) writeSockJS(buf *bytes.Buffer) {
+	buf.Grow(len(frame.Command) + len(frame.body) + 16 + len(frame.Headers)*32)
+	buf.WriteByte('[')
+	frame.writeSockJSElement(buf)
+	buf.WriteByte(']')
+}
+
+// writeSockJSElement writes the frame as a string element of a SockJS array message, JSON escaped like
+// encoding/json does. Invalid UTF-8 is replaced with U+FFFD, which changes the body; the send functions reject
+// such frames with ErrInvalidUTF8 before.
+func (frame *Frame) writeSockJSElement(buf *bytes.Buffer) {
+	buf.WriteByte('"')
+	buf.Write(appendJSONString(buf.AvailableBuffer(), frame.Command))
+	buf.WriteString("\\n")
 	for _, header := range frame.Headers {
-		resultSlice = append(resultSlice, header+"\\n")
+		buf.Write(appendJSONString(buf.AvailableBuffer(), header))
+		buf.WriteString("\\n")
 	}
-	resultSlice = append(resultSlice, "\\n")
-	resultSlice = append(resultSlice, frame.Body)
-	resultSlice = append(resultSlice, "\\u0000\"]")
-	result := strings.Join(resultSlice, "")
-	return []byte(result)
+	buf.WriteString("\\n")
+	buf.Write(appendJSONString(buf.AvailableBuffer(), frame.body))
+	buf.WriteString("\\u0000\"")
 }
 
+// validUTF8 reports whether the command, headers and body of the frame are valid UTF-8, so writeSockJSElement
+// writes them unchanged.
+func (frame *Frame) validUTF8() bool {
+	if !utf8.ValidString(frame.Command) || !utf8.Valid(frame.body) {
+		return false
+	}
+	for _, header := range frame.Headers {
+		if !utf8.ValidString(header) {
+			return false
+		}
+	}
+	return true
+}
+
+// frameBuffers holds the buffers writeFrame serializes frames into. The websocket connection copies the message,
+// so a buffer is reused as soon as the write returns.
+var frameBuffers = sync.Pool{New: func() any { return new(bytes.Buffer) }}
+
 func (frame *Frame) Contains(header string) (string, bool) {
 	for _, frameHeader := range frame.Headers {
 		index := strings.Index(frameHeader, ":")
+		if index < 0 {
+			continue
+		}
 		key := frameHeader[:index]
 		if key == header {
 			value := frameHeader[index+1:]
@@ -1,9 +1,11 @@
 package go_stomp_websocket
 
 import (
+	"encoding/json"
 	"strings"
 	"testing"
 
+	"github.com/gorilla/websocket"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -69,6 +71,11 @@ func TestReadFrame(t *testing.T) {
 			input: createTestInput("CONNECTED", nil, "body"),
 			want:  createTestFrame("CONNECTED", nil, "body"),
 		},
+		{
+			name:  "frame with content-length keeps NUL in body",
+			input: createTestInput("ERROR", []string{"content-length:3"}, `a\u0000b`),
+			want:  createTestFrame("ERROR", []string{"content-length:3"}, "a\x00b"),
+		},
 	}
 
 	for _, tt := range tests {
@@ -92,7 +99,7 @@ func TestFrame_Bytes(t *testing.T) {
 		{
 			name:     "normal frame",
 			frame:    createTestFrame("CONNECTED", []string{"version:1.2", "heart-beat:1000,1000"}, `{"test": "json"}`),
-			expected: `["CONNECTED\nversion:1.2\nheart-beat:1000,1000\n\n{"test": "json"}\u0000"]`,
+			expected: `["CONNECTED\nversion:1.2\nheart-beat:1000,1000\n\n{\"test\": \"json\"}\u0000"]`,
 		},
 		{
 			name:     "frame with empty body",
@@ -106,8 +113,8 @@ func TestFrame_Bytes(t *testing.T) {
 		},
 		{
 			name:     "frame with special characters",
-			frame:    createTestFrame("CONNECTED", []string{"header:value"}, "body"),
-			expected: `["CONNECTED\nheader:value\n\nbody\u0000"]`,
+			frame:    createTestFrame("CONNECTED", []string{`header:a\cb`}, "line1\nline2\t\x01\u2028"),
+			expected: `["CONNECTED\nheader:a\\cb\n\nline1\nline2\t\u0001\u2028\u0000"]`,
 		},
 	}
 
@@ -119,6 +126,27 @@ func TestFrame_Bytes(t *testing.T) {
 	}
 }
 
+func TestFrame_Bytes_JSONRoundTrip(t *testing.T) {
+	bodies := []string{
+		`{"a":"line1` + "\n" + `line2"}`,
+		`C:\temp\"x"`,
+		"\x00\x01\b\f\r\t\x1f",
+		"a\u2028b\u2029c 🙂",
+	}
+	for _, body := range bodies {
+		frame, err := NewSendFrame("/queue/a", []byte(body))
+		if !assert.NoError(t, err) {
+			continue
+		}
+		encoded := frame.Bytes()
+		assert.True(t, json.Valid(encoded), "%q", encoded)
+		var elements []string
+		if assert.NoError(t, json.Unmarshal(encoded, &elements)) && assert.Len(t, elements, 1) {
+			assert.Equal(t, string(frame.rawBytes()), elements[0])
+		}
+	}
+}
+
 func TestFrame_Contains(t *testing.T) {
 	tests := []struct {
 		name          string
@@ -173,14 +201,110 @@ func TestFrame_Contains(t *testing.T) {
 	}
 }
 
+func TestFrame_Body(t *testing.T) {
+	frame := CreateFrame(MESSAGE, nil)
+	assert.Nil(t, frame.Body())
+	assert.Equal(t, "", frame.BodyString())
+
+	body := []byte("payload")
+	frame.SetBody(body)
+	assert.Equal(t, "payload", frame.BodyString())
+	body[0] = 'P'
+	assert.Equal(t, "Payload", string(frame.Body()), "Body must share the slice passed to SetBody")
+}
+
+func TestReadFrame_MultiLineBody(t *testing.T) {
+	frame := ReadFrame([]byte(`a["MESSAGE\nsubscription:1\n\nline1\nline2\n\nline4\u0000"]`))
+	assert.Equal(t, []string{"subscription:1"}, frame.Headers)
+	assert.Equal(t, "line1\nline2\n\nline4", frame.BodyString())
+}
+
+func BenchmarkReadFrame_1MB(b *testing.B) {
+	input := createTestInput(MESSAGE, []string{"subscription:1", "destination:/topic/test"}, strings.Repeat("x", 1<<20))
+	b.ReportAllocs()
+	b.SetBytes(int64(len(input)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ReadFrame(input)
+	}
+}
+
+func BenchmarkFrameBytes_1MB(b *testing.B) {
+	frame := createTestFrame(MESSAGE, []string{"subscription:1", "destination:/topic/test"}, strings.Repeat("x", 1<<20))
+	b.ReportAllocs()
+	b.SetBytes(int64(len(frame.Body())))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		frame.Bytes()
+	}
+}
+
+// typical1KBMessage is a SockJS message carrying a MESSAGE frame with a 1KB body.
+func typical1KBMessage() []byte {
+	return createTestInput(MESSAGE, []string{
+		"destination:/topic/tenant-changed",
+		"content-type:application/json",
+		"subscription:7a6c1c4e-6b3f-4b9e-9f0e-1f5f0c6a2d11",
+		"message-id:T_7a6c1c4e-6b3f-4b9e-9f0e-1f5f0c6a2d11@@session-abc@@42",
+		"content-length:1024",
+	}, strings.Repeat("x", 1024))
+}
+
+func BenchmarkParseFrame(b *testing.B) {
+	input := typical1KBMessage()
+	client := &StompClient{splitter: &rawFrameSplitter{}}
+	data := make([]byte, len(input))
+	b.ReportAllocs()
+	b.SetBytes(int64(len(input)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		copy(data, input) // the read loop gets a new message every time
+		frames, err := client.readFrames(data)
+		if err != nil || len(frames) != 1 {
+			b.Fatalf("readFrames returned %d frames, error %v", len(frames), err)
+		}
+	}
+}
+
+func BenchmarkWriteFrame(b *testing.B) {
+	ts := startScriptedWSServer(b, func(c *websocket.Conn) {
+		for {
+			if _, _, err := c.NextReader(); err != nil {
+				return
+			}
+		}
+	})
+	defer ts.Close()
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http"), nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer conn.Close()
+	client := &StompClient{connection: conn, logger: NopLogger(), metrics: nopMetrics{}}
+	frame := createTestFrame(SEND, []string{
+		"destination:/topic/tenant-changed",
+		"content-type:application/json",
+		"content-length:1024",
+	}, strings.Repeat("x", 1024))
+	b.ReportAllocs()
+	b.SetBytes(int64(len(frame.Body())))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := client.writeFrame(frame); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
 //-----------------------------------------------------------------------------------
 
 func createTestFrame(command string, headers []string, body string) *Frame {
-	return &Frame{
+	frame := &Frame{
 		Command: command,
 		Headers: headers,
-		Body:    body,
 	}
+	frame.SetBody([]byte(body))
+	return frame
 }
 
 func createTestInput(command string, headers []string, body string) []byte {
@@ -195,3 +319,32 @@ func createTestInput(command string, headers []string, body string) []byte {
 	result = append(result, "\\u0000\"]")
 	return []byte(strings.Join(result, ""))
 }
+
+func TestCheckBodySize(t *testing.T) {
+	tests := []struct {
+		name    string
+		frame   *Frame
+		max     int64
+		wantErr bool
+	}{
+		{name: "no limit", frame: createTestFrame(MESSAGE, nil, "0123456789"), max: 0},
+		{name: "body within limit", frame: createTestFrame(MESSAGE, nil, "0123456789"), max: 10},
+		{name: "body over limit", frame: createTestFrame(MESSAGE, nil, "0123456789"), max: 9, wantErr: true},
+		{name: "content-length over limit", frame: createTestFrame(MESSAGE, []string{"content-length:100"}, "0"), max: 10, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkBodySize(tt.frame, tt.max)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrFrameTooLarge)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestReadFrame_TrailingEOLAfterNUL(t *testing.T) {
+	frame := ReadFrame([]byte(`a["MESSAGE\nsubscription:1\n\nbody\u0000\n"]`))
+	assert.Equal(t, "body", frame.BodyString())
+}
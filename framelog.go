@@ -0,0 +1,114 @@
+package go_stomp_websocket
+
+import (
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// DefaultFrameStringBodyLimit is the number of body bytes Frame.String and Frame.Redacted write. Longer bodies are
+// cut and end with the number of bytes left out.
+const DefaultFrameStringBodyLimit = 256
+
+var defaultRedactedHeaderKeys = []string{"Authorization", "passcode", "login"}
+
+// DefaultRedactedHeaderKeys returns the headers whose values Frame.Redacted, Frame.LogValue and the frame trace of
+// a client without WithRedactedHeaders mask, compared case-insensitively.
+func DefaultRedactedHeaderKeys() []string {
+	return slices.Clone(defaultRedactedHeaderKeys)
+}
+
+// frameTrace holds how the client traces frames at debug level, copied from the options at connect.
+type frameTrace struct {
+	bodyLimit       int
+	redactedHeaders []string
+}
+
+// WithTraceBodyLimit makes the frame trace of the client write up to limit body bytes of every frame; a negative
+// limit writes whole bodies. The default 0 leaves the bodies out.
+func WithTraceBodyLimit(limit int) ConnectOption {
+	return func(options *connectOptions) {
+		options.trace.bodyLimit = limit
+	}
+}
+
+// WithRedactedHeaders sets the headers whose values the frame trace of the client masks, compared
+// case-insensitively, in place of DefaultRedactedHeaderKeys.
+func WithRedactedHeaders(keys ...string) ConnectOption {
+	return func(options *connectOptions) {
+		options.trace.redactedHeaders = slices.Clone(keys)
+	}
+}
+
+// String returns the frame as it is sent on the wire, without the NUL terminator and with the body truncated to
+// DefaultFrameStringBodyLimit bytes. Header values are not masked, use Redacted for logs.
+func (frame *Frame) String() string {
+	return frame.format(frame.Headers, DefaultFrameStringBodyLimit)
+}
+
+// Redacted is String with the values of DefaultRedactedHeaderKeys masked.
+func (frame *Frame) Redacted() string {
+	return frame.RedactedWith(DefaultFrameStringBodyLimit, defaultRedactedHeaderKeys)
+}
+
+// RedactedWith is Redacted with the body truncated to bodyLimit bytes, or whole for a negative limit, and the values
+// of redactedHeaders masked.
+func (frame *Frame) RedactedWith(bodyLimit int, redactedHeaders []string) string {
+	return frame.format(maskedHeaders(frame.Headers, redactedHeaders), bodyLimit)
+}
+
+func (frame *Frame) format(headers []string, bodyLimit int) string {
+	var b strings.Builder
+	b.WriteString(frame.Command)
+	b.WriteByte('\n')
+	for _, header := range headers {
+		b.WriteString(header)
+		b.WriteByte('\n')
+	}
+	b.WriteByte('\n')
+	b.WriteString(truncatedBody(frame.body, bodyLimit))
+	return b.String()
+}
+
+// truncatedBody returns the first limit bytes of body followed by the number of bytes left out, or the whole body
+// when it is not longer or limit is negative.
+func truncatedBody(body []byte, limit int) string {
+	if limit < 0 || len(body) <= limit {
+		return string(body)
+	}
+	return string(body[:limit]) + "... (" + strconv.Itoa(len(body)-limit) + " more bytes)"
+}
+
+// LogValue makes slog log the command, the headers with the values of DefaultRedactedHeaderKeys masked, and the
+// body size of the frame, not the body.
+func (frame *Frame) LogValue() slog.Value {
+	headers := make([]any, 0, len(frame.Headers))
+	for _, header := range maskedHeaders(frame.Headers, defaultRedactedHeaderKeys) {
+		key, value, _ := strings.Cut(header, ":")
+		headers = append(headers, slog.String(key, value))
+	}
+	return slog.GroupValue(
+		slog.String("command", frame.Command),
+		slog.Group("headers", headers...),
+		slog.Int("bodySize", len(frame.body)),
+	)
+}
+
+// maskedHeaders returns a copy of the frame headers with the values of the redacted headers masked.
+func maskedHeaders(headers []string, redacted []string) []string {
+	result := make([]string, len(headers))
+	for i, header := range headers {
+		result[i] = header
+		key, _, found := strings.Cut(header, ":")
+		if !found {
+			continue
+		}
+		for _, masked := range redacted {
+			if strings.EqualFold(key, masked) {
+				result[i] = key + ":***"
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,70 @@
+package go_stomp_websocket
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFrame_String(t *testing.T) {
+	tests := []struct {
+		name     string
+		limit    int
+		frame    *Frame
+		expected string
+		redacted string
+	}{
+		{name: "no body", limit: DefaultFrameStringBodyLimit, frame: createTestFrame(SUBSCRIBE, []string{"id:1", "destination:/topic/a"}, ""),
+			expected: "SUBSCRIBE\nid:1\ndestination:/topic/a\n\n", redacted: "SUBSCRIBE\nid:1\ndestination:/topic/a\n\n"},
+		{name: "credentials", limit: DefaultFrameStringBodyLimit, frame: createTestFrame(CONNECT, []string{"login:guest", "passcode:secret", "Authorization:Bearer abc"}, ""),
+			expected: "CONNECT\nlogin:guest\npasscode:secret\nAuthorization:Bearer abc\n\n", redacted: "CONNECT\nlogin:***\npasscode:***\nAuthorization:***\n\n"},
+		{name: "truncated body", limit: 5, frame: createTestFrame(SEND, []string{"destination:/queue/a"}, "hello world"),
+			expected: "SEND\ndestination:/queue/a\n\nhello... (6 more bytes)", redacted: "SEND\ndestination:/queue/a\n\nhello... (6 more bytes)"},
+		{name: "body at the limit", limit: 5, frame: createTestFrame(SEND, nil, "hello"),
+			expected: "SEND\n\nhello", redacted: "SEND\n\nhello"},
+		{name: "no limit", limit: -1, frame: createTestFrame(SEND, nil, "hello world"),
+			expected: "SEND\n\nhello world", redacted: "SEND\n\nhello world"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.limit == DefaultFrameStringBodyLimit {
+				assert.Equal(t, tt.expected, tt.frame.String())
+				assert.Equal(t, tt.redacted, tt.frame.Redacted())
+			}
+			assert.Equal(t, tt.redacted, tt.frame.RedactedWith(tt.limit, DefaultRedactedHeaderKeys()))
+			assert.Equal(t, tt.expected, tt.frame.RedactedWith(tt.limit, nil))
+		})
+	}
+}
+
+func TestDefaultRedactedHeaderKeys_ReturnsCopy(t *testing.T) {
+	keys := DefaultRedactedHeaderKeys()
+	keys[0] = "destination"
+	assert.Equal(t, []string{"Authorization", "passcode", "login"}, DefaultRedactedHeaderKeys())
+	frame := createTestFrame(SEND, []string{"destination:/queue/a", "Authorization:Bearer abc"}, "")
+	assert.Equal(t, "SEND\ndestination:/queue/a\nAuthorization:***\n\n", frame.Redacted())
+}
+
+func TestFrame_LogValue(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+	frame := createTestFrame(SEND, []string{"destination:/queue/a", "Authorization:Bearer abc"}, "hello")
+	logger.Info("frame", "frame", frame)
+
+	var record struct {
+		Frame struct {
+			Command  string            `json:"command"`
+			Headers  map[string]string `json:"headers"`
+			BodySize int               `json:"bodySize"`
+		} `json:"frame"`
+	}
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+	assert.Equal(t, SEND, record.Frame.Command)
+	assert.Equal(t, map[string]string{"destination": "/queue/a", "Authorization": "***"}, record.Frame.Headers)
+	assert.Equal(t, 5, record.Frame.BodySize)
+	assert.False(t, strings.Contains(buf.String(), "hello"))
+}
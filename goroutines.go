@@ -0,0 +1,95 @@
+package go_stomp_websocket
+
+import (
+	"context"
+	"runtime/pprof"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	roleReadLoop    = "read-loop"
+	roleProcessLoop = "process-loop"
+	roleBusFanOut   = "bus-fan-out"
+	roleSupervisor  = "supervisor"
+	roleMessageFeed = "message-feed"
+	roleFrameBridge = "frame-bridge"
+	roleAcker       = "acker"
+)
+
+// GoroutineInfo describes a background goroutine of the client.
+type GoroutineInfo struct {
+	Role      string
+	StartedAt time.Time
+	Uptime    time.Duration
+}
+
+type goroutineTracker struct {
+	mutex   sync.Mutex
+	labels  []string
+	running map[uint64]GoroutineInfo // by instance, several goroutines may have the same role
+	next    uint64
+	logger  Logger
+}
+
+func newGoroutineTracker(clientId, endpoint string, logger Logger) *goroutineTracker {
+	return &goroutineTracker{
+		labels:  []string{"stomp.client", clientId, "stomp.endpoint", endpoint},
+		running: make(map[uint64]GoroutineInfo),
+		logger:  logger,
+	}
+}
+
+// goRole runs fn in a new goroutine tagged with the client pprof labels and role.
+func (tracker *goroutineTracker) goRole(role string, fn func()) {
+	tracker.mutex.Lock()
+	tracker.next++
+	instance := tracker.next
+	tracker.running[instance] = GoroutineInfo{Role: role, StartedAt: time.Now()}
+	tracker.mutex.Unlock()
+	go func() {
+		defer func() {
+			tracker.mutex.Lock()
+			delete(tracker.running, instance)
+			tracker.mutex.Unlock()
+		}()
+		defer func() {
+			if r := recover(); r != nil {
+				tracker.logger.Errorf("[%s] goroutine panicked: %v", role, r)
+				panic(r)
+			}
+		}()
+		labels := pprof.Labels(append(tracker.labels, "stomp.role", role)...)
+		pprof.Do(context.Background(), labels, func(ctx context.Context) {
+			fn()
+		})
+	}()
+}
+
+func (tracker *goroutineTracker) report() []GoroutineInfo {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+	now := time.Now()
+	result := make([]GoroutineInfo, 0, len(tracker.running))
+	for _, info := range tracker.running {
+		info.Uptime = now.Sub(info.StartedAt)
+		result = append(result, info)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Role != result[j].Role {
+			return result[i].Role < result[j].Role
+		}
+		return result[i].StartedAt.Before(result[j].StartedAt)
+	})
+	return result
+}
+
+// GoroutineReport lists the background goroutines currently running for the client, sorted by role and start
+// time. Roles that run per subscription, such as the message feed, are listed once per goroutine.
+func (stompClient StompClient) GoroutineReport() []GoroutineInfo {
+	if stompClient.goroutines == nil {
+		return []GoroutineInfo{}
+	}
+	return stompClient.goroutines.report()
+}
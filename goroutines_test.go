@@ -0,0 +1,80 @@
+package go_stomp_websocket
+
+import (
+	"bytes"
+	"net/url"
+	"runtime/pprof"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGoroutineReport_NotConnected(t *testing.T) {
+	client := &StompClient{}
+	assert.Empty(t, client.GoroutineReport())
+}
+
+func TestGoroutineReport_Lifecycle(t *testing.T) {
+	ts, _ := startTestWSServer(t)
+	defer ts.Close()
+	u, _ := url.Parse(ts.URL)
+	u.Scheme = "ws"
+
+	client, err := ConnectWithToken(*u, websocket.Dialer{}, "token-abc")
+	if err != nil {
+		t.Fatalf("ConnectWithToken failed: %v", err)
+	}
+
+	report := client.GoroutineReport()
+	if assert.Len(t, report, 2) {
+		assert.Equal(t, roleProcessLoop, report[0].Role)
+		assert.Equal(t, roleReadLoop, report[1].Role)
+		for _, info := range report {
+			assert.False(t, info.StartedAt.IsZero())
+			assert.GreaterOrEqual(t, info.Uptime, time.Duration(0))
+		}
+	}
+
+	assert.Eventually(t, func() bool {
+		var profile bytes.Buffer
+		_ = pprof.Lookup("goroutine").WriteTo(&profile, 1)
+		return strings.Contains(profile.String(), `"stomp.role":"`+roleReadLoop+`"`) &&
+			strings.Contains(profile.String(), `"stomp.role":"`+roleProcessLoop+`"`)
+	}, 2*time.Second, 10*time.Millisecond)
+
+	assert.NoError(t, client.Disconnect())
+	assert.Eventually(t, func() bool {
+		return len(client.GoroutineReport()) == 0
+	}, 2*time.Second, 10*time.Millisecond)
+}
+
+func TestGoroutineReport_GoroutinesPerSubscription(t *testing.T) {
+	ts, _, subscribed := startTriggeredPushServer(t)
+	client := connectTestClient(t, ts, WithLogger(NopLogger()))
+	defer client.connection.Close()
+	first, err := client.Subscribe("/topic/a")
+	assert.NoError(t, err)
+	<-subscribed
+	second, err := client.Subscribe("/topic/b")
+	assert.NoError(t, err)
+	<-subscribed
+	first.Messages()
+	second.Messages()
+
+	feeds := func() int {
+		count := 0
+		for _, info := range client.GoroutineReport() {
+			if info.Role == roleMessageFeed {
+				count++
+			}
+		}
+		return count
+	}
+	assert.Equal(t, 2, feeds())
+	first.Unsubscribe()
+	assert.Eventually(t, func() bool { return feeds() == 1 }, 2*time.Second, 10*time.Millisecond)
+	assert.Never(t, func() bool { return feeds() == 0 }, 100*time.Millisecond, 10*time.Millisecond)
+}
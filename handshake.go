@@ -0,0 +1,52 @@
+package go_stomp_websocket
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// awaitConnected reads until the broker answers CONNECT and returns the CONNECTED frame with any frames
+// that arrived in the same message after it. An ERROR frame is returned as *ConnectRejectedError.
+// The wait ends with the context, or with ErrHandshakeTimeout once timeout elapsed when it is positive;
+// the connection is closed to unblock the read then.
+func (stompClient *StompClient) awaitConnected(ctx context.Context, timeout time.Duration) (*Frame, []*Frame, error) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, timeout, ErrHandshakeTimeout)
+		defer cancel()
+	}
+	stop := context.AfterFunc(ctx, func() { stompClient.connection.Close() })
+	connected, pending, err := stompClient.readConnected()
+	if !stop() {
+		return nil, nil, fmt.Errorf("waiting for CONNECTED: %w", context.Cause(ctx))
+	}
+	return connected, pending, err
+}
+
+func (stompClient *StompClient) readConnected() (*Frame, []*Frame, error) {
+	for {
+		messageType, data, err := stompClient.readMessage(nil)
+		if err != nil {
+			return nil, nil, err
+		}
+		frames, err := stompClient.readMessageFrames(messageType, data)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w during STOMP handshake", err)
+		}
+		if len(frames) == 0 {
+			continue
+		}
+		for _, frame := range frames {
+			stompClient.frameReceived(frame)
+		}
+		switch frames[0].Command {
+		case CONNECTED:
+			return frames[0], frames[1:], nil
+		case ERROR:
+			return nil, nil, newConnectRejectedError(newBrokerError(frames[0], stompClient.errorRules))
+		default:
+			return nil, nil, fmt.Errorf("unexpected %s frame during STOMP handshake", frames[0].Command)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package go_stomp_websocket
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+// startSilentWSServer starts a test server that opens the SockJS session and never answers CONNECT.
+func startSilentWSServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	upgrader := websocket.Upgrader{CheckOrigin: func(r *http.Request) bool { return true }}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("upgrade error: %v", err)
+			return
+		}
+		defer c.Close()
+		_ = c.WriteMessage(websocket.TextMessage, []byte("o"))
+		for {
+			if _, _, err := c.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func TestConnect_BrokerNeverAnswersCONNECT(t *testing.T) {
+	tests := []struct {
+		name        string
+		timeout     time.Duration
+		dialer      websocket.Dialer
+		connect     func(ctx context.Context, ts *httptest.Server, dialer websocket.Dialer) (*StompClient, error)
+		expectedErr error
+	}{
+		{
+			name:    "context deadline",
+			timeout: 200 * time.Millisecond,
+			connect: func(ctx context.Context, ts *httptest.Server, dialer websocket.Dialer) (*StompClient, error) {
+				return ConnectWithTokenProvider(ctx, wsURL(ts), dialer, StaticToken("token-abc"))
+			},
+			expectedErr: context.DeadlineExceeded,
+		},
+		{
+			name:    "dialer handshake timeout",
+			timeout: 10 * time.Second,
+			dialer:  websocket.Dialer{HandshakeTimeout: 200 * time.Millisecond},
+			connect: func(ctx context.Context, ts *httptest.Server, dialer websocket.Dialer) (*StompClient, error) {
+				return ConnectWithTokenProvider(ctx, wsURL(ts), dialer, StaticToken("token-abc"))
+			},
+			expectedErr: ErrHandshakeTimeout,
+		},
+		{
+			name:    "retry bounded by the context",
+			timeout: 300 * time.Millisecond,
+			connect: func(ctx context.Context, ts *httptest.Server, dialer websocket.Dialer) (*StompClient, error) {
+				return ConnectWithRetry(ctx, wsURL(ts), dialer, "token-abc", RetryPolicy{InitialBackoff: 10 * time.Millisecond})
+			},
+			expectedErr: context.DeadlineExceeded,
+		},
+		{
+			name:    "Connect with a handshake timeout",
+			timeout: 10 * time.Second,
+			dialer:  websocket.Dialer{HandshakeTimeout: 200 * time.Millisecond},
+			connect: func(_ context.Context, ts *httptest.Server, dialer websocket.Dialer) (*StompClient, error) {
+				return Connect(wsURL(ts), dialer, nil, gorillaDialer{})
+			},
+			expectedErr: ErrHandshakeTimeout,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := startSilentWSServer(t)
+			ctx, cancel := context.WithTimeout(context.Background(), tt.timeout)
+			defer cancel()
+
+			start := time.Now()
+			client, err := tt.connect(ctx, ts, tt.dialer)
+			assert.Nil(t, client)
+			assert.ErrorIs(t, err, tt.expectedErr)
+			assert.Less(t, time.Since(start), 5*time.Second)
+		})
+	}
+}
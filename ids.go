@@ -0,0 +1,82 @@
+package go_stomp_websocket
+
+import (
+	"crypto/rand"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// IDGenerator generates the ids a client puts on the wire: subscription, receipt and chunk ids, and the SockJS
+// server and session ids of the dialed URL path. It is called from several goroutines.
+type IDGenerator interface {
+	// ID returns a new subscription, receipt or chunk id. Ids must be unique within a connection.
+	ID() string
+	// SockJSSession returns the server and session ids of a new connection. They may only contain letters,
+	// digits, '-', '_' and '~'.
+	SockJSSession() (serverID, sessionID string)
+}
+
+// randomIDs is the default IDGenerator, backed by crypto/rand.
+type randomIDs struct{}
+
+func (randomIDs) ID() string {
+	return uuid.NewString()
+}
+
+func (randomIDs) SockJSSession() (serverID, sessionID string) {
+	return randomIntn(999), randomString()
+}
+
+// newID returns a new id from the generator of the client.
+func (stompClient StompClient) newID() string {
+	if stompClient.ids == nil {
+		return randomIDs{}.ID()
+	}
+	return stompClient.ids.ID()
+}
+
+// randomIntn returns a random number below max, zero-padded to the width of max.
+func randomIntn(max int) string {
+	n, err := rand.Int(rand.Reader, big.NewInt(int64(max)))
+	if err != nil {
+		panic("error reading random bytes: " + err.Error())
+	}
+	var (
+		ml = len(strconv.Itoa(max))
+		is = n.String()
+	)
+	if len(is) < ml {
+		is = strings.Repeat("0", ml-len(is)) + is
+	}
+	return is
+}
+
+func randomString() string {
+	length := 16
+	chars := []byte("ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789")
+	clen := len(chars)
+	maxrb := 255 - (256 % clen)
+	b := make([]byte, length)
+	r := make([]byte, length+(length/4)) // storage for random bytes.
+	i := 0
+	for {
+		if _, err := rand.Read(r); err != nil {
+			panic("uniuri: error reading random bytes: " + err.Error())
+		}
+		for _, rb := range r {
+			c := int(rb)
+			if c > maxrb {
+				// Skip this number to avoid modulo bias.
+				continue
+			}
+			b[i] = chars[c%clen]
+			i++
+			if i == length {
+				return string(b)
+			}
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package go_stomp_websocket
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+type sequentialIDs struct {
+	next atomic.Uint64
+}
+
+func (ids *sequentialIDs) ID() string {
+	return "id-" + strconv.FormatUint(ids.next.Add(1), 10)
+}
+
+func (ids *sequentialIDs) SockJSSession() (serverID, sessionID string) {
+	return "000", ids.ID()
+}
+
+func TestWithIDGenerator(t *testing.T) {
+	messages := make(chan string, 8)
+	ts := startScriptedWSServer(t, func(c *websocket.Conn) {
+		for {
+			_, data, err := c.ReadMessage()
+			if err != nil {
+				return
+			}
+			messages <- string(data)
+			if receipt, ok := ReadFrame(append([]byte("a"), data...)).Contains(Receipt); ok {
+				_ = c.WriteMessage(websocket.TextMessage, []byte(`a["RECEIPT\nreceipt-id:`+receipt+`\n\n\u0000"]`))
+			}
+		}
+	})
+	defer ts.Close()
+	client := connectTestClient(t, ts, WithLogger(NopLogger()), WithIDGenerator(&sequentialIDs{}))
+	// id-1 is the session, id-2 the goroutine tracker
+	assert.Equal(t, SockJSSession{ServerID: "000", SessionID: "id-1"}, client.SockJSSession())
+
+	_, err := client.Subscribe("/topic/a")
+	assert.NoError(t, err)
+	assert.NoError(t, client.Disconnect())
+	for _, expected := range []string{
+		`["SUBSCRIBE\nid:id-3\ndestination:/topic/a\n\n\u0000"]`,
+		`["DISCONNECT\nreceipt:id-4\n\n\u0000"]`,
+	} {
+		select {
+		case message := <-messages:
+			assert.Equal(t, expected, message)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no message, expected %s", expected)
+		}
+	}
+}
+
+func TestRandomIDs_Concurrent(t *testing.T) {
+	const goroutines, perGoroutine = 8, 100
+	var (
+		mutex sync.Mutex
+		seen  = make(map[string]bool)
+		wg    sync.WaitGroup
+	)
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < perGoroutine; j++ {
+				id := randomIDs{}.ID()
+				_, session := randomIDs{}.SockJSSession()
+				mutex.Lock()
+				seen[id] = true
+				seen[session] = true
+				mutex.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Len(t, seen, 2*goroutines*perGoroutine)
+}
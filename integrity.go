@@ -0,0 +1,86 @@
+package go_stomp_websocket
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path"
+)
+
+// BodySHA256 is the header carrying the hex encoded SHA-256 of the frame body.
+const BodySHA256 = "x-body-sha256"
+
+// IntegrityConfig configures body checksums. Both the sender and the receiver have to use this client.
+type IntegrityConfig struct {
+	// Sign adds the x-body-sha256 header to every SEND frame.
+	Sign bool
+	// Verify lists the destination patterns, in path.Match syntax, whose MESSAGE frames are checked.
+	// Frames without the header pass.
+	Verify []string
+	// Strict lists the destination patterns whose MESSAGE frames must carry the header. It implies Verify.
+	Strict []string
+	// MaxBodySize skips hashing and checking of larger bodies. Zero means no limit.
+	MaxBodySize int
+}
+
+// WithIntegrity enables body checksums. Frames failing the check are dropped and ErrIntegrityCheckFailed is sent to
+// the Errors channel of the subscription.
+func WithIntegrity(config IntegrityConfig) ConnectOption {
+	return func(options *connectOptions) {
+		options.integrity = &config
+	}
+}
+
+func bodyChecksum(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+func (config *IntegrityConfig) skips(body []byte) bool {
+	return config.MaxBodySize > 0 && len(body) > config.MaxBodySize
+}
+
+// sign adds the checksum header to a SEND frame builder.
+func (config *IntegrityConfig) sign(builder *FrameBuilder, body []byte) {
+	if config == nil || !config.Sign || config.skips(body) {
+		return
+	}
+	builder.WithHeader(BodySHA256, bodyChecksum(body))
+}
+
+// middleware returns the check for the frames of destination, or nil if they are not checked.
+func (config *IntegrityConfig) middleware(destination string, metrics MetricsCollector) Middleware {
+	if config == nil {
+		return nil
+	}
+	strict := matchesAny(config.Strict, destination)
+	if !strict && !matchesAny(config.Verify, destination) {
+		return nil
+	}
+	return func(next HandlerFunc) HandlerFunc {
+		return func(frame *Frame) error {
+			if frame.Command != MESSAGE || config.skips(frame.body) {
+				return next(frame)
+			}
+			expected, ok := frame.Contains(BodySHA256)
+			switch {
+			case !ok && strict:
+				metrics.ErrorOccurred(ErrorKindIntegrity)
+				return fmt.Errorf("%w: MESSAGE from %s has no %s header", ErrIntegrityCheckFailed, destination, BodySHA256)
+			case ok && expected != bodyChecksum(frame.body):
+				metrics.ErrorOccurred(ErrorKindIntegrity)
+				return fmt.Errorf("%w: body of MESSAGE from %s does not match %s", ErrIntegrityCheckFailed, destination, BodySHA256)
+			}
+			return next(frame)
+		}
+	}
+}
+
+func matchesAny(patterns []string, destination string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, destination); matched {
+			return true
+		}
+	}
+	return false
+}
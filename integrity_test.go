@@ -0,0 +1,85 @@
+package go_stomp_websocket
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIntegrityConfig_Middleware(t *testing.T) {
+	body := "payload"
+	valid := createTestFrame(MESSAGE, []string{BodySHA256 + ":" + bodyChecksum([]byte(body))}, body)
+	corrupted := createTestFrame(MESSAGE, []string{BodySHA256 + ":" + bodyChecksum([]byte(body))}, "paXload")
+	unsigned := createTestFrame(MESSAGE, nil, body)
+	tests := []struct {
+		name      string
+		config    IntegrityConfig
+		frame     *Frame
+		delivered bool
+	}{
+		{name: "valid", config: IntegrityConfig{Verify: []string{"/topic/*"}}, frame: valid, delivered: true},
+		{name: "corrupted", config: IntegrityConfig{Verify: []string{"/topic/*"}}, frame: corrupted},
+		{name: "unsigned passes", config: IntegrityConfig{Verify: []string{"/topic/*"}}, frame: unsigned, delivered: true},
+		{name: "unsigned strict", config: IntegrityConfig{Strict: []string{"/topic/*"}}, frame: unsigned},
+		{name: "corrupted above size threshold", config: IntegrityConfig{Verify: []string{"/topic/*"}, MaxBodySize: 4}, frame: corrupted, delivered: true},
+		{name: "ERROR frame", config: IntegrityConfig{Strict: []string{"/topic/*"}}, frame: createTestFrame(ERROR, nil, ""), delivered: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metrics := NewCounterMetrics()
+			check := tt.config.middleware("/topic/a", metrics)
+			delivered := false
+			err := check(func(frame *Frame) error {
+				delivered = true
+				return nil
+			})(tt.frame)
+			assert.Equal(t, tt.delivered, delivered)
+			if tt.delivered {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, ErrIntegrityCheckFailed)
+				assert.Equal(t, uint64(1), metrics.Snapshot().Errors[ErrorKindIntegrity])
+			}
+		})
+	}
+}
+
+func TestIntegrityConfig_NotConfiguredDestination(t *testing.T) {
+	config := &IntegrityConfig{Verify: []string{"/topic/secure/*"}}
+	assert.Nil(t, config.middleware("/topic/plain", nopMetrics{}))
+	assert.NotNil(t, config.middleware("/topic/secure/a", nopMetrics{}))
+	assert.Nil(t, (*IntegrityConfig)(nil).middleware("/topic/secure/a", nopMetrics{}))
+}
+
+func TestIntegrityConfig_Sign(t *testing.T) {
+	client := StompClient{integrity: &IntegrityConfig{Sign: true, MaxBodySize: 10}}
+	frame, err := client.createSendFrame("/topic/a", "", []byte("small"))
+	assert.NoError(t, err)
+	value, ok := frame.Contains(BodySHA256)
+	assert.True(t, ok)
+	assert.Equal(t, bodyChecksum([]byte("small")), value)
+
+	frame, err = client.createSendFrame("/topic/a", "", []byte("larger than ten bytes"))
+	assert.NoError(t, err)
+	_, ok = frame.Contains(BodySHA256)
+	assert.False(t, ok)
+}
+
+func TestWithIntegrity_EndToEnd(t *testing.T) {
+	ts, _ := startTestBroker(t)
+	defer ts.Close()
+	client := connectTestClient(t, ts, WithIntegrity(IntegrityConfig{Sign: true, Strict: []string{"/topic/*"}}))
+	defer client.connection.Close()
+
+	sub, err := client.Subscribe("/topic/a")
+	assert.NoError(t, err)
+	assert.NoError(t, client.Send("/topic/a", "", []byte("hello")))
+	select {
+	case frame := <-sub.FrameCh:
+		assert.Equal(t, "hello", frame.BodyString())
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the message")
+	}
+	assert.Zero(t, sub.MiddlewareErrors())
+}
@@ -0,0 +1,128 @@
+package go_stomp_websocket
+
+import (
+	"fmt"
+	"io"
+	"unicode/utf8"
+)
+
+const hexDigits = "0123456789abcdef"
+
+// appendJSONString appends s escaped as the content of a JSON string the way encoding/json escapes strings, minus
+// the HTML escapes: quotes, backslashes and control characters are escaped, and so are U+2028 and U+2029, which
+// JavaScript does not allow in string literals. Invalid UTF-8 is replaced with U+FFFD, so the content-length of a
+// body with invalid UTF-8 no longer matches; outboundFrames and jsonStringWriter reject such bodies.
+func appendJSONString[T string | []byte](dst []byte, s T) []byte {
+	start := 0
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c < utf8.RuneSelf {
+			if c >= 0x20 && c != '"' && c != '\\' {
+				i++
+				continue
+			}
+			dst = append(dst, s[start:i]...)
+			switch c {
+			case '"', '\\':
+				dst = append(dst, '\\', c)
+			case '\n':
+				dst = append(dst, '\\', 'n')
+			case '\r':
+				dst = append(dst, '\\', 'r')
+			case '\t':
+				dst = append(dst, '\\', 't')
+			case '\b':
+				dst = append(dst, '\\', 'b')
+			case '\f':
+				dst = append(dst, '\\', 'f')
+			default:
+				dst = append(dst, '\\', 'u', '0', '0', hexDigits[c>>4], hexDigits[c&0xf])
+			}
+			i++
+			start = i
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(string(s[i:min(i+utf8.UTFMax, len(s))]))
+		if r == utf8.RuneError && size == 1 {
+			dst = append(append(dst, s[start:i]...), "\ufffd"...)
+		} else if r == '\u2028' || r == '\u2029' {
+			dst = append(append(dst, s[start:i]...), '\\', 'u', '2', '0', '2', hexDigits[r&0xf])
+		} else {
+			i += size
+			continue
+		}
+		i += size
+		start = i
+	}
+	return append(dst, s[start:]...)
+}
+
+// jsonStringLen returns the length of s escaped by appendJSONString.
+func jsonStringLen[T string | []byte](s T) int {
+	n := len(s)
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c < utf8.RuneSelf {
+			switch {
+			case c == '"' || c == '\\' || c == '\n' || c == '\r' || c == '\t' || c == '\b' || c == '\f':
+				n++
+			case c < 0x20:
+				n += 5
+			}
+			i++
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(string(s[i:min(i+utf8.UTFMax, len(s))]))
+		if r == utf8.RuneError && size == 1 {
+			n += 2 // U+FFFD for one byte
+		} else if r == '\u2028' || r == '\u2029' {
+			n += 3 // \u202x for three bytes
+		}
+		i += size
+	}
+	return n
+}
+
+// jsonStringWriter writes its input escaped as the content of a JSON string. A UTF-8 sequence split across
+// writes is held back until the next write completes it. Input that is not valid UTF-8 fails with ErrInvalidUTF8,
+// and so does Flush when the input ended in the middle of a sequence.
+type jsonStringWriter struct {
+	w       io.Writer
+	scratch []byte
+	partial []byte // the start of a UTF-8 sequence at the end of the last write
+}
+
+func (writer *jsonStringWriter) Write(p []byte) (int, error) {
+	data := p
+	if len(writer.partial) > 0 {
+		data = append(writer.partial, p...)
+		writer.partial = nil
+	}
+	// hold back a trailing sequence that may still be completed
+	for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax+1; i-- {
+		if utf8.RuneStart(data[i]) {
+			if data[i] >= utf8.RuneSelf && !utf8.FullRune(data[i:]) {
+				writer.partial = append([]byte(nil), data[i:]...)
+				data = data[:i]
+			}
+			break
+		}
+	}
+	if !utf8.Valid(data) {
+		return 0, fmt.Errorf("%w: streamed body", ErrInvalidUTF8)
+	}
+	writer.scratch = appendJSONString(writer.scratch[:0], data)
+	if _, err := writer.w.Write(writer.scratch); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Flush reports a held back sequence, which the input ended in the middle of.
+func (writer *jsonStringWriter) Flush() error {
+	if len(writer.partial) == 0 {
+		return nil
+	}
+	writer.partial = nil
+	return fmt.Errorf("%w: streamed body ends in the middle of a sequence", ErrInvalidUTF8)
+}
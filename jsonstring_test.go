@@ -0,0 +1,69 @@
+package go_stomp_websocket
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var jsonStringTests = []struct {
+	name  string
+	input string
+}{
+	{name: "plain", input: "hello"},
+	{name: "quotes and backslashes", input: `{"a":"b\\c"}`},
+	{name: "EOLs and tabs", input: "line1\nline2\r\n\tend"},
+	{name: "control characters", input: "\x00\x01\b\f\x1f\x7f"},
+	{name: "line and paragraph separators", input: "a\u2028b\u2029c"},
+	{name: "multibyte", input: "zürich 東京 🙂"},
+	{name: "invalid UTF-8", input: "a\xffb\xe2\x80"},
+	{name: "truncated sequence", input: "ab\xe2\x80"},
+	{name: "HTML", input: "<a href='x'>&</a>"},
+}
+
+func TestAppendJSONString(t *testing.T) {
+	for _, tt := range jsonStringTests {
+		t.Run(tt.name, func(t *testing.T) {
+			var expected bytes.Buffer
+			encoder := json.NewEncoder(&expected)
+			encoder.SetEscapeHTML(false)
+			assert.NoError(t, encoder.Encode(tt.input))
+			got := appendJSONString([]byte(`"`), tt.input)
+			assert.Equal(t, expected.String(), string(got)+"\"\n")
+			assert.Equal(t, got, appendJSONString([]byte(`"`), []byte(tt.input)))
+			assert.Equal(t, len(got)-1, jsonStringLen(tt.input))
+		})
+	}
+}
+
+func TestJSONStringWriter(t *testing.T) {
+	for _, tt := range jsonStringTests {
+		t.Run(tt.name, func(t *testing.T) {
+			expected := string(appendJSONString(nil, tt.input))
+			for size := 1; size <= 4; size++ {
+				var out bytes.Buffer
+				writer := &jsonStringWriter{w: &out}
+				var err error
+				for i := 0; i < len(tt.input) && err == nil; i += size {
+					var n int
+					if n, err = writer.Write([]byte(tt.input[i:min(i+size, len(tt.input))])); err == nil {
+						assert.Equal(t, min(size, len(tt.input)-i), n)
+					}
+				}
+				if err == nil {
+					err = writer.Flush()
+				}
+				if !utf8.ValidString(tt.input) {
+					// the content-length of the frame would not match the body U+FFFD replaced the bytes in
+					assert.ErrorIs(t, err, ErrInvalidUTF8, "writes of %d bytes", size)
+					continue
+				}
+				assert.NoError(t, err)
+				assert.Equal(t, expected, out.String(), "writes of %d bytes", size)
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package go_stomp_websocket
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// maxMissedPongs is the number of consecutive pings without a pong after which the connection is torn down.
+const maxMissedPongs = 3
+
+// keepalive tracks websocket pings sent by processLoop and the pongs seen by the read loop.
+type keepalive struct {
+	interval time.Duration
+	missed   atomic.Int32
+}
+
+// pongHandler resets the missed pong count and extends the read deadline. It runs in the read loop.
+func (stompClient *StompClient) pongHandler(string) error {
+	stompClient.keepalive.missed.Store(0)
+	if stompClient.readTimeout > 0 {
+		return stompClient.connection.SetReadDeadline(time.Now().Add(stompClient.readTimeout))
+	}
+	return nil
+}
+
+// ping sends a websocket ping, or fails with ErrPongTimeout when the previous pings were not answered.
+// It must only be called from processLoop, which is the single writer of the connection.
+func (stompClient *StompClient) ping() error {
+	if missed := stompClient.keepalive.missed.Add(1); missed > maxMissedPongs {
+		stompClient.metrics.ErrorOccurred(ErrorKindPongTimeout)
+		return fmt.Errorf("%w: %d pings sent every %s were not answered", ErrPongTimeout, maxMissedPongs, stompClient.keepalive.interval)
+	}
+	deadline := time.Now().Add(stompClient.keepalive.interval)
+	if stompClient.writeTimeout > 0 {
+		deadline = time.Now().Add(stompClient.writeTimeout)
+	}
+	if err := stompClient.connection.WriteControl(websocket.PingMessage, nil, deadline); err != nil {
+		stompClient.metrics.ErrorOccurred(ErrorKindWrite)
+		return err
+	}
+	return nil
+}
+
+// defaultHeartbeatTolerance is how many incoming heart-beat intervals may pass without a read before the
+// connection is considered dead.
+const defaultHeartbeatTolerance = 2.0
+
+// heartbeatWatchdog detects a broker that stopped sending heart-beats. The read loop records the time of every
+// websocket message it reads, and processLoop checks it once per interval.
+type heartbeatWatchdog struct {
+	interval time.Duration // the negotiated incoming heart-beat interval
+	timeout  time.Duration
+	lastRead atomic.Int64 // unix nanoseconds
+}
+
+// newHeartbeatWatchdog returns the watchdog for the negotiated "outgoing,incoming" heart-beat header, or nil when
+// the broker sends no heart-beats or tolerance is not positive. A positive override replaces the incoming interval.
+func newHeartbeatWatchdog(negotiated string, tolerance float64, override time.Duration) *heartbeatWatchdog {
+	_, incoming := parseHeartBeat(negotiated)
+	interval := time.Duration(incoming) * time.Millisecond
+	if override > 0 {
+		interval = override
+	}
+	if interval <= 0 || tolerance <= 0 {
+		return nil
+	}
+	watchdog := &heartbeatWatchdog{interval: interval, timeout: time.Duration(float64(interval) * tolerance)}
+	watchdog.touch(time.Now())
+	return watchdog
+}
+
+// touch records a read. It runs in the read loop.
+func (watchdog *heartbeatWatchdog) touch(now time.Time) {
+	if watchdog != nil {
+		watchdog.lastRead.Store(now.UnixNano())
+	}
+}
+
+// check fails with ErrHeartbeatTimeout when nothing was read for longer than the timeout.
+func (watchdog *heartbeatWatchdog) check(now time.Time) error {
+	if silence := now.Sub(time.Unix(0, watchdog.lastRead.Load())); silence > watchdog.timeout {
+		return fmt.Errorf("%w: nothing received for %s, the broker heart-beat interval is %s",
+			ErrHeartbeatTimeout, silence.Round(time.Millisecond), watchdog.interval)
+	}
+	return nil
+}
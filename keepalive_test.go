@@ -0,0 +1,179 @@
+package go_stomp_websocket
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithPingInterval_PongsKeepConnectionAlive(t *testing.T) {
+	pings := &atomic.Int32{}
+	ts := startScriptedWSServer(t, func(c *websocket.Conn) {
+		c.SetPingHandler(func(data string) error {
+			pings.Add(1)
+			return c.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(time.Second))
+		})
+		for {
+			if _, _, err := c.ReadMessage(); err != nil {
+				return
+			}
+		}
+	})
+	defer ts.Close()
+	// the server sends no frames, so only the pongs extend the read deadline
+	client := connectTestClient(t, ts, WithPingInterval(10*time.Millisecond), WithReadTimeout(100*time.Millisecond))
+	defer client.connection.Close()
+
+	select {
+	case err := <-client.Errors():
+		t.Fatalf("unexpected terminal error: %v", err)
+	case <-time.After(400 * time.Millisecond):
+	}
+	assert.Greater(t, pings.Load(), int32(maxMissedPongs))
+}
+
+func TestWithPingInterval_MissingPongsCloseConnection(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	ts := startScriptedWSServer(t, func(c *websocket.Conn) {
+		// not reading, so pings are never answered
+		<-release
+	})
+	defer ts.Close()
+	metrics := NewCounterMetrics()
+	client := connectTestClient(t, ts, WithPingInterval(10*time.Millisecond), WithMetrics(metrics))
+	defer client.connection.Close()
+	sub, err := client.Subscribe("/topic/test")
+	assert.NoError(t, err)
+
+	err, ok := receiveTerminalError(t, client)
+	assert.True(t, ok)
+	assert.True(t, errors.Is(err, ErrPongTimeout))
+	select {
+	case frame := <-sub.FrameCh:
+		assert.Equal(t, ERROR, frame.Command)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting on the subscription ERROR frame")
+	}
+	assert.Equal(t, uint64(1), metrics.Snapshot().Errors[ErrorKindPongTimeout])
+}
+
+func TestNewHeartbeatWatchdog(t *testing.T) {
+	tests := []struct {
+		name            string
+		negotiated      string
+		tolerance       float64
+		override        time.Duration
+		expectedTimeout time.Duration // 0 for no watchdog
+	}{
+		{name: "no broker heart-beats", negotiated: "10000,0", tolerance: 2},
+		{name: "default tolerance", negotiated: "0,10000", tolerance: 2, expectedTimeout: 20 * time.Second},
+		{name: "fractional tolerance", negotiated: "0,10000", tolerance: 1.5, expectedTimeout: 15 * time.Second},
+		{name: "turned off", negotiated: "0,10000", tolerance: 0},
+		{name: "override", negotiated: "0,0", tolerance: 2, override: 10 * time.Millisecond, expectedTimeout: 20 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			watchdog := newHeartbeatWatchdog(tt.negotiated, tt.tolerance, tt.override)
+			if tt.expectedTimeout == 0 {
+				assert.Nil(t, watchdog)
+				return
+			}
+			assert.Equal(t, tt.expectedTimeout, watchdog.timeout)
+		})
+	}
+}
+
+func TestHeartbeatWatchdog_Check(t *testing.T) {
+	watchdog := newHeartbeatWatchdog("0,10000", 2, 0)
+	start := time.Now()
+	watchdog.touch(start)
+	assert.NoError(t, watchdog.check(start.Add(20*time.Second)))
+	watchdog.touch(start.Add(10 * time.Second))
+	assert.NoError(t, watchdog.check(start.Add(25*time.Second)))
+	err := watchdog.check(start.Add(31 * time.Second))
+	assert.ErrorIs(t, err, ErrHeartbeatTimeout)
+	assert.EqualError(t, err, "heartbeat timeout: nothing received for 21s, the broker heart-beat interval is 10s")
+}
+
+// withIncomingHeartbeat replaces the negotiated incoming heart-beat interval, which is at least the 10 seconds
+// the client asks for.
+func withIncomingHeartbeat(interval time.Duration) ConnectOption {
+	return func(options *connectOptions) {
+		options.incomingHeartbeat = interval
+	}
+}
+
+func TestHeartbeatTimeout_ClosesConnection(t *testing.T) {
+	ts := startScriptedWSServer(t, func(c *websocket.Conn) {
+		// reading, but never sending anything
+		for {
+			if _, _, err := c.ReadMessage(); err != nil {
+				return
+			}
+		}
+	})
+	defer ts.Close()
+	metrics := NewCounterMetrics()
+	client := connectTestClient(t, ts, withIncomingHeartbeat(20*time.Millisecond), WithMetrics(metrics), WithLogger(NopLogger()))
+	defer client.connection.Close()
+	sub, err := client.Subscribe("/topic/test")
+	assert.NoError(t, err)
+
+	err, ok := receiveTerminalError(t, client)
+	assert.True(t, ok)
+	assert.ErrorIs(t, err, ErrHeartbeatTimeout)
+	select {
+	case frame := <-sub.FrameCh:
+		assert.Equal(t, ERROR, frame.Command)
+		message, _ := frame.Contains(Message)
+		assert.Contains(t, message, "heartbeat timeout")
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting on the subscription ERROR frame")
+	}
+	assert.Equal(t, uint64(1), metrics.Snapshot().Errors[ErrorKindHeartbeatTimeout])
+}
+
+func TestHeartbeatTimeout_HeartbeatsKeepConnectionAlive(t *testing.T) {
+	ts := startScriptedWSServer(t, func(c *websocket.Conn) {
+		for {
+			time.Sleep(5 * time.Millisecond)
+			if err := c.WriteMessage(websocket.TextMessage, []byte("h")); err != nil {
+				return
+			}
+		}
+	})
+	defer ts.Close()
+	client := connectTestClient(t, ts, withIncomingHeartbeat(20*time.Millisecond), WithLogger(NopLogger()))
+
+	select {
+	case err := <-client.Errors():
+		t.Fatalf("unexpected terminal error: %v", err)
+	case <-time.After(200 * time.Millisecond):
+	}
+	// the watchdog stops with processLoop
+	_ = client.connection.Close()
+	<-client.done
+}
+
+func TestHeartbeatTimeout_FailsPendingReceipts(t *testing.T) {
+	ts := startScriptedWSServer(t, func(c *websocket.Conn) {
+		// no RECEIPT for the DISCONNECT
+		for {
+			if _, _, err := c.ReadMessage(); err != nil {
+				return
+			}
+		}
+	})
+	defer ts.Close()
+	client := connectTestClient(t, ts, withIncomingHeartbeat(20*time.Millisecond), WithDisconnectTimeout(time.Minute),
+		WithLogger(NopLogger()))
+
+	start := time.Now()
+	assert.NoError(t, client.Disconnect())
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
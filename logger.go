@@ -0,0 +1,82 @@
+package go_stomp_websocket
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+)
+
+// Logger is the logging interface of the client. The package logger of qubership-core-lib-go satisfies it.
+// Without WithLogger the client logs nothing.
+type Logger interface {
+	Debugf(format string, args ...interface{})
+	Infof(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Debugf(string, ...interface{}) {}
+func (nopLogger) Infof(string, ...interface{})  {}
+func (nopLogger) Errorf(string, ...interface{}) {}
+
+// NopLogger returns a Logger that discards everything.
+func NopLogger() Logger {
+	return nopLogger{}
+}
+
+type slogLogger struct {
+	logger *slog.Logger
+}
+
+// NewSlogLogger adapts a standard library slog.Logger to Logger.
+func NewSlogLogger(logger *slog.Logger) Logger {
+	return slogLogger{logger: logger}
+}
+
+func (l slogLogger) Debugf(format string, args ...interface{}) {
+	l.log(slog.LevelDebug, format, args)
+}
+
+func (l slogLogger) Infof(format string, args ...interface{}) {
+	l.log(slog.LevelInfo, format, args)
+}
+
+func (l slogLogger) Errorf(format string, args ...interface{}) {
+	l.log(slog.LevelError, format, args)
+}
+
+func (l slogLogger) log(level slog.Level, format string, args []interface{}) {
+	ctx := context.Background()
+	if l.logger.Enabled(ctx, level) {
+		l.logger.Log(ctx, level, fmt.Sprintf(format, args...))
+	}
+}
+
+func (stompClient *StompClient) traceFrame(direction string, frame *Frame) {
+	stompClient.logger.Debugf("%s %v", direction, tracedFrame{frame, stompClient.trace})
+}
+
+// tracedFrame formats the command, the masked headers and the truncated body of a frame only when the trace is
+// logged.
+type tracedFrame struct {
+	frame *Frame
+	trace frameTrace
+}
+
+func (traced tracedFrame) String() string {
+	headers := maskedHeaders(traced.frame.Headers, traced.trace.redactedHeaders)
+	if traced.trace.bodyLimit == 0 || len(traced.frame.body) == 0 {
+		return fmt.Sprintf("%s %v", traced.frame.Command, headers)
+	}
+	return fmt.Sprintf("%s %v %q", traced.frame.Command, headers, truncatedBody(traced.frame.body, traced.trace.bodyLimit))
+}
+
+// frameReceived traces and counts a frame read from the connection.
+func (stompClient *StompClient) frameReceived(frame *Frame) {
+	stompClient.traceFrame("<<<", frame)
+	stompClient.metrics.FrameReceived(frame.Command, frame.size())
+	if frame.Command == ERROR {
+		stompClient.metrics.ErrorOccurred(ErrorKindBroker)
+	}
+}
@@ -0,0 +1,135 @@
+package go_stomp_websocket
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/netcracker/qubership-core-lib-go/v3/logging"
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingLogger struct {
+	mutex sync.Mutex
+	lines []string
+}
+
+func (l *recordingLogger) record(level, format string, args []interface{}) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.lines = append(l.lines, level+" "+fmt.Sprintf(format, args...))
+}
+
+func (l *recordingLogger) Debugf(format string, args ...interface{}) { l.record("DEBUG", format, args) }
+func (l *recordingLogger) Infof(format string, args ...interface{})  { l.record("INFO", format, args) }
+func (l *recordingLogger) Errorf(format string, args ...interface{}) { l.record("ERROR", format, args) }
+
+func (l *recordingLogger) contains(substr string) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	for _, line := range l.lines {
+		if strings.Contains(line, substr) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestMaskedHeaders(t *testing.T) {
+	tests := []struct {
+		name     string
+		headers  []string
+		expected []string
+	}{
+		{
+			name:     "no credentials",
+			headers:  []string{"destination:/topic/a", "content-type:text/plain"},
+			expected: []string{"destination:/topic/a", "content-type:text/plain"},
+		},
+		{
+			name:     "credentials",
+			headers:  []string{"login:guest", "passcode:secret", "Authorization:Bearer abc", "AUTHORIZATION:x"},
+			expected: []string{"login:***", "passcode:***", "Authorization:***", "AUTHORIZATION:***"},
+		},
+		{
+			name:     "header without colon",
+			headers:  []string{"passcode"},
+			expected: []string{"passcode"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, maskedHeaders(tt.headers, defaultRedactedHeaderKeys))
+		})
+	}
+}
+
+func TestSlogLogger(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewSlogLogger(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelInfo})))
+	l.Debugf("hidden %d", 1)
+	l.Infof("shown %d", 2)
+	l.Errorf("failed %s", "badly")
+	out := buf.String()
+	assert.NotContains(t, out, "hidden")
+	assert.Contains(t, out, `level=INFO msg="shown 2"`)
+	assert.Contains(t, out, `level=ERROR msg="failed badly"`)
+}
+
+func TestWithLogger_TracesFrames(t *testing.T) {
+	ts, _ := startTestWSServer(t)
+	defer ts.Close()
+	l := &recordingLogger{}
+	client := connectTestClient(t, ts, WithLogger(l), WithTokenTransport(TokenInQuery))
+	defer client.connection.Close()
+
+	assert.NoError(t, client.Send("/topic/a", "", []byte("x")))
+	assert.NoError(t, client.Disconnect())
+
+	assert.True(t, l.contains("access_token=redacted"))
+	assert.False(t, l.contains("token-abc"))
+	assert.True(t, l.contains("DEBUG >>> CONNECT [accept-version:1.2,1.1,1.0 heart-beat:10000,10000]"))
+	assert.True(t, l.contains("DEBUG <<< CONNECTED"))
+	assert.True(t, l.contains("DEBUG >>> SEND [destination:/topic/a]"))
+	assert.True(t, l.contains("matched"))
+}
+
+func TestWithTraceBodyLimit_PerClient(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     []ConnectOption
+		expected string
+	}{
+		{name: "defaults", expected: "DEBUG >>> SEND [destination:/topic/a content-type:text/plain]"},
+		{name: "body limit", opts: []ConnectOption{WithTraceBodyLimit(5)},
+			expected: `DEBUG >>> SEND [destination:/topic/a content-type:text/plain] "hello... (6 more bytes)"`},
+		{name: "whole body", opts: []ConnectOption{WithTraceBodyLimit(-1)},
+			expected: `DEBUG >>> SEND [destination:/topic/a content-type:text/plain] "hello world"`},
+		{name: "redacted headers", opts: []ConnectOption{WithRedactedHeaders("destination")},
+			expected: "DEBUG >>> SEND [destination:*** content-type:text/plain]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts, _ := startTestWSServer(t)
+			defer ts.Close()
+			l := &recordingLogger{}
+			client := connectTestClient(t, ts, append(tt.opts, WithLogger(l))...)
+			defer client.connection.Close()
+
+			assert.NoError(t, client.Send("/topic/a", "text/plain", []byte("hello world")))
+			assert.NoError(t, client.Disconnect())
+			assert.True(t, l.contains(tt.expected), "trace %q not logged", tt.expected)
+		})
+	}
+}
+
+func TestLogger_DefaultsToNop(t *testing.T) {
+	assert.Equal(t, NopLogger(), newConnectOptions(nil).logger)
+	assert.Equal(t, NopLogger(), newConnectOptions([]ConnectOption{WithLogger(nil)}).logger)
+	// the logger of earlier releases can still be configured
+	var stomp Logger = logging.GetLogger("stomp")
+	assert.Equal(t, stomp, newConnectOptions([]ConnectOption{WithLogger(stomp)}).logger)
+}
@@ -0,0 +1,172 @@
+package go_stomp_websocket
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// StompMessage is a MESSAGE frame of a subscription with its common headers parsed. Ack and Nack acknowledge it
+// through the client that received it.
+type StompMessage struct {
+	Destination  string
+	MessageID    string
+	Subscription SubscriptionID
+	ContentType  string
+	Body         []byte // the body of the frame, not a copy
+	frame        *Frame
+	stompClient  StompClient
+	acker        *cumulativeAcker // nil unless the subscription has AutoCumulativeAck
+}
+
+func newMessage(stompClient StompClient, frame *Frame) *StompMessage {
+	destination, _ := frame.Contains(Destination)
+	messageId, _ := frame.Contains(MessageId)
+	subscription, _ := frame.Contains(Subscription_h)
+	contentType, _ := frame.Contains(ContentType)
+	return &StompMessage{
+		Destination:  destination,
+		MessageID:    messageId,
+		Subscription: SubscriptionID(subscription),
+		ContentType:  contentType,
+		Body:         frame.body,
+		frame:        frame,
+		stompClient:  stompClient,
+	}
+}
+
+// Frame returns the MESSAGE frame, for the headers StompMessage does not parse.
+func (m *StompMessage) Frame() *Frame {
+	return m.frame
+}
+
+// Ack acknowledges the message with StompClient.Ack.
+func (m *StompMessage) Ack() error {
+	return m.stompClient.Ack(m.frame)
+}
+
+// Nack rejects the message with StompClient.Nack.
+func (m *StompMessage) Nack(opts ...NackOption) error {
+	return m.stompClient.Nack(m.frame, opts...)
+}
+
+// Done marks the message processed for AutoCumulativeAck. It does nothing for the messages of other
+// subscriptions.
+func (m *StompMessage) Done() {
+	if m.acker != nil {
+		m.acker.done(m.frame)
+	}
+}
+
+// ReadMessage is Read for MESSAGE frames. The ERROR frame that closes the connection is returned as a
+// *BrokerError, and other frames are skipped.
+func (s *Subscription) ReadMessage(ctx context.Context) (*StompMessage, error) {
+	for {
+		frame, err := s.Read(ctx)
+		if err != nil {
+			return nil, err
+		}
+		switch frame.Command {
+		case MESSAGE:
+			message := newMessage(s.stompClient, frame)
+			message.acker = s.acker
+			return message, nil
+		case ERROR:
+			return nil, newBrokerError(frame, s.stompClient.errorRules)
+		}
+	}
+}
+
+// messageFeed is the channel of Subscription.Messages, created by its first call.
+type messageFeed struct {
+	once sync.Once
+	ch   chan *StompMessage
+}
+
+// Messages returns a channel that receives the MESSAGE frames of the subscription as StompMessages. The first call
+// starts a goroutine of the client that receives from FrameCh; do not receive from it elsewhere. The channel is
+// closed when ReadMessage would fail: after the unsubscribe once the buffered frames are received, or when the
+// client is closed. The *BrokerError of an ERROR frame is sent to Errors before. Messages returns nil for a
+// subscription that was not made by a client.
+func (s *Subscription) Messages() <-chan *StompMessage {
+	if s.messages == nil {
+		return nil
+	}
+	s.messages.once.Do(func() {
+		ch := make(chan *StompMessage)
+		s.messages.ch = ch
+		release := claimReader(s)
+		run := func() {
+			defer close(ch)
+			defer release()
+			s.feedMessages(ch)
+		}
+		if s.stompClient.goroutines != nil {
+			s.stompClient.goroutines.goRole(roleMessageFeed, run)
+		} else {
+			go run()
+		}
+	})
+	return s.messages.ch
+}
+
+func (s *Subscription) feedMessages(ch chan<- *StompMessage) {
+	for {
+		message, err := s.ReadMessage(context.Background())
+		if err != nil {
+			var brokerErr *BrokerError
+			if errors.As(err, &brokerErr) {
+				select {
+				case s.errorCh <- err:
+				default:
+				}
+			}
+			return
+		}
+		select {
+		case ch <- message:
+		case <-s.stompClient.done:
+			return
+		}
+	}
+}
+
+// MessagesToFrames returns a channel that receives the MESSAGE frames of messages in their order, for code that
+// still consumes chan *Frame; StompClient.Ack and Nack take them like the frames of FrameCh. A goroutine forwards
+// the frames and closes the channel after messages is closed.
+func MessagesToFrames(messages <-chan *StompMessage) <-chan *Frame {
+	frames := make(chan *Frame)
+	go func() {
+		defer close(frames)
+		for message := range messages {
+			frames <- message.frame
+		}
+	}()
+	return frames
+}
+
+// FramesToMessages returns a channel that receives the MESSAGE frames of frames in their order as StompMessages
+// of client, so Ack and Nack go through it, and Done too while the subscription is not unsubscribed. Other frames
+// are skipped. A goroutine of the client forwards the messages and closes the channel after frames is closed.
+func FramesToMessages(client *StompClient, frames <-chan *Frame) <-chan *StompMessage {
+	messages := make(chan *StompMessage)
+	run := func() {
+		defer close(messages)
+		for frame := range frames {
+			if frame.Command != MESSAGE {
+				continue
+			}
+			message := newMessage(*client, frame)
+			if sub, ok := client.Subscription(string(message.Subscription)); ok {
+				message.acker = sub.acker
+			}
+			messages <- message
+		}
+	}
+	if client.goroutines != nil {
+		client.goroutines.goRole(roleFrameBridge, run)
+	} else {
+		go run()
+	}
+	return messages
+}
@@ -0,0 +1,228 @@
+package go_stomp_websocket
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewMessage(t *testing.T) {
+	frame := createTestFrame(MESSAGE, []string{"destination:/topic/a", "message-id:msg-1", "subscription:sub-1",
+		"content-type:text/plain", "custom:value"}, "hello")
+	message := newMessage(StompClient{}, frame)
+	assert.Equal(t, "/topic/a", message.Destination)
+	assert.Equal(t, "msg-1", message.MessageID)
+	assert.Equal(t, SubscriptionID("sub-1"), message.Subscription)
+	assert.Equal(t, "text/plain", message.ContentType)
+	assert.Equal(t, []byte("hello"), message.Body)
+	assert.Same(t, frame, message.Frame())
+	custom, _ := message.Frame().Contains("custom")
+	assert.Equal(t, "value", custom)
+}
+
+func TestStompMessage_AckNack(t *testing.T) {
+	client := &StompClient{
+		writeCh: make(chan writeRequest, 1),
+		version: "1.2",
+	}
+	written := make(chan string, 2)
+	go func() {
+		for i := 0; i < 2; i++ {
+			req := <-client.writeCh
+			written <- string(req.Frame.rawBytes())
+			req.Err <- nil
+		}
+	}()
+	message := newMessage(*client, createTestFrame(MESSAGE, []string{"subscription:sub-1", "ack:ack-1"}, ""))
+	assert.NoError(t, message.Ack())
+	assert.Equal(t, "ACK\nid:ack-1\n\n\x00", <-written)
+	assert.NoError(t, message.Nack(WithRequeue(false)))
+	assert.Equal(t, "NACK\nid:ack-1\nrequeue:false\n\n\x00", <-written)
+}
+
+func TestReadMessage(t *testing.T) {
+	sub := &Subscription{id: "sub-1", FrameCh: make(chan *Frame, 3)}
+	sub.FrameCh <- createTestFrame(RECEIPT, []string{"receipt-id:r-1"}, "")
+	sub.FrameCh <- createTestFrame(MESSAGE, []string{"destination:/topic/a"}, "1")
+	sub.FrameCh <- createTestFrame(ERROR, []string{"message:Access denied"}, "")
+
+	message, err := sub.ReadMessage(context.Background())
+	if assert.NoError(t, err) {
+		assert.Equal(t, "/topic/a", message.Destination)
+		assert.Equal(t, "1", string(message.Body))
+	}
+	_, err = sub.ReadMessage(context.Background())
+	var brokerErr *BrokerError
+	if assert.ErrorAs(t, err, &brokerErr) {
+		assert.Equal(t, "Access denied", brokerErr.Message)
+	}
+}
+
+func TestMessages(t *testing.T) {
+	ts, push, subscribed := startTriggeredPushServer(t)
+	client := connectTestClient(t, ts, WithLogger(NopLogger()))
+	defer client.connection.Close()
+	sub, err := client.Subscribe("/topic/a", WithBufferSize(4))
+	if !assert.NoError(t, err) {
+		return
+	}
+	<-subscribed
+	assert.Equal(t, sub.Messages(), sub.Messages())
+
+	push <- "1"
+	push <- "2"
+	for _, expected := range []string{"1", "2"} {
+		select {
+		case message := <-sub.Messages():
+			assert.Equal(t, expected, string(message.Body))
+			assert.Equal(t, "/topic/a", message.Destination)
+			assert.Equal(t, sub.Id(), message.Subscription)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no message, expected %s", expected)
+		}
+	}
+
+	sub.Unsubscribe()
+	select {
+	case _, ok := <-sub.Messages():
+		assert.False(t, ok)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Messages was not closed")
+	}
+	assert.Nil(t, (&Subscription{}).Messages())
+}
+
+func TestMessages_ErrorFrame(t *testing.T) {
+	sub := &Subscription{id: "sub-1", FrameCh: make(chan *Frame, 1), errorCh: make(chan error, 1), messages: &messageFeed{}}
+	sub.FrameCh <- createTestFrame(ERROR, []string{"message:Access denied"}, "")
+	close(sub.FrameCh)
+	_, ok := <-sub.Messages()
+	assert.False(t, ok)
+	var brokerErr *BrokerError
+	assert.ErrorAs(t, <-sub.Errors(), &brokerErr)
+}
+
+// bridgeTestSubscription returns a subscription of a client whose written frames go to the returned channel, with
+// frames buffered in FrameCh, which is closed then.
+func bridgeTestSubscription(frames ...*Frame) (*StompClient, *Subscription, <-chan string) {
+	client := &StompClient{writeCh: make(chan writeRequest), version: "1.2"}
+	written := make(chan string, len(frames))
+	go func() {
+		for req := range client.writeCh {
+			written <- string(req.Frame.rawBytes())
+			req.Err <- nil
+		}
+	}()
+	sub := &Subscription{id: "sub-1", FrameCh: make(chan *Frame, len(frames)), stompClient: *client, messages: &messageFeed{}}
+	for _, frame := range frames {
+		sub.FrameCh <- frame
+	}
+	close(sub.FrameCh)
+	return client, sub, written
+}
+
+func bridgeTestFrames() []*Frame {
+	return []*Frame{
+		createTestFrame(MESSAGE, []string{"subscription:sub-1", "destination:/topic/a", "ack:1"}, "one"),
+		createTestFrame(MESSAGE, []string{"subscription:sub-1", "destination:/topic/a", "ack:2"}, "two"),
+		createTestFrame(MESSAGE, []string{"subscription:sub-1", "destination:/topic/b", "ack:3"}, "three"),
+	}
+}
+
+func TestFramesToMessages(t *testing.T) {
+	// the consumer acks the first two messages, nacks the third and returns what it saw and what was written
+	consume := func(messages <-chan *StompMessage, written <-chan string) []string {
+		var observed []string
+		for message := range messages {
+			observed = append(observed, message.Destination+" "+string(message.Body))
+			var err error
+			if string(message.Body) == "three" {
+				err = message.Nack(WithRequeue(false))
+			} else {
+				err = message.Ack()
+			}
+			observed = append(observed, <-written, fmt.Sprint(err))
+		}
+		return append(observed, "closed")
+	}
+	tests := []struct {
+		name     string
+		messages func(client *StompClient, sub *Subscription) <-chan *StompMessage
+	}{
+		{name: "native", messages: func(_ *StompClient, sub *Subscription) <-chan *StompMessage {
+			return sub.Messages()
+		}},
+		{name: "bridged", messages: func(client *StompClient, sub *Subscription) <-chan *StompMessage {
+			return FramesToMessages(client, sub.FrameCh)
+		}},
+		{name: "bridged both ways", messages: func(client *StompClient, sub *Subscription) <-chan *StompMessage {
+			return FramesToMessages(client, MessagesToFrames(sub.Messages()))
+		}},
+	}
+	var expected []string
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			frames := append(bridgeTestFrames(), createTestFrame(RECEIPT, []string{"receipt-id:r-1"}, ""))
+			client, sub, written := bridgeTestSubscription(frames...)
+			observed := consume(tt.messages(client, sub), written)
+			if expected == nil {
+				expected = observed
+				assert.Equal(t, []string{
+					"/topic/a one", "ACK\nid:1\n\n\x00", "<nil>",
+					"/topic/a two", "ACK\nid:2\n\n\x00", "<nil>",
+					"/topic/b three", "NACK\nid:3\nrequeue:false\n\n\x00", "<nil>",
+					"closed",
+				}, observed)
+			}
+			assert.Equal(t, expected, observed)
+		})
+	}
+}
+
+func TestMessagesToFrames(t *testing.T) {
+	consume := func(client *StompClient, frames <-chan *Frame, written <-chan string) []string {
+		var observed []string
+		for frame := range frames {
+			observed = append(observed, frame.BodyString(), fmt.Sprint(client.Ack(frame)), <-written)
+		}
+		return append(observed, "closed")
+	}
+	client, sub, written := bridgeTestSubscription(bridgeTestFrames()...)
+	native := consume(client, sub.FrameCh, written)
+	client, sub, written = bridgeTestSubscription(bridgeTestFrames()...)
+	bridged := consume(client, MessagesToFrames(sub.Messages()), written)
+	assert.Equal(t, native, bridged)
+	assert.Equal(t, []string{"one", "<nil>", "ACK\nid:1\n\n\x00", "two", "<nil>", "ACK\nid:2\n\n\x00",
+		"three", "<nil>", "ACK\nid:3\n\n\x00", "closed"}, bridged)
+}
+
+func TestFramesToMessages_BindsCumulativeAck(t *testing.T) {
+	ts, push, subscribed := startTriggeredPushServer(t)
+	client := connectTestClient(t, ts, WithLogger(NopLogger()))
+	defer client.connection.Close()
+	sub, err := client.Subscribe("/topic/a", AutoCumulativeAck(time.Hour, 100))
+	if !assert.NoError(t, err) {
+		return
+	}
+	<-subscribed
+	messages := FramesToMessages(client, sub.FrameCh)
+	push <- "1"
+	select {
+	case message := <-messages:
+		assert.Same(t, sub.acker, message.acker)
+		assert.Equal(t, "1", string(message.Body))
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message")
+	}
+	assert.Eventually(t, func() bool {
+		for _, info := range client.GoroutineReport() {
+			if info.Role == roleFrameBridge {
+				return true
+			}
+		}
+		return false
+	}, time.Second, 10*time.Millisecond)
+}
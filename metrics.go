@@ -0,0 +1,148 @@
+package go_stomp_websocket
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Error kinds reported to MetricsCollector.ErrorOccurred.
+const (
+	ErrorKindRead              = "read"
+	ErrorKindParse             = "parse"
+	ErrorKindFrameTooLarge     = "frame_too_large"
+	ErrorKindWrite             = "write"
+	ErrorKindWriteTimeout      = "write_timeout"
+	ErrorKindBroker            = "broker"
+	ErrorKindIntegrity         = "integrity"
+	ErrorKindDisconnectTimeout = "disconnect_timeout"
+	ErrorKindPongTimeout       = "pong_timeout"
+	ErrorKindHeartbeatTimeout  = "heartbeat_timeout"
+	ErrorKindDropped           = "dropped" // a frame dropped by the subscription overflow policy
+	ErrorKindChunkTimeout      = "chunk_timeout"
+	ErrorKindConsumerPanic     = "consumer_panic" // a panic of a consume function run by Supervise
+
+	ErrorKindProtocolHandshakeFrame             = "protocol_handshake_frame"
+	ErrorKindProtocolUnknownReceipt             = "protocol_unknown_receipt"
+	ErrorKindProtocolMessageWithoutSubscription = "protocol_message_without_subscription"
+	ErrorKindProtocolUnknownDestinationAlias    = "protocol_unknown_destination_alias"
+)
+
+// MetricsCollector receives client metrics. The byte counts are STOMP frame sizes without the transport framing.
+// Hooks are called from the client goroutines, never while an internal lock is held, and must not block.
+type MetricsCollector interface {
+	FrameSent(command string, bytes int)
+	FrameReceived(command string, bytes int)
+	ErrorOccurred(kind string)
+	// WriteQueueDepth is sampled by the writer goroutine every time it takes a frame from the queue.
+	WriteQueueDepth(n int)
+}
+
+type nopMetrics struct{}
+
+func (nopMetrics) FrameSent(string, int)     {}
+func (nopMetrics) FrameReceived(string, int) {}
+func (nopMetrics) ErrorOccurred(string)      {}
+func (nopMetrics) WriteQueueDepth(int)       {}
+
+// CounterMetrics is a MetricsCollector that keeps counters in memory. Read them with Snapshot.
+type CounterMetrics struct {
+	framesSent         atomic.Uint64
+	bytesSent          atomic.Uint64
+	framesReceived     atomic.Uint64
+	bytesReceived      atomic.Uint64
+	writeQueueDepth    atomic.Int64
+	maxWriteQueueDepth atomic.Int64
+
+	mutex             sync.Mutex
+	sentByCommand     map[string]uint64
+	receivedByCommand map[string]uint64
+	errors            map[string]uint64
+}
+
+// MetricsSnapshot is a copy of the CounterMetrics counters.
+type MetricsSnapshot struct {
+	FramesSent         uint64
+	BytesSent          uint64
+	FramesReceived     uint64
+	BytesReceived      uint64
+	SentByCommand      map[string]uint64
+	ReceivedByCommand  map[string]uint64
+	Errors             map[string]uint64
+	WriteQueueDepth    int
+	MaxWriteQueueDepth int
+}
+
+func NewCounterMetrics() *CounterMetrics {
+	return &CounterMetrics{
+		sentByCommand:     make(map[string]uint64),
+		receivedByCommand: make(map[string]uint64),
+		errors:            make(map[string]uint64),
+	}
+}
+
+func (metrics *CounterMetrics) FrameSent(command string, bytes int) {
+	metrics.framesSent.Add(1)
+	metrics.bytesSent.Add(uint64(bytes))
+	metrics.increment(metrics.sentByCommand, command)
+}
+
+func (metrics *CounterMetrics) FrameReceived(command string, bytes int) {
+	metrics.framesReceived.Add(1)
+	metrics.bytesReceived.Add(uint64(bytes))
+	metrics.increment(metrics.receivedByCommand, command)
+}
+
+func (metrics *CounterMetrics) ErrorOccurred(kind string) {
+	metrics.increment(metrics.errors, kind)
+}
+
+func (metrics *CounterMetrics) WriteQueueDepth(n int) {
+	metrics.writeQueueDepth.Store(int64(n))
+	for {
+		max := metrics.maxWriteQueueDepth.Load()
+		if int64(n) <= max || metrics.maxWriteQueueDepth.CompareAndSwap(max, int64(n)) {
+			return
+		}
+	}
+}
+
+func (metrics *CounterMetrics) increment(counters map[string]uint64, key string) {
+	metrics.mutex.Lock()
+	counters[key]++
+	metrics.mutex.Unlock()
+}
+
+// Snapshot returns the current counters.
+func (metrics *CounterMetrics) Snapshot() MetricsSnapshot {
+	snapshot := MetricsSnapshot{
+		FramesSent:         metrics.framesSent.Load(),
+		BytesSent:          metrics.bytesSent.Load(),
+		FramesReceived:     metrics.framesReceived.Load(),
+		BytesReceived:      metrics.bytesReceived.Load(),
+		WriteQueueDepth:    int(metrics.writeQueueDepth.Load()),
+		MaxWriteQueueDepth: int(metrics.maxWriteQueueDepth.Load()),
+	}
+	metrics.mutex.Lock()
+	defer metrics.mutex.Unlock()
+	snapshot.SentByCommand = copyCounters(metrics.sentByCommand)
+	snapshot.ReceivedByCommand = copyCounters(metrics.receivedByCommand)
+	snapshot.Errors = copyCounters(metrics.errors)
+	return snapshot
+}
+
+func copyCounters(counters map[string]uint64) map[string]uint64 {
+	result := make(map[string]uint64, len(counters))
+	for key, value := range counters {
+		result[key] = value
+	}
+	return result
+}
+
+// size returns the length of the frame serialized as plain STOMP.
+func (frame *Frame) size() int {
+	size := len(frame.Command) + 1 + 1 + len(frame.body) + 1
+	for _, header := range frame.Headers {
+		size += len(header) + 1
+	}
+	return size
+}
@@ -0,0 +1,56 @@
+package go_stomp_websocket
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCounterMetrics(t *testing.T) {
+	metrics := NewCounterMetrics()
+	metrics.FrameSent(SEND, 10)
+	metrics.FrameSent(SEND, 5)
+	metrics.FrameSent(SUBSCRIBE, 3)
+	metrics.FrameReceived(MESSAGE, 7)
+	metrics.ErrorOccurred(ErrorKindRead)
+	metrics.WriteQueueDepth(4)
+	metrics.WriteQueueDepth(1)
+
+	snapshot := metrics.Snapshot()
+	assert.Equal(t, uint64(3), snapshot.FramesSent)
+	assert.Equal(t, uint64(18), snapshot.BytesSent)
+	assert.Equal(t, map[string]uint64{SEND: 2, SUBSCRIBE: 1}, snapshot.SentByCommand)
+	assert.Equal(t, uint64(1), snapshot.FramesReceived)
+	assert.Equal(t, uint64(7), snapshot.BytesReceived)
+	assert.Equal(t, map[string]uint64{MESSAGE: 1}, snapshot.ReceivedByCommand)
+	assert.Equal(t, map[string]uint64{ErrorKindRead: 1}, snapshot.Errors)
+	assert.Equal(t, 1, snapshot.WriteQueueDepth)
+	assert.Equal(t, 4, snapshot.MaxWriteQueueDepth)
+
+	// the snapshot is a copy
+	snapshot.SentByCommand[SEND] = 100
+	assert.Equal(t, uint64(2), metrics.Snapshot().SentByCommand[SEND])
+}
+
+func TestFrameSize(t *testing.T) {
+	frame := createTestFrame(SEND, []string{"destination:/a"}, "body")
+	assert.Equal(t, len(frame.rawBytes()), frame.size())
+}
+
+func TestWithMetrics_CountsFrames(t *testing.T) {
+	ts, _ := startTestWSServer(t)
+	defer ts.Close()
+	metrics := NewCounterMetrics()
+	client := connectTestClient(t, ts, WithMetrics(metrics))
+	defer client.connection.Close()
+
+	body := []byte("hello")
+	assert.NoError(t, client.Send("/topic/a", "", body))
+	assert.NoError(t, client.Disconnect())
+
+	snapshot := metrics.Snapshot()
+	assert.Equal(t, map[string]uint64{CONNECT: 1, SEND: 1, DISCONNECT: 1}, snapshot.SentByCommand)
+	assert.Equal(t, uint64(1), snapshot.ReceivedByCommand[CONNECTED])
+	assert.Equal(t, uint64(1), snapshot.ReceivedByCommand[RECEIPT])
+	assert.Empty(t, snapshot.Errors)
+}
@@ -0,0 +1,99 @@
+package go_stomp_websocket
+
+import (
+	"sync/atomic"
+)
+
+// subscriptionErrorBuffer is the capacity of the subscription error channel.
+const subscriptionErrorBuffer = 16
+
+// HandlerFunc handles a MESSAGE frame of a subscription.
+type HandlerFunc func(frame *Frame) error
+
+// Middleware wraps the delivery of the frames of one subscription. It may change the frame before calling next,
+// or drop it by returning without calling next.
+type Middleware func(next HandlerFunc) HandlerFunc
+
+type SubscribeOption func(*subscribeOptions)
+
+type subscribeOptions struct {
+	middleware []Middleware
+	bufferSize int
+	overflow   OverflowPolicy
+	channel    chan *Frame // set by MigrationWrapper, nil creates one of bufferSize
+	durable    string
+
+	cumulativeAck *cumulativeAckOptions
+}
+
+// WithBufferSize sets the capacity of FrameCh. The default is 0, so the dispatcher waits for the consumer on
+// every frame and a slow consumer delays all subscriptions of the connection. With a buffer the dispatcher
+// only waits when the buffer is full.
+func WithBufferSize(size int) SubscribeOption {
+	return func(options *subscribeOptions) {
+		options.bufferSize = size
+	}
+}
+
+// WithSubscriptionOverflow sets what the dispatcher does with a frame when FrameCh is full. The default is
+// OverflowBlock. Dropped frames are counted by Subscription.Dropped and reported to the metrics as ErrorKindDropped.
+// With an unbuffered FrameCh OverflowDropOldest has nothing to evict and drops the new frame instead.
+func WithSubscriptionOverflow(policy OverflowPolicy) SubscribeOption {
+	return func(options *subscribeOptions) {
+		options.overflow = policy
+	}
+}
+
+// WithMiddleware adds middleware around the delivery of the subscription frames to FrameCh. Middleware runs in
+// the order it is given, the first one outermost. It runs in the dispatcher goroutine, so it should be fast.
+func WithMiddleware(middleware ...Middleware) SubscribeOption {
+	return func(options *subscribeOptions) {
+		options.middleware = append(options.middleware, middleware...)
+	}
+}
+
+// withFrameChannel makes the subscription deliver to ch instead of a channel of its own.
+func withFrameChannel(ch chan *Frame) SubscribeOption {
+	return func(options *subscribeOptions) {
+		options.channel = ch
+	}
+}
+
+// subscriptionHandler is the dispatcher side of a subscription with middleware or an overflow policy.
+type subscriptionHandler struct {
+	middleware []Middleware
+	errorCh    chan error
+	errors     *atomic.Uint64
+	overflow   OverflowPolicy
+	dropped    *atomic.Uint64
+}
+
+// handle runs frame through the middleware chain with deliver at the end. Errors are counted and
+// sent to the subscription error channel without blocking.
+func (handler *subscriptionHandler) handle(frame *Frame, deliver HandlerFunc) {
+	next := deliver
+	for i := len(handler.middleware) - 1; i >= 0; i-- {
+		next = handler.middleware[i](next)
+	}
+	if err := next(frame); err != nil {
+		handler.errors.Add(1)
+		select {
+		case handler.errorCh <- err:
+		default:
+		}
+	}
+}
+
+// Errors returns the channel that receives the errors returned by the subscription middleware. Errors are dropped
+// when nobody reads the channel and its buffer is full; MiddlewareErrors still counts them.
+func (s *Subscription) Errors() <-chan error {
+	return s.errorCh
+}
+
+// MiddlewareErrors returns how many errors the subscription middleware has returned.
+func (s *Subscription) MiddlewareErrors() uint64 {
+	if s.errors == nil {
+		return 0
+	}
+	return s.errors.Load()
+}
@@ -0,0 +1,72 @@
+package go_stomp_websocket
+
+import (
+	"errors"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubscription_Middleware(t *testing.T) {
+	const count = 10
+	ts := startPushWSServer(t, count)
+	defer ts.Close()
+	client := connectTestClient(t, ts)
+	defer client.connection.Close()
+
+	// dropOdd must run first: after prefix the body no longer parses as a number
+	dropOdd := func(next HandlerFunc) HandlerFunc {
+		return func(frame *Frame) error {
+			n, _ := strconv.Atoi(frame.BodyString())
+			if n == 4 {
+				return errors.New("four is rejected")
+			}
+			if n%2 == 1 {
+				return nil
+			}
+			return next(frame)
+		}
+	}
+	prefix := func(next HandlerFunc) HandlerFunc {
+		return func(frame *Frame) error {
+			frame.SetBody(append([]byte("n"), frame.Body()...))
+			return next(frame)
+		}
+	}
+	sub, err := client.Subscribe("/topic/test", WithMiddleware(dropOdd), WithMiddleware(prefix))
+	assert.NoError(t, err)
+
+	for _, expected := range []string{"n0", "n2", "n6", "n8"} {
+		select {
+		case frame := <-sub.FrameCh:
+			assert.Equal(t, expected, frame.BodyString())
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for %s", expected)
+		}
+	}
+	select {
+	case err := <-sub.Errors():
+		assert.EqualError(t, err, "four is rejected")
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the middleware error")
+	}
+	assert.Equal(t, uint64(1), sub.MiddlewareErrors())
+}
+
+func TestSubscriptionHandler_ErrorChannelFull(t *testing.T) {
+	handler := &subscriptionHandler{
+		middleware: []Middleware{func(next HandlerFunc) HandlerFunc {
+			return func(frame *Frame) error { return errors.New("boom") }
+		}},
+		errorCh: make(chan error, 1),
+		errors:  &atomic.Uint64{},
+	}
+	for i := 0; i < 3; i++ {
+		handler.handle(&Frame{Command: MESSAGE}, func(frame *Frame) error { return nil })
+	}
+	assert.Equal(t, uint64(3), handler.errors.Load())
+	assert.Len(t, handler.errorCh, 1)
+}
@@ -0,0 +1,278 @@
+package go_stomp_websocket
+
+import (
+	"errors"
+	"fmt"
+	"hash/maphash"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// MigrationMode tells how MigrationWrapper.Send treats a failure of the secondary client.
+type MigrationMode int
+
+const (
+	// MigrationBestEffort logs and counts failures of the secondary client; Send only returns the error of the
+	// primary one.
+	MigrationBestEffort MigrationMode = iota
+	// MigrationRequireBoth makes Send fail when either client fails.
+	MigrationRequireBoth
+)
+
+// defaultDivergenceWindow is how long a message received through one client waits for its copy from the other.
+const defaultDivergenceWindow = 30 * time.Second
+
+type MigrationOption func(*migrationOptions)
+
+type migrationOptions struct {
+	mode   MigrationMode
+	window time.Duration
+}
+
+// WithMigrationMode sets how Send treats a failure of the secondary client. The default is MigrationBestEffort.
+func WithMigrationMode(mode MigrationMode) MigrationOption {
+	return func(options *migrationOptions) {
+		options.mode = mode
+	}
+}
+
+// WithDivergenceWindow sets how long a message received through one client waits for its copy from the other
+// before it counts as seen on one side only. The default is 30 seconds; 0 turns the comparison off.
+func WithDivergenceWindow(window time.Duration) MigrationOption {
+	return func(options *migrationOptions) {
+		options.window = window
+	}
+}
+
+// MigrationWrapper publishes through two clients connected to the brokers of a migration and consumes through
+// the one that is primary, comparing what arrives through both. The old client is primary until Switchover.
+type MigrationWrapper struct {
+	clients         [2]*StompClient // old, new
+	switchovers     atomic.Uint32   // the primary client is clients[switchovers%2]
+	mode            MigrationMode
+	divergence      *divergenceTracker // nil when the comparison is off
+	secondaryErrors atomic.Uint64
+}
+
+// NewMigrationWrapper wraps the clients of the old and the new broker. The wrapper does not connect or
+// reconnect them; Disconnect disconnects both.
+func NewMigrationWrapper(oldClient, newClient *StompClient, opts ...MigrationOption) *MigrationWrapper {
+	options := &migrationOptions{window: defaultDivergenceWindow}
+	for _, opt := range opts {
+		opt(options)
+	}
+	wrapper := &MigrationWrapper{clients: [2]*StompClient{oldClient, newClient}, mode: options.mode}
+	if options.window > 0 {
+		wrapper.divergence = newDivergenceTracker(options.window, time.Now)
+	}
+	return wrapper
+}
+
+func (w *MigrationWrapper) primaryIndex() int {
+	return int(w.switchovers.Load() % 2)
+}
+
+// Primary returns the client Subscribe consumes from.
+func (w *MigrationWrapper) Primary() *StompClient {
+	return w.clients[w.primaryIndex()]
+}
+
+// Secondary returns the client whose subscriptions are only compared.
+func (w *MigrationWrapper) Secondary() *StompClient {
+	return w.clients[1-w.primaryIndex()]
+}
+
+// Switchover swaps the primary and the secondary client. The subscriptions keep their FrameCh: frames of the
+// former primary that are buffered are still received, and the next frames come from the new primary.
+func (w *MigrationWrapper) Switchover() {
+	w.switchovers.Add(1)
+}
+
+// Send sends a SEND frame to destination through both clients, the primary one first.
+func (w *MigrationWrapper) Send(destination, contentType string, body []byte) error {
+	primary := w.primaryIndex()
+	err := w.clients[primary].Send(destination, contentType, body)
+	secondaryErr := w.clients[1-primary].Send(destination, contentType, body)
+	if secondaryErr == nil {
+		return err
+	}
+	w.secondaryErrors.Add(1)
+	if w.mode == MigrationRequireBoth {
+		return errors.Join(err, fmt.Errorf("%w: %w", ErrSecondarySend, secondaryErr))
+	}
+	w.clients[1-primary].logger.Errorf("Can't send to %s through the secondary client: %v", destination, secondaryErr)
+	return err
+}
+
+// MigrationSubscription is a subscription of a MigrationWrapper to a topic, made through both clients.
+type MigrationSubscription struct {
+	// FrameCh receives the MESSAGE frames of the primary client, and the ERROR frame of either client
+	// when its connection fails.
+	FrameCh       chan *Frame
+	Topic         string
+	subscriptions [2]*Subscription
+}
+
+// Subscribe subscribes to topic through both clients with opts. Both subscriptions deliver to FrameCh; the
+// frames of the secondary client are only compared with those of the primary one and then dropped. The
+// overflow policy applies to the frames of the primary client.
+func (w *MigrationWrapper) Subscribe(topic string, opts ...SubscribeOption) (*MigrationSubscription, error) {
+	options := &subscribeOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	subscription := &MigrationSubscription{FrameCh: make(chan *Frame, options.bufferSize), Topic: topic}
+	for side, client := range w.clients {
+		// the tap is innermost, so the middleware of opts sees the frames of both clients
+		sideOpts := append(opts[:len(opts):len(opts)], WithMiddleware(w.tap(side)), withFrameChannel(subscription.FrameCh))
+		s, err := client.Subscribe(topic, sideOpts...)
+		if err != nil {
+			subscription.Unsubscribe()
+			return nil, err
+		}
+		subscription.subscriptions[side] = s
+	}
+	return subscription, nil
+}
+
+// tap records the frames of the subscriptions of one client and drops them while the client is secondary.
+func (w *MigrationWrapper) tap(side int) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(frame *Frame) error {
+			if w.divergence != nil {
+				w.divergence.observe(side, frame)
+			}
+			if w.primaryIndex() != side {
+				return nil
+			}
+			return next(frame)
+		}
+	}
+}
+
+// Unsubscribe unsubscribes through both clients.
+func (s *MigrationSubscription) Unsubscribe() {
+	for _, subscription := range s.subscriptions {
+		if subscription != nil {
+			subscription.Unsubscribe()
+		}
+	}
+}
+
+// Disconnect disconnects both clients.
+func (w *MigrationWrapper) Disconnect() error {
+	return errors.Join(w.clients[0].Disconnect(), w.clients[1].Disconnect())
+}
+
+// DivergenceStats compares the MESSAGE frames the subscriptions of a MigrationWrapper received through the old
+// and the new client. Frames with the same destination and body are copies of one message.
+type DivergenceStats struct {
+	Matched         uint64 // received through both clients within the window
+	OnlyOld         uint64 // received through the old client only
+	OnlyNew         uint64 // received through the new client only
+	PendingOld      int    // received through the old client within the window, the copy may still arrive
+	PendingNew      int    // received through the new client within the window, the copy may still arrive
+	SecondaryErrors uint64 // failed sends through the secondary client
+}
+
+// Divergence returns what the subscriptions received through one client only. It is safe to cut over when
+// OnlyOld and OnlyNew stop growing. Only SecondaryErrors is set when the comparison is off.
+func (w *MigrationWrapper) Divergence() DivergenceStats {
+	var stats DivergenceStats
+	if w.divergence != nil {
+		stats = w.divergence.stats()
+	}
+	stats.SecondaryErrors = w.secondaryErrors.Load()
+	return stats
+}
+
+type observation struct {
+	key  uint64
+	side int
+	at   time.Time
+}
+
+// divergenceTracker matches the frames received through one client with those received through the other.
+type divergenceTracker struct {
+	mutex    sync.Mutex
+	window   time.Duration
+	now      func() time.Time
+	seed     maphash.Seed
+	unpaired map[uint64]*[2]int // frames per key and side still waiting for a copy
+	queue    []observation      // in arrival order, for expiry
+	pending  [2]int
+	only     [2]uint64
+	matched  uint64
+}
+
+func newDivergenceTracker(window time.Duration, now func() time.Time) *divergenceTracker {
+	return &divergenceTracker{window: window, now: now, seed: maphash.MakeSeed(), unpaired: make(map[uint64]*[2]int)}
+}
+
+func (t *divergenceTracker) key(frame *Frame) uint64 {
+	var h maphash.Hash
+	h.SetSeed(t.seed)
+	destination, _ := frame.Contains("destination")
+	_, _ = h.WriteString(destination)
+	_ = h.WriteByte(0)
+	_, _ = h.Write(frame.body)
+	return h.Sum64()
+}
+
+// observe records a frame received through side, matching it with an unpaired copy from the other side.
+func (t *divergenceTracker) observe(side int, frame *Frame) {
+	key := t.key(frame)
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	now := t.now()
+	t.expire(now)
+	counts := t.unpaired[key]
+	if counts != nil && counts[1-side] > 0 {
+		t.release(key, counts, 1-side)
+		t.matched++
+		return
+	}
+	if counts == nil {
+		counts = new([2]int)
+		t.unpaired[key] = counts
+	}
+	counts[side]++
+	t.pending[side]++
+	t.queue = append(t.queue, observation{key: key, side: side, at: now})
+}
+
+// expire counts the frames that waited longer than the window for their copy as seen on one side only.
+// A matched frame leaves its observation in the queue, which then expires the next unpaired frame with the same
+// key and side a little early; the counts stay the same.
+func (t *divergenceTracker) expire(now time.Time) {
+	for len(t.queue) > 0 && now.Sub(t.queue[0].at) > t.window {
+		o := t.queue[0]
+		t.queue = t.queue[1:]
+		if counts := t.unpaired[o.key]; counts != nil && counts[o.side] > 0 {
+			t.release(o.key, counts, o.side)
+			t.only[o.side]++
+		}
+	}
+}
+
+func (t *divergenceTracker) release(key uint64, counts *[2]int, side int) {
+	counts[side]--
+	t.pending[side]--
+	if counts[0] == 0 && counts[1] == 0 {
+		delete(t.unpaired, key)
+	}
+}
+
+func (t *divergenceTracker) stats() DivergenceStats {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.expire(t.now())
+	return DivergenceStats{
+		Matched:    t.matched,
+		OnlyOld:    t.only[0],
+		OnlyNew:    t.only[1],
+		PendingOld: t.pending[0],
+		PendingNew: t.pending[1],
+	}
+}
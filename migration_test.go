@@ -0,0 +1,175 @@
+package go_stomp_websocket
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDivergenceTracker(t *testing.T) {
+	type event struct {
+		side  int
+		body  string
+		after time.Duration // since the previous event
+	}
+	tests := []struct {
+		name     string
+		events   []event
+		expected DivergenceStats
+	}{
+		{name: "matched", events: []event{{side: 0, body: "a"}, {side: 1, body: "a", after: time.Second}},
+			expected: DivergenceStats{Matched: 1}},
+		{name: "matched either way", events: []event{{side: 1, body: "a"}, {side: 0, body: "a"}},
+			expected: DivergenceStats{Matched: 1}},
+		{name: "pending", events: []event{{side: 0, body: "a"}, {side: 1, body: "b"}},
+			expected: DivergenceStats{PendingOld: 1, PendingNew: 1}},
+		{name: "same side twice", events: []event{{side: 0, body: "a"}, {side: 0, body: "a"}, {side: 1, body: "a"}},
+			expected: DivergenceStats{Matched: 1, PendingOld: 1}},
+		{name: "copy after the window", events: []event{{side: 0, body: "a"}, {side: 1, body: "a", after: 11 * time.Second}},
+			expected: DivergenceStats{OnlyOld: 1, PendingNew: 1}},
+		{name: "expired by stats", events: []event{{side: 1, body: "a"}, {side: 0, body: "b", after: 5 * time.Second}, {side: 0, body: "c", after: 6 * time.Second}},
+			expected: DivergenceStats{OnlyNew: 1, PendingOld: 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Unix(0, 0)
+			tracker := newDivergenceTracker(10*time.Second, func() time.Time { return now })
+			for _, e := range tt.events {
+				now = now.Add(e.after)
+				tracker.observe(e.side, createTestFrame(MESSAGE, []string{"destination:/topic/a"}, e.body))
+			}
+			assert.Equal(t, tt.expected, tracker.stats())
+		})
+	}
+}
+
+func TestMigrationWrapper_Send(t *testing.T) {
+	tests := []struct {
+		name            string
+		mode            MigrationMode
+		closeSecondary  bool
+		expectedErr     error
+		secondaryErrors uint64
+	}{
+		{name: "both sent", mode: MigrationRequireBoth},
+		{name: "best effort", mode: MigrationBestEffort, closeSecondary: true, secondaryErrors: 1},
+		{name: "require both", mode: MigrationRequireBoth, closeSecondary: true, expectedErr: ErrSecondarySend, secondaryErrors: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			oldServer, _ := startTestWSServer(t)
+			defer oldServer.Close()
+			newServer, _ := startTestWSServer(t)
+			defer newServer.Close()
+			oldClient := connectTestClient(t, oldServer, WithLogger(NopLogger()))
+			newClient := connectTestClient(t, newServer, WithLogger(NopLogger()))
+			wrapper := NewMigrationWrapper(oldClient, newClient, WithMigrationMode(tt.mode))
+			if tt.closeSecondary {
+				// closed under the client, a send after Disconnect panics with the stompdebug tag
+				_ = newClient.connection.Close()
+				<-newClient.done
+			}
+
+			err := wrapper.Send("/queue/a", "text/plain", []byte("hello"))
+			if tt.expectedErr != nil {
+				assert.ErrorIs(t, err, tt.expectedErr)
+				assert.ErrorIs(t, err, ErrClientClosed)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.secondaryErrors, wrapper.Divergence().SecondaryErrors)
+			assert.NoError(t, oldClient.Disconnect())
+		})
+	}
+}
+
+// startTriggeredPushServer starts a test server that answers receipts and sends a MESSAGE frame for the last
+// subscription with every body sent to the returned channel. subscribed is closed on the first SUBSCRIBE.
+func startTriggeredPushServer(t *testing.T) (ts *httptest.Server, push chan<- string, subscribed <-chan struct{}) {
+	bodies := make(chan string)
+	subscribedCh := make(chan struct{})
+	ts = startScriptedWSServer(t, func(c *websocket.Conn) {
+		incoming := make(chan *Frame)
+		go func() {
+			defer close(incoming)
+			for {
+				_, data, err := c.ReadMessage()
+				if err != nil {
+					return
+				}
+				incoming <- ReadFrame(append([]byte("a"), data...))
+			}
+		}()
+		var id string
+		for {
+			select {
+			case frame, ok := <-incoming:
+				if !ok {
+					return
+				}
+				if frame.Command == SUBSCRIBE && id == "" {
+					id, _ = frame.Contains(Id)
+					close(subscribedCh)
+				}
+				if receipt, ok := frame.Contains(Receipt); ok {
+					_ = c.WriteMessage(websocket.TextMessage, []byte(`a["RECEIPT\nreceipt-id:`+receipt+`\n\n\u0000"]`))
+				}
+			case body := <-bodies:
+				message := CreateFrame(MESSAGE, []string{Subscription_h + ":" + id, "destination:/topic/a"})
+				message.SetBody([]byte(body))
+				_ = c.WriteMessage(websocket.TextMessage, append([]byte("a"), message.Bytes()...))
+			}
+		}
+	})
+	t.Cleanup(ts.Close)
+	return ts, bodies, subscribedCh
+}
+
+func receiveBody(t *testing.T, ch chan *Frame) string {
+	t.Helper()
+	select {
+	case frame := <-ch:
+		return frame.BodyString()
+	case <-time.After(5 * time.Second):
+		t.Fatal("no frame received")
+		return ""
+	}
+}
+
+func TestMigrationWrapper_Switchover(t *testing.T) {
+	oldServer, pushOld, oldSubscribed := startTriggeredPushServer(t)
+	newServer, pushNew, newSubscribed := startTriggeredPushServer(t)
+	oldClient := connectTestClient(t, oldServer, WithLogger(NopLogger()))
+	newClient := connectTestClient(t, newServer, WithLogger(NopLogger()))
+	wrapper := NewMigrationWrapper(oldClient, newClient)
+	defer func() { assert.NoError(t, wrapper.Disconnect()) }()
+
+	subscription, err := wrapper.Subscribe("/topic/a", WithBufferSize(8))
+	if !assert.NoError(t, err) {
+		return
+	}
+	<-oldSubscribed
+	<-newSubscribed
+
+	pushOld <- "1"
+	pushNew <- "1"
+	assert.Equal(t, "1", receiveBody(t, subscription.FrameCh))
+	pushNew <- "2" // dropped, the new client is secondary
+	assert.Eventually(t, func() bool {
+		return wrapper.Divergence() == DivergenceStats{Matched: 1, PendingNew: 1}
+	}, 5*time.Second, 10*time.Millisecond)
+
+	wrapper.Switchover()
+	assert.Same(t, newClient, wrapper.Primary())
+	pushNew <- "3"
+	pushOld <- "3"
+	assert.Equal(t, "3", receiveBody(t, subscription.FrameCh))
+	assert.Eventually(t, func() bool {
+		return wrapper.Divergence() == DivergenceStats{Matched: 2, PendingNew: 1}
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, 0, len(subscription.FrameCh))
+	subscription.Unsubscribe()
+}
@@ -0,0 +1,347 @@
+package go_stomp_websocket
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+type ConnectOption func(*connectOptions)
+
+const defaultDisconnectTimeout = 5 * time.Second
+
+type TokenTransport int
+
+const (
+	// TokenInHeader sends the token as a bearer Authorization header on the upgrade request, so WithUpgradeHeaders
+	// must not set one.
+	TokenInHeader TokenTransport = iota
+	// TokenInQuery sends the token as the access_token query parameter of the websocket URL. A URL that has an
+	// access_token parameter already is rejected by connect.
+	TokenInQuery
+)
+
+type connectOptions struct {
+	upgradeHeaders http.Header
+	cookieJar      http.CookieJar
+	tokenTransport TokenTransport
+	writeQueueSize int
+	readTimeout    time.Duration
+	writeTimeout   time.Duration
+
+	disconnectTimeout time.Duration
+	rawTransport      bool
+	binaryFrames      bool
+	lenientSockJS     bool
+	logger            Logger
+	trace             frameTrace
+	metrics           MetricsCollector
+	maxFrameSize      int64
+	integrity         *IntegrityConfig
+	bufferSizer       *BufferSizer
+
+	pingInterval time.Duration
+
+	maxOutboundMessageSize int
+	chunkTimeout           time.Duration
+	aliasMinLength         int
+	maxAliases             int
+	batchFrames            int
+	batchBytes             int
+	errorRules             []ErrorRule
+	clientID               string
+	dialect                BrokerDialect
+	headerSupplier         HeaderSupplier
+	suppliedHeaders        []suppliedHeader // of the connect attempt, set before dialing
+
+	acceptVersions      []string // empty means defaultAcceptVersions
+	subprotocols        []string // nil means defaultSubprotocols
+	offeredSubprotocols []string // set by applyDialer
+
+	renegotiateHeartbeats bool
+	bufferPoisoning       bool
+
+	parseErrorPolicy          ParseErrorPolicy
+	maxConsecutiveParseErrors int // below 1 means defaultMaxConsecutiveParseErrors
+
+	tokenConnect     bool   // set by the token connect functions, which use tokenTransport
+	requestedBuffers [2]int // dialer read and write buffer sizes as given
+	effectiveBuffers [2]int // after applyDialer
+
+	ids                IDGenerator
+	heartbeatTolerance float64
+	incomingHeartbeat  time.Duration // replaces the negotiated incoming heart-beat interval, for tests
+	handshakeTimeout   time.Duration // of the dialer, also bounds the wait for CONNECTED; set by applyDialer
+	sessionIDGenerator func() (serverID, sessionID string)
+	session            SockJSSession // generated for the current connect
+	endpoint           url.URL       // as passed to the current connect
+
+	proxy     func(*http.Request) (*url.URL, error)
+	proxyUser *url.Userinfo
+
+	compression           *compression // nil leaves the dialer as given
+	offeredCompression    bool         // set by applyDialer
+	compressionNegotiated bool         // set by the upgrade response of the current connect
+
+	affinityCookies  []*http.Cookie
+	sockJSInfoCheck  bool
+	sockJSInfoClient *http.Client   // nil builds one from the dialer
+	sockJSInfo       *SockJSInfo    // set by the info check of the current connect
+	responseCookies  []*http.Cookie // set by the upgrade response of the current connect
+}
+
+func newConnectOptions(opts []ConnectOption) *connectOptions {
+	options := &connectOptions{
+		disconnectTimeout:  defaultDisconnectTimeout,
+		logger:             NopLogger(),
+		trace:              frameTrace{redactedHeaders: defaultRedactedHeaderKeys},
+		metrics:            nopMetrics{},
+		errorRules:         defaultErrorRules,
+		dialect:            DialectActiveMQ,
+		ids:                randomIDs{},
+		heartbeatTolerance: defaultHeartbeatTolerance,
+	}
+	for _, opt := range opts {
+		opt(options)
+	}
+	return options
+}
+
+// WithUpgradeHeaders adds extra HTTP headers to the websocket upgrade request.
+func WithUpgradeHeaders(headers http.Header) ConnectOption {
+	return func(options *connectOptions) {
+		if options.upgradeHeaders == nil {
+			options.upgradeHeaders = http.Header{}
+		}
+		for key, values := range headers {
+			for _, value := range values {
+				options.upgradeHeaders.Add(key, value)
+			}
+		}
+	}
+}
+
+// WithCookieJar sets the cookie jar used by the dialer for the websocket upgrade request.
+func WithCookieJar(jar http.CookieJar) ConnectOption {
+	return func(options *connectOptions) {
+		options.cookieJar = jar
+	}
+}
+
+// WithTokenTransport selects how ConnectWithToken passes the token to the server. The default is TokenInHeader.
+func WithTokenTransport(transport TokenTransport) ConnectOption {
+	return func(options *connectOptions) {
+		options.tokenTransport = transport
+	}
+}
+
+// WithWriteQueueSize sets the capacity of the outgoing frame queue. The default is 0, so every write waits for
+// the writer goroutine to pick it up.
+func WithWriteQueueSize(size int) ConnectOption {
+	return func(options *connectOptions) {
+		options.writeQueueSize = size
+	}
+}
+
+// WithReadTimeout sets the deadline for every read from the websocket connection. A read that times out
+// closes the connection and delivers an ERROR frame to the subscriptions. Zero means no deadline.
+// Heart-beats count as reads, so the timeout must be longer than the server heart-beat interval
+// (SockJS servers send one every 25 seconds by default).
+func WithReadTimeout(timeout time.Duration) ConnectOption {
+	return func(options *connectOptions) {
+		options.readTimeout = timeout
+	}
+}
+
+// WithWriteTimeout sets the deadline for every write to the websocket connection. A write that times out
+// closes the connection and delivers an ERROR frame to the subscriptions. Zero means no deadline.
+func WithWriteTimeout(timeout time.Duration) ConnectOption {
+	return func(options *connectOptions) {
+		options.writeTimeout = timeout
+	}
+}
+
+// WithDisconnectTimeout sets how long Disconnect waits for the broker receipt. The default is 5 seconds.
+func WithDisconnectTimeout(timeout time.Duration) ConnectOption {
+	return func(options *connectOptions) {
+		options.disconnectTimeout = timeout
+	}
+}
+
+// WithRawTransport makes the client speak plain STOMP over the websocket instead of SockJS framing.
+// The URL is dialed as given, without SockJS session segments.
+func WithRawTransport() ConnectOption {
+	return func(options *connectOptions) {
+		options.rawTransport = true
+	}
+}
+
+// WithLenientSockJS makes the client read SockJS messages that are not valid JSON with ReadFrame, for legacy
+// servers that do not JSON escape the frames they send. Without it such a message fails as a *FrameParseError.
+func WithLenientSockJS() ConnectOption {
+	return func(options *connectOptions) {
+		options.lenientSockJS = true
+	}
+}
+
+// WithBinaryFrames makes the raw transport send frames as binary websocket messages, for brokers that require
+// them. SockJS is text only, so the option has no effect without WithRawTransport.
+func WithBinaryFrames() ConnectOption {
+	return func(options *connectOptions) {
+		options.binaryFrames = true
+	}
+}
+
+// WithLogger sets the logger of the client. Frames sent and received are traced at debug level with
+// credential headers masked. The default discards everything; pass logging.GetLogger("stomp") of
+// qubership-core-lib-go to keep the logs of earlier releases.
+func WithLogger(l Logger) ConnectOption {
+	return func(options *connectOptions) {
+		if l == nil {
+			l = NopLogger()
+		}
+		options.logger = l
+	}
+}
+
+// WithMetrics sets the collector of the client metrics. The default collects nothing; NewCounterMetrics
+// returns a collector with in-memory counters.
+func WithMetrics(metrics MetricsCollector) ConnectOption {
+	return func(options *connectOptions) {
+		if metrics == nil {
+			metrics = nopMetrics{}
+		}
+		options.metrics = metrics
+	}
+}
+
+// WithMaxFrameSize limits the size of incoming websocket messages and the body length of incoming frames.
+// A larger message or frame closes the connection and delivers an ERROR frame to the subscriptions.
+// Zero, the default, means no limit.
+func WithMaxFrameSize(bytes int64) ConnectOption {
+	return func(options *connectOptions) {
+		options.maxFrameSize = bytes
+	}
+}
+
+// WithSessionIDGenerator replaces the random SockJS server and session ids in the dialed URL path.
+// The ids may only contain letters, digits, '-', '_' and '~'; others fail the connect.
+func WithSessionIDGenerator(generator func() (serverID, sessionID string)) ConnectOption {
+	return func(options *connectOptions) {
+		options.sessionIDGenerator = generator
+	}
+}
+
+// WithIDGenerator replaces the random subscription, receipt, chunk and SockJS session ids, for example with a
+// sequential generator in tests that compare frames byte for byte. WithSessionIDGenerator takes precedence for
+// the SockJS ids. A nil generator keeps the default.
+func WithIDGenerator(generator IDGenerator) ConnectOption {
+	return func(options *connectOptions) {
+		if generator != nil {
+			options.ids = generator
+		}
+	}
+}
+
+// WithPingInterval makes the client send a websocket ping every interval, independent of STOMP heart-beats,
+// so that proxies do not close an idle connection. A pong extends the read deadline set by WithReadTimeout.
+// When 3 pings in a row are not answered the connection is closed and ErrPongTimeout is reported.
+// Zero, the default, sends no pings.
+func WithPingInterval(interval time.Duration) ConnectOption {
+	return func(options *connectOptions) {
+		options.pingInterval = interval
+	}
+}
+
+// WithMaxOutboundMessageSize limits the size of the websocket messages the client writes, so that gorilla/websocket
+// never fragments a message for gateways that reject fragments. Set the dialer WriteBufferSize to the same value.
+// Larger frames are rejected by Send and TrySend with ErrFrameTooLargeForTransport. Zero, the default, means no limit.
+func WithMaxOutboundMessageSize(bytes int) ConnectOption {
+	return func(options *connectOptions) {
+		options.maxOutboundMessageSize = bytes
+	}
+}
+
+// WithChunking makes Send split the body of a frame larger than WithMaxOutboundMessageSize across several frames
+// with x-chunk headers, and joins such frames into one message on the receiving side. A message whose chunks do not
+// all arrive within timeout is dropped and ErrChunkTimeout is sent to the subscription Errors channel.
+// Only clients of this library join chunks, so enable it on both sides, usually with the raw transport.
+func WithChunking(timeout time.Duration) ConnectOption {
+	return func(options *connectOptions) {
+		options.chunkTimeout = timeout
+	}
+}
+
+// WithHeartbeatTolerance sets how many heart-beat intervals the broker may stay silent before the client
+// considers the connection dead. The interval is the incoming one negotiated in CONNECTED; when nothing, not
+// even a heart-beat, is read for interval times factor, the connection is closed, ErrHeartbeatTimeout is
+// reported, and pending receipts and the subscriptions get an ERROR frame. The default is 2; 0 turns the check
+// off. Brokers that negotiate no incoming heart-beats are never checked.
+func WithHeartbeatTolerance(factor float64) ConnectOption {
+	return func(options *connectOptions) {
+		options.heartbeatTolerance = factor
+	}
+}
+
+// WithHeartbeatRenegotiation makes the client take over the heart-beat header of a CONNECTED frame the broker
+// sends mid-session. Without it such a frame is only reported as a ProtocolAnomaly.
+func WithHeartbeatRenegotiation() ConnectOption {
+	return func(options *connectOptions) {
+		options.renegotiateHeartbeats = true
+	}
+}
+
+// WithBufferPoisoning overwrites the body passed to a SubscribeRaw handler once the handler returns, so that
+// handlers keeping the body beyond the call are caught in tests. It is a debugging aid and costs a pass over
+// every body.
+func WithBufferPoisoning() ConnectOption {
+	return func(options *connectOptions) {
+		options.bufferPoisoning = true
+	}
+}
+
+func (options *connectOptions) applyDialer(dialer *websocket.Dialer) {
+	requested := *dialer
+	defer func() { options.recordDialer(requested, *dialer) }()
+	if options.cookieJar != nil {
+		dialer.Jar = options.cookieJar
+	}
+	options.applyProxy(dialer)
+	if len(dialer.Subprotocols) == 0 {
+		dialer.Subprotocols = options.subprotocols
+		if options.subprotocols == nil {
+			dialer.Subprotocols = defaultSubprotocols
+		}
+	}
+	options.offeredSubprotocols = dialer.Subprotocols
+	options.handshakeTimeout = dialer.HandshakeTimeout
+	if options.compression != nil {
+		dialer.EnableCompression = options.compression.enabled
+	}
+	options.offeredCompression = dialer.EnableCompression
+	if options.bufferSizer != nil {
+		options.bufferSizer.apply(dialer, options.logger)
+	}
+}
+
+// mergeUpgradeHeaders copies the caller supplied upgrade headers into requestHeaders.
+// Headers listed in reserved are set by the client itself, so a caller value for them is reported as an error
+// instead of being dropped.
+func (options *connectOptions) mergeUpgradeHeaders(requestHeaders http.Header, reserved ...string) error {
+	for key := range options.upgradeHeaders {
+		for _, r := range reserved {
+			if http.CanonicalHeaderKey(key) == http.CanonicalHeaderKey(r) {
+				return fmt.Errorf("%w: %s", errReservedUpgradeHeader, r)
+			}
+		}
+	}
+	for key, values := range options.upgradeHeaders {
+		for _, value := range values {
+			requestHeaders.Add(key, value)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package go_stomp_websocket
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+)
+
+// ParseErrorPolicy decides what the read loop does with a websocket message it can't read STOMP frames from.
+type ParseErrorPolicy int
+
+const (
+	// FailConnection ends the connection with the *FrameParseError. It is the default.
+	FailConnection ParseErrorPolicy = iota
+	// SkipFrame drops the rest of the malformed message and keeps reading. The frames read from the message
+	// before the malformed one are delivered.
+	SkipFrame
+)
+
+// defaultMaxConsecutiveParseErrors is the number of malformed messages in a row after which SkipFrame gives up.
+const defaultMaxConsecutiveParseErrors = 10
+
+// WithParseErrorPolicy sets what happens when a websocket message can't be parsed. The default is FailConnection.
+// With SkipFrame the malformed message is logged, counted with the ErrorKindParse metric, published on
+// Anomalies as AnomalyMalformedFrame and dropped. A message larger than WithMaxFrameSize allows and a SockJS
+// close message still end the connection.
+func WithParseErrorPolicy(policy ParseErrorPolicy) ConnectOption {
+	return func(options *connectOptions) {
+		options.parseErrorPolicy = policy
+	}
+}
+
+// WithMaxConsecutiveParseErrors sets after how many malformed messages in a row SkipFrame ends the connection
+// with an error matching ErrTooManyParseErrors, so that a client does not spin on a desynchronized stream. The
+// count starts over once a message yields a frame. The default is 10; n below 1 keeps it.
+func WithMaxConsecutiveParseErrors(n int) ConnectOption {
+	return func(options *connectOptions) {
+		options.maxConsecutiveParseErrors = n
+	}
+}
+
+// parseErrors applies the ParseErrorPolicy of a connection.
+type parseErrors struct {
+	policy      ParseErrorPolicy
+	limit       int
+	consecutive int // owned by the read loop
+	skipped     atomic.Uint64
+}
+
+func newParseErrors(options *connectOptions) *parseErrors {
+	limit := options.maxConsecutiveParseErrors
+	if limit < 1 {
+		limit = defaultMaxConsecutiveParseErrors
+	}
+	return &parseErrors{policy: options.parseErrorPolicy, limit: limit}
+}
+
+// SkippedFrames returns the number of malformed websocket messages that SkipFrame dropped.
+func (stompClient StompClient) SkippedFrames() uint64 {
+	if stompClient.parseErrors == nil {
+		return 0
+	}
+	return stompClient.parseErrors.skipped.Load()
+}
+
+// skipParseError reports and drops a malformed message under SkipFrame and returns nil. It returns the error to
+// end the connection with otherwise. It must only be called from the read loop.
+func (stompClient *StompClient) skipParseError(err error) error {
+	state := stompClient.parseErrors
+	var parseErr *FrameParseError
+	if state == nil || state.policy != SkipFrame || !errors.As(err, &parseErr) || errors.Is(err, ErrFrameTooLarge) {
+		return err
+	}
+	state.consecutive++
+	if state.consecutive >= state.limit {
+		return fmt.Errorf("%w: %d websocket messages in a row: %w", ErrTooManyParseErrors, state.consecutive, err)
+	}
+	state.skipped.Add(1)
+	stompClient.logger.Errorf("[%s] Skipping malformed websocket message: %s\n", roleReadLoop, err)
+	stompClient.metrics.ErrorOccurred(ErrorKindParse)
+	select {
+	case stompClient.anomalies <- ProtocolAnomaly{Kind: AnomalyMalformedFrame, Err: parseErr}:
+	default:
+	}
+	return nil
+}
+
+// parsed starts the count of malformed messages in a row over once a message yielded frames.
+func (state *parseErrors) parsed(frames []*Frame) {
+	if state != nil && len(frames) > 0 {
+		state.consecutive = 0
+	}
+}
@@ -0,0 +1,135 @@
+package go_stomp_websocket
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+// startMalformedWSServer starts a test server that writes bodies once the first SUBSCRIBE arrives: a nil body as
+// a binary message, which SockJS can't parse, any other as a MESSAGE frame for the subscription.
+func startMalformedWSServer(t *testing.T, bodies ...[]byte) *httptest.Server {
+	t.Helper()
+	ts := startScriptedWSServer(t, func(c *websocket.Conn) {
+		for {
+			_, msg, err := c.ReadMessage()
+			if err != nil {
+				return
+			}
+			frame := ReadFrame(append([]byte("a"), msg...))
+			if frame.Command != SUBSCRIBE {
+				continue
+			}
+			id, _ := frame.Contains(Id)
+			for _, body := range bodies {
+				messageType, data := websocket.BinaryMessage, []byte{0x01, 0x02}
+				if body != nil {
+					message := createTestFrame(MESSAGE, []string{Subscription_h + ":" + id, Destination + ":/topic/test"}, string(body))
+					messageType, data = websocket.TextMessage, append([]byte("a"), message.Bytes()...)
+				}
+				if err := c.WriteMessage(messageType, data); err != nil {
+					return
+				}
+			}
+		}
+	})
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func TestSkipFrame_DropsMalformedMessages(t *testing.T) {
+	ts := startMalformedWSServer(t, nil, []byte("1"), nil, nil, []byte("2"))
+	metrics := NewCounterMetrics()
+	client := connectTestClient(t, ts, WithLogger(NopLogger()), WithMetrics(metrics),
+		WithParseErrorPolicy(SkipFrame), WithMaxConsecutiveParseErrors(3))
+	defer client.connection.Close()
+	sub, err := client.Subscribe("/topic/test")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, "1", receiveBody(t, sub.FrameCh))
+	assert.Equal(t, "2", receiveBody(t, sub.FrameCh))
+	assert.Equal(t, uint64(3), client.SkippedFrames())
+	assert.Equal(t, uint64(3), metrics.Snapshot().Errors[ErrorKindParse])
+	for range 3 {
+		select {
+		case anomaly := <-client.Anomalies():
+			assert.Equal(t, AnomalyMalformedFrame, anomaly.Kind)
+			assert.Nil(t, anomaly.Frame)
+			if assert.NotNil(t, anomaly.Err) {
+				assert.ErrorIs(t, anomaly.Err, ErrBinaryMessage)
+				assert.Equal(t, []byte{0x01, 0x02}, anomaly.Err.Raw)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting on the anomaly")
+		}
+	}
+	select {
+	case err := <-client.Errors():
+		t.Fatalf("unexpected connection error %v", err)
+	default:
+	}
+}
+
+func TestParseErrorPolicy_FailsConnection(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    []ConnectOption
+		bodies  [][]byte
+		check   func(t *testing.T, err error)
+		skipped uint64
+	}{
+		{
+			name:   "FailConnection",
+			bodies: [][]byte{nil},
+			check: func(t *testing.T, err error) {
+				assert.ErrorIs(t, err, ErrBinaryMessage)
+				assert.False(t, errors.Is(err, ErrTooManyParseErrors))
+			},
+		},
+		{
+			name:   "SkipFrame gives up",
+			opts:   []ConnectOption{WithParseErrorPolicy(SkipFrame), WithMaxConsecutiveParseErrors(3)},
+			bodies: [][]byte{nil, nil, nil},
+			check: func(t *testing.T, err error) {
+				assert.ErrorIs(t, err, ErrTooManyParseErrors)
+				assert.ErrorIs(t, err, ErrBinaryMessage)
+				assert.ErrorAs(t, err, new(*FrameParseError))
+				assert.Contains(t, err.Error(), "3 websocket messages in a row")
+			},
+			skipped: 2,
+		},
+		{
+			name:   "SkipFrame does not skip frames that are too large",
+			opts:   []ConnectOption{WithParseErrorPolicy(SkipFrame), WithMaxFrameSize(64)},
+			bodies: [][]byte{make([]byte, 128)},
+			check: func(t *testing.T, err error) {
+				assert.ErrorIs(t, err, ErrFrameTooLarge)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := startMalformedWSServer(t, tt.bodies...)
+			client := connectTestClient(t, ts, append(tt.opts, WithLogger(NopLogger()))...)
+			defer client.connection.Close()
+			_, err := client.Subscribe("/topic/test")
+			assert.NoError(t, err)
+
+			err, ok := receiveTerminalError(t, client)
+			if assert.True(t, ok) {
+				tt.check(t, err)
+			}
+			assert.Equal(t, tt.skipped, client.SkippedFrames())
+		})
+	}
+}
+
+func TestSkippedFrames_ClosedClient(t *testing.T) {
+	assert.Zero(t, StompClient{}.SkippedFrames())
+}
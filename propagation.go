@@ -0,0 +1,142 @@
+package go_stomp_websocket
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// HeaderSupplier returns the headers, as "key:value" strings like Frame.Headers, that the client stamps onto the
+// websocket upgrade request, the CONNECT frame and the frames of SendCtx and SubscribeCtx. It is meant for
+// propagating trace headers such as traceparent or X-B3-TraceId taken from ctx.
+type HeaderSupplier func(ctx context.Context) []string
+
+// WithHeaderSupplier sets the HeaderSupplier of the client. It is called with the context of the connect call,
+// context.Background() for Connect, and with the context of every SendCtx and SubscribeCtx call. Supplied
+// headers that STOMP or the client set themselves fail the call with ErrReservedHeader.
+func WithHeaderSupplier(supplier HeaderSupplier) ConnectOption {
+	return func(options *connectOptions) {
+		options.headerSupplier = supplier
+	}
+}
+
+// reservedHeaders are the headers of the STOMP frames and of the client's own features, which a HeaderSupplier
+// must not set. They are compared case-insensitively.
+var reservedHeaders = map[string]bool{
+	"accept-version": true,
+	"heart-beat":     true,
+	"host":           true,
+	"login":          true,
+	"passcode":       true,
+	"version":        true,
+	"session":        true,
+	"server":         true,
+	Destination:      true,
+	ContentType:      true,
+	contentLength:    true,
+	Id:               true,
+	Ack:              true,
+	Receipt:          true,
+	ReceiptId:        true,
+	Subscription_h:   true,
+	MessageId:        true,
+	Message:          true,
+	"transaction":    true,
+	ClientId:         true,
+	ChunkId:          true,
+	ChunkIndex:       true,
+	ChunkCount:       true,
+	BodySHA256:       true,
+	DestinationAlias: true,
+}
+
+func isReservedHeader(key string) bool {
+	return reservedHeaders[strings.ToLower(key)]
+}
+
+type suppliedHeader struct {
+	key, value string
+}
+
+// suppliedHeaders calls supplier with ctx and parses the headers it returns. It returns nil without a supplier.
+func suppliedHeaders(ctx context.Context, supplier HeaderSupplier) ([]suppliedHeader, error) {
+	if supplier == nil {
+		return nil, nil
+	}
+	var headers []suppliedHeader
+	for _, header := range supplier(ctx) {
+		key, value, found := strings.Cut(header, ":")
+		if !found {
+			return nil, fmt.Errorf("supplied header %q has no ':'", header)
+		}
+		if isReservedHeader(key) {
+			return nil, fmt.Errorf("%w: %s", ErrReservedHeader, key)
+		}
+		headers = append(headers, suppliedHeader{key: key, value: value})
+	}
+	return headers, nil
+}
+
+// stampHeaders adds headers to builder, which fails on keys it has already.
+func stampHeaders(builder *FrameBuilder, headers []suppliedHeader) {
+	for _, header := range headers {
+		builder.WithHeader(header.key, header.value)
+	}
+}
+
+// addUpgradeHeaders adds headers to the websocket upgrade request.
+func addUpgradeHeaders(requestHeaders http.Header, headers []suppliedHeader) {
+	for _, header := range headers {
+		requestHeaders.Add(header.key, header.value)
+	}
+}
+
+// SendCtx works like Send and adds the headers of the HeaderSupplier for ctx to the SEND frame. It returns
+// ctx.Err() without sending when ctx is done already.
+func (stompClient StompClient) SendCtx(ctx context.Context, destination, contentType string, body []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	headers, err := suppliedHeaders(ctx, stompClient.headerSupplier)
+	if err != nil {
+		return err
+	}
+	frame, err := stompClient.createSendFrame(destination, contentType, body, headers...)
+	if err != nil {
+		return err
+	}
+	return stompClient.sendFrame(frame)
+}
+
+// SubscribeCtx works like Subscribe and adds the headers of the HeaderSupplier for ctx to the SUBSCRIBE frame.
+// It returns ctx.Err() without subscribing when ctx is done already.
+func (stompClient StompClient) SubscribeCtx(ctx context.Context, topic string, opts ...SubscribeOption) (*Subscription, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	headers, err := suppliedHeaders(ctx, stompClient.headerSupplier)
+	if err != nil {
+		return nil, err
+	}
+	return stompClient.subscribe(topic, headers, opts)
+}
+
+// CustomHeaders returns the headers of the frame that are not STOMP headers or headers of the client, as
+// "key:value" strings, for example the trace headers a producer's HeaderSupplier added. Broker specific headers
+// are included.
+func (frame *Frame) CustomHeaders() []string {
+	var headers []string
+	for _, header := range frame.Headers {
+		key, _, _ := strings.Cut(header, ":")
+		if !isReservedHeader(key) {
+			headers = append(headers, header)
+		}
+	}
+	return headers
+}
+
+// CustomHeaders returns the headers of the MESSAGE frame that are not STOMP headers. See Frame.CustomHeaders.
+func (m *StompMessage) CustomHeaders() []string {
+	return m.frame.CustomHeaders()
+}
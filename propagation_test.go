@@ -0,0 +1,134 @@
+package go_stomp_websocket
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+type traceKey struct{}
+
+func traceSupplier(ctx context.Context) []string {
+	if trace, ok := ctx.Value(traceKey{}).(string); ok {
+		return []string{"traceparent:" + trace}
+	}
+	return nil
+}
+
+func TestSuppliedHeaders(t *testing.T) {
+	tests := []struct {
+		name        string
+		headers     []string
+		expected    []suppliedHeader
+		expectedErr error
+	}{
+		{name: "none"},
+		{name: "trace headers", headers: []string{"traceparent:00-abc-01", "X-B3-TraceId:abc"},
+			expected: []suppliedHeader{{key: "traceparent", value: "00-abc-01"}, {key: "X-B3-TraceId", value: "abc"}}},
+		{name: "value with colon", headers: []string{"x-trace:a:b"}, expected: []suppliedHeader{{key: "x-trace", value: "a:b"}}},
+		{name: "reserved", headers: []string{"destination:/topic/b"}, expectedErr: ErrReservedHeader},
+		{name: "reserved in another case", headers: []string{"Content-Length:0"}, expectedErr: ErrReservedHeader},
+		{name: "client header", headers: []string{BodySHA256 + ":x"}, expectedErr: ErrReservedHeader},
+		{name: "no colon", headers: []string{"traceparent"}, expectedErr: errors.New("supplied header \"traceparent\" has no ':'")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			headers, err := suppliedHeaders(context.Background(), func(context.Context) []string { return tt.headers })
+			switch {
+			case tt.expectedErr == nil:
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expected, headers)
+			case errors.Is(tt.expectedErr, ErrReservedHeader):
+				assert.ErrorIs(t, err, ErrReservedHeader)
+			default:
+				assert.EqualError(t, err, tt.expectedErr.Error())
+			}
+		})
+	}
+}
+
+func TestHeaderSupplier_StampsFrames(t *testing.T) {
+	messages := make(chan string, 8)
+	recording := startRecordingWSServer(t, messages)
+	upgrades := make(chan http.Header, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upgrades <- r.Header.Clone()
+		recording.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	ctx := context.WithValue(context.Background(), traceKey{}, "00-connect-01")
+	u := wsURL(ts)
+	client, err := ConnectWithTokenProvider(ctx, u, websocket.Dialer{}, StaticToken("token-abc"),
+		WithLogger(NopLogger()), WithHeaderSupplier(traceSupplier))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() { assert.NoError(t, client.Disconnect()) }()
+	assert.Equal(t, "00-connect-01", (<-upgrades).Get("traceparent"))
+	assert.Contains(t, ReadFrame([]byte("a"+receiveMessage(t, messages))).Headers, "traceparent:00-connect-01")
+
+	ctx = context.WithValue(context.Background(), traceKey{}, "00-subscribe-01")
+	subscription, err := client.SubscribeCtx(ctx, "/topic/a")
+	if !assert.NoError(t, err) {
+		return
+	}
+	frame := ReadFrame([]byte("a" + receiveMessage(t, messages)))
+	assert.Equal(t, SUBSCRIBE, frame.Command)
+	assert.Contains(t, frame.Headers, "traceparent:00-subscribe-01")
+
+	ctx = context.WithValue(context.Background(), traceKey{}, "00-send-01")
+	assert.NoError(t, client.SendCtx(ctx, "/queue/a", "text/plain", []byte("hello")))
+	frame = ReadFrame([]byte("a" + receiveMessage(t, messages)))
+	assert.Equal(t, SEND, frame.Command)
+	assert.Contains(t, frame.Headers, "traceparent:00-send-01")
+
+	assert.NoError(t, client.Send("/queue/a", "text/plain", []byte("untraced")))
+	for _, header := range ReadFrame([]byte("a" + receiveMessage(t, messages))).Headers {
+		assert.NotContains(t, header, "traceparent")
+	}
+	subscription.Unsubscribe()
+}
+
+func TestHeaderSupplier_RejectsReservedHeaders(t *testing.T) {
+	ts, _ := startTestWSServer(t)
+	defer ts.Close()
+	ctx := context.WithValue(context.Background(), traceKey{}, "")
+	reserved := func(ctx context.Context) []string {
+		if ctx.Value(traceKey{}) != nil {
+			return []string{"receipt:1"}
+		}
+		return nil
+	}
+	client := connectTestClient(t, ts, WithLogger(NopLogger()), WithHeaderSupplier(reserved))
+	defer func() { assert.NoError(t, client.Disconnect()) }()
+
+	assert.ErrorIs(t, client.SendCtx(ctx, "/queue/a", "", nil), ErrReservedHeader)
+	_, err := client.SubscribeCtx(ctx, "/topic/a")
+	assert.ErrorIs(t, err, ErrReservedHeader)
+
+	_, err = ConnectWithTokenProvider(ctx, wsURL(ts), websocket.Dialer{}, StaticToken("token-abc"),
+		WithLogger(NopLogger()), WithHeaderSupplier(reserved))
+	assert.ErrorIs(t, err, ErrReservedHeader)
+}
+
+func TestSendCtx_ContextDone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, StompClient{}.SendCtx(ctx, "/queue/a", "", nil), context.Canceled)
+	_, err := StompClient{}.SubscribeCtx(ctx, "/topic/a")
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestFrame_CustomHeaders(t *testing.T) {
+	frame := createTestFrame(MESSAGE, []string{
+		Subscription_h + ":id-3", "destination:/topic/a", "message-id:1", "traceparent:00-abc-01", "redelivered:false",
+	}, "")
+	assert.Equal(t, []string{"traceparent:00-abc-01", "redelivered:false"}, frame.CustomHeaders())
+	assert.Equal(t, frame.CustomHeaders(), newMessage(StompClient{}, frame).CustomHeaders())
+}
@@ -0,0 +1,198 @@
+package go_stomp_websocket
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const contentLength = "content-length"
+
+// maxReassemblySize limits the frames and SockJS messages split across websocket messages when WithMaxFrameSize
+// is not set, so that input that never completes can't grow the buffer forever.
+const maxReassemblySize = 64 << 20
+
+// rawBytes serializes the frame as plain STOMP, the way it is sent over the raw transport.
+func (frame *Frame) rawBytes() []byte {
+	var buf bytes.Buffer
+	frame.writeRaw(&buf)
+	return buf.Bytes()
+}
+
+// writeRaw writes the frame as the plain STOMP message rawBytes returns.
+func (frame *Frame) writeRaw(buf *bytes.Buffer) {
+	buf.Grow(len(frame.Command) + len(frame.body) + 4 + len(frame.Headers)*32)
+	buf.WriteString(frame.Command)
+	buf.WriteByte('\n')
+	for _, header := range frame.Headers {
+		buf.WriteString(header)
+		buf.WriteByte('\n')
+	}
+	buf.WriteByte('\n')
+	buf.Write(frame.body)
+	buf.WriteByte(0)
+}
+
+// rawFrameSplitter extracts STOMP frames from the websocket messages of the raw transport and from the elements
+// of SockJS messages. A message may carry several frames and EOLs, and a frame may be split across messages,
+// so the incomplete tail of a message is kept until the next one arrives.
+//
+// EOLs between frames are either heart-beats or the EOLs some brokers (RabbitMQ) send after the NUL of every
+// frame. They are counted as heart-beats when the broker sends heart-beats and as stray EOLs otherwise.
+//
+// The splitter also keeps the start of a SockJS message that a server or an intermediary split across websocket
+// messages, until the rest arrives.
+type rawFrameSplitter struct {
+	pending     []byte
+	message     []byte     // the start of a SockJS message, nil when there is none
+	maxBodySize int64      // zero means maxReassemblySize for split frames and messages and no limit otherwise
+	routes      *rawRoutes // handles the MESSAGE frames of SubscribeRaw subscriptions, if any
+
+	heartbeating bool // the broker sends heart-beats
+	heartbeats   uint64
+	strayEOLs    uint64
+}
+
+// Feed appends data to the pending bytes and returns every complete frame together with the number
+// of EOLs (LF or CRLF) found between frames. The EOLs are skipped, they never become part of a frame.
+func (splitter *rawFrameSplitter) Feed(data []byte) (frames []*Frame, eols int, err error) {
+	return splitter.feed(data, false)
+}
+
+// feed is Feed for a caller that hands data over: when nothing is pending the frame bodies then share data
+// instead of a copy of it.
+func (splitter *rawFrameSplitter) feed(data []byte, owned bool) (frames []*Frame, eols int, err error) {
+	buf := data
+	if !owned || len(splitter.pending) > 0 {
+		buf = append(splitter.pending, data...)
+	}
+	defer func() {
+		if splitter.heartbeating {
+			splitter.heartbeats += uint64(eols)
+		} else {
+			splitter.strayEOLs += uint64(eols)
+		}
+	}()
+	for {
+		i := 0
+		for i < len(buf) && (buf[i] == '\n' || buf[i] == '\r') {
+			if buf[i] == '\n' {
+				eols++
+			}
+			i++
+		}
+		buf = buf[i:]
+		if len(buf) == 0 {
+			break
+		}
+		if splitter.routes.active() {
+			if n := splitter.routes.dispatch(buf, splitter.maxBodySize); n > 0 {
+				buf = buf[n:]
+				continue
+			}
+		}
+		frame, n, parseErr := parseRawFrame(buf, splitter.maxBodySize)
+		if parseErr != nil {
+			splitter.pending = nil
+			return frames, eols, parseErr
+		}
+		if frame == nil {
+			break
+		}
+		frames = append(frames, frame)
+		buf = buf[n:]
+	}
+	if limit := splitter.reassemblyLimit(); int64(len(buf)) > limit {
+		splitter.pending = nil
+		return frames, eols, fmt.Errorf("%w: incomplete frame of %d bytes is larger than %d bytes", ErrFrameTooLarge, len(buf), limit)
+	}
+	if len(buf) == 0 {
+		splitter.pending = nil
+	} else {
+		splitter.pending = append([]byte(nil), buf...)
+	}
+	return frames, eols, nil
+}
+
+// reassemblyLimit is the size up to which the splitter keeps a frame or a SockJS message that is split across
+// websocket messages.
+func (splitter *rawFrameSplitter) reassemblyLimit() int64 {
+	if splitter.maxBodySize > 0 {
+		return splitter.maxBodySize
+	}
+	return maxReassemblySize
+}
+
+// holdMessage keeps a copy of the start of a SockJS message until the next websocket message.
+func (splitter *rawFrameSplitter) holdMessage(data []byte) error {
+	if limit := splitter.reassemblyLimit(); int64(len(data)) > limit {
+		return fmt.Errorf("%w: incomplete SockJS message of %d bytes is larger than %d bytes", ErrFrameTooLarge, len(data), limit)
+	}
+	splitter.message = append([]byte(nil), data...)
+	return nil
+}
+
+// parseRawFrame parses the frame at the start of buf and returns it with the number of bytes it occupies.
+// It returns a nil frame if buf does not hold a complete frame yet. A content-length above maxBodySize is an error
+// unless maxBodySize is zero. The command and headers share one string and the body shares buf.
+func parseRawFrame(buf []byte, maxBodySize int64) (*Frame, int, error) {
+	// find the blank line that ends the headers
+	lines, pos := 0, 0
+	for {
+		end := bytes.IndexByte(buf[pos:], '\n')
+		if end < 0 {
+			return nil, 0, nil
+		}
+		line := buf[pos : pos+end]
+		pos += end + 1
+		if lines > 0 && (len(line) == 0 || len(line) == 1 && line[0] == '\r') {
+			break
+		}
+		lines++
+	}
+
+	text := string(buf[:pos])
+	nextLine := func() string {
+		line, rest, _ := strings.Cut(text, "\n")
+		text = rest
+		return strings.TrimSuffix(line, "\r")
+	}
+	command := nextLine()
+	frame := &Frame{Command: command}
+	if lines > 1 {
+		frame.Headers = make([]string, 0, lines-1)
+	}
+	bodyLength := -1
+	for i := 1; i < lines; i++ {
+		line := nextLine()
+		frame.Headers = append(frame.Headers, line)
+		if key, value, found := strings.Cut(line, ":"); found && key == contentLength && bodyLength < 0 {
+			length, err := strconv.Atoi(value)
+			if err != nil || length < 0 {
+				return nil, 0, fmt.Errorf("invalid content-length %q in %s frame", value, command)
+			}
+			if maxBodySize > 0 && int64(length) > maxBodySize {
+				return nil, 0, fmt.Errorf("%w: content-length %d of %s frame is larger than %d bytes", ErrFrameTooLarge, length, command, maxBodySize)
+			}
+			bodyLength = length
+		}
+	}
+
+	if bodyLength >= 0 {
+		if len(buf)-pos < bodyLength+1 {
+			return nil, 0, nil
+		}
+		if buf[pos+bodyLength] != 0 {
+			return nil, 0, fmt.Errorf("%s frame body is not NUL terminated after content-length %d", command, bodyLength)
+		}
+		frame.SetBody(buf[pos : pos+bodyLength])
+		return frame, pos + bodyLength + 1, nil
+	}
+	end := bytes.IndexByte(buf[pos:], 0)
+	if end < 0 {
+		return nil, 0, nil
+	}
+	frame.SetBody(buf[pos : pos+end])
+	return frame, pos + end + 1, nil
+}
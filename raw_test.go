@@ -0,0 +1,295 @@
+package go_stomp_websocket
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFrame_rawBytes(t *testing.T) {
+	frame := createTestFrame(SEND, []string{"destination:/queue/a"}, "body")
+	assert.Equal(t, "SEND\ndestination:/queue/a\n\nbody\x00", string(frame.rawBytes()))
+}
+
+func TestRawFrameSplitter_Feed(t *testing.T) {
+	tests := []struct {
+		name       string
+		input      []string
+		want       []*Frame
+		heartbeats int
+	}{
+		{
+			name:  "single frame",
+			input: []string{"MESSAGE\nsubscription:1\n\nhello\x00"},
+			want:  []*Frame{createTestFrame(MESSAGE, []string{"subscription:1"}, "hello")},
+		},
+		{
+			name:  "multiple frames per message with heart-beats",
+			input: []string{"MESSAGE\nsubscription:1\n\none\x00\nMESSAGE\nsubscription:2\n\ntwo\x00\n\n"},
+			want: []*Frame{
+				createTestFrame(MESSAGE, []string{"subscription:1"}, "one"),
+				createTestFrame(MESSAGE, []string{"subscription:2"}, "two"),
+			},
+			heartbeats: 3,
+		},
+		{
+			name:       "heart-beats only",
+			input:      []string{"\n", "\r\n"},
+			heartbeats: 2,
+		},
+		{
+			name:  "frame split mid-body",
+			input: []string{"MESSAGE\nsubscription:1\n\nhel", "lo\x00"},
+			want:  []*Frame{createTestFrame(MESSAGE, []string{"subscription:1"}, "hello")},
+		},
+		{
+			name:  "frame split mid-header",
+			input: []string{"MESS", "AGE\nsubscr", "iption:1\n", "\nhello\x00"},
+			want:  []*Frame{createTestFrame(MESSAGE, []string{"subscription:1"}, "hello")},
+		},
+		{
+			name:  "content-length body with NUL split across messages",
+			input: []string{"MESSAGE\ncontent-length:5\n\nab\x00", "cd\x00MESSAGE\n\nnext\x00"},
+			want: []*Frame{
+				createTestFrame(MESSAGE, []string{"content-length:5"}, "ab\x00cd"),
+				createTestFrame(MESSAGE, nil, "next"),
+			},
+		},
+		{
+			name:  "CRLF line endings",
+			input: []string{"MESSAGE\r\nsubscription:1\r\n\r\nhello\x00"},
+			want:  []*Frame{createTestFrame(MESSAGE, []string{"subscription:1"}, "hello")},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			splitter := &rawFrameSplitter{}
+			var got []*Frame
+			heartbeats := 0
+			for _, input := range tt.input {
+				frames, hb, err := splitter.Feed([]byte(input))
+				assert.NoError(t, err)
+				got = append(got, frames...)
+				heartbeats += hb
+			}
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.heartbeats, heartbeats)
+			assert.Empty(t, splitter.pending)
+		})
+	}
+}
+
+func TestRawFrameSplitter_FeedErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{
+			name:  "invalid content-length",
+			input: "MESSAGE\ncontent-length:abc\n\nbody\x00",
+		},
+		{
+			name:  "negative content-length",
+			input: "MESSAGE\ncontent-length:-1\n\nbody\x00",
+		},
+		{
+			name:  "content-length body without NUL",
+			input: "MESSAGE\ncontent-length:2\n\nbody\x00",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			splitter := &rawFrameSplitter{}
+			_, _, err := splitter.Feed([]byte(tt.input))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func FuzzRawFrameSplitter(f *testing.F) {
+	f.Add([]byte("MESSAGE\nsubscription:1\n\none\x00\nMESSAGE\ncontent-length:3\n\na\x00b\x00\n"), 7)
+	f.Add([]byte("\n\n\r\nRECEIPT\nreceipt-id:1\n\n\x00"), 1)
+	f.Fuzz(func(t *testing.T, data []byte, split int) {
+		whole := &rawFrameSplitter{}
+		wantFrames, wantHeartbeats, wantErr := whole.Feed(data)
+
+		if split < 0 {
+			split = -split
+		}
+		if len(data) > 0 {
+			split %= len(data) + 1
+		} else {
+			split = 0
+		}
+		parts := &rawFrameSplitter{}
+		gotFrames, gotHeartbeats, gotErr := parts.Feed(data[:split])
+		if gotErr == nil {
+			frames, heartbeats, err := parts.Feed(data[split:])
+			gotFrames = append(gotFrames, frames...)
+			gotHeartbeats += heartbeats
+			gotErr = err
+		}
+
+		if (wantErr == nil) != (gotErr == nil) {
+			t.Fatalf("error mismatch: whole=%v parts=%v", wantErr, gotErr)
+		}
+		if wantErr != nil {
+			return
+		}
+		if len(wantFrames) != len(gotFrames) || wantHeartbeats != gotHeartbeats {
+			t.Fatalf("whole gave %d frames/%d heart-beats, parts gave %d/%d",
+				len(wantFrames), wantHeartbeats, len(gotFrames), gotHeartbeats)
+		}
+		for i := range wantFrames {
+			if !bytes.Equal(wantFrames[i].rawBytes(), gotFrames[i].rawBytes()) {
+				t.Fatalf("frame %d differs: %q != %q", i, wantFrames[i].rawBytes(), gotFrames[i].rawBytes())
+			}
+		}
+		if !bytes.Equal(whole.pending, parts.pending) {
+			t.Fatalf("pending differs: %q != %q", whole.pending, parts.pending)
+		}
+	})
+}
+
+func TestRawTransport_BatchedFrames(t *testing.T) {
+	upgrader := websocket.Upgrader{
+		CheckOrigin: func(r *http.Request) bool { return true },
+	}
+	paths := make(chan string, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths <- r.URL.Path
+		c, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("upgrade error: %v", err)
+			return
+		}
+		defer c.Close()
+		if _, _, err = c.ReadMessage(); err != nil {
+			return
+		}
+		_ = c.WriteMessage(websocket.TextMessage, []byte("CONNECTED\nversion:1.2\n\n\x00"))
+		_, msg, err := c.ReadMessage()
+		if err != nil {
+			return
+		}
+		frames, _, err := (&rawFrameSplitter{}).Feed(msg)
+		if err != nil || len(frames) != 1 {
+			t.Errorf("expected one SUBSCRIBE frame, got %v (%v)", frames, err)
+			return
+		}
+		id, _ := frames[0].Contains(Id)
+		one := createTestFrame(MESSAGE, []string{Subscription_h + ":" + id}, "one")
+		two := createTestFrame(MESSAGE, []string{Subscription_h + ":" + id, "content-length:7"}, "t\x00w\x00o\x00!")
+		three := createTestFrame(MESSAGE, []string{Subscription_h + ":" + id}, "three")
+		batch := append(append(one.rawBytes(), '\n'), two.rawBytes()...)
+		batch = append(batch, three.rawBytes()[:10]...)
+		_ = c.WriteMessage(websocket.TextMessage, batch)
+		_ = c.WriteMessage(websocket.TextMessage, append(three.rawBytes()[10:], '\n', '\n'))
+		_, _, _ = c.ReadMessage()
+	}))
+	defer ts.Close()
+
+	client := connectTestClient(t, ts, WithRawTransport())
+	defer client.connection.Close()
+	assert.Equal(t, "/", <-paths)
+
+	sub, err := client.Subscribe("/topic/test")
+	assert.NoError(t, err)
+	for _, expected := range []string{"one", "t\x00w\x00o\x00!", "three"} {
+		select {
+		case frame := <-sub.FrameCh:
+			assert.Equal(t, expected, frame.BodyString())
+		case <-time.After(2 * time.Second):
+			t.Fatalf("did not receive %q", expected)
+		}
+	}
+}
+
+func TestRawFrameSplitter_MaxBodySize(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		wantErr bool
+	}{
+		{name: "content-length within limit", input: "MESSAGE\ncontent-length:4\n\nabcd\x00"},
+		{name: "content-length over limit", input: "MESSAGE\ncontent-length:5\n\nabcde\x00", wantErr: true},
+		{name: "incomplete frame over limit", input: "MESSAGE\n\nabcdefghijklmnop", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			splitter := &rawFrameSplitter{maxBodySize: 4}
+			_, _, err := splitter.Feed([]byte(tt.input))
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrFrameTooLarge)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestRawTransport_BinaryMessages(t *testing.T) {
+	for _, binaryFrames := range []bool{false, true} {
+		t.Run(fmt.Sprintf("binary frames %v", binaryFrames), func(t *testing.T) {
+			expectedType := websocket.TextMessage
+			opts := []ConnectOption{WithRawTransport()}
+			if binaryFrames {
+				expectedType = websocket.BinaryMessage
+				opts = append(opts, WithBinaryFrames())
+			}
+			upgrader := websocket.Upgrader{
+				CheckOrigin: func(r *http.Request) bool { return true },
+			}
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				c, err := upgrader.Upgrade(w, r, nil)
+				if err != nil {
+					t.Errorf("upgrade error: %v", err)
+					return
+				}
+				defer c.Close()
+				for {
+					messageType, msg, err := c.ReadMessage()
+					if err != nil {
+						return
+					}
+					assert.Equal(t, expectedType, messageType)
+					frames, _, _ := (&rawFrameSplitter{}).Feed(msg)
+					for _, frame := range frames {
+						switch frame.Command {
+						case CONNECT:
+							_ = c.WriteMessage(websocket.BinaryMessage, []byte("CONNECTED\nversion:1.2\n\n\x00"))
+						case SUBSCRIBE:
+							id, _ := frame.Contains(Id)
+							message := createTestFrame(MESSAGE, []string{Subscription_h + ":" + id}, "h\xc3\xa9llo\x00world")
+							message.Headers = append(message.Headers, "content-length:12")
+							_ = c.WriteMessage(websocket.BinaryMessage, message.rawBytes())
+						}
+					}
+				}
+			}))
+			defer ts.Close()
+
+			client := connectTestClient(t, ts, opts...)
+			defer client.connection.Close()
+			sub, err := client.Subscribe("/topic/test")
+			if !assert.NoError(t, err) {
+				return
+			}
+			select {
+			case frame := <-sub.FrameCh:
+				assert.Equal(t, MESSAGE, frame.Command)
+				assert.Equal(t, "h\xc3\xa9llo\x00world", frame.BodyString())
+			case <-time.After(2 * time.Second):
+				t.Fatal("no MESSAGE received")
+			}
+		})
+	}
+}
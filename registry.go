@@ -0,0 +1,156 @@
+package go_stomp_websocket
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// SubscriptionInfo describes a subscription of a client at the time of the Subscriptions call.
+type SubscriptionInfo struct {
+	ID        SubscriptionID
+	Topic     string
+	AckMode   string    // the ack header of the SUBSCRIBE frame, "auto" without one
+	Pending   int       // frames buffered in FrameCh
+	Capacity  int       // the buffer size of FrameCh
+	Dropped   uint64    // frames dropped by the overflow policy
+	CreatedAt time.Time // when Subscribe was called
+}
+
+type registeredSubscription struct {
+	subscription *Subscription
+	ackMode      string
+	createdAt    time.Time
+}
+
+// subscriptionRegistry holds the subscriptions of a client for Subscriptions and Subscription. processLoop keeps
+// its own maps for routing; this one is written by Subscribe and Unsubscribe and cleared when the client closes.
+type subscriptionRegistry struct {
+	mutex   sync.RWMutex
+	entries map[SubscriptionID]registeredSubscription
+}
+
+func newSubscriptionRegistry() *subscriptionRegistry {
+	return &subscriptionRegistry{entries: make(map[SubscriptionID]registeredSubscription)}
+}
+
+// register adds a subscription before its SUBSCRIBE frame is queued. It fails with ErrSubscriptionExists when
+// the client has a subscription with the same id already.
+func (stompClient StompClient) register(subscription *Subscription, subscribe *Frame) error {
+	registry := stompClient.registry
+	if registry == nil {
+		return nil
+	}
+	ackMode, ok := subscribe.Contains(Ack)
+	if !ok {
+		ackMode = "auto"
+	}
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+	if _, ok := registry.entries[subscription.id]; ok {
+		return fmt.Errorf("%w: %s", ErrSubscriptionExists, subscription.id)
+	}
+	registry.entries[subscription.id] = registeredSubscription{subscription: subscription, ackMode: ackMode, createdAt: time.Now()}
+	return nil
+}
+
+// registered is called once the SUBSCRIBE frame of a registered subscription is queued.
+func (stompClient StompClient) registered(id SubscriptionID) {
+	select {
+	case <-stompClient.done:
+		// processLoop exited after the frame was queued and may have cleared the registry before the add
+		stompClient.registry.remove(id)
+	default:
+	}
+}
+
+func (registry *subscriptionRegistry) remove(id SubscriptionID) {
+	if registry == nil {
+		return
+	}
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+	delete(registry.entries, id)
+}
+
+// ending marks the subscription id as getting the frame that ends the connection and returns the signal to
+// stop waiting for its consumer: closed for a subscription that is unsubscribed already.
+func (registry *subscriptionRegistry) ending(id SubscriptionID) <-chan struct{} {
+	if registry == nil {
+		return nil
+	}
+	registry.mutex.RLock()
+	entry, ok := registry.entries[id]
+	registry.mutex.RUnlock()
+	if !ok {
+		return closedSignal
+	}
+	entry.subscription.ending.Store(true)
+	return entry.subscription.unsubscribed.done()
+}
+
+func (registry *subscriptionRegistry) clear() {
+	if registry == nil {
+		return
+	}
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+	clear(registry.entries)
+}
+
+// subscriptions returns the subscriptions that are not unsubscribed.
+func (registry *subscriptionRegistry) subscriptions() []*Subscription {
+	if registry == nil {
+		return nil
+	}
+	registry.mutex.RLock()
+	defer registry.mutex.RUnlock()
+	subscriptions := make([]*Subscription, 0, len(registry.entries))
+	for _, entry := range registry.entries {
+		subscriptions = append(subscriptions, entry.subscription)
+	}
+	return subscriptions
+}
+
+// Subscriptions returns a snapshot of the subscriptions of the client that are not unsubscribed, oldest first.
+// It is empty once the client is closed.
+func (stompClient StompClient) Subscriptions() []SubscriptionInfo {
+	registry := stompClient.registry
+	if registry == nil {
+		return nil
+	}
+	registry.mutex.RLock()
+	infos := make([]SubscriptionInfo, 0, len(registry.entries))
+	for id, entry := range registry.entries {
+		infos = append(infos, SubscriptionInfo{
+			ID:        id,
+			Topic:     entry.subscription.Topic,
+			AckMode:   entry.ackMode,
+			Pending:   entry.subscription.Pending(),
+			Capacity:  cap(entry.subscription.channel()),
+			Dropped:   entry.subscription.Dropped(),
+			CreatedAt: entry.createdAt,
+		})
+	}
+	registry.mutex.RUnlock()
+	sort.Slice(infos, func(i, j int) bool {
+		if !infos[i].CreatedAt.Equal(infos[j].CreatedAt) {
+			return infos[i].CreatedAt.Before(infos[j].CreatedAt)
+		}
+		return infos[i].ID < infos[j].ID
+	})
+	return infos
+}
+
+// Subscription returns the subscription with the given id, unless it is unsubscribed or the client is closed.
+func (stompClient StompClient) Subscription(id string) (*Subscription, bool) {
+	registry := stompClient.registry
+	if registry == nil {
+		return nil, false
+	}
+	registry.mutex.RLock()
+	defer registry.mutex.RUnlock()
+	entry, ok := registry.entries[SubscriptionID(id)]
+	return entry.subscription, ok
+}
@@ -0,0 +1,130 @@
+package go_stomp_websocket
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubscriptions(t *testing.T) {
+	ts, _ := startTestWSServer(t)
+	defer ts.Close()
+	client := connectTestClient(t, ts, WithLogger(NopLogger()), WithIDGenerator(&sequentialIDs{}))
+	start := time.Now()
+	queue, err := client.Subscribe("/queue/a", WithBufferSize(4), WithSubscriptionOverflow(OverflowDropNewest))
+	assert.NoError(t, err)
+	raw, err := client.SubscribeRaw("/topic/b", func(string, []byte) {})
+	assert.NoError(t, err)
+
+	infos := client.Subscriptions()
+	if assert.Len(t, infos, 2) {
+		assert.False(t, infos[0].CreatedAt.Before(start))
+		assert.False(t, infos[1].CreatedAt.Before(infos[0].CreatedAt))
+		infos[0].CreatedAt, infos[1].CreatedAt = time.Time{}, time.Time{}
+		assert.Equal(t, []SubscriptionInfo{
+			{ID: "id-3", Topic: "/queue/a", AckMode: "auto", Capacity: 4},
+			{ID: "id-4", Topic: "/topic/b", AckMode: "auto", Capacity: 1},
+		}, infos)
+	}
+	infos[0].Topic = "changed"
+	assert.Equal(t, "/queue/a", client.Subscriptions()[0].Topic)
+
+	found, ok := client.Subscription("id-4")
+	assert.True(t, ok)
+	assert.Same(t, raw, found)
+	_, ok = client.Subscription("unknown")
+	assert.False(t, ok)
+
+	queue.Unsubscribe()
+	_, ok = client.Subscription(queue.Id().String())
+	assert.False(t, ok)
+	assert.Len(t, client.Subscriptions(), 1)
+
+	assert.NoError(t, client.Disconnect())
+	assert.Eventually(t, func() bool { return len(client.Subscriptions()) == 0 }, 5*time.Second, time.Millisecond)
+	assert.Nil(t, StompClient{}.Subscriptions())
+}
+
+func TestSubscriptions_Concurrent(t *testing.T) {
+	ts, _ := startTestWSServer(t)
+	defer ts.Close()
+	client := connectTestClient(t, ts, WithLogger(NopLogger()))
+	defer client.connection.Close()
+
+	const goroutines, perGoroutine = 4, 50
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	readers := sync.WaitGroup{}
+	readers.Add(1)
+	go func() {
+		defer readers.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			for _, info := range client.Subscriptions() {
+				if sub, ok := client.Subscription(info.ID.String()); ok {
+					assert.Equal(t, info.Topic, sub.Topic)
+				}
+			}
+		}
+	}()
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var kept []*Subscription
+			for j := 0; j < perGoroutine; j++ {
+				sub, err := client.Subscribe("/topic/a")
+				if !assert.NoError(t, err) {
+					return
+				}
+				if j%2 == 0 {
+					sub.Unsubscribe()
+				} else {
+					kept = append(kept, sub)
+				}
+			}
+			assert.Len(t, kept, perGoroutine/2)
+		}()
+	}
+	wg.Wait()
+	close(stop)
+	readers.Wait()
+	assert.Len(t, client.Subscriptions(), goroutines*perGoroutine/2)
+}
+
+// fixedIDs returns the same id after the session and the goroutine tracker are named.
+type fixedIDs struct {
+	sequentialIDs
+}
+
+func (ids *fixedIDs) ID() string {
+	if id := ids.sequentialIDs.ID(); id <= "id-2" {
+		return id
+	}
+	return "fixed"
+}
+
+func TestSubscribe_DuplicateID(t *testing.T) {
+	ts, _ := startTestWSServer(t)
+	defer ts.Close()
+	client := connectTestClient(t, ts, WithLogger(NopLogger()), WithIDGenerator(&fixedIDs{}))
+	first, err := client.Subscribe("/queue/a")
+	assert.NoError(t, err)
+
+	_, err = client.Subscribe("/queue/b")
+	assert.ErrorIs(t, err, ErrSubscriptionExists)
+	_, err = client.SubscribeRaw("/topic/c", func(string, []byte) {})
+	assert.ErrorIs(t, err, ErrSubscriptionExists)
+
+	found, ok := client.Subscription("fixed")
+	assert.True(t, ok)
+	assert.Same(t, first, found)
+	assert.Len(t, client.Subscriptions(), 1)
+	assert.NoError(t, client.Disconnect())
+}
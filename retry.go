@@ -0,0 +1,125 @@
+package go_stomp_websocket
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	defaultInitialBackoff = 500 * time.Millisecond
+	defaultMaxBackoff     = 30 * time.Second
+)
+
+// RetryPolicy configures ConnectWithRetry.
+type RetryPolicy struct {
+	// MaxAttempts is the number of connect attempts. Zero means retrying until the context is done.
+	MaxAttempts int
+	// InitialBackoff is the wait after the first failed attempt, doubled after every next one. The default is 500ms.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the wait between attempts. The default is 30 seconds.
+	MaxBackoff time.Duration
+	// Jitter is the fraction of the wait that is randomized, 0.2 makes it vary by up to 20% either way.
+	Jitter float64
+}
+
+// RetryError is returned by ConnectWithRetry when no attempt succeeded.
+type RetryError struct {
+	Attempts int
+	Err      error // the error of the last attempt, joined with the context error if the context is done
+}
+
+func (e *RetryError) Error() string {
+	return fmt.Sprintf("connect failed after %d attempts: %v", e.Attempts, e.Err)
+}
+
+func (e *RetryError) Unwrap() error {
+	return e.Err
+}
+
+// ConnectWithRetry works like ConnectWithToken and retries failed dials and handshakes according to policy.
+// ERROR frames of the broker, such as authentication failures, and configuration errors are not retried,
+// except broker errors of CategoryTransient.
+// The context bounds the whole call, including the waits between attempts and the wait for CONNECTED; the
+// HandshakeTimeout of the dialer bounds that wait per attempt, and ErrHandshakeTimeout is retried. Cookies
+// set by the server on an attempt are sent with the next ones, to keep the session on the same backend.
+func ConnectWithRetry(ctx context.Context, webSocketURL url.URL, dialer websocket.Dialer, token string, policy RetryPolicy, opts ...ConnectOption) (*StompClient, error) {
+	log := newConnectOptions(opts).logger
+	var lastErr error
+	var affinity []*http.Cookie
+	for attempt := 1; ; attempt++ {
+		options := newConnectOptions(append(opts[:len(opts):len(opts)], WithAffinityCookies(affinity)))
+		client, err := connectWithTokenProvider(ctx, webSocketURL, dialer, StaticToken(token), options)
+		affinity = mergeCookies(affinity, options.responseCookies)
+		if err == nil {
+			return client, nil
+		}
+		lastErr = err
+		if !retryable(err) || (policy.MaxAttempts > 0 && attempt >= policy.MaxAttempts) {
+			return nil, &RetryError{Attempts: attempt, Err: lastErr}
+		}
+		wait := policy.backoff(attempt)
+		log.Infof("connect attempt %d failed, retrying in %s: %v", attempt, wait, err)
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, &RetryError{Attempts: attempt, Err: errors.Join(ctx.Err(), lastErr)}
+		}
+	}
+}
+
+// backoff returns the wait after the given failed attempt, counting from 1.
+func (policy RetryPolicy) backoff(attempt int) time.Duration {
+	initial, max := policy.InitialBackoff, policy.MaxBackoff
+	if initial <= 0 {
+		initial = defaultInitialBackoff
+	}
+	if max <= 0 {
+		max = defaultMaxBackoff
+	}
+	wait := initial
+	for i := 1; i < attempt && wait < max; i++ {
+		wait *= 2
+	}
+	if wait > max {
+		wait = max
+	}
+	if policy.Jitter > 0 {
+		delta := float64(wait) * policy.Jitter * (2*rand.Float64() - 1)
+		wait += time.Duration(delta)
+	}
+	if wait > max {
+		wait = max
+	}
+	return wait
+}
+
+// retryable tells whether a connect attempt that failed with err is worth repeating. A rejected CONNECT is not,
+// unless the error rules classify the ERROR frame as transient, such as a broker that is shutting down.
+func retryable(err error) bool {
+	var brokerErr *BrokerError
+	if errors.As(err, &brokerErr) {
+		return brokerErr.Category == CategoryTransient
+	}
+	switch {
+	case errors.Is(err, ErrInvalidScheme),
+		errors.Is(err, errReservedUpgradeHeader),
+		errors.Is(err, errReservedQueryParam),
+		errors.Is(err, ErrReservedHeader),
+		errors.Is(err, ErrUnsupportedSubprotocol),
+		errors.Is(err, ErrUnsupportedVersion),
+		errors.Is(err, ErrWebSocketDisabled),
+		errors.Is(err, context.Canceled),
+		errors.Is(err, context.DeadlineExceeded):
+		return false
+	}
+	return true
+}
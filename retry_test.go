@@ -0,0 +1,151 @@
+package go_stomp_websocket
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	policy := RetryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+	var got []time.Duration
+	for attempt := 1; attempt <= 6; attempt++ {
+		got = append(got, policy.backoff(attempt))
+	}
+	assert.Equal(t, []time.Duration{
+		100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second, time.Second,
+	}, got)
+
+	assert.Equal(t, defaultInitialBackoff, RetryPolicy{}.backoff(1))
+	assert.Equal(t, defaultMaxBackoff, RetryPolicy{}.backoff(100))
+
+	jittered := RetryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second, Jitter: 0.5}
+	for i := 0; i < 100; i++ {
+		wait := jittered.backoff(2)
+		assert.GreaterOrEqual(t, wait, 100*time.Millisecond)
+		assert.LessOrEqual(t, wait, 300*time.Millisecond)
+	}
+}
+
+// startFlakyWSServer starts a test server that rejects the first failures upgrade requests with 503
+func startFlakyWSServer(t *testing.T, failures int32) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	attempts := &atomic.Int32{}
+	ts, _ := startTestWSServer(t)
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) <= failures {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		ts.Config.Handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(ts.Close)
+	return proxy, attempts
+}
+
+func wsURL(ts *httptest.Server) url.URL {
+	u, _ := url.Parse(ts.URL)
+	u.Scheme = "ws"
+	return *u
+}
+
+func TestConnectWithRetry(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 5, InitialBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond}
+
+	t.Run("succeeds after failed dials", func(t *testing.T) {
+		ts, attempts := startFlakyWSServer(t, 2)
+		defer ts.Close()
+		client, err := ConnectWithRetry(context.Background(), wsURL(ts), websocket.Dialer{}, "token", policy)
+		assert.NoError(t, err)
+		assert.Equal(t, int32(3), attempts.Load())
+		client.connection.Close()
+	})
+
+	t.Run("gives up after max attempts", func(t *testing.T) {
+		ts, attempts := startFlakyWSServer(t, 100)
+		defer ts.Close()
+		_, err := ConnectWithRetry(context.Background(), wsURL(ts), websocket.Dialer{}, "token", policy)
+		var retryErr *RetryError
+		assert.True(t, errors.As(err, &retryErr))
+		assert.Equal(t, 5, retryErr.Attempts)
+		assert.ErrorIs(t, err, websocket.ErrBadHandshake)
+		assert.Equal(t, int32(5), attempts.Load())
+	})
+
+	t.Run("broker ERROR fails fast", func(t *testing.T) {
+		attempts := &atomic.Int32{}
+		upgrader := websocket.Upgrader{CheckOrigin: func(r *http.Request) bool { return true }}
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			attempts.Add(1)
+			c, err := upgrader.Upgrade(w, r, nil)
+			if err != nil {
+				return
+			}
+			defer c.Close()
+			_, _, _ = c.ReadMessage()
+			_ = c.WriteMessage(websocket.TextMessage, []byte(`a["ERROR\nmessage:bad credentials\n\n\u0000"]`))
+			_, _, _ = c.ReadMessage()
+		}))
+		defer ts.Close()
+		_, err := ConnectWithRetry(context.Background(), wsURL(ts), websocket.Dialer{}, "token", policy)
+		var brokerErr *BrokerError
+		assert.True(t, errors.As(err, &brokerErr))
+		var rejected *ConnectRejectedError
+		if assert.True(t, errors.As(err, &rejected)) {
+			assert.Equal(t, "bad credentials", rejected.Message)
+		}
+		var retryErr *RetryError
+		assert.True(t, errors.As(err, &retryErr))
+		assert.Equal(t, 1, retryErr.Attempts)
+		assert.Equal(t, int32(1), attempts.Load())
+	})
+
+	t.Run("transient broker error is retried", func(t *testing.T) {
+		attempts := &atomic.Int32{}
+		upgrader := websocket.Upgrader{CheckOrigin: func(r *http.Request) bool { return true }}
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			attempts.Add(1)
+			c, err := upgrader.Upgrade(w, r, nil)
+			if err != nil {
+				return
+			}
+			defer c.Close()
+			_, _, _ = c.ReadMessage()
+			_ = c.WriteMessage(websocket.TextMessage, []byte(`a["ERROR\nmessage:server is shutting down\n\n\u0000"]`))
+			_, _, _ = c.ReadMessage()
+		}))
+		defer ts.Close()
+		_, err := ConnectWithRetry(context.Background(), wsURL(ts), websocket.Dialer{}, "token", policy)
+		var brokerErr *BrokerError
+		if assert.True(t, errors.As(err, &brokerErr)) {
+			assert.Equal(t, CategoryTransient, brokerErr.Category)
+		}
+		assert.Equal(t, policy.MaxAttempts, int(attempts.Load()))
+	})
+
+	t.Run("malformed URL fails fast", func(t *testing.T) {
+		_, err := ConnectWithRetry(context.Background(), url.URL{Scheme: "http", Host: "localhost"}, websocket.Dialer{}, "token", policy)
+		var retryErr *RetryError
+		assert.True(t, errors.As(err, &retryErr))
+		assert.Equal(t, 1, retryErr.Attempts)
+	})
+
+	t.Run("context cancelled between attempts", func(t *testing.T) {
+		ts, _ := startFlakyWSServer(t, 100)
+		defer ts.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		slow := RetryPolicy{InitialBackoff: time.Hour}
+		_, err := ConnectWithRetry(ctx, wsURL(ts), websocket.Dialer{}, "token", slow)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.ErrorIs(t, err, websocket.ErrBadHandshake)
+	})
+}
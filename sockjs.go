@@ -0,0 +1,337 @@
+package go_stomp_websocket
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/gorilla/websocket"
+)
+
+var errSockJSClosed = errors.New("SockJS session closed")
+
+// readFrames returns the STOMP frames carried by a websocket message of either transport.
+// SockJS open and heartbeat messages carry no frames, and a SockJS close message is returned as an error.
+func (stompClient *StompClient) readFrames(data []byte) ([]*Frame, error) {
+	if stompClient.rawTransport {
+		// the websocket connection returns every message in a new slice, so the frames may share it
+		frames, _, err := stompClient.splitter.feed(data, true)
+		return frames, err
+	}
+	if pending := stompClient.splitter.message; pending != nil {
+		stompClient.splitter.message = nil
+		return stompClient.readSplitSockJSArray(append(pending, data...))
+	}
+	if len(data) == 0 {
+		return nil, nil
+	}
+	switch data[0] {
+	case 'c':
+		return nil, sockJSCloseError(data[1:])
+	case 'a':
+		return stompClient.readSockJSArray(data)
+	}
+	// 'o' open frame, 'h' heartbeat
+	return nil, nil
+}
+
+// sockJSCloseError returns the *WebSocketClosedError of a SockJS close message body such as [3000,"Go away!"].
+func sockJSCloseError(body []byte) error {
+	closed := &WebSocketClosedError{Cause: fmt.Errorf("%w: %s", errSockJSClosed, body)}
+	var fields []any
+	if json.Unmarshal(body, &fields) == nil && len(fields) == 2 {
+		if code, ok := fields[0].(float64); ok {
+			closed.Code = int(code)
+		}
+		closed.Reason, _ = fields[1].(string)
+	}
+	return closed
+}
+
+// readMessageFrames is readFrames for a websocket message of messageType. The raw transport reads text and binary
+// messages alike; SockJS is text only, so a binary message fails with ErrBinaryMessage.
+func (stompClient *StompClient) readMessageFrames(messageType int, data []byte) ([]*Frame, error) {
+	if messageType == websocket.BinaryMessage && !stompClient.rawTransport {
+		return nil, fmt.Errorf("%w: got %d bytes, SockJS sends text messages only; use WithRawTransport for a plain STOMP endpoint",
+			ErrBinaryMessage, len(data))
+	}
+	return stompClient.readFrames(data)
+}
+
+// readSockJSArray splits every element of a SockJS array message with the frame splitter, so an element may hold
+// several frames with EOLs between them.
+// Arrays of plain JSON strings are unescaped in place, the frames share data. A message that is the start of an
+// array of strings is kept until the next websocket messages complete it.
+func (stompClient *StompClient) readSockJSArray(data []byte) ([]*Frame, error) {
+	switch scanSockJSStringArray(data[1:]) {
+	case sockJSInvalid:
+		return stompClient.readSockJSJSON(data)
+	case sockJSIncomplete:
+		return nil, stompClient.splitter.holdMessage(data)
+	}
+	var frames []*Frame
+	for rest := data[1:]; ; {
+		var element []byte
+		if element, rest = nextSockJSElement(rest); element == nil {
+			return frames, nil
+		}
+		elementFrames, _, err := stompClient.splitter.feed(element, true)
+		frames = append(frames, elementFrames...)
+		if err != nil {
+			return frames, err
+		}
+	}
+}
+
+// readSplitSockJSArray is readSockJSArray for a SockJS message that arrived in several websocket messages. Unlike a
+// message that arrived whole, it fails once it can't become valid JSON any more, since the websocket messages
+// after the first one may be anything.
+func (stompClient *StompClient) readSplitSockJSArray(data []byte) ([]*Frame, error) {
+	if scanSockJSStringArray(data[1:]) == sockJSInvalid && !json.Valid(data[1:]) {
+		return nil, fmt.Errorf("SockJS message of %d bytes split across websocket messages is not a JSON array", len(data))
+	}
+	return stompClient.readSockJSArray(data)
+}
+
+// readSockJSJSON is readSockJSArray for messages with anything but an array of strings of valid UTF-8. Messages
+// that are not valid JSON are an error, or read with ReadFrame with WithLenientSockJS.
+func (stompClient *StompClient) readSockJSJSON(data []byte) ([]*Frame, error) {
+	var elements []string
+	if err := json.Unmarshal(data[1:], &elements); err != nil {
+		if !stompClient.lenientSockJS {
+			return nil, fmt.Errorf("SockJS message is not a JSON array of strings: %w", err)
+		}
+		frame := ReadFrame(data)
+		if err := checkBodySize(frame, stompClient.maxFrameSize); err != nil {
+			return nil, err
+		}
+		return []*Frame{frame}, nil
+	}
+	var frames []*Frame
+	for _, element := range elements {
+		elementFrames, _, err := stompClient.splitter.feed([]byte(element), true)
+		frames = append(frames, elementFrames...)
+		if err != nil {
+			return frames, err
+		}
+	}
+	return frames, nil
+}
+
+// sockJSScan is what scanSockJSStringArray found.
+type sockJSScan int
+
+const (
+	sockJSInvalid    sockJSScan = iota
+	sockJSIncomplete            // the data ends before the array does
+	sockJSComplete
+)
+
+// isSockJSStringArray tells whether data is a JSON array of strings that nextSockJSElement can unescape the way
+// encoding/json does: valid UTF-8, no control characters and only valid escapes.
+func isSockJSStringArray(data []byte) bool {
+	return scanSockJSStringArray(data) == sockJSComplete
+}
+
+// scanSockJSStringArray tells whether data is an array isSockJSStringArray accepts, the start of one, cut anywhere,
+// even within an escape sequence or a UTF-8 sequence, or neither.
+func scanSockJSStringArray(data []byte) sockJSScan {
+	i := skipJSONSpace(data, 0)
+	if i == len(data) {
+		return sockJSIncomplete
+	}
+	if data[i] != '[' {
+		return sockJSInvalid
+	}
+	i = skipJSONSpace(data, i+1)
+	if i < len(data) && data[i] == ']' {
+		return endOfSockJSArray(data, i+1)
+	}
+	for {
+		if i == len(data) {
+			return sockJSIncomplete
+		}
+		if data[i] != '"' {
+			return sockJSInvalid
+		}
+		end, scan := scanJSONString(data, i+1)
+		if scan != sockJSComplete {
+			return scan
+		}
+		i = skipJSONSpace(data, end+1)
+		if i == len(data) {
+			return sockJSIncomplete
+		}
+		switch data[i] {
+		case ',':
+			i = skipJSONSpace(data, i+1)
+		case ']':
+			return endOfSockJSArray(data, i+1)
+		default:
+			return sockJSInvalid
+		}
+	}
+}
+
+// endOfSockJSArray checks that nothing but space follows the array that ends before i.
+func endOfSockJSArray(data []byte, i int) sockJSScan {
+	if skipJSONSpace(data, i) == len(data) {
+		return sockJSComplete
+	}
+	return sockJSInvalid
+}
+
+// scanJSONString returns the index of the quote that closes the string starting at i, or sockJSIncomplete if data
+// ends first.
+func scanJSONString(data []byte, i int) (int, sockJSScan) {
+	for i < len(data) {
+		switch c := data[i]; {
+		case c == '"':
+			return i, sockJSComplete
+		case c == '\\':
+			if i+1 == len(data) {
+				return 0, sockJSIncomplete
+			}
+			switch data[i+1] {
+			case '"', '\\', '/', 'b', 'f', 'n', 'r', 't':
+				i += 2
+			case 'u':
+				if _, ok := hexRune(data[i+2:]); !ok {
+					return 0, hexPrefix(data[i+2:])
+				}
+				i += 6
+			default:
+				return 0, sockJSInvalid
+			}
+		case c < 0x20:
+			return 0, sockJSInvalid
+		case c < utf8.RuneSelf:
+			i++
+		default:
+			if !utf8.FullRune(data[i:]) {
+				return 0, sockJSIncomplete
+			}
+			r, size := utf8.DecodeRune(data[i:])
+			if r == utf8.RuneError && size == 1 {
+				return 0, sockJSInvalid
+			}
+			i += size
+		}
+	}
+	return 0, sockJSIncomplete
+}
+
+// hexPrefix tells whether data, which hexRune rejected, is the start of four hex digits.
+func hexPrefix(data []byte) sockJSScan {
+	if len(data) >= 4 {
+		return sockJSInvalid
+	}
+	for _, c := range data {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F') {
+			return sockJSInvalid
+		}
+	}
+	return sockJSIncomplete
+}
+
+// nextSockJSElement unescapes the next string of a SockJS array checked by isSockJSStringArray in place and returns
+// it with the rest of the array. It returns a nil element after the last one. Unescaping never makes a string
+// longer, so the result fits where the escaped string was.
+func nextSockJSElement(data []byte) (element, rest []byte) {
+	start := bytes.IndexByte(data, '"')
+	if start < 0 {
+		return nil, nil
+	}
+	out := start + 1
+	for i := start + 1; ; {
+		c := data[i]
+		switch {
+		case c == '"':
+			return data[start+1 : out], data[i+1:]
+		case c != '\\':
+			data[out] = c
+			out++
+			i++
+			continue
+		}
+		switch data[i+1] {
+		case 'u':
+			r, _ := hexRune(data[i+2:])
+			i += 6
+			if utf16.IsSurrogate(r) {
+				r2, ok := rune(-1), false
+				if i+1 < len(data) && data[i] == '\\' && data[i+1] == 'u' {
+					r2, ok = hexRune(data[i+2:])
+				}
+				if pair := utf16.DecodeRune(r, r2); ok && pair != unicode.ReplacementChar {
+					r = pair
+					i += 6
+				} else {
+					r = unicode.ReplacementChar
+				}
+			}
+			out += utf8.EncodeRune(data[out:], r)
+			continue
+		case 'b':
+			data[out] = '\b'
+		case 'f':
+			data[out] = '\f'
+		case 'n':
+			data[out] = '\n'
+		case 'r':
+			data[out] = '\r'
+		case 't':
+			data[out] = '\t'
+		default: // '"', '\\' and '/'
+			data[out] = data[i+1]
+		}
+		out++
+		i += 2
+	}
+}
+
+func hexRune(data []byte) (rune, bool) {
+	if len(data) < 4 {
+		return 0, false
+	}
+	var r rune
+	for _, c := range data[:4] {
+		switch {
+		case c >= '0' && c <= '9':
+			c -= '0'
+		case c >= 'a' && c <= 'f':
+			c = c - 'a' + 10
+		case c >= 'A' && c <= 'F':
+			c = c - 'A' + 10
+		default:
+			return 0, false
+		}
+		r = r*16 + rune(c)
+	}
+	return r, true
+}
+
+func skipJSONSpace(data []byte, i int) int {
+	for i < len(data) && (data[i] == ' ' || data[i] == '\t' || data[i] == '\n' || data[i] == '\r') {
+		i++
+	}
+	return i
+}
+
+// brokerSendsHeartbeats tells whether the heart-beat header of the CONNECTED frame makes the broker send
+// heart-beats to a client that asked for them. Brokers without the header send none.
+func brokerSendsHeartbeats(connected *Frame) bool {
+	value, ok := connected.Contains("heart-beat")
+	if !ok {
+		return false
+	}
+	sx, _, _ := strings.Cut(value, ",")
+	interval, err := strconv.Atoi(strings.TrimSpace(sx))
+	return err == nil && interval > 0
+}
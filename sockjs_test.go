@@ -0,0 +1,387 @@
+package go_stomp_websocket
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func sockJSArray(t *testing.T, elements ...string) []byte {
+	t.Helper()
+	data, err := json.Marshal(elements)
+	assert.NoError(t, err)
+	return append([]byte("a"), data...)
+}
+
+func TestReadFrames_TrailingEOLs(t *testing.T) {
+	one := "MESSAGE\nsubscription:1\n\none\x00"
+	two := "MESSAGE\nsubscription:1\n\ntwo\x00"
+	want := []*Frame{
+		createTestFrame(MESSAGE, []string{"subscription:1"}, "one"),
+		createTestFrame(MESSAGE, []string{"subscription:1"}, "two"),
+	}
+	tests := []struct {
+		name     string
+		raw      bool
+		messages func(t *testing.T) [][]byte
+		eols     uint64
+	}{
+		{
+			name: "SockJS without EOLs",
+			messages: func(t *testing.T) [][]byte {
+				return [][]byte{sockJSArray(t, one), sockJSArray(t, two)}
+			},
+		},
+		{
+			name: "SockJS with one EOL after each frame",
+			messages: func(t *testing.T) [][]byte {
+				return [][]byte{sockJSArray(t, one+"\n"), sockJSArray(t, two+"\n")}
+			},
+			eols: 2,
+		},
+		{
+			name: "SockJS with several EOLs and frames in one element",
+			messages: func(t *testing.T) [][]byte {
+				return [][]byte{sockJSArray(t, one+"\n\r\n\n"+two+"\r\n")}
+			},
+			eols: 4,
+		},
+		{
+			name: "SockJS with several elements",
+			messages: func(t *testing.T) [][]byte {
+				return [][]byte{sockJSArray(t, one+"\n", "\n"+two)}
+			},
+			eols: 2,
+		},
+		{
+			name: "raw without EOLs",
+			raw:  true,
+			messages: func(t *testing.T) [][]byte {
+				return [][]byte{[]byte(one + two)}
+			},
+		},
+		{
+			name: "raw with one EOL after each frame",
+			raw:  true,
+			messages: func(t *testing.T) [][]byte {
+				return [][]byte{[]byte(one + "\n"), []byte(two + "\n")}
+			},
+			eols: 2,
+		},
+		{
+			name: "raw with several EOLs",
+			raw:  true,
+			messages: func(t *testing.T) [][]byte {
+				return [][]byte{[]byte(one + "\r\n\n\n" + two + "\n\n")}
+			},
+			eols: 5,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, heartbeating := range []bool{false, true} {
+				client := &StompClient{rawTransport: tt.raw, splitter: &rawFrameSplitter{heartbeating: heartbeating}}
+				var got []*Frame
+				for _, message := range tt.messages(t) {
+					frames, err := client.readFrames(message)
+					assert.NoError(t, err)
+					got = append(got, frames...)
+				}
+				assert.Equal(t, want, got)
+				if heartbeating {
+					assert.Equal(t, tt.eols, client.splitter.heartbeats)
+					assert.Zero(t, client.splitter.strayEOLs)
+				} else {
+					assert.Equal(t, tt.eols, client.splitter.strayEOLs)
+					assert.Zero(t, client.splitter.heartbeats)
+				}
+			}
+		})
+	}
+}
+
+func TestReadFrames_SockJSControlMessages(t *testing.T) {
+	client := &StompClient{splitter: &rawFrameSplitter{}}
+	for _, message := range []string{"o", "h", ""} {
+		frames, err := client.readFrames([]byte(message))
+		assert.NoError(t, err)
+		assert.Empty(t, frames)
+	}
+	_, err := client.readFrames([]byte(`c[3000,"Go away!"]`))
+	assert.ErrorIs(t, err, errSockJSClosed)
+	assert.Equal(t, &WebSocketClosedError{Code: 3000, Reason: "Go away!", Cause: errors.Unwrap(err)}, err)
+}
+
+func TestSockJSCloseError_Malformed(t *testing.T) {
+	err := sockJSCloseError([]byte(`[oops`))
+	assert.ErrorIs(t, err, errSockJSClosed)
+	assert.EqualError(t, err, "SockJS session closed: [oops")
+	var closed *WebSocketClosedError
+	if assert.ErrorAs(t, err, &closed) {
+		assert.Zero(t, closed.Code)
+		assert.Empty(t, closed.Reason)
+	}
+}
+
+func TestReadFrames_InvalidJSON(t *testing.T) {
+	message := []byte(`a["MESSAGE\nsubscription:1\n\n{"a":1}\u0000"]`)
+	_, err := (&StompClient{splitter: &rawFrameSplitter{}}).readFrames(message)
+	assert.ErrorContains(t, err, "SockJS message is not a JSON array of strings")
+
+	frames, err := (&StompClient{splitter: &rawFrameSplitter{}, lenientSockJS: true}).readFrames(message)
+	assert.NoError(t, err)
+	assert.Equal(t, []*Frame{createTestFrame(MESSAGE, []string{"subscription:1"}, `{"a":1}`)}, frames)
+}
+
+func TestBrokerSendsHeartbeats(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers []string
+		want    bool
+	}{
+		{name: "no header", want: false},
+		{name: "broker sends", headers: []string{"heart-beat:10000,10000"}, want: true},
+		{name: "broker does not send", headers: []string{"heart-beat:0,10000"}, want: false},
+		{name: "malformed", headers: []string{"heart-beat:x"}, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, brokerSendsHeartbeats(createTestFrame(CONNECTED, tt.headers, "")))
+		})
+	}
+}
+
+func TestReadSockJSArray_UnescapesLikeEncodingJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"escapes", `a["MESSAGE\nsubscription:1\n\n{\"a\":\"b\\\/c\"}\t\r\b\f\u0000"]`},
+		{"unicode", `a["MESSAGE\nsubscription:1\n\né中€\u0000"]`},
+		{"surrogate pair", `a["MESSAGE\nsubscription:1\n\n😀\u0000"]`},
+		{"lone surrogate", `a["MESSAGE\nsubscription:1\n\n\ud83dx\ud83dA\u0000"]`},
+		{"several elements", `a[ "MESSAGE\nsubscription:1\n\none\u0000" , "MESSAGE\nsubscription:2\n\ntwo\u0000\n"]`},
+		{"empty element", `a["","MESSAGE\nsubscription:1\n\n\u0000"]`},
+		{"empty array", `a[]`},
+		{"null", `anull`},
+		{"null element", `a[null,"MESSAGE\nsubscription:1\n\n\u0000"]`},
+		{"invalid UTF-8", "a[\"MESSAGE\\nsubscription:1\\n\\n\xff\\u0000\"]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expected, expectedErr := (&StompClient{splitter: &rawFrameSplitter{}}).readSockJSJSON([]byte(tt.data))
+			frames, err := (&StompClient{splitter: &rawFrameSplitter{}}).readSockJSArray([]byte(tt.data))
+			assert.Equal(t, expectedErr, err)
+			assert.Equal(t, expected, frames)
+		})
+	}
+}
+
+func TestIsSockJSStringArray(t *testing.T) {
+	tests := []struct {
+		data     string
+		expected bool
+	}{
+		{`["a","b"]`, true},
+		{` [ "a" ] `, true},
+		{`[]`, true},
+		{`["a",]`, false},
+		{`["a"`, false},
+		{`["a\x"]`, false},
+		{`["a\u00"]`, false},
+		{"[\"a\tb\"]", false},
+		{`["a"]x`, false},
+		{`[1]`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.data, func(t *testing.T) {
+			assert.Equal(t, tt.expected, isSockJSStringArray([]byte(tt.data)))
+		})
+	}
+}
+
+func TestReadMessageFrames_MessageType(t *testing.T) {
+	tests := []struct {
+		name        string
+		client      StompClient
+		messageType int
+		data        string
+		expectedErr error
+		frames      int
+	}{
+		{name: "SockJS text", messageType: websocket.TextMessage, data: `a["MESSAGE\nsubscription:1\n\nhi\u0000"]`, frames: 1},
+		{name: "SockJS binary", messageType: websocket.BinaryMessage, data: `a["MESSAGE\nsubscription:1\n\nhi\u0000"]`, expectedErr: ErrBinaryMessage},
+		{name: "raw text", client: StompClient{rawTransport: true}, messageType: websocket.TextMessage, data: "MESSAGE\nsubscription:1\n\nhi\x00", frames: 1},
+		{name: "raw binary", client: StompClient{rawTransport: true}, messageType: websocket.BinaryMessage, data: "MESSAGE\nsubscription:1\n\nhi\x00", frames: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := tt.client
+			client.splitter = &rawFrameSplitter{}
+			frames, err := client.readMessageFrames(tt.messageType, []byte(tt.data))
+			assert.ErrorIs(t, err, tt.expectedErr)
+			assert.Len(t, frames, tt.frames)
+		})
+	}
+}
+
+func TestSockJS_BinaryMessageFailsConnection(t *testing.T) {
+	ts := startScriptedWSServer(t, func(c *websocket.Conn) {
+		_ = c.WriteMessage(websocket.BinaryMessage, []byte(`a["MESSAGE\nsubscription:1\n\nhi\u0000"]`))
+		_, _, _ = c.ReadMessage()
+	})
+	defer ts.Close()
+	client, err := ConnectWithToken(wsURL(ts), websocket.Dialer{}, "token", WithLogger(NopLogger()))
+	if !assert.NoError(t, err) {
+		return
+	}
+	err, ok := receiveTerminalError(t, client)
+	assert.True(t, ok)
+	assert.ErrorIs(t, err, ErrBinaryMessage)
+}
+
+func TestScanSockJSStringArray(t *testing.T) {
+	tests := []struct {
+		data     string
+		expected sockJSScan
+	}{
+		{`["a","b"]`, sockJSComplete},
+		{``, sockJSIncomplete},
+		{` [`, sockJSIncomplete},
+		{`["a`, sockJSIncomplete},
+		{`["a\`, sockJSIncomplete},
+		{`["a\u00`, sockJSIncomplete},
+		{`["a"`, sockJSIncomplete},
+		{`["a", `, sockJSIncomplete},
+		{"[\"\xe2\x82", sockJSIncomplete},
+		{`["a\u00x`, sockJSInvalid},
+		{`["a\x`, sockJSInvalid},
+		{"[\"\xff", sockJSInvalid},
+		{`["a"]x`, sockJSInvalid},
+		{`["a",]`, sockJSInvalid},
+		{`x`, sockJSInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.data, func(t *testing.T) {
+			assert.Equal(t, tt.expected, scanSockJSStringArray([]byte(tt.data)))
+		})
+	}
+}
+
+// splits returns message cut at every position into two websocket messages, and cut into single bytes.
+func splits(message string) [][]string {
+	var result [][]string
+	for i := 1; i < len(message); i++ {
+		result = append(result, []string{message[:i], message[i:]})
+	}
+	var bytes []string
+	for i := 0; i < len(message); i++ {
+		bytes = append(bytes, message[i:i+1])
+	}
+	return append(result, bytes)
+}
+
+func TestReadFrames_ReassemblesSplitMessages(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     bool
+		message string
+	}{
+		{name: "SockJS", message: `a["MESSAGE\nsubscription:1\nx-name:caf\u00e9 ` + "é" + ` \ud83d\ude00\n\n{\"a\":\"b\\\/c\"}\u0000","MESSAGE\nsubscription:2\n\ntwo\u0000\n"]`},
+		{name: "raw with content-length", raw: true, message: "MESSAGE\nsubscription:1\ncontent-length:5\n\na\x00b\x00c\x00\nMESSAGE\nsubscription:2\n\ntwo\x00"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expected, err := (&StompClient{rawTransport: tt.raw, splitter: &rawFrameSplitter{}}).readFrames([]byte(tt.message))
+			if !assert.NoError(t, err) || !assert.Len(t, expected, 2) {
+				return
+			}
+			for _, messages := range splits(tt.message) {
+				client := &StompClient{rawTransport: tt.raw, splitter: &rawFrameSplitter{}}
+				var frames []*Frame
+				for _, message := range messages {
+					got, err := client.readFrames([]byte(message))
+					if !assert.NoError(t, err, "split into %q", messages) {
+						return
+					}
+					frames = append(frames, got...)
+				}
+				assert.Equal(t, expected, frames, "split into %q", messages)
+				assert.Nil(t, client.splitter.message)
+				assert.Empty(t, client.splitter.pending)
+			}
+		})
+	}
+}
+
+func TestReadFrames_SplitMessageFailures(t *testing.T) {
+	tests := []struct {
+		name        string
+		raw         bool
+		maxBodySize int64
+		messages    []string
+		expectedErr error
+	}{
+		{name: "never a JSON array", messages: []string{`a["MESSAGE\n`, `\n\n\u0000"]x`}, expectedErr: errors.New("SockJS message of 25 bytes split across websocket messages is not a JSON array")},
+		{name: "control character", messages: []string{`a["MESSAGE`, "\n\x00"}, expectedErr: errors.New("SockJS message of 12 bytes split across websocket messages is not a JSON array")},
+		{name: "SockJS message too large", maxBodySize: 16, messages: []string{`a["MESSAGE\n`, `\n\nsixteen bytes`}, expectedErr: ErrFrameTooLarge},
+		{name: "raw frame too large", raw: true, maxBodySize: 16, messages: []string{"MESSAGE\n", "\nsixteen bytes"}, expectedErr: ErrFrameTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &StompClient{rawTransport: tt.raw, splitter: &rawFrameSplitter{maxBodySize: tt.maxBodySize}}
+			var err error
+			for _, message := range tt.messages {
+				if _, err = client.readFrames([]byte(message)); err != nil {
+					break
+				}
+			}
+			if errors.Is(tt.expectedErr, ErrFrameTooLarge) {
+				assert.ErrorIs(t, err, ErrFrameTooLarge)
+			} else {
+				assert.EqualError(t, err, tt.expectedErr.Error())
+			}
+			assert.Nil(t, client.splitter.message)
+			assert.Empty(t, client.splitter.pending)
+		})
+	}
+}
+
+func TestSockJS_SplitMessages(t *testing.T) {
+	ts := startScriptedWSServer(t, func(c *websocket.Conn) {
+		_, data, err := c.ReadMessage()
+		if err != nil {
+			return
+		}
+		id, _ := ReadFrame(append([]byte("a"), data...)).Contains(Id)
+		for _, message := range []string{`a["MESSAGE\nsubscription:` + id + `\nx-a:\u00`, `e9\n\nhello\u00`, `00"]`, `a["MESS`, `"]]`} {
+			_ = c.WriteMessage(websocket.TextMessage, []byte(message))
+		}
+		_, _, _ = c.ReadMessage()
+	})
+	defer ts.Close()
+	client, err := ConnectWithToken(wsURL(ts), websocket.Dialer{}, "token", WithLogger(NopLogger()))
+	if !assert.NoError(t, err) {
+		return
+	}
+	subscription, err := client.Subscribe("/topic/a", WithBufferSize(1))
+	if !assert.NoError(t, err) {
+		return
+	}
+	select {
+	case frame := <-subscription.FrameCh:
+		assert.Equal(t, "hello", frame.BodyString())
+		value, _ := frame.Contains("x-a")
+		assert.Equal(t, "é", value)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no frame received")
+	}
+	err, ok := receiveTerminalError(t, client)
+	assert.True(t, ok)
+	var parseErr *FrameParseError
+	assert.ErrorAs(t, err, &parseErr)
+}
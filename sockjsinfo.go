@@ -0,0 +1,124 @@
+package go_stomp_websocket
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/gorilla/websocket"
+)
+
+// maxSockJSInfoBytes limits the body of the SockJS /info answer that is read.
+const maxSockJSInfoBytes = 64 << 10
+
+// SockJSInfo is the answer of the SockJS /info endpoint.
+type SockJSInfo struct {
+	WebSocket    bool     `json:"websocket"`     // false when the server has the websocket transport disabled
+	CookieNeeded bool     `json:"cookie_needed"` // the server relies on a JSESSIONID cookie for sticky sessions
+	Origins      []string `json:"origins"`
+	Entropy      int64    `json:"entropy"`
+}
+
+// WithSockJSInfoCheck makes the client GET the SockJS /info endpoint before the websocket upgrade, as the
+// SockJS clients of Spring do. The request has the headers, cookies and query of the upgrade request, and the
+// cookies of the answer are sent with the upgrade request. The connect fails with ErrWebSocketDisabled when
+// the server answers websocket:false. The answer is kept for StompClient.SockJSInfo. Ignored with
+// WithRawTransport.
+func WithSockJSInfoCheck(enabled bool) ConnectOption {
+	return func(options *connectOptions) {
+		options.sockJSInfoCheck = enabled
+	}
+}
+
+// WithSockJSInfoClient sets the HTTP client of the WithSockJSInfoCheck request. The default client uses the TLS
+// config, proxy, net dial functions, handshake timeout and cookie jar of the dialer.
+func WithSockJSInfoClient(client *http.Client) ConnectOption {
+	return func(options *connectOptions) {
+		options.sockJSInfoClient = client
+	}
+}
+
+// SockJSInfo returns the answer of the SockJS /info endpoint; ok is false without WithSockJSInfoCheck.
+func (stompClient StompClient) SockJSInfo() (info SockJSInfo, ok bool) {
+	if stompClient.sockJSInfo == nil {
+		return SockJSInfo{}, false
+	}
+	return *stompClient.sockJSInfo, true
+}
+
+// sockJSInfoURL returns the /info URL of the SockJS endpoint base with params merged into its query.
+func sockJSInfoURL(base url.URL, params url.Values) (url.URL, error) {
+	schema, err := extractSchema(base)
+	if err != nil {
+		return url.URL{}, err
+	}
+	infoURL := base
+	infoURL.Scheme = schema
+	infoURL.Fragment = ""
+	infoURL.RawFragment = ""
+	infoURL.Path, infoURL.RawPath = appendPathSegments(base, "info")
+	infoURL.RawQuery = mergeQuery(base.RawQuery, params)
+	return infoURL, nil
+}
+
+// sockJSInfoClient returns a client that connects the way dialer does.
+func sockJSInfoClient(dialer *websocket.Dialer) *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			Proxy:               dialer.Proxy,
+			DialContext:         dialer.NetDialContext,
+			DialTLSContext:      dialer.NetDialTLSContext,
+			TLSClientConfig:     dialer.TLSClientConfig,
+			TLSHandshakeTimeout: dialer.HandshakeTimeout,
+		},
+		Jar:     dialer.Jar,
+		Timeout: dialer.HandshakeTimeout,
+	}
+}
+
+// checkSockJSInfo GETs the /info endpoint of base when WithSockJSInfoCheck is set and remembers the answer and
+// its cookies. requestHeaders are the headers of the upgrade request, before the affinity cookies are added.
+func (options *connectOptions) checkSockJSInfo(ctx context.Context, base url.URL, params url.Values, dialer *websocket.Dialer, requestHeaders http.Header) error {
+	if !options.sockJSInfoCheck || options.rawTransport {
+		return nil
+	}
+	infoURL, err := sockJSInfoURL(base, params)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, infoURL.String(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header = requestHeaders.Clone()
+	req.Header.Del("Host")
+	options.applyAffinityCookies(req.Header)
+	client := options.sockJSInfoClient
+	if client == nil {
+		client = sockJSInfoClient(dialer)
+	}
+	redacted := redactedURL(infoURL)
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("SockJS info request to %s failed: %w", redacted, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("SockJS info request to %s failed: %s", redacted, resp.Status)
+	}
+	info := &SockJSInfo{}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxSockJSInfoBytes)).Decode(info); err != nil {
+		return fmt.Errorf("can't decode SockJS info of %s: %w", redacted, err)
+	}
+	if !info.WebSocket {
+		return fmt.Errorf("%w: %s", ErrWebSocketDisabled, redacted)
+	}
+	if options.cookieJar == nil {
+		options.affinityCookies = mergeCookies(options.affinityCookies, resp.Cookies())
+	}
+	options.sockJSInfo = info
+	return nil
+}
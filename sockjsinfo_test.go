@@ -0,0 +1,130 @@
+package go_stomp_websocket
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSockJSInfoURL(t *testing.T) {
+	tests := []struct {
+		name     string
+		base     string
+		params   url.Values
+		expected string
+	}{
+		{name: "ws", base: "ws://localhost:8080/api/watch", expected: "http://localhost:8080/api/watch/info"},
+		{name: "wss", base: "wss://localhost/api/watch/", expected: "https://localhost/api/watch/info"},
+		{name: "query and params", base: "ws://localhost/watch?tenant=abc#x", params: url.Values{accessTokenParam: {"t"}},
+			expected: "http://localhost/watch/info?tenant=abc&access_token=t"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			base, _ := url.Parse(tt.base)
+			infoURL, err := sockJSInfoURL(*base, tt.params)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, infoURL.String())
+		})
+	}
+	_, err := sockJSInfoURL(url.URL{Scheme: "http", Host: "localhost"}, nil)
+	assert.ErrorIs(t, err, ErrInvalidScheme)
+}
+
+// startSockJSInfoServer starts a test server that answers /info with info and sets the SESSION cookie, and
+// completes the STOMP handshake on the other paths. The upgrade requests and info requests are sent to the
+// returned channels.
+func startSockJSInfoServer(t *testing.T, info string) (ts *httptest.Server, infoRequests, upgrades <-chan *http.Request) {
+	t.Helper()
+	infoCh := make(chan *http.Request, 4)
+	upgradeCh := make(chan *http.Request, 4)
+	stomp := startScriptedWSServer(t, func(c *websocket.Conn) {
+		for {
+			if _, _, err := c.ReadMessage(); err != nil {
+				return
+			}
+		}
+	})
+	t.Cleanup(stomp.Close)
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/info") {
+			infoCh <- r
+			http.SetCookie(w, &http.Cookie{Name: "SESSION", Value: "s-1"})
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(info))
+			return
+		}
+		upgradeCh <- r
+		stomp.Config.Handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(ts.Close)
+	return ts, infoCh, upgradeCh
+}
+
+func TestWithSockJSInfoCheck(t *testing.T) {
+	ts, infoRequests, upgrades := startSockJSInfoServer(t, `{"entropy":42,"origins":["*:*"],"cookie_needed":true,"websocket":true}`)
+	client, err := ConnectWithToken(wsURL(ts), websocket.Dialer{}, "token", WithLogger(NopLogger()),
+		WithSockJSInfoCheck(true), WithUpgradeHeaders(http.Header{"X-Tenant": {"abc"}}))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer client.connection.Close()
+
+	info, ok := client.SockJSInfo()
+	assert.True(t, ok)
+	assert.Equal(t, SockJSInfo{WebSocket: true, CookieNeeded: true, Origins: []string{"*:*"}, Entropy: 42}, info)
+	infoRequest := <-infoRequests
+	assert.Equal(t, "/info", infoRequest.URL.Path)
+	assert.Equal(t, "Bearer token", infoRequest.Header.Get("Authorization"))
+	assert.Equal(t, "abc", infoRequest.Header.Get("X-Tenant"))
+	upgrade := <-upgrades
+	cookie, err := upgrade.Cookie("SESSION")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "s-1", cookie.Value)
+	}
+}
+
+func TestWithSockJSInfoCheck_WebSocketDisabled(t *testing.T) {
+	ts, _, upgrades := startSockJSInfoServer(t, `{"entropy":42,"websocket":false}`)
+	client, err := ConnectWithToken(wsURL(ts), websocket.Dialer{}, "token", WithLogger(NopLogger()), WithSockJSInfoCheck(true))
+	assert.Nil(t, client)
+	assert.ErrorIs(t, err, ErrWebSocketDisabled)
+	assert.False(t, retryable(err))
+	assert.Len(t, upgrades, 0)
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func TestWithSockJSInfoClient(t *testing.T) {
+	ts, infoRequests, _ := startSockJSInfoServer(t, `{"websocket":true}`)
+	used := make(chan string, 1)
+	httpClient := &http.Client{Transport: roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		used <- r.URL.String()
+		return http.DefaultTransport.RoundTrip(r)
+	})}
+	client, err := ConnectWithToken(wsURL(ts), websocket.Dialer{}, "token", WithLogger(NopLogger()),
+		WithSockJSInfoCheck(true), WithSockJSInfoClient(httpClient))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer client.connection.Close()
+	assert.Equal(t, ts.URL+"/info", <-used)
+	assert.Len(t, infoRequests, 1)
+}
+
+func TestSockJSInfo_NotChecked(t *testing.T) {
+	ts, infoRequests, _ := startSockJSInfoServer(t, `{"websocket":true}`)
+	client := connectTestClient(t, ts, WithLogger(NopLogger()))
+	defer client.connection.Close()
+	_, ok := client.SockJSInfo()
+	assert.False(t, ok)
+	assert.Len(t, infoRequests, 0)
+}
@@ -1,134 +1,664 @@
 package go_stomp_websocket
 
 import (
+	"bytes"
+	"context"
 	"errors"
-	"math/rand"
+	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"net/url"
-	"strconv"
 	"strings"
+	"sync"
+	"time"
 
-	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
-	"github.com/netcracker/qubership-core-lib-go/v3/logging"
 )
 
-var logger = logging.GetLogger("stomp")
-
 type StompClient struct {
 	webSocketURL url.URL
+	endpoint     url.URL // as passed to the connect function
 	connection   *websocket.Conn
 	readCh       chan *Frame
 	writeCh      chan writeRequest
+	swapCh       chan swapRequest
+	done         chan struct{} // closed when processLoop exits
+	goroutines   *goroutineTracker
+	readTimeout  time.Duration
+	writeTimeout time.Duration
+
+	disconnectTimeout time.Duration
+	disconnectOnce    *sync.Once
+
+	rawTransport  bool
+	binaryFrames  bool // the raw transport sends binary messages
+	lenientSockJS bool
+	splitter      *rawFrameSplitter
+	rawRoutes     *rawRoutes
+	maxFrameSize  int64
+	version       string // negotiated STOMP version
+	terminal      *terminalState
+	integrity     *IntegrityConfig
+	bufferSizer   *BufferSizer
+	session       SockJSSession
+	sockJSInfo    *SockJSInfo // nil without WithSockJSInfoCheck
+	ids           IDGenerator
+	cookies       []*http.Cookie
+	keepalive     *keepalive
+	watchdog      *heartbeatWatchdog // nil when the broker sends no heart-beats
+	registry      *subscriptionRegistry
+	anomalies     chan ProtocolAnomaly
+	parseErrors   *parseErrors
+	logger        Logger
+	trace         frameTrace
+	metrics       MetricsCollector
+
+	renegotiateHeartbeats bool
+
+	maxOutboundMessageSize int
+	chunkTimeout           time.Duration
+	aliases                *destinationAliases
+	batchFrames            int // more than 1 enables write batching
+	batchBytes             int
+	errorRules             []ErrorRule
+	dialect                BrokerDialect
+	headerSupplier         HeaderSupplier
+	subprotocol            string
+	compressed             bool
+
+	requestedConfig ClientConfig
+	effectiveConfig ClientConfig
 }
 
+// writeRequest is a frame for processLoop to write. processLoop writes the requests in the order they were
+// queued in; a request without a frame only reports on Err that the requests queued before it are written.
 type writeRequest struct {
-	Frame *Frame      // frame to send
-	C     chan *Frame // response channel
+	Frame   *Frame               // frame to send, nil for a Flush marker
+	C       chan *Frame          // response channel
+	Err     chan error           // write result channel, must be buffered
+	Handler *subscriptionHandler // middleware of a SUBSCRIBE request
+	Stream  *streamBody          // body of a SendReader frame
+}
+
+// TokenProvider returns the token to authenticate the websocket upgrade with.
+type TokenProvider func(ctx context.Context) (string, error)
+
+// StaticToken returns a TokenProvider that always returns token.
+func StaticToken(token string) TokenProvider {
+	return func(ctx context.Context) (string, error) {
+		return token, nil
+	}
 }
 
 type ConnectionDialer interface {
 	Dial(webSocketURL url.URL, dialer websocket.Dialer, requestHeaders http.Header) (*websocket.Conn, *http.Response, error)
 }
 
-func Connect(webSocketURL url.URL, dialer websocket.Dialer, requestHeaders http.Header, connDialer ConnectionDialer) (*StompClient, error) {
-	webSocketURL.Path = webSocketURL.Path + "/" + randomIntn(999) + "/" + randomString() + "/websocket"
-	logger.Infof("connecting to %s", webSocketURL.String())
-	conn, _, err := connDialer.Dial(webSocketURL, dialer, requestHeaders)
+func Connect(webSocketURL url.URL, dialer websocket.Dialer, requestHeaders http.Header, connDialer ConnectionDialer, opts ...ConnectOption) (*StompClient, error) {
+	options := newConnectOptions(opts)
+	base := webSocketURL
+	options.endpoint = base
+	webSocketURL, err := options.dialURL(webSocketURL, nil)
 	if err != nil {
 		return nil, err
 	}
-	return establishConnection(webSocketURL, conn)
+	options.logger.Infof("connecting to %s", redactedURL(webSocketURL))
+	requestHeaders = requestHeaders.Clone()
+	if requestHeaders == nil {
+		requestHeaders = http.Header{}
+	}
+	if err := options.mergeUpgradeHeaders(requestHeaders); err != nil {
+		return nil, err
+	}
+	if options.suppliedHeaders, err = suppliedHeaders(context.Background(), options.headerSupplier); err != nil {
+		return nil, err
+	}
+	addUpgradeHeaders(requestHeaders, options.suppliedHeaders)
+	options.applyDialer(&dialer)
+	if err := options.checkSockJSInfo(context.Background(), base, nil, &dialer, requestHeaders); err != nil {
+		return nil, err
+	}
+	options.applyAffinityCookies(requestHeaders)
+	conn, resp, err := connDialer.Dial(webSocketURL, dialer, requestHeaders)
+	options.captureCookies(resp)
+	options.captureCompression(resp)
+	if err != nil {
+		return nil, &HandshakeError{Cause: err}
+	}
+	return establishConnection(context.Background(), webSocketURL, conn, options)
+}
+
+func ConnectWithToken(webSocketURL url.URL, dialer websocket.Dialer, token string, opts ...ConnectOption) (*StompClient, error) {
+	return ConnectWithTokenProvider(context.Background(), webSocketURL, dialer, StaticToken(token), opts...)
 }
 
-func ConnectWithToken(webSocketURL url.URL, dialer websocket.Dialer, token string) (*StompClient, error) {
-	webSocketURL.Path = webSocketURL.Path + "/" + randomIntn(999) + "/" + randomString() + "/websocket"
-	logger.Infof("connecting to %s", webSocketURL.String())
+// ConnectWithTokenProvider works like ConnectWithToken but asks tokenProvider for the token right before dialing,
+// so every connect attempt uses a fresh token. Provider failures are reported wrapped in ErrTokenProvider.
+func ConnectWithTokenProvider(ctx context.Context, webSocketURL url.URL, dialer websocket.Dialer, tokenProvider TokenProvider, opts ...ConnectOption) (*StompClient, error) {
+	return connectWithTokenProvider(ctx, webSocketURL, dialer, tokenProvider, newConnectOptions(opts))
+}
+
+func connectWithTokenProvider(ctx context.Context, webSocketURL url.URL, dialer websocket.Dialer, tokenProvider TokenProvider, options *connectOptions) (*StompClient, error) {
+	options.tokenConnect = true
 	schema, err := extractSchema(webSocketURL)
 	if err != nil {
-		logger.Errorf("Schema have to start with ws or wss \n %v", err)
+		options.logger.Errorf("Schema have to start with ws or wss \n %v", err)
 		return nil, err
 	}
 	requestHeaders := http.Header{}
-	requestHeaders.Add("Host", webSocketURL.Host)
-	requestHeaders.Add("Origin", schema+"://"+webSocketURL.Host)
-	requestHeaders.Add("Authorization", "Bearer "+token)
-	conn, _, err := dialer.Dial(webSocketURL.String(), requestHeaders)
+	var reserved []string
+	if options.tokenTransport == TokenInHeader {
+		reserved = []string{"Authorization"}
+	}
+	if err := options.mergeUpgradeHeaders(requestHeaders, reserved...); err != nil {
+		return nil, err
+	}
+	if options.tokenTransport == TokenInQuery {
+		if err := checkReservedQuery(webSocketURL, accessTokenParam); err != nil {
+			return nil, err
+		}
+	}
+	token, err := tokenProvider(ctx)
 	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrTokenProvider, err)
+	}
+	var params url.Values
+	if options.tokenTransport == TokenInQuery {
+		params = url.Values{accessTokenParam: []string{token}}
+	}
+	base := webSocketURL
+	options.endpoint = base
+	webSocketURL, err = options.dialURL(webSocketURL, params)
+	if err != nil {
+		return nil, err
+	}
+	options.logger.Infof("connecting to %s", redactedURL(webSocketURL))
+	if requestHeaders.Get("Host") == "" {
+		requestHeaders.Add("Host", webSocketURL.Host)
+	}
+	if requestHeaders.Get("Origin") == "" {
+		requestHeaders.Add("Origin", schema+"://"+webSocketURL.Host)
+	}
+	if options.tokenTransport == TokenInHeader {
+		requestHeaders.Add("Authorization", "Bearer "+token)
+	}
+	if options.suppliedHeaders, err = suppliedHeaders(ctx, options.headerSupplier); err != nil {
 		return nil, err
 	}
-	return establishConnection(webSocketURL, conn)
+	addUpgradeHeaders(requestHeaders, options.suppliedHeaders)
+	options.applyDialer(&dialer)
+	if err := options.checkSockJSInfo(ctx, base, params, &dialer, requestHeaders); err != nil {
+		return nil, err
+	}
+	options.applyAffinityCookies(requestHeaders)
+	conn, resp, err := dialer.DialContext(ctx, webSocketURL.String(), requestHeaders)
+	options.captureCookies(resp)
+	options.captureCompression(resp)
+	if err != nil {
+		return nil, &HandshakeError{Cause: err}
+	}
+	return establishConnection(ctx, webSocketURL, conn, options)
 }
 
-func establishConnection(webSocketURL url.URL, conn *websocket.Conn) (*StompClient, error) {
+func establishConnection(ctx context.Context, webSocketURL url.URL, conn *websocket.Conn, options *connectOptions) (*StompClient, error) {
 	readCh := make(chan *Frame)
-	writeCh := make(chan writeRequest)
+	writeCh := make(chan writeRequest, options.writeQueueSize)
+	routes := newRawRoutes(options.bufferPoisoning || assertionsEnabled, options.metrics)
 	stompClient := &StompClient{
 		webSocketURL: webSocketURL,
+		endpoint:     options.endpoint,
 		connection:   conn,
 		readCh:       readCh,
 		writeCh:      writeCh,
+		swapCh:       make(chan swapRequest),
+		done:         make(chan struct{}),
+		goroutines:   newGoroutineTracker(options.ids.ID(), webSocketURL.Host, options.logger),
+		readTimeout:  options.readTimeout,
+		writeTimeout: options.writeTimeout,
+
+		disconnectTimeout: options.disconnectTimeout,
+		disconnectOnce:    &sync.Once{},
+
+		rawTransport:  options.rawTransport,
+		binaryFrames:  options.rawTransport && options.binaryFrames,
+		lenientSockJS: options.lenientSockJS,
+		splitter:      &rawFrameSplitter{maxBodySize: options.maxFrameSize, routes: routes},
+		rawRoutes:     routes,
+		maxFrameSize:  options.maxFrameSize,
+		logger:        options.logger,
+		trace:         options.trace,
+		metrics:       options.metrics,
+		terminal:      newTerminalState(),
+		integrity:     options.integrity,
+		bufferSizer:   options.bufferSizer,
+		session:       options.session,
+		sockJSInfo:    options.sockJSInfo,
+		ids:           options.ids,
+		cookies:       options.responseCookies,
+		keepalive:     &keepalive{interval: options.pingInterval},
+		registry:      newSubscriptionRegistry(),
+		anomalies:     make(chan ProtocolAnomaly, anomalyBuffer),
+		parseErrors:   newParseErrors(options),
+
+		renegotiateHeartbeats: options.renegotiateHeartbeats,
+
+		maxOutboundMessageSize: options.maxOutboundMessageSize,
+		chunkTimeout:           options.chunkTimeout,
+		aliases:                newDestinationAliases(options),
+		batchFrames:            options.batchFrames,
+		batchBytes:             options.batchBytes,
+		errorRules:             options.errorRules,
+		dialect:                options.dialect,
+		headerSupplier:         options.headerSupplier,
+		subprotocol:            conn.Subprotocol(),
+		compressed:             options.compressionNegotiated,
+
+		requestedConfig: options.requestedConfig(redactedURL(webSocketURL)),
 	}
 
-	headers := []string{"accept-version:1.2,1.1,1.0", "heart-beat:10000,10000"}
-	connectFrame := CreateFrame(CONNECT, headers)
-	if connectErr := stompClient.connection.WriteMessage(1, connectFrame.Bytes()); connectErr != nil {
-		return nil, connectErr
-	} else {
-		_, _, err := stompClient.connection.ReadMessage()
-		if err != nil {
+	if err := options.checkSubprotocol(conn.Subprotocol()); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err := options.checkAcceptVersions(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if options.maxFrameSize > 0 {
+		conn.SetReadLimit(options.maxFrameSize)
+	}
+	if options.compression != nil && options.compression.enabled {
+		if err := conn.SetCompressionLevel(options.compression.level); err != nil {
+			conn.Close()
 			return nil, err
 		}
 	}
-	go readLoop(stompClient)
-	go processLoop(stompClient)
+	connectBuilder := NewFrame(CONNECT).
+		WithHeader("accept-version", strings.Join(options.offeredVersions(), ",")).
+		WithHeader("heart-beat", requestedHeartBeat)
+	if options.clientID != "" {
+		connectBuilder.WithHeader(ClientId, options.clientID)
+	}
+	stampHeaders(connectBuilder, options.suppliedHeaders)
+	connectFrame, err := connectBuilder.Build()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if connectErr := stompClient.writeFrame(connectFrame); connectErr != nil {
+		conn.Close()
+		return nil, connectErr
+	}
+	connected, pending, err := stompClient.awaitConnected(ctx, options.handshakeTimeout)
+	if err != nil {
+		options.logger.Debugf("STOMP handshake failed: %v", err)
+		conn.Close()
+		return nil, err
+	}
+	stompClient.splitter.heartbeating = brokerSendsHeartbeats(connected)
+	stompClient.version = negotiatedVersion(connected)
+	if err := options.checkVersion(stompClient.version); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	routes.escaped = escapesHeaders(stompClient.version)
+	stompClient.effectiveConfig = options.effectiveConfig(stompClient.requestedConfig, connected, stompClient.subprotocol)
+	stompClient.watchdog = newHeartbeatWatchdog(stompClient.effectiveConfig.HeartBeat, options.heartbeatTolerance, options.incomingHeartbeat)
+	if options.pingInterval > 0 {
+		conn.SetPongHandler(stompClient.pongHandler)
+	}
+	stompClient.goroutines.goRole(roleReadLoop, func() { readLoop(stompClient, pending) })
+	stompClient.goroutines.goRole(roleProcessLoop, func() { processLoop(stompClient) })
 	return stompClient, nil
 }
 
+// SockJSSession returns the SockJS server and session ids of the connection, for correlation with
+// server logs. Both are empty for the raw transport.
+func (stompClient StompClient) SockJSSession() SockJSSession {
+	return stompClient.session
+}
+
+// Disconnect sends DISCONNECT and waits for the broker receipt up to the disconnect timeout, then closes
+// the connection. If the receipt does not arrive in time the connection is closed anyway and
+// ErrDisconnectTimeout is returned. Calls after the first one do nothing.
 func (stompClient StompClient) Disconnect() error {
-	receiptId := uuid.New()
-	headers := []string{"receipt:" + receiptId.String()}
+	var err error
+	stompClient.terminal.recordDisconnect()
+	stompClient.disconnectOnce.Do(func() {
+		err = stompClient.disconnect()
+	})
+	return err
+}
+
+func (stompClient StompClient) disconnect() error {
+	stompClient.terminal.disconnecting.Store(true)
+	frame, err := NewFrame(DISCONNECT).WithHeader(Receipt, stompClient.newID()).Build()
+	if err != nil {
+		return err
+	}
+	timer := time.NewTimer(stompClient.disconnectTimeout)
+	defer timer.Stop()
 
-	ch := make(chan *Frame)
-	stompClient.writeCh <- writeRequest{
-		Frame: CreateFrame(DISCONNECT, headers),
+	// buffered, so processLoop never blocks on them once we stop waiting
+	ch := make(chan *Frame, 1)
+	errCh := make(chan error, 1)
+	select {
+	case stompClient.writeCh <- writeRequest{
+		Frame: frame,
 		C:     ch,
+		Err:   errCh,
+	}:
+	case <-stompClient.done:
+		stompClient.logger.Debugf("Client already closed; closing connection")
+		stompClient.connection.Close()
+		stompClient.terminal.finish(nil)
+		return fmt.Errorf("%w: the connection was lost before Disconnect", ErrClientClosed)
+	case <-timer.C:
+		stompClient.forceClose()
+		stompClient.terminal.finish(ErrDisconnectTimeout)
+		return ErrDisconnectTimeout
 	}
-	response := <-ch
-	if response.Command == RECEIPT {
-		logger.Infof("Connection closed")
+	select {
+	case response, ok := <-ch:
+		// processLoop reports the write result before it answers the receipt with an ERROR frame
+		// when the DISCONNECT could not be written
+		select {
+		case err := <-errCh:
+			if err != nil {
+				stompClient.connection.Close()
+				stompClient.terminal.finish(err)
+				return err
+			}
+		default:
+		}
+		if ok && response.Command == RECEIPT {
+			stompClient.logger.Infof("Connection closed")
+		}
 		stompClient.connection.Close()
+		stompClient.terminal.finish(nil)
+		return nil
+	case <-timer.C:
+		stompClient.forceClose()
+		stompClient.terminal.finish(ErrDisconnectTimeout)
+		return ErrDisconnectTimeout
+	}
+}
+
+// forceClose sends a websocket close frame and closes the socket. The read loop then fails and tears down processLoop.
+func (stompClient StompClient) forceClose() {
+	stompClient.metrics.ErrorOccurred(ErrorKindDisconnectTimeout)
+	stompClient.logger.Errorf("no receipt for DISCONNECT within %s; Closing underlying connection", stompClient.disconnectTimeout)
+	closeMessage := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+	_ = stompClient.connection.WriteControl(websocket.CloseMessage, closeMessage, time.Now().Add(time.Second))
+	stompClient.connection.Close()
+}
+
+// Send sends a SEND frame to destination and waits until it is written to the connection.
+// It blocks while the write queue is full. With WithChunking a frame larger than the outbound message limit
+// is sent as several chunk frames.
+func (stompClient StompClient) Send(destination, contentType string, body []byte) error {
+	frame, err := stompClient.createSendFrame(destination, contentType, body)
+	if err != nil {
+		return err
+	}
+	return stompClient.sendFrame(frame)
+}
+
+func (stompClient StompClient) sendFrame(frame *Frame) error {
+	frames, err := stompClient.outboundFrames(frame, true)
+	if err != nil {
+		return err
+	}
+	for _, f := range frames {
+		if err := stompClient.write(writeRequest{Frame: f}); err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
-func readLoop(stompClient *StompClient) {
+// TrySend queues a SEND frame to destination without waiting for it to be written.
+// It returns ErrWriteQueueFull instead of blocking when the write queue is full. It does not chunk frames.
+func (stompClient StompClient) TrySend(destination, contentType string, body []byte) error {
+	frame, err := stompClient.createSendFrame(destination, contentType, body)
+	if err != nil {
+		return err
+	}
+	if _, err := stompClient.outboundFrames(frame, false); err != nil {
+		return err
+	}
+	select {
+	case stompClient.writeCh <- writeRequest{
+		Frame: frame,
+		Err:   make(chan error, 1),
+	}:
+		return nil
+	default:
+		return ErrWriteQueueFull
+	}
+}
+
+// Flush waits until the frames queued before the call are written to the connection, whichever goroutine queued
+// them. Frames are written in the order their calls queued them, so a SUBSCRIBE from a Subscribe call that
+// returned reaches the broker before a SEND made after it; Flush is for callers that need the frames written,
+// for example those of TrySend. It returns the write error if a write fails, ErrClientClosed if the client is
+// closed and ctx.Err() when ctx is done first.
+func (stompClient StompClient) Flush(ctx context.Context) error {
+	errCh := make(chan error, 1)
+	select {
+	case stompClient.writeCh <- writeRequest{Err: errCh}:
+	case <-stompClient.done:
+		return ErrClientClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case err := <-errCh:
+		return err
+	case <-stompClient.done:
+		select {
+		case err := <-errCh:
+			return err
+		default:
+			return ErrClientClosed
+		}
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (stompClient StompClient) createSendFrame(destination, contentType string, body []byte, headers ...suppliedHeader) (*Frame, error) {
+	if err := stompClient.checkDraining(); err != nil {
+		return nil, err
+	}
+	builder := NewFrame(SEND).WithHeader(Destination, destination).WithBody(body)
+	if contentType != "" {
+		builder.WithHeader(ContentType, contentType)
+	}
+	stampHeaders(builder, headers)
+	stompClient.integrity.sign(builder, body)
+	return builder.Build()
+}
+
+// readMessage reads the next websocket message, into buf unless it is nil. The caller may then reuse buf once
+// nothing refers to the message any more.
+func (stompClient *StompClient) readMessage(buf *bytes.Buffer) (int, []byte, error) {
+	if stompClient.readTimeout > 0 {
+		if err := stompClient.connection.SetReadDeadline(time.Now().Add(stompClient.readTimeout)); err != nil {
+			return 0, nil, err
+		}
+	}
+	var messageType int
+	var data []byte
+	var err error
+	if buf == nil {
+		messageType, data, err = stompClient.connection.ReadMessage()
+	} else {
+		var r io.Reader
+		if messageType, r, err = stompClient.connection.NextReader(); err == nil {
+			_, err = buf.ReadFrom(r)
+			data = buf.Bytes()
+		}
+	}
+	if err == nil && stompClient.bufferSizer != nil {
+		stompClient.bufferSizer.recordRead(len(data))
+	}
+	return messageType, data, classifyCloseError(err)
+}
+
+func (stompClient *StompClient) writeMessage(data []byte) error {
+	if stompClient.writeTimeout > 0 {
+		if err := stompClient.connection.SetWriteDeadline(time.Now().Add(stompClient.writeTimeout)); err != nil {
+			return err
+		}
+	}
+	if stompClient.bufferSizer != nil {
+		stompClient.bufferSizer.recordWrite(len(data))
+	}
+	messageType := websocket.TextMessage
+	if stompClient.binaryFrames {
+		messageType = websocket.BinaryMessage
+	}
+	return classifyCloseError(stompClient.connection.WriteMessage(messageType, data))
+}
+
+func (stompClient *StompClient) writeFrame(frame *Frame) error {
+	stompClient.traceFrame(">>>", frame)
+	buf := frameBuffers.Get().(*bytes.Buffer)
+	defer frameBuffers.Put(buf)
+	buf.Reset()
+	if escaped := stompClient.escapeFrame(stompClient.aliases.shorten(frame)); stompClient.rawTransport {
+		escaped.writeRaw(buf)
+	} else {
+		escaped.writeSockJS(buf)
+	}
+	err := stompClient.writeMessage(buf.Bytes())
+	switch {
+	case err == nil:
+		stompClient.metrics.FrameSent(frame.Command, frame.size())
+	case isTimeout(err):
+		stompClient.metrics.ErrorOccurred(ErrorKindWriteTimeout)
+	default:
+		stompClient.metrics.ErrorOccurred(ErrorKindWrite)
+	}
+	return err
+}
+
+// route hands a frame read by the read loop to processLoop, except for handshake frames and the frames of
+// SubscribeRaw subscriptions, which are handled here. Destination aliases are expanded first.
+func (stompClient *StompClient) route(frame *Frame) {
+	if !stompClient.aliases.expand(frame) {
+		stompClient.reportAnomaly(AnomalyUnknownDestinationAlias, frame)
+		return
+	}
+	if isHandshakeFrame(frame) {
+		stompClient.handshakeFrame(frame)
+		return
+	}
+	if stompClient.rawRoutes.deliver(frame) {
+		return
+	}
+	stompClient.deliver(frame)
+}
+
+// readLoop delivers the frames left over from the handshake and then everything read from the connection.
+func readLoop(stompClient *StompClient, pending []*Frame) {
+	for _, frame := range pending {
+		stompClient.unescapeHeaders(frame)
+		stompClient.route(frame)
+	}
 	for {
-		_, data, err := stompClient.connection.ReadMessage()
+		var buf *bytes.Buffer
+		if stompClient.rawRoutes.active() {
+			buf = readBuffers.Get().(*bytes.Buffer)
+			buf.Reset()
+		}
+		messageType, data, err := stompClient.readMessage(buf)
+		if err == nil {
+			stompClient.watchdog.touch(time.Now())
+		}
+		if errors.Is(err, websocket.ErrReadLimit) {
+			err = fmt.Errorf("%w: websocket message is larger than %d bytes", ErrFrameTooLarge, stompClient.maxFrameSize)
+		}
 		if err != nil {
-			logger.Errorf("An error occurred while reading message: %s\n", err)
-			stompClient.readCh <- &Frame{Command: ERROR}
+			stompClient.logger.Errorf("[%s] An error occurred while reading message: %s\n", roleReadLoop, err)
+			if errors.Is(err, ErrFrameTooLarge) {
+				stompClient.metrics.ErrorOccurred(ErrorKindFrameTooLarge)
+			} else if !errors.Is(err, net.ErrClosed) {
+				// a closed socket means the client closed it and the cause has been reported already
+				stompClient.metrics.ErrorOccurred(ErrorKindRead)
+			}
+			if !errors.Is(err, net.ErrClosed) {
+				stompClient.terminal.fail(err)
+			}
+			stompClient.deliver(newErrorFrame(err.Error()))
 			break
 		}
-		if len(data) < 1 {
-			continue
+		frames, err := stompClient.readMessageFrames(messageType, data)
+		if err != nil && !errors.As(err, new(*WebSocketClosedError)) {
+			err = newFrameParseError(data, err)
 		}
-		switch data[0] {
-		case 'h':
-			// Heartbeat
+		if buf != nil && len(frames) == 0 {
+			// the message held nothing but frames of raw subscriptions, heart-beats or an incomplete frame,
+			// which the splitter copies
+			readBuffers.Put(buf)
+		}
+		for _, frame := range frames {
+			stompClient.unescapeHeaders(frame)
+			stompClient.frameReceived(frame)
+			stompClient.route(frame)
+		}
+		if err == nil {
+			stompClient.parseErrors.parsed(frames)
+		} else if err = stompClient.skipParseError(err); err == nil {
 			continue
-		case 'a':
-			// Normal message
-			stompClient.readCh <- ReadFrame(data)
-		case 'c':
-			// Session closed
+		}
+		if err != nil {
+			stompClient.logger.Errorf("[%s] An error occurred while parsing frame: %s\n", roleReadLoop, err)
+			stompClient.metrics.ErrorOccurred(parseErrorKind(err))
+			stompClient.terminal.fail(err)
+			stompClient.deliver(newErrorFrame(err.Error()))
 			break
 		}
 	}
 }
 
+// deliver hands a received frame to processLoop unless it has already exited.
+func (stompClient *StompClient) deliver(frame *Frame) {
+	select {
+	case stompClient.readCh <- frame:
+	case <-stompClient.done:
+	}
+}
+
 func processLoop(stompClient *StompClient) {
-	channels := make(map[string]chan *Frame)
+	defer close(stompClient.done)
+	defer stompClient.registry.clear()
+	channels := make(map[SubscriptionID]chan *Frame)
+	handlers := make(map[SubscriptionID]*subscriptionHandler)
+	receipts := make(map[string]chan *Frame)
+	var assembler *chunkAssembler
+	var chunkC <-chan time.Time
+	if stompClient.chunkTimeout > 0 {
+		assembler = newChunkAssembler(stompClient.chunkTimeout)
+		ticker := time.NewTicker(stompClient.chunkTimeout / 2)
+		defer ticker.Stop()
+		chunkC = ticker.C
+	}
+	batch := make([]writeRequest, 0, max(1, stompClient.batchFrames))
+	var pingC <-chan time.Time
+	if stompClient.keepalive != nil && stompClient.keepalive.interval > 0 {
+		ticker := time.NewTicker(stompClient.keepalive.interval)
+		defer ticker.Stop()
+		pingC = ticker.C
+	}
+	var watchdogC <-chan time.Time
+	if stompClient.watchdog != nil {
+		ticker := time.NewTicker(stompClient.watchdog.interval)
+		defer ticker.Stop()
+		watchdogC = ticker.C
+	}
 	for {
 		select {
 
@@ -136,102 +666,282 @@ func processLoop(stompClient *StompClient) {
 			switch f.Command {
 			case RECEIPT:
 				if id, ok := f.Contains(ReceiptId); ok {
-					if ch, ok := channels[id]; ok {
+					if ch, ok := receipts[id]; ok {
+						stompClient.logger.Debugf("[%s] receipt %s matched", roleProcessLoop, id)
 						ch <- f
-						delete(channels, id)
+						delete(receipts, id)
 						close(ch)
+					} else {
+						stompClient.reportAnomaly(AnomalyUnknownReceipt, f)
 					}
 				} else {
+					stompClient.logger.Errorf("[%s] RECEIPT without receipt-id; Closing processing", roleProcessLoop)
 					err := "missing receipt-id"
-					sendError(channels, err)
+					stompClient.terminal.fail(errors.New(err))
+					stompClient.failChannels(newErrorFrame(err), channels, receipts)
 					return
 				}
 
 			case ERROR:
-				logger.Errorf("received ERROR; Closing underlying connection")
-				for _, ch := range channels {
-					ch <- f
-					close(ch)
-				}
+				stompClient.logger.Errorf("[%s] received ERROR; Closing underlying connection", roleProcessLoop)
+				// a no-op for the ERROR frames of the read loop, which has reported the cause already
+				stompClient.terminal.fail(newBrokerError(f, stompClient.errorRules))
+				stompClient.failChannels(f, channels, receipts)
 				stompClient.connection.Close()
 
 				return
 
 			case MESSAGE:
-				if id, ok := f.Contains(Subscription_h); ok {
-					if ch, ok := channels[id]; ok {
-						ch <- f
+				if value, ok := f.Contains(Subscription_h); ok {
+					id := SubscriptionID(value)
+					if _, ok := channels[id]; ok {
+						if assembler != nil {
+							if f = assembler.add(id, f, time.Now()); f == nil {
+								break
+							}
+						}
+						stompClient.deliverMessage(channels, handlers, id, f)
 					} else {
-						logger.Infof("ignored MESSAGE for subscription %v", id)
+						stompClient.logger.Infof("[%s] ignored MESSAGE for subscription %v", roleProcessLoop, id)
 					}
+				} else {
+					stompClient.reportAnomaly(AnomalyMessageWithoutSubscription, f)
 				}
 			}
 
+		case req := <-stompClient.swapCh:
+			swapChannel(channels, req)
+
+		case now := <-chunkC:
+			for _, key := range assembler.expire(now) {
+				stompClient.chunkTimedOut(handlers[key.subscription], key)
+			}
+
+		case <-pingC:
+			if err := stompClient.ping(); err != nil {
+				stompClient.logger.Errorf("[%s] keepalive failed: %v; Closing underlying connection", roleProcessLoop, err)
+				stompClient.terminal.fail(err)
+				stompClient.failChannels(newErrorFrame(err.Error()), channels, receipts)
+				stompClient.connection.Close()
+				return
+			}
+
+		case now := <-watchdogC:
+			if err := stompClient.watchdog.check(now); err != nil {
+				stompClient.logger.Errorf("[%s] %v; Closing underlying connection", roleProcessLoop, err)
+				stompClient.metrics.ErrorOccurred(ErrorKindHeartbeatTimeout)
+				stompClient.terminal.fail(err)
+				stompClient.failChannels(newErrorFrame(err.Error()), channels, receipts)
+				stompClient.connection.Close()
+				return
+			}
+
 		case req, _ := <-stompClient.writeCh:
-			if req.C != nil {
-				if receipt, ok := req.Frame.Contains(Receipt); ok {
-					// remember the channel for this receipt
-					channels[receipt] = req.C
+			stompClient.metrics.WriteQueueDepth(len(stompClient.writeCh))
+			var next writeRequest
+			var more bool
+			batch, next, more = stompClient.nextBatch(batch[:0], req)
+			for {
+				for _, r := range batch {
+					registerRequest(r, channels, handlers, receipts, stompClient.rawRoutes)
+				}
+				err := stompClient.writeRequests(batch)
+				for _, r := range batch {
+					if r.Err != nil {
+						r.Err <- err
+					}
+				}
+				if err != nil {
+					stompClient.writeFailed(err, channels, receipts)
+					return
+				}
+				if !more {
+					break
 				}
+				batch, more = append(batch[:0], next), false
 			}
-			switch req.Frame.Command {
-			case SUBSCRIBE:
-				id, _ := req.Frame.Contains(Id)
-				channels[id] = req.C
+		}
+	}
+}
+
+// registerRequest updates the processLoop bookkeeping for a request before its frame is written.
+func registerRequest(req writeRequest, channels map[SubscriptionID]chan *Frame, handlers map[SubscriptionID]*subscriptionHandler, receipts map[string]chan *Frame, routes *rawRoutes) {
+	if req.Frame == nil {
+		return
+	}
+	if req.C != nil {
+		if receipt, ok := req.Frame.Contains(Receipt); ok {
+			// remember the channel for this receipt
+			receipts[receipt] = req.C
+		}
+	}
+	switch req.Frame.Command {
+	case SUBSCRIBE:
+		value, _ := req.Frame.Contains(Id)
+		id := SubscriptionID(value)
+		channels[id] = req.C
+		if req.Handler != nil {
+			handlers[id] = req.Handler
+		} else {
+			// left by a detached subscription of the same id
+			delete(handlers, id)
+		}
+	case UNSUBSCRIBE:
+		// frames the broker sends before it sees UNSUBSCRIBE are ignored from now on
+		value, _ := req.Frame.Contains(Id)
+		id := SubscriptionID(value)
+		delete(channels, id)
+		delete(handlers, id)
+		if routes != nil {
+			routes.remove(id)
+		}
+	}
+}
+
+// writeFailed closes the connection after a failed write; the websocket connection can't be written to after
+// that. The requests still queued fail with the same error, and subscriptions and receipts get an ERROR frame.
+func (stompClient *StompClient) writeFailed(err error, channels map[SubscriptionID]chan *Frame, receipts map[string]chan *Frame) {
+	message := err.Error()
+	switch {
+	case errors.Is(err, errStreamAborted):
+		stompClient.logger.Errorf("[%s] streamed frame partly written; Closing underlying connection", roleProcessLoop)
+	case isTimeout(err):
+		stompClient.logger.Errorf("[%s] write deadline exceeded; Closing underlying connection", roleProcessLoop)
+		message = "write timeout: " + message
+	default:
+		stompClient.logger.Errorf("[%s] Can't send message: %v; Closing underlying connection", roleProcessLoop, err)
+	}
+	stompClient.terminal.fail(err)
+	stompClient.connection.Close()
+	for {
+		select {
+		case req := <-stompClient.writeCh:
+			if req.Err != nil {
+				req.Err <- err
 			}
-			err := stompClient.connection.WriteMessage(1, req.Frame.Bytes())
-			if err != nil {
-				logger.Infof("Can't send message: %+v", err)
+			if req.C == nil {
+				continue
+			}
+			if receipt, ok := req.Frame.Contains(Receipt); ok {
+				receipts[receipt] = req.C
+			} else if req.Frame.Command == SUBSCRIBE {
+				id, _ := req.Frame.Contains(Id)
+				channels[SubscriptionID(id)] = req.C
 			}
+		default:
+			stompClient.failChannels(newErrorFrame(message), channels, receipts)
+			return
 		}
 	}
 }
 
-func sendError(m map[string]chan *Frame, err string) {
-	headers := []string{Message + ":" + err}
-	frame := CreateFrame(ERROR, headers)
-	for _, ch := range m {
-		ch <- frame
+// enqueue queues req for processLoop. It returns ErrClientClosed instead of blocking once processLoop has exited.
+func (stompClient StompClient) enqueue(req writeRequest) error {
+	select {
+	case stompClient.writeCh <- req:
+		return nil
+	case <-stompClient.done:
+		stompClient.enqueueRefused(req.Frame)
+		return ErrClientClosed
 	}
 }
 
-func randomIntn(max int) string {
-	var (
-		ml = len(strconv.Itoa(max))
-		ri = rand.Intn(max)
-		is = strconv.Itoa(ri)
-	)
-	if len(is) < ml {
-		is = strings.Repeat("0", ml-len(is)) + is
+// write queues req and waits until its frame is written.
+func (stompClient StompClient) write(req writeRequest) error {
+	errCh := make(chan error, 1)
+	req.Err = errCh
+	if err := stompClient.enqueue(req); err != nil {
+		return err
+	}
+	select {
+	case err := <-errCh:
+		return err
+	case <-stompClient.done:
+		// processLoop fails the requests it still finds queued when a write fails, later ones are never written
+		select {
+		case err := <-errCh:
+			return err
+		default:
+			return ErrClientClosed
+		}
 	}
-	return is
 }
 
-func randomString() string {
-	length := 16
-	chars := []byte("ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789")
-	clen := len(chars)
-	maxrb := 255 - (256 % clen)
-	b := make([]byte, length)
-	r := make([]byte, length+(length/4)) // storage for random bytes.
-	i := 0
-	for {
-		if _, err := rand.Read(r); err != nil {
-			panic("uniuri: error reading random bytes: " + err.Error())
+// failChannels hands the frame that ends the connection to the subscription and receipt channels and closes them,
+// see handOver. A subscription consumer that is not receiving gets the frame once it receives, until it
+// unsubscribes; receipt waiters only get it when they are receiving.
+func (stompClient *StompClient) failChannels(frame *Frame, channels map[SubscriptionID]chan *Frame, receipts map[string]chan *Frame) {
+	handed := make(map[chan *Frame]bool, len(channels)+len(receipts))
+	for id, ch := range channels {
+		if ch != nil && !handed[ch] {
+			handed[ch] = true
+			handOver(ch, frame, stompClient.registry.ending(id), true)
 		}
-		for _, rb := range r {
-			c := int(rb)
-			if c > maxrb {
-				// Skip this number to avoid modulo bias.
-				continue
-			}
-			b[i] = chars[c%clen]
-			i++
-			if i == length {
-				return string(b)
-			}
+	}
+	for _, ch := range receipts {
+		if ch != nil && !handed[ch] {
+			handed[ch] = true
+			handOver(ch, frame, closedSignal, true)
+		}
+	}
+}
+
+// sendError hands an ERROR frame with message err to every channel of m without waiting for the consumers, see
+// handOver. The channels are left open.
+func sendError[K comparable](m map[K]chan *Frame, err string) {
+	frame := newErrorFrame(err)
+	for _, ch := range m {
+		handOver(ch, frame, nil, false)
+	}
+}
+
+// closedSignal is a closed channel, the stop of handOver for consumers that are not waited for.
+var closedSignal = func() chan struct{} {
+	ch := make(chan struct{})
+	close(ch)
+	return ch
+}()
+
+// handOver sends frame to ch, and closes ch after it when closeCh is set. When the consumer is not receiving,
+// a goroutine sends the frame as soon as it receives, or gives up once stop is closed, so that processLoop
+// never waits for a consumer.
+func handOver(ch chan *Frame, frame *Frame, stop <-chan struct{}, closeCh bool) {
+	done := func() {
+		if closeCh {
+			close(ch)
 		}
 	}
+	select {
+	case ch <- frame:
+		done()
+		return
+	case <-stop:
+		done()
+		return
+	default:
+	}
+	go func() {
+		select {
+		case ch <- frame:
+		case <-stop:
+		}
+		done()
+	}()
+}
+
+func parseErrorKind(err error) string {
+	switch {
+	case errors.Is(err, ErrFrameTooLarge):
+		return ErrorKindFrameTooLarge
+	case errors.Is(err, errSockJSClosed):
+		return ErrorKindRead
+	}
+	return ErrorKindParse
+}
+
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
 }
 
 func extractSchema(webSocketURL url.URL) (string, error) {
@@ -241,5 +951,5 @@ func extractSchema(webSocketURL url.URL) (string, error) {
 	case "wss":
 		return "https", nil
 	}
-	return "", errors.New("malformed ws or wss URL")
+	return "", fmt.Errorf("%w: scheme %q", ErrInvalidScheme, webSocketURL.Scheme)
 }
@@ -1,9 +1,16 @@
 package go_stomp_websocket
 
 import (
+	"context"
+	"errors"
+	"net"
 	"net/http"
+	"net/http/cookiejar"
 	"net/http/httptest"
 	"net/url"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -101,7 +108,7 @@ func TestExtractSchema(t *testing.T) {
 			result, err := extractSchema(tt.webSocketURL)
 
 			if tt.expectedError {
-				assert.Error(t, err)
+				assert.ErrorIs(t, err, ErrInvalidScheme)
 				assert.Empty(t, result)
 			} else {
 				assert.NoError(t, err)
@@ -183,21 +190,33 @@ func TestConnectWithToken_InvalidSchema(t *testing.T) {
 	dialer := websocket.Dialer{}
 	client, err := ConnectWithToken(*u, dialer, "token123")
 	assert.Nil(t, client)
-	assert.Error(t, err)
+	assert.ErrorIs(t, err, ErrInvalidScheme)
 }
 
+const connectedTestFrame = `a["CONNECTED\nversion:1.2\nheart-beat:0,0\n\n\u0000"]`
+
 // startTestWSServer starts a websocket test server that:
 // - Reads the first client message (CONNECT frame)
-// - Sends a dummy message to satisfy the initial ReadMessage in establishConnection
+// - Sends the SockJS open frame and CONNECTED
 // - Echoes a RECEIPT with the receipt-id extracted from a DISCONNECT frame
 func startTestWSServer(t *testing.T) (*httptest.Server, chan struct{}) {
+	return startTestWSServerWithUpgradeCheck(t, nil)
+}
+
+// startTestWSServerWithUpgradeCheck works like startTestWSServer and additionally passes
+// every upgrade request to check before upgrading it
+func startTestWSServerWithUpgradeCheck(t *testing.T, check func(r *http.Request)) (*httptest.Server, chan struct{}) {
 	t.Helper()
 	done := make(chan struct{})
+	var doneOnce sync.Once
 	upgrader := websocket.Upgrader{
 		CheckOrigin: func(r *http.Request) bool { return true },
 	}
 
 	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if check != nil {
+			check(r)
+		}
 		c, err := upgrader.Upgrade(w, r, nil)
 		if err != nil {
 			t.Errorf("upgrade error: %v", err)
@@ -211,13 +230,14 @@ func startTestWSServer(t *testing.T) (*httptest.Server, chan struct{}) {
 			t.Errorf("failed reading initial client message: %v", err)
 			return
 		}
-		// Send a dummy message to let client proceed
+		// Let the client finish the handshake
 		_ = c.WriteMessage(websocket.TextMessage, []byte("o"))
+		_ = c.WriteMessage(websocket.TextMessage, []byte(connectedTestFrame))
 
 		for {
 			_, msg, err := c.ReadMessage()
 			if err != nil {
-				close(done)
+				doneOnce.Do(func() { close(done) })
 				return
 			}
 			// Expect a DISCONNECT frame array payload like: ["DISCONNECT\nreceipt:<id>\n\n\u0000"]
@@ -287,3 +307,571 @@ func TestConnectWithToken_SuccessAndDisconnect(t *testing.T) {
 		t.Fatal("server did not finish in time")
 	}
 }
+
+func TestConnectWithToken_UpgradeHeadersAndCookies(t *testing.T) {
+	upgradeRequests := make(chan *http.Request, 1)
+	ts, done := startTestWSServerWithUpgradeCheck(t, func(r *http.Request) {
+		upgradeRequests <- r
+	})
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("parse server url: %v", err)
+	}
+	jar, _ := cookiejar.New(nil)
+	jar.SetCookies(u, []*http.Cookie{{Name: "route", Value: "sticky-1"}})
+	u.Scheme = "ws"
+
+	client, err := ConnectWithToken(*u, websocket.Dialer{}, "token-abc",
+		WithUpgradeHeaders(http.Header{"X-Tenant-Id": []string{"tenant-1"}}),
+		WithCookieJar(jar))
+	if err != nil {
+		t.Fatalf("ConnectWithToken failed: %v", err)
+	}
+
+	r := <-upgradeRequests
+	assert.Equal(t, "tenant-1", r.Header.Get("X-Tenant-Id"))
+	assert.Equal(t, "Bearer token-abc", r.Header.Get("Authorization"))
+	cookie, err := r.Cookie("route")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "sticky-1", cookie.Value)
+	}
+
+	assert.NoError(t, client.Disconnect())
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("server did not finish in time")
+	}
+}
+
+func TestConnectWithToken_AuthorizationUpgradeHeaderRejected(t *testing.T) {
+	u, _ := url.Parse("ws://localhost/test")
+	client, err := ConnectWithToken(*u, websocket.Dialer{}, "token-abc",
+		WithUpgradeHeaders(http.Header{"Authorization": []string{"Basic abc"}}))
+	assert.Nil(t, client)
+	assert.ErrorContains(t, err, "Authorization")
+}
+
+func TestConnectWithToken_QueryTransportKeepsAuthorizationHeader(t *testing.T) {
+	upgradeRequests := make(chan *http.Request, 1)
+	ts, done := startTestWSServerWithUpgradeCheck(t, func(r *http.Request) {
+		upgradeRequests <- r
+	})
+	defer ts.Close()
+
+	u, _ := url.Parse(ts.URL)
+	u.Scheme = "ws"
+	client, err := ConnectWithToken(*u, websocket.Dialer{}, "token-abc", WithTokenTransport(TokenInQuery),
+		WithUpgradeHeaders(http.Header{"Authorization": []string{"Basic abc"}}))
+	if err != nil {
+		t.Fatalf("ConnectWithToken failed: %v", err)
+	}
+
+	r := <-upgradeRequests
+	assert.Equal(t, "Basic abc", r.Header.Get("Authorization"))
+	assert.Equal(t, "token-abc", r.URL.Query().Get(accessTokenParam))
+
+	assert.NoError(t, client.Disconnect())
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("server did not finish in time")
+	}
+}
+
+func TestConnectWithTokenProvider_FreshTokenPerDial(t *testing.T) {
+	upgradeRequests := make(chan *http.Request, 2)
+	ts, _ := startTestWSServerWithUpgradeCheck(t, func(r *http.Request) {
+		upgradeRequests <- r
+	})
+	defer ts.Close()
+
+	u, _ := url.Parse(ts.URL)
+	u.Scheme = "ws"
+
+	calls := 0
+	provider := func(ctx context.Context) (string, error) {
+		calls++
+		return "token-" + strconv.Itoa(calls), nil
+	}
+
+	for i := 1; i <= 2; i++ {
+		client, err := ConnectWithTokenProvider(context.Background(), *u, websocket.Dialer{}, provider)
+		if err != nil {
+			t.Fatalf("ConnectWithTokenProvider failed: %v", err)
+		}
+		r := <-upgradeRequests
+		assert.Equal(t, "Bearer token-"+strconv.Itoa(i), r.Header.Get("Authorization"))
+		assert.NoError(t, client.Disconnect())
+	}
+	assert.Equal(t, 2, calls)
+}
+
+func TestConnectWithTokenProvider_ProviderError(t *testing.T) {
+	u, _ := url.Parse("ws://localhost/test")
+	providerErr := errors.New("token expired")
+	provider := func(ctx context.Context) (string, error) {
+		return "", providerErr
+	}
+
+	client, err := ConnectWithTokenProvider(context.Background(), *u, websocket.Dialer{}, provider)
+	assert.Nil(t, client)
+	assert.ErrorIs(t, err, ErrTokenProvider)
+	assert.ErrorIs(t, err, providerErr)
+}
+
+func TestConnectWithTokenProvider_DialErrorIsNotProviderError(t *testing.T) {
+	ts := httptest.NewServer(http.NotFoundHandler())
+	defer ts.Close()
+	u, _ := url.Parse(ts.URL)
+	u.Scheme = "ws"
+
+	client, err := ConnectWithTokenProvider(context.Background(), *u, websocket.Dialer{}, StaticToken("token"))
+	assert.Nil(t, client)
+	var handshakeErr *HandshakeError
+	assert.ErrorAs(t, err, &handshakeErr)
+	assert.NotErrorIs(t, err, ErrTokenProvider)
+}
+
+// startStalledWSServer starts a websocket test server that completes the handshake and then never reads again
+func startStalledWSServer(t *testing.T) (*httptest.Server, chan struct{}) {
+	t.Helper()
+	release := make(chan struct{})
+	upgrader := websocket.Upgrader{
+		CheckOrigin: func(r *http.Request) bool { return true },
+	}
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("upgrade error: %v", err)
+			return
+		}
+		defer c.Close()
+		if _, _, err = c.ReadMessage(); err != nil {
+			t.Errorf("failed reading initial client message: %v", err)
+			return
+		}
+		_ = c.WriteMessage(websocket.TextMessage, []byte("o"))
+		_ = c.WriteMessage(websocket.TextMessage, []byte(connectedTestFrame))
+		<-release
+	})
+	return httptest.NewServer(h), release
+}
+
+func TestSend(t *testing.T) {
+	ts, _ := startTestWSServer(t)
+	defer ts.Close()
+	u, _ := url.Parse(ts.URL)
+	u.Scheme = "ws"
+
+	client, err := ConnectWithToken(*u, websocket.Dialer{}, "token-abc")
+	if err != nil {
+		t.Fatalf("ConnectWithToken failed: %v", err)
+	}
+	assert.NoError(t, client.Send("/queue/test", "application/json", []byte(`{"a":1}`)))
+	assert.NoError(t, client.Disconnect())
+}
+
+func TestTrySend_WriteQueueFull(t *testing.T) {
+	ts, release := startStalledWSServer(t)
+	defer ts.Close()
+	defer close(release)
+	u, _ := url.Parse(ts.URL)
+	u.Scheme = "ws"
+
+	client, err := ConnectWithToken(*u, websocket.Dialer{}, "token-abc", WithWriteQueueSize(2))
+	if err != nil {
+		t.Fatalf("ConnectWithToken failed: %v", err)
+	}
+	defer client.connection.Close()
+
+	// keep the queue topped up until the writer blocks on the stalled socket and the queue stays full
+	body := make([]byte, 1<<20)
+	stalled := false
+	for i := 0; i < 200 && !stalled; i++ {
+		err := client.TrySend("/queue/test", "", body)
+		if errors.Is(err, ErrWriteQueueFull) {
+			time.Sleep(50 * time.Millisecond)
+			stalled = len(client.writeCh) == cap(client.writeCh)
+			continue
+		}
+		assert.NoError(t, err)
+	}
+	assert.True(t, stalled, "write queue never filled up against a stalled server")
+
+	start := time.Now()
+	assert.ErrorIs(t, client.TrySend("/queue/test", "", body), ErrWriteQueueFull)
+	assert.Less(t, time.Since(start), 100*time.Millisecond)
+}
+
+func TestWriteTimeout_TearsDownConnection(t *testing.T) {
+	ts, release := startStalledWSServer(t)
+	defer ts.Close()
+	defer close(release)
+	u, _ := url.Parse(ts.URL)
+	u.Scheme = "ws"
+
+	client, err := ConnectWithToken(*u, websocket.Dialer{}, "token-abc", WithWriteTimeout(100*time.Millisecond))
+	if err != nil {
+		t.Fatalf("ConnectWithToken failed: %v", err)
+	}
+	sub, err := client.Subscribe("/topic/test")
+	assert.NoError(t, err)
+
+	sendErr := make(chan error, 1)
+	go func() {
+		body := make([]byte, 1<<20)
+		for {
+			if err := client.Send("/queue/test", "", body); err != nil {
+				sendErr <- err
+				return
+			}
+		}
+	}()
+
+	select {
+	case err := <-sendErr:
+		assert.True(t, isTimeout(err), "expected timeout error, got %v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("write never timed out")
+	}
+	select {
+	case frame := <-sub.FrameCh:
+		assert.Equal(t, ERROR, frame.Command)
+		msg, _ := frame.Contains(Message)
+		assert.Contains(t, msg, "write timeout")
+	case <-time.After(2 * time.Second):
+		t.Fatal("subscriber did not receive ERROR frame")
+	}
+}
+
+var errInjectedWrite = errors.New("injected write failure")
+
+// failingConn fails every write once failing is set.
+type failingConn struct {
+	net.Conn
+	failing *atomic.Bool
+}
+
+func (c failingConn) Write(b []byte) (int, error) {
+	if c.failing.Load() {
+		return 0, errInjectedWrite
+	}
+	return c.Conn.Write(b)
+}
+
+// connectFailingClient connects a client whose writes fail once the returned flag is set.
+func connectFailingClient(t *testing.T) (*StompClient, *atomic.Bool) {
+	t.Helper()
+	ts, _ := startTestWSServer(t)
+	t.Cleanup(ts.Close)
+	failing := &atomic.Bool{}
+	dialer := websocket.Dialer{NetDial: func(network, addr string) (net.Conn, error) {
+		conn, err := net.Dial(network, addr)
+		return failingConn{Conn: conn, failing: failing}, err
+	}}
+	client, err := ConnectWithToken(wsURL(ts), dialer, "token")
+	if err != nil {
+		t.Fatalf("ConnectWithToken failed: %v", err)
+	}
+	return client, failing
+}
+
+func TestWriteFailure_TearsDownConnection(t *testing.T) {
+	client, failing := connectFailingClient(t)
+	sub, err := client.Subscribe("/topic/test", WithBufferSize(1))
+	assert.NoError(t, err)
+	failing.Store(true)
+
+	assert.ErrorIs(t, client.Send("/queue/test", "", []byte("lost")), errInjectedWrite)
+	select {
+	case frame := <-sub.FrameCh:
+		assert.Equal(t, ERROR, frame.Command)
+		msg, _ := frame.Contains(Message)
+		assert.Contains(t, msg, errInjectedWrite.Error())
+	case <-time.After(2 * time.Second):
+		t.Fatal("subscriber did not receive ERROR frame")
+	}
+	err, ok := receiveTerminalError(t, client)
+	assert.True(t, ok)
+	assert.ErrorIs(t, err, errInjectedWrite)
+
+	// nothing blocks on the closed client
+	assert.ErrorIs(t, client.Send("/queue/test", "", nil), ErrClientClosed)
+	_, err = client.Subscribe("/topic/other")
+	assert.ErrorIs(t, err, ErrClientClosed)
+	assert.ErrorIs(t, sub.unsubscribe(), ErrClientClosed)
+	err = client.Disconnect()
+	assert.ErrorIs(t, err, ErrClientClosed)
+	assert.ErrorIs(t, err, ErrNotConnected)
+	assert.NoError(t, client.Disconnect(), "calls after the first do nothing")
+}
+
+func TestWriteFailure_FailsQueuedRequests(t *testing.T) {
+	client, failing := connectFailingClient(t)
+	failing.Store(true)
+
+	errs := make(chan error, 10)
+	for i := 0; i < cap(errs); i++ {
+		go func() { errs <- client.Send("/queue/test", "", []byte("lost")) }()
+	}
+	for i := 0; i < cap(errs); i++ {
+		select {
+		case err := <-errs:
+			if !errors.Is(err, errInjectedWrite) {
+				assert.ErrorIs(t, err, ErrClientClosed)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("Send blocked on a failed client")
+		}
+	}
+}
+
+func TestDisconnect_ReturnsWriteError(t *testing.T) {
+	client, failing := connectFailingClient(t)
+	failing.Store(true)
+
+	start := time.Now()
+	assert.ErrorIs(t, client.Disconnect(), errInjectedWrite)
+	assert.Less(t, time.Since(start), defaultDisconnectTimeout, "Disconnect waited for a receipt that never comes")
+	err, ok := receiveTerminalError(t, client)
+	assert.True(t, ok)
+	assert.ErrorIs(t, err, errInjectedWrite)
+}
+
+func TestReadTimeout_TearsDownConnection(t *testing.T) {
+	ts, release := startStalledWSServer(t)
+	defer ts.Close()
+	defer close(release)
+	u, _ := url.Parse(ts.URL)
+	u.Scheme = "ws"
+
+	client, err := ConnectWithToken(*u, websocket.Dialer{}, "token-abc", WithReadTimeout(100*time.Millisecond))
+	if err != nil {
+		t.Fatalf("ConnectWithToken failed: %v", err)
+	}
+	sub, err := client.Subscribe("/topic/test")
+	assert.NoError(t, err)
+
+	select {
+	case frame := <-sub.FrameCh:
+		assert.Equal(t, ERROR, frame.Command)
+		msg, _ := frame.Contains(Message)
+		assert.Contains(t, msg, "timeout")
+	case <-time.After(2 * time.Second):
+		t.Fatal("subscriber did not receive ERROR frame")
+	}
+	select {
+	case <-client.done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("process loop did not exit")
+	}
+}
+
+func TestConnectionLost_SubscriberNotReading(t *testing.T) {
+	ts, _, subscribed := startTriggeredPushServer(t)
+	client := connectTestClient(t, ts, WithLogger(NopLogger()))
+	sub, err := client.Subscribe("/topic/test")
+	if !assert.NoError(t, err) {
+		return
+	}
+	reader, err := client.Subscribe("/topic/test")
+	if !assert.NoError(t, err) {
+		return
+	}
+	unsubscribed, err := client.Subscribe("/topic/test")
+	if !assert.NoError(t, err) {
+		return
+	}
+	<-subscribed
+
+	// a lost connection rather than Disconnect, which makes the Unsubscribe below a misuse
+	_ = client.connection.Close()
+	select {
+	case <-client.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("processLoop waited for the subscriber")
+	}
+	// the ERROR frame waits for the consumers that receive late
+	frame, ok := <-sub.FrameCh
+	if assert.True(t, ok) {
+		assert.Equal(t, ERROR, frame.Command)
+	}
+	_, ok = <-sub.FrameCh
+	assert.False(t, ok)
+	frame, err = reader.Read(context.Background())
+	if assert.NoError(t, err) {
+		assert.Equal(t, ERROR, frame.Command)
+	}
+	_, err = reader.Read(context.Background())
+	assert.ErrorIs(t, err, ErrSubscriptionClosed)
+	// and for the others until they unsubscribe
+	unsubscribed.Unsubscribe()
+	assert.Eventually(t, func() bool {
+		_, ok := <-unsubscribed.FrameCh // the frame may still be handed over, then the channel is closed
+		return !ok
+	}, 5*time.Second, 10*time.Millisecond, "FrameCh was not closed after Unsubscribe")
+}
+
+func TestDisconnect_ReceiptTimeout(t *testing.T) {
+	closeCodes := make(chan int, 1)
+	upgrader := websocket.Upgrader{
+		CheckOrigin: func(r *http.Request) bool { return true },
+	}
+	// the server swallows every frame, including DISCONNECT, without answering
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("upgrade error: %v", err)
+			return
+		}
+		defer c.Close()
+		if _, _, err = c.ReadMessage(); err != nil {
+			return
+		}
+		_ = c.WriteMessage(websocket.TextMessage, []byte("o"))
+		_ = c.WriteMessage(websocket.TextMessage, []byte(connectedTestFrame))
+		for {
+			if _, _, err := c.ReadMessage(); err != nil {
+				var closeErr *websocket.CloseError
+				if errors.As(err, &closeErr) {
+					closeCodes <- closeErr.Code
+				}
+				close(closeCodes)
+				return
+			}
+		}
+	}))
+	defer ts.Close()
+	u, _ := url.Parse(ts.URL)
+	u.Scheme = "ws"
+
+	client, err := ConnectWithToken(*u, websocket.Dialer{}, "token-abc", WithDisconnectTimeout(200*time.Millisecond))
+	if err != nil {
+		t.Fatalf("ConnectWithToken failed: %v", err)
+	}
+
+	start := time.Now()
+	assert.ErrorIs(t, client.Disconnect(), ErrDisconnectTimeout)
+	assert.Less(t, time.Since(start), 2*time.Second)
+
+	select {
+	case code := <-closeCodes:
+		assert.Equal(t, websocket.CloseNormalClosure, code)
+	case <-time.After(2 * time.Second):
+		t.Fatal("server did not observe the close")
+	}
+	assert.Eventually(t, func() bool {
+		return len(client.GoroutineReport()) == 0
+	}, 2*time.Second, 10*time.Millisecond)
+
+	// second call is a no-op
+	assert.NoError(t, client.Disconnect())
+}
+
+func TestConnectWithToken_HandshakeBrokerError(t *testing.T) {
+	body := "Token lacks the required scopes:\n - websocket\n - tenant:read"
+	tests := []struct {
+		name        string
+		headers     []string
+		body        string
+		message     string
+		contentType string
+	}{
+		{name: "header only", headers: []string{"message:Access denied"}, message: "Access denied"},
+		{name: "body only", headers: []string{"content-type:text/plain"}, body: body, message: "Token lacks the required scopes:", contentType: "text/plain"},
+		{name: "both", headers: []string{"message:Access denied", "content-type:text/plain"}, body: body, message: "Access denied", contentType: "text/plain"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			headers := append(tt.headers, "content-length:"+strconv.Itoa(len(tt.body)))
+			errorFrame := createTestFrame(ERROR, headers, tt.body)
+			upgrader := websocket.Upgrader{
+				CheckOrigin: func(r *http.Request) bool { return true },
+			}
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				c, err := upgrader.Upgrade(w, r, nil)
+				if err != nil {
+					t.Errorf("upgrade error: %v", err)
+					return
+				}
+				defer c.Close()
+				_ = c.WriteMessage(websocket.TextMessage, []byte("o"))
+				if _, _, err = c.ReadMessage(); err != nil {
+					return
+				}
+				_ = c.WriteMessage(websocket.TextMessage, append([]byte("a"), errorFrame.Bytes()...))
+			}))
+			defer ts.Close()
+			u, _ := url.Parse(ts.URL)
+			u.Scheme = "ws"
+
+			client, err := ConnectWithToken(*u, websocket.Dialer{}, "token-abc")
+			assert.Nil(t, client)
+			var brokerErr *BrokerError
+			if assert.ErrorAs(t, err, &brokerErr) {
+				assert.Equal(t, tt.message, brokerErr.Message)
+				assert.Equal(t, tt.body, brokerErr.Body)
+			}
+			var rejected *ConnectRejectedError
+			if assert.ErrorAs(t, err, &rejected) {
+				assert.Equal(t, brokerErr.Header, rejected.Message)
+				assert.Equal(t, tt.body, rejected.Body)
+				assert.Equal(t, tt.contentType, rejected.ContentType)
+			}
+			assert.Contains(t, err.Error(), tt.message)
+			assert.Contains(t, err.Error(), tt.body)
+		})
+	}
+}
+
+func TestConnectWithToken_HandshakeError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "token expired", http.StatusUnauthorized)
+	}))
+	defer ts.Close()
+
+	_, err := ConnectWithToken(wsURL(ts), websocket.Dialer{}, "token")
+	var handshakeErr *HandshakeError
+	if assert.ErrorAs(t, err, &handshakeErr) {
+		assert.ErrorIs(t, handshakeErr.Cause, websocket.ErrBadHandshake)
+	}
+	assert.EqualError(t, err, "websocket handshake failed: websocket: bad handshake")
+
+	_, err = Connect(wsURL(ts), websocket.Dialer{}, nil, gorillaDialer{})
+	assert.ErrorAs(t, err, &handshakeErr)
+}
+
+type gorillaDialer struct{}
+
+func (gorillaDialer) Dial(webSocketURL url.URL, dialer websocket.Dialer, requestHeaders http.Header) (*websocket.Conn, *http.Response, error) {
+	return dialer.Dial(webSocketURL.String(), requestHeaders)
+}
+
+func TestConnectWithToken_HandshakeUnexpectedFrame(t *testing.T) {
+	upgrader := websocket.Upgrader{
+		CheckOrigin: func(r *http.Request) bool { return true },
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("upgrade error: %v", err)
+			return
+		}
+		defer c.Close()
+		if _, _, err = c.ReadMessage(); err != nil {
+			return
+		}
+		_ = c.WriteMessage(websocket.TextMessage, []byte("o"))
+		_ = c.WriteMessage(websocket.TextMessage, []byte(`c[3000,"Go away!"]`))
+	}))
+	defer ts.Close()
+	u, _ := url.Parse(ts.URL)
+	u.Scheme = "ws"
+
+	client, err := ConnectWithToken(*u, websocket.Dialer{}, "token-abc")
+	assert.Nil(t, client)
+	assert.ErrorContains(t, err, "Go away!")
+}
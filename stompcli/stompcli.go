@@ -0,0 +1,87 @@
+// Package stompcli provides one-shot STOMP operations for command line tools and scripts. Every call connects,
+// performs the operation, disconnects and returns all errors synchronously; no goroutines or channels are left
+// for the caller to manage.
+package stompcli
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	"github.com/gorilla/websocket"
+	stomp "github.com/netcracker/qubership-core-lib-go-stomp-websocket/v3"
+)
+
+// Publish sends body to destination over a new connection to webSocketURL authenticated with token, then
+// disconnects. The broker confirms DISCONNECT with a receipt only after the frames sent before it, so a
+// nil error means the broker has processed the SEND. opts are passed to the client.
+func Publish(ctx context.Context, webSocketURL, token, destination string, body []byte, opts ...stomp.ConnectOption) error {
+	client, err := connect(ctx, webSocketURL, token, opts)
+	if err != nil {
+		return err
+	}
+	if err := client.Send(destination, "", body); err != nil {
+		_ = client.Disconnect()
+		return fmt.Errorf("can't send to %s: %w", destination, err)
+	}
+	if err := client.Disconnect(); err != nil {
+		return fmt.Errorf("can't confirm the send to %s: %w", destination, err)
+	}
+	return nil
+}
+
+// Consume subscribes to destination over a new connection to webSocketURL authenticated with token, waits for
+// n MESSAGE frames and disconnects. When ctx is done or the connection fails first, the frames received so far
+// are returned with the error. opts are passed to the client.
+func Consume(ctx context.Context, webSocketURL, token, destination string, n int, opts ...stomp.ConnectOption) ([]*stomp.Frame, error) {
+	client, err := connect(ctx, webSocketURL, token, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Disconnect()
+	// frames beyond n are dropped, so that the dispatcher never waits for them and Disconnect goes through
+	subscription, err := client.Subscribe(destination, stomp.WithBufferSize(n), stomp.WithSubscriptionOverflow(stomp.OverflowDropNewest))
+	if err != nil {
+		return nil, fmt.Errorf("can't subscribe to %s: %w", destination, err)
+	}
+	frames := make([]*stomp.Frame, 0, n)
+	for len(frames) < n {
+		select {
+		case frame, ok := <-subscription.FrameCh:
+			if !ok || frame.Command == stomp.ERROR {
+				return frames, connectionError(client)
+			}
+			if frame.Command == stomp.MESSAGE {
+				frames = append(frames, frame)
+			}
+		case err := <-client.Errors():
+			if err == nil {
+				err = stomp.ErrClientClosed
+			}
+			return frames, err
+		case <-ctx.Done():
+			return frames, ctx.Err()
+		}
+	}
+	return frames, nil
+}
+
+func connect(ctx context.Context, webSocketURL, token string, opts []stomp.ConnectOption) (*stomp.StompClient, error) {
+	u, err := url.Parse(webSocketURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid websocket URL: %w", err)
+	}
+	client, err := stomp.ConnectWithTokenProvider(ctx, *u, websocket.Dialer{}, stomp.StaticToken(token), opts...)
+	if err != nil {
+		return nil, fmt.Errorf("can't connect to %s: %w", u.Redacted(), err)
+	}
+	return client, nil
+}
+
+// connectionError returns the terminal error of a client whose subscription received ERROR or was closed.
+func connectionError(client *stomp.StompClient) error {
+	if err, ok := <-client.Errors(); ok && err != nil {
+		return err
+	}
+	return stomp.ErrClientClosed
+}
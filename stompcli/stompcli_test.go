@@ -0,0 +1,113 @@
+package stompcli
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	stomp "github.com/netcracker/qubership-core-lib-go-stomp-websocket/v3"
+	"github.com/netcracker/qubership-core-lib-go-stomp-websocket/v3/stomptest"
+	"github.com/stretchr/testify/assert"
+)
+
+func serverURL(s *stomptest.Server) string {
+	u := s.URL()
+	return u.String()
+}
+
+func TestPublish(t *testing.T) {
+	s := stomptest.NewServer(t)
+	s.RequireToken("token")
+
+	err := Publish(context.Background(), serverURL(s), "token", "/app/test", []byte("hello"))
+	assert.NoError(t, err)
+	send := s.Expect(stomp.SEND)
+	destination, _ := send.Contains(stomp.Destination)
+	assert.Equal(t, "/app/test", destination)
+	assert.Equal(t, "hello", send.BodyString())
+	s.Expect(stomp.DISCONNECT)
+}
+
+func TestPublish_Unconfirmed(t *testing.T) {
+	s := stomptest.NewServer(t)
+	s.RespondToReceipts(false)
+
+	err := Publish(context.Background(), serverURL(s), "token", "/app/test", []byte("hello"),
+		stomp.WithDisconnectTimeout(50*time.Millisecond))
+	assert.ErrorIs(t, err, stomp.ErrDisconnectTimeout)
+}
+
+func TestConsume(t *testing.T) {
+	s := stomptest.NewServer(t)
+	s.RequireToken("token")
+
+	pushed := make(chan struct{})
+	go func() {
+		defer close(pushed)
+		subscribe := s.Expect(stomp.SUBSCRIBE)
+		id, _ := subscribe.Contains(stomp.Id)
+		for _, body := range []string{"one", "two"} {
+			message := stomp.CreateFrame(stomp.MESSAGE, []string{"destination:/topic/test"})
+			message.SetBody([]byte(body))
+			s.Push(id, message)
+		}
+	}()
+	frames, err := Consume(context.Background(), serverURL(s), "token", "/topic/test", 2)
+	<-pushed
+	assert.NoError(t, err)
+	var bodies []string
+	for _, frame := range frames {
+		bodies = append(bodies, frame.BodyString())
+	}
+	assert.Equal(t, []string{"one", "two"}, bodies)
+}
+
+func TestConsume_Timeout(t *testing.T) {
+	s := stomptest.NewServer(t)
+
+	pushed := make(chan struct{})
+	go func() {
+		defer close(pushed)
+		subscribe := s.Expect(stomp.SUBSCRIBE)
+		id, _ := subscribe.Contains(stomp.Id)
+		s.Push(id, nil)
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	frames, err := Consume(ctx, serverURL(s), "token", "/topic/test", 2)
+	<-pushed
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Len(t, frames, 1, "the frames received before the timeout are returned")
+}
+
+func TestConsume_ConnectionClosed(t *testing.T) {
+	s := stomptest.NewServer(t)
+
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		s.Expect(stomp.SUBSCRIBE)
+		s.CloseWithError(websocket.CloseGoingAway, "shutting down")
+	}()
+	_, err := Consume(context.Background(), serverURL(s), "token", "/topic/test", 1)
+	<-closed
+	var connErr *stomp.ConnectionError
+	assert.ErrorAs(t, err, &connErr)
+}
+
+func TestAuthFailure(t *testing.T) {
+	s := stomptest.NewServer(t)
+	s.RequireToken("token")
+
+	err := Publish(context.Background(), serverURL(s), "wrong", "/app/test", []byte("hello"))
+	assert.ErrorIs(t, err, websocket.ErrBadHandshake)
+
+	_, err = Consume(context.Background(), serverURL(s), "wrong", "/topic/test", 1)
+	assert.ErrorIs(t, err, websocket.ErrBadHandshake)
+}
+
+func TestInvalidURL(t *testing.T) {
+	err := Publish(context.Background(), "ws://%zz", "token", "/app/test", nil)
+	assert.ErrorContains(t, err, "invalid websocket URL")
+}
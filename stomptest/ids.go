@@ -0,0 +1,21 @@
+package stomptest
+
+import (
+	"strconv"
+	"sync/atomic"
+)
+
+// SequentialIDs is a stomp.IDGenerator for stomp.WithIDGenerator that returns "1", "2" and so on, so that tests
+// can compare the frames the client sends with exact expected frames. The SockJS server id is "000" and the session
+// id is the next id. The zero value is ready to use.
+type SequentialIDs struct {
+	next atomic.Uint64
+}
+
+func (ids *SequentialIDs) ID() string {
+	return strconv.FormatUint(ids.next.Add(1), 10)
+}
+
+func (ids *SequentialIDs) SockJSSession() (serverID, sessionID string) {
+	return "000", ids.ID()
+}
@@ -0,0 +1,279 @@
+// Package stomptest provides a scriptable fake STOMP over SockJS server for tests of code built on the client.
+package stomptest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	stomp "github.com/netcracker/qubership-core-lib-go-stomp-websocket/v3"
+)
+
+// Timeout is how long the Expect methods wait for a frame before they fail the test.
+var Timeout = 5 * time.Second
+
+// Server is a fake broker speaking STOMP over SockJS websocket. It sends the SockJS open frame, answers CONNECT with
+// CONNECTED (version 1.2, no heart-beats) and answers frames with a receipt header with RECEIPT. Every frame the
+// client sends is recorded for the Expect methods. Frames are encoded with encoding/json, and a client message that
+// is not a valid SockJS array of strings fails the test.
+type Server struct {
+	t      testing.TB
+	server *httptest.Server
+
+	mutex    sync.Mutex
+	conn     *websocket.Conn // the latest client connection
+	receipts bool
+	token    string // required on the upgrade request unless empty
+	frames   chan *stomp.Frame
+	connects chan *stomp.Frame
+}
+
+// NewServer starts a Server that is closed when the test ends.
+func NewServer(t testing.TB) *Server {
+	t.Helper()
+	s := &Server{
+		t:        t,
+		receipts: true,
+		frames:   make(chan *stomp.Frame, 1024),
+		connects: make(chan *stomp.Frame, 16),
+	}
+	upgrader := websocket.Upgrader{
+		CheckOrigin: func(r *http.Request) bool { return true },
+	}
+	s.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.authorized(r) {
+			http.Error(w, "invalid token", http.StatusUnauthorized)
+			return
+		}
+		c, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("stomptest: upgrade error: %v", err)
+			return
+		}
+		s.serve(c)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// URL returns the websocket URL to connect the client to.
+func (s *Server) URL() url.URL {
+	u, _ := url.Parse(s.server.URL)
+	u.Scheme = "ws"
+	return *u
+}
+
+// Close disconnects the client and stops the server.
+func (s *Server) Close() {
+	s.mutex.Lock()
+	if s.conn != nil {
+		s.conn.Close()
+	}
+	s.mutex.Unlock()
+	s.server.Close()
+}
+
+// ExpectConnect waits until a client has connected and returns its CONNECT frame.
+func (s *Server) ExpectConnect() *stomp.Frame {
+	s.t.Helper()
+	select {
+	case frame := <-s.connects:
+		return frame
+	case <-time.After(Timeout):
+		s.t.Fatalf("stomptest: no client connected within %s", Timeout)
+		return nil
+	}
+}
+
+// Expect waits for the next frame with command the client sends and returns it. Frames with other commands
+// received meanwhile are skipped.
+func (s *Server) Expect(command string) *stomp.Frame {
+	s.t.Helper()
+	timeout := time.After(Timeout)
+	for {
+		select {
+		case frame := <-s.frames:
+			if frame.Command == command {
+				return frame
+			}
+		case <-timeout:
+			s.t.Fatalf("stomptest: no %s frame received within %s", command, Timeout)
+			return nil
+		}
+	}
+}
+
+// Push sends frame to the client as a MESSAGE of the subscription. The subscription header is added unless
+// the frame has one, and a nil frame is an empty MESSAGE.
+func (s *Server) Push(subscriptionID string, frame *stomp.Frame) {
+	s.t.Helper()
+	if frame == nil {
+		frame = stomp.CreateFrame(stomp.MESSAGE, nil)
+	}
+	if _, ok := frame.Contains(stomp.Subscription_h); !ok {
+		message := stomp.CreateFrame(frame.Command, append([]string{stomp.Subscription_h + ":" + subscriptionID}, frame.Headers...))
+		message.SetBody(frame.Body())
+		frame = message
+	}
+	s.write(frame)
+}
+
+// RespondToReceipts sets whether frames with a receipt header are answered with RECEIPT. It is on by default;
+// turn it off to test receipt timeouts.
+func (s *Server) RespondToReceipts(respond bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.receipts = respond
+}
+
+// RequireToken makes the server reject upgrade requests that carry neither the bearer Authorization header nor
+// the access_token query parameter with token, answering 401 Unauthorized. An empty token accepts any request,
+// which is the default.
+func (s *Server) RequireToken(token string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.token = token
+}
+
+func (s *Server) authorized(r *http.Request) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.token == "" || r.Header.Get("Authorization") == "Bearer "+s.token || r.URL.Query().Get("access_token") == s.token
+}
+
+// CloseWithError closes the client connection with a websocket close frame of code and reason.
+func (s *Server) CloseWithError(code int, reason string) {
+	s.t.Helper()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.conn == nil {
+		s.t.Fatalf("stomptest: no client connection to close")
+		return
+	}
+	message := websocket.FormatCloseMessage(code, reason)
+	_ = s.conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(time.Second))
+	s.conn.Close()
+}
+
+func (s *Server) write(frame *stomp.Frame) {
+	s.t.Helper()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.conn == nil {
+		s.t.Fatalf("stomptest: no client connection to write %s to", frame.Command)
+		return
+	}
+	if err := s.conn.WriteMessage(websocket.TextMessage, encodeMessage(frame)); err != nil {
+		s.t.Errorf("stomptest: can't write %s: %v", frame.Command, err)
+	}
+}
+
+func (s *Server) serve(c *websocket.Conn) {
+	defer c.Close()
+	s.mutex.Lock()
+	s.conn = c
+	err := c.WriteMessage(websocket.TextMessage, []byte("o"))
+	s.mutex.Unlock()
+	if err != nil {
+		return
+	}
+	for {
+		_, msg, err := c.ReadMessage()
+		if err != nil {
+			return
+		}
+		frames, err := parseMessage(msg)
+		if err != nil {
+			s.t.Errorf("stomptest: %v", err)
+			continue
+		}
+		for _, frame := range frames {
+			s.handle(c, frame)
+		}
+	}
+}
+
+func (s *Server) handle(c *websocket.Conn, frame *stomp.Frame) {
+	var reply *stomp.Frame
+	s.mutex.Lock()
+	switch receipt, ok := frame.Contains(stomp.Receipt); {
+	case frame.Command == stomp.CONNECT || frame.Command == stomp.STOMP:
+		reply = stomp.CreateFrame(stomp.CONNECTED, []string{"version:1.2", "heart-beat:0,0"})
+	case ok && s.receipts:
+		reply = stomp.CreateFrame(stomp.RECEIPT, []string{stomp.ReceiptId + ":" + receipt})
+	}
+	if reply != nil {
+		_ = c.WriteMessage(websocket.TextMessage, encodeMessage(reply))
+	}
+	s.mutex.Unlock()
+	if frame.Command == stomp.CONNECT || frame.Command == stomp.STOMP {
+		s.connects <- frame
+		return
+	}
+	select {
+	case s.frames <- frame:
+	default:
+		s.t.Errorf("stomptest: more than %d frames received and not expected", cap(s.frames))
+	}
+}
+
+// parseMessage decodes a SockJS message of the client into its frames.
+func parseMessage(msg []byte) ([]*stomp.Frame, error) {
+	var elements []string
+	if err := json.Unmarshal(msg, &elements); err != nil {
+		return nil, fmt.Errorf("client message %q is not a JSON array of strings: %w", msg, err)
+	}
+	var frames []*stomp.Frame
+	for _, element := range elements {
+		frames = append(frames, parseFrame([]byte(element)))
+	}
+	return frames, nil
+}
+
+// encodeMessage encodes frame as a SockJS array message with encoding/json.
+func encodeMessage(frame *stomp.Frame) []byte {
+	var b strings.Builder
+	b.WriteString(frame.Command + "\n")
+	for _, header := range frame.Headers {
+		b.WriteString(header + "\n")
+	}
+	b.WriteString("\n")
+	b.Write(frame.Body())
+	b.WriteByte(0)
+	var buf bytes.Buffer
+	buf.WriteByte('a')
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	_ = encoder.Encode([]string{b.String()})
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n"))
+}
+
+// parseFrame parses a plain STOMP frame. The body ends at the NUL after content-length bytes, or at the first NUL.
+func parseFrame(data []byte) *stomp.Frame {
+	head, body, _ := bytes.Cut(data, []byte("\n\n"))
+	lines := strings.Split(strings.ReplaceAll(string(head), "\r\n", "\n"), "\n")
+	frame := stomp.CreateFrame(lines[0], nil)
+	if len(lines) > 1 {
+		frame.Headers = lines[1:]
+	}
+	if value, ok := frame.Contains("content-length"); ok {
+		if length, err := strconv.Atoi(value); err == nil && length >= 0 && length <= len(body) {
+			frame.SetBody(body[:length])
+			return frame
+		}
+	}
+	if end := bytes.IndexByte(body, 0); end >= 0 {
+		body = body[:end]
+	}
+	frame.SetBody(body)
+	return frame
+}
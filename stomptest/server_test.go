@@ -0,0 +1,149 @@
+package stomptest
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	stomp "github.com/netcracker/qubership-core-lib-go-stomp-websocket/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+func connect(t *testing.T, s *Server, opts ...stomp.ConnectOption) *stomp.StompClient {
+	t.Helper()
+	client, err := stomp.ConnectWithToken(s.URL(), websocket.Dialer{}, "token", opts...)
+	if err != nil {
+		t.Fatalf("ConnectWithToken failed: %v", err)
+	}
+	return client
+}
+
+func TestServer_ConnectSubscribePush(t *testing.T) {
+	s := NewServer(t)
+	client := connect(t, s)
+
+	connectFrame := s.ExpectConnect()
+	version, _ := connectFrame.Contains("accept-version")
+	assert.Equal(t, "1.2,1.1,1.0", version)
+
+	sub, err := client.Subscribe("/topic/test")
+	assert.NoError(t, err)
+	subscribe := s.Expect(stomp.SUBSCRIBE)
+	id, _ := subscribe.Contains(stomp.Id)
+	assert.Equal(t, sub.Id().String(), id)
+
+	message := stomp.CreateFrame(stomp.MESSAGE, []string{"destination:/topic/test"})
+	message.SetBody([]byte(`{"tenant":"a"}`))
+	s.Push(id, message)
+	select {
+	case frame := <-sub.FrameCh:
+		assert.Equal(t, message.Body(), frame.Body())
+	case <-time.After(Timeout):
+		t.Fatal("timed out waiting on the pushed frame")
+	}
+
+	assert.NoError(t, client.Send("/app/test", "text/plain", []byte("line1\nline2")))
+	send := s.Expect(stomp.SEND)
+	assert.Equal(t, "line1\nline2", send.BodyString())
+
+	assert.NoError(t, client.Disconnect())
+}
+
+func TestServer_RespondToReceipts(t *testing.T) {
+	s := NewServer(t)
+	s.RespondToReceipts(false)
+	client := connect(t, s, stomp.WithDisconnectTimeout(50*time.Millisecond))
+	s.ExpectConnect()
+
+	assert.ErrorIs(t, client.Disconnect(), stomp.ErrDisconnectTimeout)
+	s.Expect(stomp.DISCONNECT)
+}
+
+func TestServer_CloseWithError(t *testing.T) {
+	s := NewServer(t)
+	client := connect(t, s)
+	s.ExpectConnect()
+
+	s.CloseWithError(4001, "going away")
+	select {
+	case err := <-client.Errors():
+		var closeErr *websocket.CloseError
+		if assert.True(t, errors.As(err, &closeErr)) {
+			assert.Equal(t, 4001, closeErr.Code)
+			assert.Equal(t, "going away", closeErr.Text)
+		}
+	case <-time.After(Timeout):
+		t.Fatal("timed out waiting on the connection error")
+	}
+}
+
+func TestParseMessage(t *testing.T) {
+	frames, err := parseMessage([]byte(`["SEND\ndestination:/a\n\none\u0000","SEND\ndestination:/b\n\n{\"a\":1}\u0000"]`))
+	if assert.NoError(t, err) && assert.Len(t, frames, 2) {
+		assert.Equal(t, "one", frames[0].BodyString())
+		assert.Equal(t, `{"a":1}`, frames[1].BodyString())
+	}
+	_, err = parseMessage([]byte(`["SEND\ndestination:/a\n\n{"a":1}\u0000"]`))
+	assert.ErrorContains(t, err, "is not a JSON array of strings")
+}
+
+func TestEncodeMessage(t *testing.T) {
+	frame := stomp.CreateFrame(stomp.MESSAGE, []string{"destination:/a", "x-path:C:\\temp"})
+	frame.SetBody([]byte("{\"a\":\"line1\nline2\"} <&>"))
+	message := encodeMessage(frame)
+	assert.Equal(t, byte('a'), message[0])
+	frames, err := parseMessage(message[1:])
+	if assert.NoError(t, err) && assert.Len(t, frames, 1) {
+		assert.Equal(t, frame.Headers, frames[0].Headers)
+		assert.Equal(t, frame.BodyString(), frames[0].BodyString())
+	}
+	assert.Equal(t, string(frame.Bytes()), string(message[1:]), "the client encodes frames the same way")
+}
+
+func TestParseFrame(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		command string
+		headers []string
+		body    string
+	}{
+		{"no headers", "DISCONNECT\n\n\x00", "DISCONNECT", nil, ""},
+		{"headers", "SEND\ndestination:/a\n\nbody\x00", "SEND", []string{"destination:/a"}, "body"},
+		{"content-length", "SEND\ncontent-length:3\n\na\x00b\x00", "SEND", []string{"content-length:3"}, "a\x00b"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			frame := parseFrame([]byte(tt.data))
+			assert.Equal(t, tt.command, frame.Command)
+			assert.Equal(t, tt.headers, frame.Headers)
+			assert.Equal(t, tt.body, frame.BodyString())
+		})
+	}
+}
+
+func TestServer_RequireToken(t *testing.T) {
+	s := NewServer(t)
+	s.RequireToken("token")
+
+	_, err := stomp.ConnectWithToken(s.URL(), websocket.Dialer{}, "wrong")
+	assert.ErrorIs(t, err, websocket.ErrBadHandshake)
+
+	client := connect(t, s, stomp.WithTokenTransport(stomp.TokenInQuery))
+	s.ExpectConnect()
+	assert.NoError(t, client.Disconnect())
+}
+
+func TestSequentialIDs(t *testing.T) {
+	s := NewServer(t)
+	client := connect(t, s, stomp.WithIDGenerator(&SequentialIDs{}))
+	s.ExpectConnect()
+	assert.Equal(t, stomp.SockJSSession{ServerID: "000", SessionID: "1"}, client.SockJSSession())
+
+	_, err := client.Subscribe("/topic/test")
+	assert.NoError(t, err)
+	expected := stomp.CreateFrame(stomp.SUBSCRIBE, []string{"id:3", "destination:/topic/test"})
+	assert.Equal(t, string(expected.Bytes()), string(s.Expect(stomp.SUBSCRIBE).Bytes()))
+	assert.NoError(t, client.Disconnect())
+}
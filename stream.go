@@ -0,0 +1,116 @@
+package go_stomp_websocket
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// streamBody is the body of a writeRequest that is copied to the connection instead of being held in the frame.
+type streamBody struct {
+	reader io.Reader
+	size   int64
+}
+
+// errStreamAborted marks a streamed frame that failed after part of it was written.
+var errStreamAborted = errors.New("streamed frame aborted")
+
+// SendReader sends a SEND frame to destination with size bytes read from body, without holding the body in memory.
+// It waits until the frame is written. The frame is written by the writer goroutine like every other frame;
+// the body is JSON escaped on the fly for SockJS, so only UTF-8 bodies can be sent there. If body fails, ends before
+// size bytes or is not valid UTF-8 on SockJS, the partly written frame cannot be recovered and the connection is
+// closed.
+// Streamed bodies are not signed by WithIntegrity.
+func (stompClient StompClient) SendReader(destination, contentType string, body io.Reader, size int64) error {
+	if err := stompClient.checkDraining(); err != nil {
+		return err
+	}
+	if size < 0 {
+		return fmt.Errorf("negative body size %d", size)
+	}
+	builder := NewFrame(SEND).WithHeader(Destination, destination).WithHeader(contentLength, strconv.FormatInt(size, 10))
+	if contentType != "" {
+		builder.WithHeader(ContentType, contentType)
+	}
+	frame, err := builder.Build()
+	if err != nil {
+		return err
+	}
+	limit := stompClient.maxOutboundMessageSize
+	if encoded := int64(frame.encodedSize(stompClient.rawTransport)) + size; limit > 0 && encoded > int64(limit) {
+		return fmt.Errorf("%w: %s frame of at least %d bytes, the limit is %d bytes", ErrFrameTooLargeForTransport, frame.Command, encoded, limit)
+	}
+	return stompClient.write(writeRequest{
+		Frame:  frame,
+		Stream: &streamBody{reader: body, size: size},
+	})
+}
+
+// writeStream writes frame with the streamed body as one websocket message. Errors after the message was started
+// wrap errStreamAborted.
+func (stompClient *StompClient) writeStream(frame *Frame, body *streamBody) error {
+	stompClient.traceFrame(">>>", frame)
+	if stompClient.writeTimeout > 0 {
+		if err := stompClient.connection.SetWriteDeadline(time.Now().Add(stompClient.writeTimeout)); err != nil {
+			return err
+		}
+	}
+	w, err := stompClient.connection.NextWriter(websocket.TextMessage)
+	if err != nil {
+		stompClient.metrics.ErrorOccurred(ErrorKindWrite)
+		return err
+	}
+	err = stompClient.copyStream(w, frame, body)
+	if closeErr := w.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		stompClient.metrics.ErrorOccurred(ErrorKindWrite)
+		return fmt.Errorf("%w: %w", errStreamAborted, err)
+	}
+	stompClient.metrics.FrameSent(frame.Command, frame.size()+int(body.size))
+	return nil
+}
+
+func (stompClient *StompClient) copyStream(w io.Writer, frame *Frame, body *streamBody) error {
+	buf := frameBuffers.Get().(*bytes.Buffer)
+	defer frameBuffers.Put(buf)
+	buf.Reset()
+	var dst io.Writer = w
+	var escaped *jsonStringWriter
+	frame = stompClient.escapeFrame(stompClient.aliases.shorten(frame))
+	if stompClient.rawTransport {
+		frame.writeRaw(buf)
+	} else {
+		frame.writeSockJS(buf)
+		escaped = &jsonStringWriter{w: w}
+		dst = escaped
+	}
+	// the serialized frame has an empty body, so it splits into the part before and after the body
+	encoded := buf.Bytes()
+	suffix := 1 // NUL
+	if !stompClient.rawTransport {
+		suffix = len(`\u0000"]`)
+	}
+	if _, err := w.Write(encoded[:len(encoded)-suffix]); err != nil {
+		return err
+	}
+	if n, err := io.CopyN(dst, body.reader, body.size); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = fmt.Errorf("body ended after %d of %d bytes: %w", n, body.size, io.ErrUnexpectedEOF)
+		}
+		return err
+	}
+	if escaped != nil {
+		if err := escaped.Flush(); err != nil {
+			return err
+		}
+	}
+	_, err := w.Write(encoded[len(encoded)-suffix:])
+	return err
+}
@@ -0,0 +1,119 @@
+package go_stomp_websocket
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSendReader(t *testing.T) {
+	frames := make(chan *Frame, 1)
+	ts := startScriptedWSServer(t, func(c *websocket.Conn) {
+		for {
+			_, msg, err := c.ReadMessage()
+			if err != nil {
+				return
+			}
+			var elements []string
+			if err := json.Unmarshal(msg, &elements); err != nil {
+				t.Errorf("message is not a JSON array of strings: %v", err)
+				return
+			}
+			frame, _, err := parseRawFrame([]byte(elements[0]), 0)
+			assert.NoError(t, err)
+			frames <- frame
+		}
+	})
+	defer ts.Close()
+	client := connectTestClient(t, ts)
+	defer client.connection.Close()
+
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"5MB", strings.Repeat("0123456789", 512*1024)},
+		{"escaped", "he said \"hi\"\n\\path\t\x01é"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := client.SendReader("/topic/files", "text/plain", strings.NewReader(tt.body), int64(len(tt.body)))
+			assert.NoError(t, err)
+			select {
+			case frame := <-frames:
+				assert.Equal(t, SEND, frame.Command)
+				length, _ := frame.Contains(contentLength)
+				assert.Equal(t, len(tt.body), len(frame.Body()), "content-length %s", length)
+				assert.True(t, tt.body == frame.BodyString(), "body changed")
+			case <-time.After(5 * time.Second):
+				t.Fatal("timed out waiting on the frame")
+			}
+		})
+	}
+}
+
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) {
+	return 0, errors.New("disk failed")
+}
+
+func TestSendReader_ErrorMidStreamClosesConnection(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     io.Reader
+		expected string
+	}{
+		{"reader error", io.MultiReader(strings.NewReader("abc"), failingReader{}), "disk failed"},
+		{"short body", strings.NewReader("abc"), "body ended after 3 of 100 bytes"},
+		{"invalid UTF-8", strings.NewReader("ab\xff" + strings.Repeat("c", 97)), "frame is not valid UTF-8"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := startScriptedWSServer(t, func(c *websocket.Conn) {
+				for {
+					if _, _, err := c.ReadMessage(); err != nil {
+						return
+					}
+				}
+			})
+			defer ts.Close()
+			client := connectTestClient(t, ts)
+			defer client.connection.Close()
+
+			err := client.SendReader("/topic/files", "", tt.body, 100)
+			assert.ErrorContains(t, err, tt.expected)
+			err, ok := receiveTerminalError(t, client)
+			assert.True(t, ok)
+			assert.True(t, errors.Is(err, errStreamAborted))
+		})
+	}
+}
+
+func TestCopyStream_MatchesFrameSerialization(t *testing.T) {
+	frame := createTestFrame(SEND, []string{"destination:/topic/files", "content-length:4"}, "")
+	for _, raw := range []bool{false, true} {
+		client := &StompClient{rawTransport: raw}
+		var buf bytes.Buffer
+		assert.NoError(t, client.copyStream(&buf, frame, &streamBody{reader: strings.NewReader("body"), size: 4}))
+		expected := createTestFrame(SEND, frame.Headers, "body")
+		if raw {
+			assert.Equal(t, string(expected.rawBytes()), buf.String())
+		} else {
+			assert.Equal(t, string(expected.Bytes()), buf.String())
+		}
+	}
+}
+
+func TestSendReader_OutboundLimit(t *testing.T) {
+	client := StompClient{maxOutboundMessageSize: 1024}
+	err := client.SendReader("/topic/files", "", strings.NewReader(""), 5000)
+	assert.ErrorIs(t, err, ErrFrameTooLargeForTransport)
+}
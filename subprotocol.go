@@ -0,0 +1,31 @@
+package go_stomp_websocket
+
+import (
+	"fmt"
+	"slices"
+)
+
+// defaultSubprotocols are the STOMP websocket subprotocols offered on the upgrade unless WithSubprotocols is used.
+var defaultSubprotocols = []string{"v12.stomp", "v11.stomp", "v10.stomp"}
+
+// WithSubprotocols sets the websocket subprotocols offered on the upgrade request, replacing the default
+// v12.stomp, v11.stomp and v10.stomp. Without arguments no subprotocol is offered. Subprotocols set on the
+// dialer take precedence.
+func WithSubprotocols(protocols ...string) ConnectOption {
+	return func(options *connectOptions) {
+		options.subprotocols = append([]string{}, protocols...)
+	}
+}
+
+// NegotiatedSubprotocol returns the websocket subprotocol the server selected, or "" if it selected none.
+func (stompClient StompClient) NegotiatedSubprotocol() string {
+	return stompClient.subprotocol
+}
+
+// checkSubprotocol fails the connect when the server selected a subprotocol the client did not offer.
+func (options *connectOptions) checkSubprotocol(selected string) error {
+	if selected == "" || slices.Contains(options.offeredSubprotocols, selected) {
+		return nil
+	}
+	return fmt.Errorf("%w: server selected %q, offered %q", ErrUnsupportedSubprotocol, selected, options.offeredSubprotocols)
+}
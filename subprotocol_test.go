@@ -0,0 +1,75 @@
+package go_stomp_websocket
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+// startSubprotocolWSServer starts a test server that selects the subprotocol returned by selectProtocol
+// for the offered ones
+func startSubprotocolWSServer(t *testing.T, selectProtocol func(offered []string) string) *httptest.Server {
+	t.Helper()
+	upgrader := websocket.Upgrader{CheckOrigin: func(r *http.Request) bool { return true }}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var header http.Header
+		if selected := selectProtocol(websocket.Subprotocols(r)); selected != "" {
+			header = http.Header{"Sec-Websocket-Protocol": []string{selected}}
+		}
+		c, err := upgrader.Upgrade(w, r, header)
+		if err != nil {
+			t.Errorf("upgrade error: %v", err)
+			return
+		}
+		defer c.Close()
+		if _, _, err = c.ReadMessage(); err != nil {
+			return
+		}
+		_ = c.WriteMessage(websocket.TextMessage, []byte("o"))
+		_ = c.WriteMessage(websocket.TextMessage, []byte(connectedTestFrame))
+		_, _, _ = c.ReadMessage()
+	}))
+}
+
+func TestSubprotocolNegotiation(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     []ConnectOption
+		dialer   websocket.Dialer
+		selected string
+		offered  []string
+		err      error
+	}{
+		{name: "default", selected: "v12.stomp", offered: []string{"v12.stomp", "v11.stomp", "v10.stomp"}},
+		{name: "server selects none", offered: []string{"v12.stomp", "v11.stomp", "v10.stomp"}},
+		{name: "configured", opts: []ConnectOption{WithSubprotocols("v11.stomp")}, selected: "v11.stomp", offered: []string{"v11.stomp"}},
+		{name: "dialer wins", opts: []ConnectOption{WithSubprotocols("v11.stomp")}, dialer: websocket.Dialer{Subprotocols: []string{"v10.stomp"}}, selected: "v10.stomp", offered: []string{"v10.stomp"}},
+		{name: "none offered", opts: []ConnectOption{WithSubprotocols()}},
+		{name: "unknown selected", selected: "mqtt", offered: []string{"v12.stomp", "v11.stomp", "v10.stomp"}, err: ErrUnsupportedSubprotocol},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var offered []string
+			ts := startSubprotocolWSServer(t, func(protocols []string) string {
+				offered = protocols
+				return tt.selected
+			})
+			defer ts.Close()
+			client, err := ConnectWithToken(wsURL(ts), tt.dialer, "token", tt.opts...)
+			assert.Equal(t, tt.offered, offered)
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+				assert.ErrorContains(t, err, tt.selected)
+				return
+			}
+			if assert.NoError(t, err) {
+				defer client.connection.Close()
+				assert.Equal(t, tt.selected, client.NegotiatedSubprotocol())
+				assert.Equal(t, tt.selected, client.EffectiveConfig().Subprotocol)
+			}
+		})
+	}
+}
@@ -1,37 +1,421 @@
 package go_stomp_websocket
 
-import "github.com/google/uuid"
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+// SubscriptionID identifies a subscription of a client. It is the id header of the SUBSCRIBE frame.
+type SubscriptionID string
+
+func (id SubscriptionID) String() string {
+	return string(id)
+}
 
 type Subscription struct {
-	FrameCh     chan *Frame
-	Id          string
-	Topic       string
-	stompClient StompClient
+	// FrameCh receives the frames of the subscription. When the connection ends it receives the ERROR frame of
+	// the cause and is closed after it; the client does not wait for the consumer to take it, and gives up on
+	// it once the subscription is unsubscribed. SwapChannel replaces it; goroutines that receive while another
+	// one swaps should use Read or TryRead instead.
+	FrameCh chan *Frame
+	// current is the channel the dispatcher delivers to, updated by swapChannel before it closes the old one
+	current atomic.Pointer[chan *Frame]
+	// ending is set by processLoop before the client is done when it hands the ERROR frame that ends the
+	// connection to the channel, which is closed after it
+	ending atomic.Bool
+	// Deprecated: use Id(). The field is kept populated for one release; changing it has no effect.
+	SubscriptionId string
+	id             SubscriptionID
+	Topic          string
+	stompClient    StompClient
+	errorCh        chan error
+	errors         *atomic.Uint64
+	dropped        *atomic.Uint64
+	unsubscribed   *unsubscribeSignal
+	messages       *messageFeed
+	durable        string // the durable subscription name, empty for other subscriptions
+	acker          *cumulativeAcker
 }
 
-func (stompClient StompClient) Subscribe(topic string) (*Subscription, error) {
-	subscription := &Subscription{}
-	subscriptionId := uuid.New()
-	headers := []string{"id:" + subscriptionId.String(), "destination:" + topic}
-	ch := make(chan *Frame)
-	stompClient.writeCh <- writeRequest{
-		Frame: CreateFrame(SUBSCRIBE, headers),
+// unsubscribeSignal is closed by the first Unsubscribe of a subscription, to wake up Read.
+type unsubscribeSignal struct {
+	once sync.Once
+	ch   chan struct{}
+}
+
+func newUnsubscribeSignal() *unsubscribeSignal {
+	return &unsubscribeSignal{ch: make(chan struct{})}
+}
+
+func (signal *unsubscribeSignal) close() {
+	if signal != nil {
+		signal.once.Do(func() { close(signal.ch) })
+	}
+}
+
+// done returns the channel closed by close, nil for subscriptions without a signal.
+func (signal *unsubscribeSignal) done() <-chan struct{} {
+	if signal == nil {
+		return nil
+	}
+	return signal.ch
+}
+
+// Subscribe subscribes to topic. Every call creates an independent subscription with its own id, channel and
+// lifecycle, also for a topic that is subscribed already; MESSAGE frames are routed by their subscription header.
+func (stompClient StompClient) Subscribe(topic string, opts ...SubscribeOption) (*Subscription, error) {
+	return stompClient.subscribe(topic, nil, opts)
+}
+
+// subscribe subscribes to topic with a SUBSCRIBE frame that has headers added.
+func (stompClient StompClient) subscribe(topic string, headers []suppliedHeader, opts []SubscribeOption) (*Subscription, error) {
+	if err := stompClient.checkDraining(); err != nil {
+		return nil, err
+	}
+	options := &subscribeOptions{}
+	if check := stompClient.integrity.middleware(topic, stompClient.metrics); check != nil {
+		// outermost, so the other middleware sees the body as it was sent
+		options.middleware = append(options.middleware, check)
+	}
+	for _, opt := range opts {
+		opt(options)
+	}
+	var acker *cumulativeAcker
+	ack := ""
+	if options.cumulativeAck != nil {
+		if err := options.cumulativeAck.check(options.overflow); err != nil {
+			return nil, err
+		}
+		acker = newCumulativeAcker(options.cumulativeAck)
+		options.middleware = append(options.middleware, acker.middleware())
+		ack = "client"
+	}
+	subscriptionId := options.durable
+	if subscriptionId == "" {
+		subscriptionId = stompClient.newID()
+	}
+	builder := NewFrame(SUBSCRIBE).WithHeader(Id, subscriptionId).WithHeader(Destination, topic)
+	if ack != "" {
+		builder.WithHeader(Ack, ack)
+	}
+	if options.durable != "" {
+		stompClient.dialect.DurableSubscribe(builder, options.durable)
+	}
+	stampHeaders(builder, headers)
+	frame, err := builder.Build()
+	if err != nil {
+		return nil, err
+	}
+	ch := options.channel
+	if ch == nil {
+		ch = make(chan *Frame, options.bufferSize)
+	}
+	handler := &subscriptionHandler{
+		middleware: options.middleware,
+		errorCh:    make(chan error, subscriptionErrorBuffer),
+		errors:     &atomic.Uint64{},
+		overflow:   options.overflow,
+		dropped:    &atomic.Uint64{},
+	}
+	req := writeRequest{
+		Frame: frame,
 		C:     ch,
 	}
-	subscription = &Subscription{
-		stompClient: stompClient,
-		Id:          subscriptionId.String(),
-		FrameCh:     ch,
-		Topic:       topic,
+	if len(handler.middleware) > 0 || handler.overflow != OverflowBlock || stompClient.chunkTimeout > 0 {
+		req.Handler = handler
+	}
+	subscription := &Subscription{
+		stompClient:    stompClient,
+		id:             SubscriptionID(subscriptionId),
+		SubscriptionId: subscriptionId,
+		FrameCh:        ch,
+		Topic:          topic,
+		errorCh:        handler.errorCh,
+		errors:         handler.errors,
+		dropped:        handler.dropped,
+		unsubscribed:   newUnsubscribeSignal(),
+		messages:       &messageFeed{},
+		durable:        options.durable,
+		acker:          acker,
+	}
+	subscription.current.Store(&ch)
+	if err := stompClient.register(subscription, frame); err != nil {
+		return nil, err
+	}
+	if err := stompClient.enqueue(req); err != nil {
+		stompClient.registry.remove(subscription.id)
+		return nil, err
+	}
+	stompClient.registered(subscription.id)
+	if acker != nil {
+		acker.start(stompClient)
 	}
 	return subscription, nil
 }
 
+// Pending returns the number of frames buffered in FrameCh and not yet received by the consumer.
+func (s *Subscription) Pending() int {
+	return len(s.channel())
+}
+
+// channel returns the channel the subscription is delivered to, FrameCh for subscriptions not made by Subscribe.
+func (s *Subscription) channel() chan *Frame {
+	if ch := s.current.Load(); ch != nil {
+		return *ch
+	}
+	return s.FrameCh
+}
+
+// closed tells whether the subscription gets no more frames after a receive from ch returned nothing. A channel
+// closed by SwapChannel is not, the frames go to the new channel then.
+func (s *Subscription) closed(ch chan *Frame) bool {
+	select {
+	case <-s.unsubscribed.done():
+		return true
+	case <-s.stompClient.done:
+		return true
+	default:
+		return s.channel() == ch
+	}
+}
+
+// Dropped returns how many frames were dropped by the overflow policy of the subscription.
+func (s *Subscription) Dropped() uint64 {
+	if s.dropped == nil {
+		return 0
+	}
+	return s.dropped.Load()
+}
+
+// Read returns the next frame of the subscription. It fails with ctx.Err() when ctx is done first, and with
+// ErrSubscriptionClosed once the subscription is unsubscribed or the client is closed; frames buffered before
+// that are still returned first. Read may be called from several goroutines, each frame goes to one of them.
+func (s *Subscription) Read(ctx context.Context) (*Frame, error) {
+	for {
+		ch := s.channel()
+		var frame *Frame
+		var ok bool
+		select {
+		case frame, ok = <-ch:
+		default:
+			select {
+			case frame, ok = <-ch:
+			case <-s.unsubscribed.done():
+				return nil, ErrSubscriptionClosed
+			case <-s.stompClient.done:
+				if !s.ending.Load() {
+					return nil, ErrSubscriptionClosed
+				}
+				// the ERROR frame that ended the connection is on its way, the channel is closed after it
+				select {
+				case frame, ok = <-ch:
+				case <-s.unsubscribed.done():
+					return nil, ErrSubscriptionClosed
+				case <-ctx.Done():
+					return nil, ctx.Err()
+				}
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+		if ok {
+			return frame, nil
+		}
+		if s.closed(ch) {
+			return nil, ErrSubscriptionClosed
+		}
+		// the channel was swapped, read from the new one
+	}
+}
+
+// TryRead returns the next frame of the subscription if one is buffered, without waiting.
+func (s *Subscription) TryRead() (*Frame, bool) {
+	for {
+		ch := s.channel()
+		select {
+		case frame, ok := <-ch:
+			if ok || s.closed(ch) {
+				return frame, ok
+			}
+			// the channel was swapped, read from the new one
+		default:
+			return nil, false
+		}
+	}
+}
+
+// Id returns the id of the subscription.
+func (s *Subscription) Id() SubscriptionID {
+	return s.id
+}
+
+// Unsubscribe sends an UNSUBSCRIBE frame without waiting for it to be written, which also removes a durable
+// subscription from the broker.
 func (s *Subscription) Unsubscribe() {
-	headers := []string{"id:" + s.Id}
+	frame, err := s.unsubscribeFrame("")
+	if err != nil {
+		s.stompClient.logger.Errorf("Can't unsubscribe %s: %v", s.id, err)
+		return
+	}
 	ch := make(chan *Frame)
-	s.stompClient.writeCh <- writeRequest{
-		Frame: CreateFrame(UNSUBSCRIBE, headers),
-		C:     ch,
+	s.stompClient.registry.remove(s.id)
+	s.unsubscribed.close()
+	s.acker.close(s.stompClient)
+	if err := s.stompClient.enqueue(writeRequest{Frame: frame, C: ch}); err != nil {
+		s.stompClient.logger.Errorf("Can't unsubscribe %s: %v", s.id, err)
+	}
+}
+
+// unsubscribe is Unsubscribe that waits until the UNSUBSCRIBE frame is written. The dispatcher delivers
+// no more frames to FrameCh after that.
+func (s *Subscription) unsubscribe() error {
+	frame, err := s.unsubscribeFrame("")
+	if err != nil {
+		return err
+	}
+	s.stompClient.registry.remove(s.id)
+	s.unsubscribed.close()
+	s.acker.close(s.stompClient)
+	return s.stompClient.write(writeRequest{Frame: frame})
+}
+
+type swapRequest struct {
+	Id     SubscriptionID
+	NewCh  chan *Frame
+	Detach bool            // stop the delivery to the subscription channel instead
+	Result chan swapResult // must be buffered
+	// Current is set to NewCh before the old channel is closed, so readers that see it closed find the new one
+	Current *atomic.Pointer[chan *Frame]
+}
+
+type swapResult struct {
+	Drained int
+	Err     error
+}
+
+// SwapChannel redirects delivery of the subscription to newCh. Frames still buffered in the old channel are moved
+// to newCh in order and the old channel is closed. newCh must have room for all of them, otherwise
+// ErrSwapChannelTooSmall is returned and nothing changes. The swap runs in the dispatcher goroutine,
+// so no frame is lost or delivered twice. Stop receiving from the old channel before the call
+// if frame order matters. Read and TryRead move on to newCh, also when they are waiting during the swap.
+func (s *Subscription) SwapChannel(newCh chan *Frame) (drained int, err error) {
+	req := swapRequest{
+		Id:      s.id,
+		NewCh:   newCh,
+		Current: &s.current,
+		Result:  make(chan swapResult, 1),
+	}
+	select {
+	case s.stompClient.swapCh <- req:
+	case <-s.stompClient.done:
+		return 0, ErrClientClosed
+	}
+	result := <-req.Result
+	if result.Err == nil {
+		s.FrameCh = newCh
+	}
+	return result.Drained, result.Err
+}
+
+// swapChannel must only be called from processLoop.
+func swapChannel(channels map[SubscriptionID]chan *Frame, req swapRequest) {
+	oldCh, ok := channels[req.Id]
+	switch {
+	case !ok:
+		req.Result <- swapResult{Err: ErrSubscriptionNotFound}
+		return
+	case req.Detach:
+		delete(channels, req.Id)
+		req.Result <- swapResult{}
+		return
+	case req.NewCh == nil || req.NewCh == oldCh:
+		req.Result <- swapResult{Err: errors.New("new channel must be a different non-nil channel")}
+		return
+	case cap(req.NewCh)-len(req.NewCh) < len(oldCh):
+		req.Result <- swapResult{Err: ErrSwapChannelTooSmall}
+		return
+	}
+	channels[req.Id] = req.NewCh
+	if req.Current != nil {
+		req.Current.Store(&req.NewCh)
+	}
+	drained := 0
+	for done := false; !done; {
+		select {
+		case f := <-oldCh:
+			req.NewCh <- f
+			drained++
+		default:
+			done = true
+		}
+	}
+	close(oldCh)
+	req.Result <- swapResult{Drained: drained}
+}
+
+// deliverMessage sends a MESSAGE frame to the subscription channel through the subscription middleware, if any,
+// applying the overflow policy of the subscription.
+func (stompClient *StompClient) deliverMessage(channels map[SubscriptionID]chan *Frame, handlers map[SubscriptionID]*subscriptionHandler, id SubscriptionID, f *Frame) {
+	handler, ok := handlers[id]
+	if !ok {
+		stompClient.enqueueMessage(channels, id, f)
+		return
+	}
+	handler.handle(f, func(frame *Frame) error {
+		stompClient.offerMessage(channels, handler, id, frame)
+		return nil
+	})
+}
+
+// offerMessage is enqueueMessage for the subscriptions with an overflow policy. The consumer may receive from
+// the channel concurrently, so eviction of the oldest frame is retried until the new frame fits.
+func (stompClient *StompClient) offerMessage(channels map[SubscriptionID]chan *Frame, handler *subscriptionHandler, id SubscriptionID, f *Frame) {
+	ch := channels[id]
+	switch {
+	case handler.overflow == OverflowDropOldest && cap(ch) > 0:
+		for {
+			select {
+			case ch <- f:
+				return
+			default:
+			}
+			select {
+			case <-ch:
+				stompClient.frameDropped(handler)
+			default:
+			}
+		}
+	case handler.overflow == OverflowDropNewest || handler.overflow == OverflowDropOldest:
+		select {
+		case ch <- f:
+		default:
+			stompClient.frameDropped(handler)
+		}
+	default:
+		stompClient.enqueueMessage(channels, id, f)
+	}
+}
+
+func (stompClient *StompClient) frameDropped(handler *subscriptionHandler) {
+	handler.dropped.Add(1)
+	stompClient.metrics.ErrorOccurred(ErrorKindDropped)
+}
+
+// enqueueMessage sends a MESSAGE frame to the subscription channel and keeps serving swap requests
+// while the consumer is not ready, so that a consumer can swap its channel or detach instead of reading.
+func (stompClient *StompClient) enqueueMessage(channels map[SubscriptionID]chan *Frame, id SubscriptionID, f *Frame) {
+	for {
+		select {
+		case channels[id] <- f:
+			return
+		case req := <-stompClient.swapCh:
+			swapChannel(channels, req)
+			if _, ok := channels[id]; !ok {
+				// detached, the frame is dropped
+				return
+			}
+		}
 	}
 }
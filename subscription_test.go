@@ -1,7 +1,17 @@
 package go_stomp_websocket
 
 import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -25,5 +35,503 @@ func TestSubscribeAndUnsubscribe(t *testing.T) {
 	// read second message
 	req2 := <-client.writeCh
 	assert.Equal(t, UNSUBSCRIBE, req2.Frame.Command)
-	assert.Contains(t, req2.Frame.Headers[0], "id:"+sub.Id)
+	assert.Contains(t, req2.Frame.Headers[0], "id:"+sub.Id().String())
+	assert.Equal(t, sub.Id().String(), sub.SubscriptionId)
+}
+
+func TestSubscription_DeprecatedIdFieldIsReadOnly(t *testing.T) {
+	client := &StompClient{writeCh: make(chan writeRequest, 2)}
+	sub, err := client.Subscribe("/topic/test")
+	assert.NoError(t, err)
+	<-client.writeCh
+
+	id := sub.Id()
+	sub.SubscriptionId = "overwritten"
+	sub.Unsubscribe()
+	req := <-client.writeCh
+	value, _ := req.Frame.Contains(Id)
+	assert.Equal(t, id.String(), value)
+	assert.Equal(t, id, sub.Id())
+}
+
+func TestSubscribe_SameTopicTwice(t *testing.T) {
+	ts := startScriptedWSServer(t, func(c *websocket.Conn) {
+		var ids []string
+		push := func(round int) bool {
+			for i := 0; i < 10; i++ {
+				id := ids[i%len(ids)]
+				message := CreateFrame(MESSAGE, []string{Subscription_h + ":" + id, Destination + ":/topic/test"})
+				message.SetBody([]byte(id + "-" + strconv.Itoa(round)))
+				if err := c.WriteMessage(websocket.TextMessage, append([]byte("a"), message.Bytes()...)); err != nil {
+					return false
+				}
+			}
+			return true
+		}
+		for {
+			_, msg, err := c.ReadMessage()
+			if err != nil {
+				return
+			}
+			frame := ReadFrame(append([]byte("a"), msg...))
+			switch frame.Command {
+			case SUBSCRIBE:
+				id, _ := frame.Contains(Id)
+				if ids = append(ids, id); len(ids) == 2 && !push(1) {
+					return
+				}
+			case UNSUBSCRIBE:
+				if !push(2) {
+					return
+				}
+			}
+		}
+	})
+	defer ts.Close()
+	client := connectTestClient(t, ts)
+	defer client.connection.Close()
+
+	first, err := client.Subscribe("/topic/test")
+	assert.NoError(t, err)
+	second, err := client.Subscribe("/topic/test")
+	assert.NoError(t, err)
+	assert.NotEqual(t, first.Id(), second.Id())
+
+	receive := func(sub *Subscription, round string) {
+		t.Helper()
+		for i := 0; i < 5; i++ {
+			select {
+			case frame := <-sub.FrameCh:
+				id, _ := frame.Contains(Subscription_h)
+				assert.Equal(t, sub.Id().String(), id)
+				assert.Equal(t, sub.Id().String()+"-"+round, frame.BodyString())
+			case <-time.After(5 * time.Second):
+				t.Fatalf("timed out waiting on subscription %s", sub.Id())
+			}
+		}
+	}
+	// the two subscriptions are served by one dispatcher, so drain them concurrently
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		receive(first, "1")
+	}()
+	receive(second, "1")
+	<-done
+
+	assert.NoError(t, first.unsubscribe())
+	receive(second, "2")
+	select {
+	case frame := <-first.FrameCh:
+		t.Fatalf("unsubscribed subscription received %s", frame.BodyString())
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestWithBufferSize_SlowConsumerDoesNotDelayOthers(t *testing.T) {
+	const count = 100
+	ts := startScriptedWSServer(t, func(c *websocket.Conn) {
+		var ids []string
+		for len(ids) < 2 {
+			_, msg, err := c.ReadMessage()
+			if err != nil {
+				return
+			}
+			if frame := ReadFrame(append([]byte("a"), msg...)); frame.Command == SUBSCRIBE {
+				id, _ := frame.Contains(Id)
+				ids = append(ids, id)
+			}
+		}
+		for i := 0; i < count; i++ {
+			for _, id := range ids {
+				message := CreateFrame(MESSAGE, []string{Subscription_h + ":" + id})
+				message.SetBody([]byte(strconv.Itoa(i)))
+				if err := c.WriteMessage(websocket.TextMessage, append([]byte("a"), message.Bytes()...)); err != nil {
+					return
+				}
+			}
+		}
+		_, _, _ = c.ReadMessage()
+	})
+	defer ts.Close()
+	client := connectTestClient(t, ts)
+	defer client.connection.Close()
+
+	slow, err := client.Subscribe("/topic/test", WithBufferSize(count))
+	assert.NoError(t, err)
+	fast, err := client.Subscribe("/topic/test")
+	assert.NoError(t, err)
+
+	// slow is never read, its frames wait in the buffer
+	for i := 0; i < count; i++ {
+		select {
+		case frame := <-fast.FrameCh:
+			assert.Equal(t, strconv.Itoa(i), frame.BodyString())
+		case <-time.After(5 * time.Second):
+			t.Fatalf("fast consumer got %d of %d frames", i, count)
+		}
+	}
+	assert.Eventually(t, func() bool { return slow.Pending() == count }, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, 0, fast.Pending())
+}
+
+// startPushWSServer starts a websocket test server that waits for a SUBSCRIBE frame and then
+// pushes count MESSAGE frames for that subscription with the sequence number as body
+func startPushWSServer(t *testing.T, count int) *httptest.Server {
+	t.Helper()
+	return startPushWSServerWithBody(t, count, func(i int) []byte { return []byte(strconv.Itoa(i)) })
+}
+
+// startPushWSServerWithBody works like startPushWSServer with the body of the i-th frame returned by body
+func startPushWSServerWithBody(t *testing.T, count int, body func(i int) []byte) *httptest.Server {
+	t.Helper()
+	upgrader := websocket.Upgrader{
+		CheckOrigin: func(r *http.Request) bool { return true },
+	}
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("upgrade error: %v", err)
+			return
+		}
+		defer c.Close()
+		if _, _, err = c.ReadMessage(); err != nil {
+			return
+		}
+		_ = c.WriteMessage(websocket.TextMessage, []byte("o"))
+		_ = c.WriteMessage(websocket.TextMessage, []byte(connectedTestFrame))
+		for {
+			_, msg, err := c.ReadMessage()
+			if err != nil {
+				return
+			}
+			frame := ReadFrame(append([]byte("a"), msg...))
+			if frame.Command != SUBSCRIBE {
+				continue
+			}
+			id, _ := frame.Contains(Id)
+			for i := 0; i < count; i++ {
+				message := CreateFrame(MESSAGE, []string{Subscription_h + ":" + id})
+				message.SetBody(body(i))
+				if err := c.WriteMessage(websocket.TextMessage, append([]byte("a"), message.Bytes()...)); err != nil {
+					return
+				}
+			}
+		}
+	})
+	return httptest.NewServer(h)
+}
+
+func connectTestClient(t *testing.T, ts *httptest.Server, opts ...ConnectOption) *StompClient {
+	t.Helper()
+	u, _ := url.Parse(ts.URL)
+	u.Scheme = "ws"
+	client, err := ConnectWithToken(*u, websocket.Dialer{}, "token-abc", opts...)
+	if err != nil {
+		t.Fatalf("ConnectWithToken failed: %v", err)
+	}
+	return client
+}
+
+func TestSubscription_SwapChannelUnderLoad(t *testing.T) {
+	const count = 3000
+	ts := startPushWSServer(t, count)
+	defer ts.Close()
+	client := connectTestClient(t, ts)
+	defer client.connection.Close()
+
+	sub, err := client.Subscribe("/topic/test")
+	assert.NoError(t, err)
+
+	swaps := 0
+	nextSwap := time.Now().Add(10 * time.Millisecond)
+	timeout := time.After(10 * time.Second)
+	for expected := 0; expected < count; {
+		if time.Now().After(nextSwap) {
+			_, err := sub.SwapChannel(make(chan *Frame, 64))
+			assert.NoError(t, err)
+			swaps++
+			nextSwap = time.Now().Add(10 * time.Millisecond)
+		}
+		select {
+		case frame, ok := <-sub.FrameCh:
+			if !assert.True(t, ok, "read from a closed channel") {
+				return
+			}
+			if !assert.Equal(t, strconv.Itoa(expected), frame.BodyString()) {
+				return
+			}
+			expected++
+			if expected%100 == 0 {
+				// let frames pile up in the buffered channel so swaps have something to drain
+				time.Sleep(time.Millisecond)
+			}
+		case <-timeout:
+			t.Fatalf("timed out after %d frames", expected)
+		}
+	}
+	assert.Positive(t, swaps)
+}
+
+func TestSubscription_SwapChannelDrainsBufferedFrames(t *testing.T) {
+	oldCh := make(chan *Frame, 3)
+	oldCh <- createTestFrame(MESSAGE, nil, "1")
+	oldCh <- createTestFrame(MESSAGE, nil, "2")
+	channels := map[SubscriptionID]chan *Frame{"sub": oldCh}
+
+	newCh := make(chan *Frame, 2)
+	result := make(chan swapResult, 1)
+	var current atomic.Pointer[chan *Frame]
+	current.Store(&oldCh)
+	swapChannel(channels, swapRequest{Id: "sub", NewCh: newCh, Current: &current, Result: result})
+
+	r := <-result
+	assert.NoError(t, r.Err)
+	assert.Equal(t, 2, r.Drained)
+	assert.Equal(t, newCh, channels["sub"])
+	assert.Equal(t, newCh, *current.Load())
+	assert.Equal(t, "1", (<-newCh).BodyString())
+	assert.Equal(t, "2", (<-newCh).BodyString())
+	_, ok := <-oldCh
+	assert.False(t, ok)
+}
+
+func TestSubscription_SwapChannelErrors(t *testing.T) {
+	oldCh := make(chan *Frame, 2)
+	oldCh <- &Frame{}
+	oldCh <- &Frame{}
+	channels := map[SubscriptionID]chan *Frame{"sub": oldCh}
+	result := make(chan swapResult, 1)
+
+	swapChannel(channels, swapRequest{Id: "unknown", NewCh: make(chan *Frame), Result: result})
+	assert.ErrorIs(t, (<-result).Err, ErrSubscriptionNotFound)
+
+	swapChannel(channels, swapRequest{Id: "sub", NewCh: make(chan *Frame, 1), Result: result})
+	assert.ErrorIs(t, (<-result).Err, ErrSwapChannelTooSmall)
+	assert.Equal(t, oldCh, channels["sub"])
+	assert.Len(t, oldCh, 2)
+
+	swapChannel(channels, swapRequest{Id: "sub", NewCh: oldCh, Result: result})
+	assert.Error(t, (<-result).Err)
+}
+
+func TestSubscription_ReadDuringSwapChannel(t *testing.T) {
+	ts, push, subscribed := startTriggeredPushServer(t)
+	client := connectTestClient(t, ts, WithLogger(NopLogger()))
+	defer client.connection.Close()
+	sub, err := client.Subscribe("/topic/a")
+	if !assert.NoError(t, err) {
+		return
+	}
+	<-subscribed
+
+	type result struct {
+		frame *Frame
+		err   error
+	}
+	results := make(chan result, 1)
+	go func() {
+		frame, err := sub.Read(context.Background())
+		results <- result{frame, err}
+	}()
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				sub.Pending()
+				sub.TryRead()
+			}
+		}
+	}()
+	time.Sleep(20 * time.Millisecond)
+	_, err = sub.SwapChannel(make(chan *Frame, 1))
+	assert.NoError(t, err)
+	push <- "a"
+
+	select {
+	case r := <-results:
+		if assert.NoError(t, r.err) {
+			assert.Equal(t, "a", r.frame.BodyString())
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Read did not return the frame delivered to the new channel")
+	}
+}
+
+func TestSubscription_SwapChannelClosedClient(t *testing.T) {
+	client := &StompClient{swapCh: make(chan swapRequest), done: make(chan struct{})}
+	close(client.done)
+	sub := &Subscription{stompClient: *client, id: "sub"}
+	_, err := sub.SwapChannel(make(chan *Frame))
+	assert.ErrorIs(t, err, ErrClientClosed)
+}
+
+func TestWithMaxFrameSize(t *testing.T) {
+	ts := startPushWSServerWithBody(t, 1, func(int) []byte { return []byte(strings.Repeat("x", 4096)) })
+	defer ts.Close()
+	client := connectTestClient(t, ts, WithMaxFrameSize(1024))
+	defer client.connection.Close()
+
+	sub, err := client.Subscribe("/topic/test")
+	assert.NoError(t, err)
+	select {
+	case frame := <-sub.FrameCh:
+		assert.Equal(t, ERROR, frame.Command)
+		message, _ := frame.Contains(Message)
+		assert.Contains(t, message, ErrFrameTooLarge.Error())
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the ERROR frame")
+	}
+	select {
+	case <-client.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("client was not closed")
+	}
+}
+
+func TestWithSubscriptionOverflow(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   OverflowPolicy
+		buffer   int
+		expected []string
+	}{
+		{"drop newest", OverflowDropNewest, 3, []string{"0", "1", "2"}},
+		{"drop oldest", OverflowDropOldest, 3, []string{"7", "8", "9"}},
+		{"drop oldest unbuffered", OverflowDropOldest, 0, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := startPushWSServer(t, 10)
+			defer ts.Close()
+			metrics := NewCounterMetrics()
+			client := connectTestClient(t, ts, WithMetrics(metrics))
+			defer client.connection.Close()
+
+			sub, err := client.Subscribe("/topic/test", WithBufferSize(tt.buffer), WithSubscriptionOverflow(tt.policy))
+			assert.NoError(t, err)
+			dropped := uint64(10 - len(tt.expected))
+			assert.Eventually(t, func() bool { return sub.Dropped() == dropped }, 5*time.Second, 10*time.Millisecond)
+			var bodies []string
+			for sub.Pending() > 0 {
+				bodies = append(bodies, (<-sub.FrameCh).BodyString())
+			}
+			assert.Equal(t, tt.expected, bodies)
+			assert.Equal(t, dropped, metrics.Snapshot().Errors[ErrorKindDropped])
+		})
+	}
+}
+
+func TestSubscription_Read(t *testing.T) {
+	tests := []struct {
+		name        string
+		buffered    []string
+		unsubscribe bool
+		closeCh     bool
+		closeClient bool
+		expected    []string
+		expectedErr error
+	}{
+		{name: "buffered frame", buffered: []string{"a"}, expected: []string{"a"}, expectedErr: context.DeadlineExceeded},
+		{name: "context done", expectedErr: context.DeadlineExceeded},
+		{name: "unsubscribed", buffered: []string{"a", "b"}, unsubscribe: true, expected: []string{"a", "b"}, expectedErr: ErrSubscriptionClosed},
+		{name: "channel closed", buffered: []string{"a"}, closeCh: true, expected: []string{"a"}, expectedErr: ErrSubscriptionClosed},
+		{name: "client closed", closeClient: true, expectedErr: ErrSubscriptionClosed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			done := make(chan struct{})
+			sub := &Subscription{
+				FrameCh:      make(chan *Frame, 4),
+				stompClient:  StompClient{done: done},
+				unsubscribed: newUnsubscribeSignal(),
+			}
+			for _, body := range tt.buffered {
+				sub.FrameCh <- createTestFrame(MESSAGE, nil, body)
+			}
+			if tt.unsubscribe {
+				sub.unsubscribed.close()
+			}
+			if tt.closeCh {
+				close(sub.FrameCh)
+			}
+			if tt.closeClient {
+				close(done)
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+			defer cancel()
+			var bodies []string
+			for {
+				frame, err := sub.Read(ctx)
+				if err != nil {
+					assert.ErrorIs(t, err, tt.expectedErr)
+					break
+				}
+				bodies = append(bodies, frame.BodyString())
+			}
+			assert.Equal(t, tt.expected, bodies)
+		})
+	}
+}
+
+func TestSubscription_TryRead(t *testing.T) {
+	sub := &Subscription{FrameCh: make(chan *Frame, 1)}
+	_, ok := sub.TryRead()
+	assert.False(t, ok)
+	sub.FrameCh <- createTestFrame(MESSAGE, nil, "a")
+	frame, ok := sub.TryRead()
+	if assert.True(t, ok) {
+		assert.Equal(t, "a", frame.BodyString())
+	}
+	close(sub.FrameCh)
+	_, ok = sub.TryRead()
+	assert.False(t, ok)
+}
+
+func TestSubscription_ReadConcurrently(t *testing.T) {
+	ts, push, subscribed := startTriggeredPushServer(t)
+	client := connectTestClient(t, ts, WithLogger(NopLogger()))
+	defer client.connection.Close()
+	sub, err := client.Subscribe("/topic/a", WithBufferSize(8))
+	if !assert.NoError(t, err) {
+		return
+	}
+	<-subscribed
+
+	const readers, count = 4, 100
+	bodies := make(chan string, count)
+	errs := make(chan error, readers)
+	for i := 0; i < readers; i++ {
+		go func() {
+			for {
+				frame, err := sub.Read(context.Background())
+				if err != nil {
+					errs <- err
+					return
+				}
+				bodies <- frame.BodyString()
+			}
+		}()
+	}
+	for i := 0; i < count; i++ {
+		push <- strconv.Itoa(i)
+	}
+	seen := make(map[string]bool)
+	for len(seen) < count {
+		select {
+		case body := <-bodies:
+			assert.False(t, seen[body], "frame %s read twice", body)
+			seen[body] = true
+		case <-time.After(5 * time.Second):
+			t.Fatalf("read %d frames, expected %d", len(seen), count)
+		}
+	}
+	sub.Unsubscribe()
+	for i := 0; i < readers; i++ {
+		assert.ErrorIs(t, <-errs, ErrSubscriptionClosed)
+	}
 }
@@ -0,0 +1,216 @@
+package go_stomp_websocket
+
+import (
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// crashBuffer is the capacity of the supervisor crash channel.
+const crashBuffer = 16
+
+const (
+	defaultMaxRestarts           = 10
+	defaultRestartWindow         = time.Minute
+	defaultRestartInitialBackoff = 100 * time.Millisecond
+	defaultRestartMaxBackoff     = 5 * time.Second
+)
+
+// ConsumerCrash is a panic of a consume function run by Supervise.
+type ConsumerCrash struct {
+	Subscription SubscriptionID
+	Frame        *Frame // the frame consume panicked on
+	Panic        any
+	Stack        []byte
+	Recent       int   // crashes within the restart window, this one included
+	NackErr      error // the error of nacking Frame, if it was nacked
+}
+
+type SuperviseOption func(*superviseOptions)
+
+type superviseOptions struct {
+	maxRestarts int
+	window      time.Duration
+	backoff     RetryPolicy
+	nackOpts    []NackOption
+}
+
+// WithRestartLimit makes the supervisor give up when consume panics more than maxRestarts times within window.
+// The default is 10 restarts per minute.
+func WithRestartLimit(maxRestarts int, window time.Duration) SuperviseOption {
+	return func(options *superviseOptions) {
+		options.maxRestarts = maxRestarts
+		options.window = window
+	}
+}
+
+// WithRestartBackoff sets the wait before a restart, initial after the first crash of the window and doubled
+// after every next one up to max. The default is 100ms up to 5 seconds.
+func WithRestartBackoff(initial, max time.Duration) SuperviseOption {
+	return func(options *superviseOptions) {
+		options.backoff.InitialBackoff = initial
+		options.backoff.MaxBackoff = max
+	}
+}
+
+// WithCrashNack sets the options of the NACK frame sent for the frame consume panicked on.
+func WithCrashNack(opts ...NackOption) SuperviseOption {
+	return func(options *superviseOptions) {
+		options.nackOpts = opts
+	}
+}
+
+// Supervisor runs the consume loop of a subscription. See Supervise.
+type Supervisor struct {
+	crashes    chan ConsumerCrash
+	crashCount atomic.Uint64
+	stop       chan struct{}
+	stopOnce   sync.Once
+	done       chan struct{}
+	err        error // set before done is closed
+}
+
+// Supervise calls consume for every frame of sub in a goroutine of the client until FrameCh is closed, the
+// client is closed or Stop is called. A panic of consume is recovered and the loop restarts with the next
+// frame after a backoff; more restarts than WithRestartLimit allows stop the supervisor with
+// ErrTooManyRestarts. Every crash is counted as ErrorKindConsumerPanic and sent to Crashes.
+//
+// The frame consume panicked on is nacked when it has an ack header, which STOMP 1.2 brokers only set on the
+// frames of subscriptions in a client ack mode. Errors returned by consume are logged and the loop goes on.
+// The supervisor receives from FrameCh as it is when Supervise is called; do not receive from it elsewhere.
+func (stompClient StompClient) Supervise(sub *Subscription, consume func(*Frame) error, opts ...SuperviseOption) *Supervisor {
+	options := &superviseOptions{
+		maxRestarts: defaultMaxRestarts,
+		window:      defaultRestartWindow,
+		backoff:     RetryPolicy{InitialBackoff: defaultRestartInitialBackoff, MaxBackoff: defaultRestartMaxBackoff},
+	}
+	for _, opt := range opts {
+		opt(options)
+	}
+	supervisor := &Supervisor{
+		crashes: make(chan ConsumerCrash, crashBuffer),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	ch := sub.FrameCh
+	release := claimReader(sub)
+	run := func() {
+		defer close(supervisor.done)
+		defer release()
+		supervisor.err = supervisor.run(stompClient, sub.id, ch, consume, options)
+	}
+	if stompClient.goroutines != nil {
+		stompClient.goroutines.goRole(roleSupervisor, run)
+	} else {
+		go run()
+	}
+	return supervisor
+}
+
+func (supervisor *Supervisor) run(stompClient StompClient, id SubscriptionID, ch chan *Frame, consume func(*Frame) error, options *superviseOptions) error {
+	var restarts []time.Time
+	for {
+		var frame *Frame
+		select {
+		case f, ok := <-ch:
+			if !ok {
+				return nil
+			}
+			frame = f
+		case <-supervisor.stop:
+			return nil
+		case <-stompClient.done:
+			return nil
+		}
+		r, stack, err := consumeFrame(consume, frame)
+		if r == nil {
+			if err != nil {
+				stompClient.logger.Errorf("[%s] consumer of %s failed: %v", roleSupervisor, id, err)
+			}
+			continue
+		}
+		now := time.Now()
+		recent := restarts[:0]
+		for _, at := range restarts {
+			if now.Sub(at) < options.window {
+				recent = append(recent, at)
+			}
+		}
+		restarts = append(recent, now)
+		crash := ConsumerCrash{Subscription: id, Frame: frame, Panic: r, Stack: stack, Recent: len(restarts)}
+		if _, ok := frame.Contains(Ack); ok && frame.Command == MESSAGE {
+			select {
+			case <-stompClient.done:
+				// the client is gone and so is the subscription, the broker redelivers the frame
+				crash.NackErr = ErrClientClosed
+			default:
+				crash.NackErr = stompClient.Nack(frame, options.nackOpts...)
+			}
+		}
+		supervisor.report(stompClient, crash)
+		if len(restarts) > options.maxRestarts {
+			return fmt.Errorf("%w: %d crashes of the consumer of %s within %s", ErrTooManyRestarts, len(restarts), id, options.window)
+		}
+		select {
+		case <-time.After(options.backoff.backoff(len(restarts))):
+		case <-supervisor.stop:
+			return nil
+		case <-stompClient.done:
+			return nil
+		}
+	}
+}
+
+// consumeFrame calls consume and recovers its panic.
+func consumeFrame(consume func(*Frame) error, frame *Frame) (r any, stack []byte, err error) {
+	defer func() {
+		if r = recover(); r != nil {
+			stack = debug.Stack()
+		}
+	}()
+	return nil, nil, consume(frame)
+}
+
+// report logs, counts and publishes a crash without blocking.
+func (supervisor *Supervisor) report(stompClient StompClient, crash ConsumerCrash) {
+	stompClient.logger.Errorf("[%s] consumer of %s panicked: %v", roleSupervisor, crash.Subscription, crash.Panic)
+	stompClient.metrics.ErrorOccurred(ErrorKindConsumerPanic)
+	supervisor.crashCount.Add(1)
+	select {
+	case supervisor.crashes <- crash:
+	default:
+	}
+}
+
+// Crashes returns the channel that receives the crashes of the consumer. Crashes are dropped when nobody reads
+// the channel and its buffer is full; CrashCount still counts them. The channel is not closed.
+func (supervisor *Supervisor) Crashes() <-chan ConsumerCrash {
+	return supervisor.crashes
+}
+
+// CrashCount returns how many times the consumer panicked.
+func (supervisor *Supervisor) CrashCount() uint64 {
+	return supervisor.crashCount.Load()
+}
+
+// Stop stops the supervisor once the frame being consumed, if any, is done.
+func (supervisor *Supervisor) Stop() {
+	supervisor.stopOnce.Do(func() { close(supervisor.stop) })
+}
+
+// Done is closed when the supervisor has stopped.
+func (supervisor *Supervisor) Done() <-chan struct{} {
+	return supervisor.done
+}
+
+// Err returns ErrTooManyRestarts if the supervisor gave up, and nil while it runs or after it stopped otherwise.
+func (supervisor *Supervisor) Err() error {
+	select {
+	case <-supervisor.done:
+		return supervisor.err
+	default:
+		return nil
+	}
+}
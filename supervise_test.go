@@ -0,0 +1,131 @@
+package go_stomp_websocket
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+// startAckPushWSServer starts a test server that answers the first SUBSCRIBE with count MESSAGE frames with the
+// sequence number as body and ack header, and sends the id header of every NACK frame it receives to nacks.
+func startAckPushWSServer(t *testing.T, count int, nacks chan<- string) *httptest.Server {
+	t.Helper()
+	ts := startScriptedWSServer(t, func(c *websocket.Conn) {
+		for {
+			_, data, err := c.ReadMessage()
+			if err != nil {
+				return
+			}
+			frame := ReadFrame(append([]byte("a"), data...))
+			switch frame.Command {
+			case SUBSCRIBE:
+				id, _ := frame.Contains(Id)
+				for i := 0; i < count; i++ {
+					message := createTestFrame(MESSAGE, []string{Subscription_h + ":" + id, "ack:" + strconv.Itoa(i)}, strconv.Itoa(i))
+					if err := c.WriteMessage(websocket.TextMessage, append([]byte("a"), message.Bytes()...)); err != nil {
+						return
+					}
+				}
+			case NACK:
+				ack, _ := frame.Contains(Id)
+				nacks <- ack
+			}
+		}
+	})
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func TestSupervise_KeepsPipelineFlowing(t *testing.T) {
+	const count = 100
+	nacks := make(chan string, count)
+	ts := startAckPushWSServer(t, count, nacks)
+	metrics := NewCounterMetrics()
+	client := connectTestClient(t, ts, WithLogger(NopLogger()), WithMetrics(metrics))
+	defer client.connection.Close()
+	sub, err := client.Subscribe("/queue/a", WithBufferSize(8))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	consumed := make(chan string, count)
+	supervisor := client.Supervise(sub, func(frame *Frame) error {
+		i, _ := strconv.Atoi(frame.BodyString())
+		if i%10 == 9 {
+			panic("consumer bug on " + frame.BodyString())
+		}
+		if i%10 == 4 {
+			return errors.New("logged, not a crash")
+		}
+		consumed <- frame.BodyString()
+		return nil
+	}, WithRestartLimit(20, time.Minute), WithRestartBackoff(time.Millisecond, time.Millisecond))
+
+	var bodies []string
+	for len(bodies) < 80 {
+		select {
+		case body := <-consumed:
+			bodies = append(bodies, body)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("consumed %d frames, expected 80", len(bodies))
+		}
+	}
+	var nacked []string
+	for len(nacked) < 10 {
+		select {
+		case ack := <-nacks:
+			nacked = append(nacked, ack)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("received %d NACK frames, expected 10", len(nacked))
+		}
+	}
+	assert.Equal(t, []string{"9", "19", "29", "39", "49", "59", "69", "79", "89", "99"}, nacked)
+	assert.Equal(t, uint64(10), supervisor.CrashCount())
+	assert.Equal(t, uint64(10), metrics.Snapshot().Errors[ErrorKindConsumerPanic])
+	for i := 0; i < 10; i++ {
+		crash := <-supervisor.Crashes()
+		assert.Equal(t, "consumer bug on "+strconv.Itoa(i*10+9), crash.Panic)
+		assert.Equal(t, i+1, crash.Recent)
+		assert.NoError(t, crash.NackErr)
+		assert.NotEmpty(t, crash.Stack)
+	}
+
+	supervisor.Stop()
+	<-supervisor.Done()
+	assert.NoError(t, supervisor.Err())
+}
+
+func TestSupervise_GivesUp(t *testing.T) {
+	ts := startAckPushWSServer(t, 10, make(chan string, 10))
+	client := connectTestClient(t, ts, WithLogger(NopLogger()))
+	defer client.connection.Close()
+	sub, err := client.Subscribe("/queue/a", WithBufferSize(10))
+	if !assert.NoError(t, err) {
+		return
+	}
+	supervisor := client.Supervise(sub, func(*Frame) error { panic("always") },
+		WithRestartLimit(3, time.Minute), WithRestartBackoff(time.Millisecond, time.Millisecond))
+	select {
+	case <-supervisor.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("supervisor did not give up")
+	}
+	assert.ErrorIs(t, supervisor.Err(), ErrTooManyRestarts)
+	assert.Equal(t, uint64(4), supervisor.CrashCount())
+}
+
+func TestSupervise_StopsWhenChannelCloses(t *testing.T) {
+	sub := &Subscription{id: "s1", FrameCh: make(chan *Frame, 1)}
+	calls := 0
+	supervisor := StompClient{}.Supervise(sub, func(*Frame) error { calls++; return nil })
+	sub.FrameCh <- createTestFrame(MESSAGE, nil, "x")
+	close(sub.FrameCh)
+	<-supervisor.Done()
+	assert.NoError(t, supervisor.Err())
+	assert.Equal(t, 1, calls)
+}
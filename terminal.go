@@ -0,0 +1,49 @@
+package go_stomp_websocket
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// terminalState reports how the connection of a client ended on the client Errors channel.
+type terminalState struct {
+	once          sync.Once
+	errors        chan error // buffered, gets at most one error and is closed after it
+	disconnecting atomic.Bool
+	draining      atomic.Bool // set by Drain
+
+	disconnectedAt atomic.Pointer[string] // stack of the Disconnect call, with the stompdebug tag only
+}
+
+func newTerminalState() *terminalState {
+	return &terminalState{errors: make(chan error, 1)}
+}
+
+// fail reports the first abnormal end of the connection. Failures after Disconnect started are the
+// expected teardown and are not reported.
+func (state *terminalState) fail(cause error) {
+	if state.disconnecting.Load() {
+		return
+	}
+	state.finish(cause)
+}
+
+// finish sends cause, if any, and closes the channel. Only the first call has an effect.
+func (state *terminalState) finish(cause error) {
+	state.once.Do(func() {
+		if cause != nil {
+			state.errors <- &ConnectionError{Cause: cause}
+		}
+		close(state.errors)
+	})
+}
+
+// Errors returns a channel that receives a *ConnectionError when the connection fails, for example when the
+// websocket is closed by the server, a frame can't be parsed, a read times out, a write fails or the broker sends ERROR.
+// The channel is closed after that error, and without any error after a clean Disconnect.
+func (stompClient StompClient) Errors() <-chan error {
+	if stompClient.terminal == nil {
+		return nil
+	}
+	return stompClient.terminal.errors
+}
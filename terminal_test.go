@@ -0,0 +1,163 @@
+package go_stomp_websocket
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+// startScriptedWSServer starts a websocket test server that completes the STOMP handshake
+// and then hands the connection to script
+func startScriptedWSServer(t testing.TB, script func(c *websocket.Conn)) *httptest.Server {
+	t.Helper()
+	upgrader := websocket.Upgrader{
+		CheckOrigin: func(r *http.Request) bool { return true },
+	}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("upgrade error: %v", err)
+			return
+		}
+		defer c.Close()
+		if _, _, err = c.ReadMessage(); err != nil {
+			return
+		}
+		_ = c.WriteMessage(websocket.TextMessage, []byte("o"))
+		_ = c.WriteMessage(websocket.TextMessage, []byte(connectedTestFrame))
+		script(c)
+	}))
+}
+
+func receiveTerminalError(t *testing.T, client *StompClient) (error, bool) {
+	t.Helper()
+	select {
+	case err, ok := <-client.Errors():
+		return err, ok
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting on the client error channel")
+		return nil, false
+	}
+}
+
+func TestErrors_ClosedOnCleanDisconnect(t *testing.T) {
+	ts, _ := startTestWSServer(t)
+	defer ts.Close()
+	client := connectTestClient(t, ts)
+
+	assert.NoError(t, client.Disconnect())
+	err, ok := receiveTerminalError(t, client)
+	assert.False(t, ok)
+	assert.NoError(t, err)
+}
+
+func TestErrors_TerminalFailures(t *testing.T) {
+	tests := []struct {
+		name   string
+		script func(c *websocket.Conn)
+		check  func(t *testing.T, err error)
+	}{
+		{
+			name: "websocket closed by the server",
+			script: func(c *websocket.Conn) {
+				closeMessage := websocket.FormatCloseMessage(websocket.CloseGoingAway, "bye")
+				_ = c.WriteControl(websocket.CloseMessage, closeMessage, time.Now().Add(time.Second))
+			},
+			check: func(t *testing.T, err error) {
+				var closeErr *websocket.CloseError
+				assert.True(t, errors.As(err, &closeErr))
+				assert.Equal(t, websocket.CloseGoingAway, closeErr.Code)
+				var closed *WebSocketClosedError
+				if assert.ErrorAs(t, err, &closed) {
+					assert.Equal(t, websocket.CloseGoingAway, closed.Code)
+					assert.Equal(t, "bye", closed.Reason)
+				}
+			},
+		},
+		{
+			name: "broker ERROR frame",
+			script: func(c *websocket.Conn) {
+				_ = c.WriteMessage(websocket.TextMessage, []byte(`a["ERROR\nmessage:session expired\n\n\u0000"]`))
+				_, _, _ = c.ReadMessage()
+			},
+			check: func(t *testing.T, err error) {
+				var brokerErr *BrokerError
+				assert.True(t, errors.As(err, &brokerErr))
+				assert.Equal(t, "session expired", brokerErr.Message)
+			},
+		},
+		{
+			name: "SockJS close",
+			script: func(c *websocket.Conn) {
+				_ = c.WriteMessage(websocket.TextMessage, []byte(`c[3000,"Go away!"]`))
+				_, _, _ = c.ReadMessage()
+			},
+			check: func(t *testing.T, err error) {
+				assert.ErrorIs(t, err, errSockJSClosed)
+				var closed *WebSocketClosedError
+				if assert.ErrorAs(t, err, &closed) {
+					assert.Equal(t, 3000, closed.Code)
+					assert.Equal(t, "Go away!", closed.Reason)
+				}
+				assert.False(t, errors.As(err, new(*FrameParseError)))
+			},
+		},
+		{
+			name: "unreadable message",
+			script: func(c *websocket.Conn) {
+				_ = c.WriteMessage(websocket.BinaryMessage, []byte{0x01, 0x02})
+				_, _, _ = c.ReadMessage()
+			},
+			check: func(t *testing.T, err error) {
+				assert.ErrorIs(t, err, ErrBinaryMessage)
+				var parseErr *FrameParseError
+				if assert.ErrorAs(t, err, &parseErr) {
+					assert.Equal(t, []byte{0x01, 0x02}, parseErr.Raw)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := startScriptedWSServer(t, tt.script)
+			defer ts.Close()
+			client := connectTestClient(t, ts)
+			defer client.connection.Close()
+
+			err, ok := receiveTerminalError(t, client)
+			assert.True(t, ok)
+			var connErr *ConnectionError
+			assert.True(t, errors.As(err, &connErr))
+			tt.check(t, err)
+
+			_, ok = receiveTerminalError(t, client)
+			assert.False(t, ok, "the channel must be closed after the terminal error")
+		})
+	}
+}
+
+func TestTerminalState_ReportsOnce(t *testing.T) {
+	state := newTerminalState()
+	state.fail(errors.New("first"))
+	state.fail(errors.New("second"))
+	state.finish(nil)
+	var got []string
+	for err := range state.errors {
+		got = append(got, err.Error())
+	}
+	assert.Equal(t, []string{"stomp connection failed: first"}, got)
+}
+
+func TestTerminalState_IgnoresFailuresWhileDisconnecting(t *testing.T) {
+	state := newTerminalState()
+	state.disconnecting.Store(true)
+	state.fail(errors.New("connection reset"))
+	state.finish(nil)
+	_, ok := <-state.errors
+	assert.False(t, ok)
+}
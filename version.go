@@ -0,0 +1,151 @@
+package go_stomp_websocket
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// defaultAcceptVersions are the STOMP versions offered on CONNECT unless WithAcceptVersions is used.
+var defaultAcceptVersions = []string{"1.2", "1.1", "1.0"}
+
+// WithAcceptVersions sets the STOMP versions offered in the accept-version header of CONNECT, replacing the
+// default 1.2, 1.1 and 1.0. Versions other than these fail the connect with ErrUnsupportedVersion, and so does a
+// broker selecting a version that was not offered. Without arguments the default is offered.
+func WithAcceptVersions(versions ...string) ConnectOption {
+	return func(options *connectOptions) {
+		options.acceptVersions = append([]string{}, versions...)
+	}
+}
+
+// offeredVersions returns the versions of the accept-version header.
+func (options *connectOptions) offeredVersions() []string {
+	if len(options.acceptVersions) == 0 {
+		return defaultAcceptVersions
+	}
+	return options.acceptVersions
+}
+
+// checkAcceptVersions fails the connect when WithAcceptVersions was given a version the client does not speak.
+func (options *connectOptions) checkAcceptVersions() error {
+	for _, version := range options.offeredVersions() {
+		if !slices.Contains(defaultAcceptVersions, version) {
+			return fmt.Errorf("%w: can't offer STOMP %q, supported are %s", ErrUnsupportedVersion, version, strings.Join(defaultAcceptVersions, ", "))
+		}
+	}
+	return nil
+}
+
+// checkVersion fails the connect when the broker selected a version the client did not offer.
+func (options *connectOptions) checkVersion(version string) error {
+	if slices.Contains(options.offeredVersions(), version) {
+		return nil
+	}
+	return fmt.Errorf("%w: broker selected STOMP %q, offered %s", ErrUnsupportedVersion, version, strings.Join(options.offeredVersions(), ","))
+}
+
+// ProtocolVersion returns the STOMP version the broker selected in its CONNECTED frame, "1.0" for brokers that
+// did not send a version header.
+func (stompClient StompClient) ProtocolVersion() string {
+	return stompClient.version
+}
+
+// escapesHeaders tells whether frames of version escape their header keys and values. STOMP 1.0 does not, and
+// neither do CONNECT and CONNECTED frames of any version.
+func escapesHeaders(version string) bool {
+	return version == "1.1" || version == "1.2"
+}
+
+// escapeFrame returns frame with its headers escaped for the negotiated version, frame itself when nothing needs
+// escaping.
+func (stompClient *StompClient) escapeFrame(frame *Frame) *Frame {
+	if !escapesHeaders(stompClient.version) || frame.Command == CONNECT || frame.Command == STOMP {
+		return frame
+	}
+	special := "\\:\n"
+	if stompClient.version == "1.2" {
+		special = "\\:\n\r"
+	}
+	var headers []string
+	for i, header := range frame.Headers {
+		key, value, _ := strings.Cut(header, ":")
+		if headers == nil && !strings.ContainsAny(key, special) && !strings.ContainsAny(value, special) {
+			continue
+		}
+		if headers == nil {
+			headers = append(make([]string, 0, len(frame.Headers)), frame.Headers[:i]...)
+		}
+		headers = append(headers, escapeHeader(key, special)+":"+escapeHeader(value, special))
+	}
+	if headers == nil {
+		return frame
+	}
+	escaped := *frame
+	escaped.Headers = headers
+	return &escaped
+}
+
+func escapeHeader(s, special string) string {
+	if !strings.ContainsAny(s, special) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\\':
+			b.WriteString(`\\`)
+		case c == ':':
+			b.WriteString(`\c`)
+		case c == '\n':
+			b.WriteString(`\n`)
+		case c == '\r' && strings.IndexByte(special, '\r') >= 0:
+			b.WriteString(`\r`)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// unescapeHeaders unescapes the header keys and values of a frame received over a connection of a version that
+// escapes them. A backslash that starts no escape sequence is kept.
+func (stompClient *StompClient) unescapeHeaders(frame *Frame) {
+	if !escapesHeaders(stompClient.version) || frame.Command == CONNECTED {
+		return
+	}
+	for i, header := range frame.Headers {
+		if strings.IndexByte(header, '\\') < 0 {
+			continue
+		}
+		key, value, _ := strings.Cut(header, ":")
+		frame.Headers[i] = unescapeHeader(key) + ":" + unescapeHeader(value)
+	}
+}
+
+func unescapeHeader(s string) string {
+	if strings.IndexByte(s, '\\') < 0 {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		switch s[i+1] {
+		case '\\':
+			b.WriteByte('\\')
+		case 'c':
+			b.WriteByte(':')
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		default:
+			b.WriteByte('\\')
+			continue
+		}
+		i++
+	}
+	return b.String()
+}
@@ -0,0 +1,165 @@
+package go_stomp_websocket
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEscapeFrame(t *testing.T) {
+	tests := []struct {
+		name     string
+		version  string
+		command  string
+		headers  []string
+		expected []string
+	}{
+		{name: "STOMP 1.0", version: "1.0", command: SEND, headers: []string{"destination:/a:b\\c"}, expected: []string{"destination:/a:b\\c"}},
+		{name: "STOMP 1.1", version: "1.1", command: SEND, headers: []string{"id:1", "destination:/a:b\\c\nd\re"},
+			expected: []string{"id:1", "destination:/a\\cb\\\\c\\nd\re"}},
+		{name: "STOMP 1.2", version: "1.2", command: SEND, headers: []string{"destination:/a:b\\c\nd\re", "id:1"},
+			expected: []string{"destination:/a\\cb\\\\c\\nd\\re", "id:1"}},
+		{name: "key", version: "1.2", command: SEND, headers: []string{"x\\y:z"}, expected: []string{"x\\\\y:z"}},
+		{name: "CONNECT", version: "1.2", command: CONNECT, headers: []string{"login:a:b"}, expected: []string{"login:a:b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			frame := createTestFrame(tt.command, tt.headers, "body")
+			original := append([]string{}, frame.Headers...)
+			escaped := (&StompClient{version: tt.version}).escapeFrame(frame)
+			assert.Equal(t, tt.expected, escaped.Headers)
+			assert.Equal(t, "body", escaped.BodyString())
+			assert.Equal(t, original, frame.Headers)
+		})
+	}
+	frame := createTestFrame(SEND, []string{"destination:/a"}, "")
+	assert.Same(t, frame, (&StompClient{version: "1.2"}).escapeFrame(frame))
+}
+
+func TestUnescapeHeaders(t *testing.T) {
+	tests := []struct {
+		name     string
+		version  string
+		command  string
+		headers  []string
+		expected []string
+	}{
+		{name: "STOMP 1.0", version: "1.0", command: MESSAGE, headers: []string{"x-a:1\\c2"}, expected: []string{"x-a:1\\c2"}},
+		{name: "escapes", version: "1.2", command: MESSAGE, headers: []string{"x-a:1\\c2\\n3\\r4\\\\5", "x\\cy:z"},
+			expected: []string{"x-a:1:2\n3\r4\\5", "x:y:z"}},
+		{name: "undefined escape and trailing backslash", version: "1.1", command: MESSAGE, headers: []string{"x-a:\\t\\"},
+			expected: []string{"x-a:\\t\\"}},
+		{name: "CONNECTED", version: "1.2", command: CONNECTED, headers: []string{"server:a\\cb"}, expected: []string{"server:a\\cb"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			frame := createTestFrame(tt.command, tt.headers, "")
+			(&StompClient{version: tt.version}).unescapeHeaders(frame)
+			assert.Equal(t, tt.expected, frame.Headers)
+		})
+	}
+}
+
+// startVersionWSServer starts a test server that answers CONNECT with connected and sends the frames it
+// receives to frames, CONNECT included. It sends message once the first SUBSCRIBE arrives.
+func startVersionWSServer(t *testing.T, connected, message string, frames chan<- *Frame) *httptest.Server {
+	t.Helper()
+	upgrader := websocket.Upgrader{CheckOrigin: func(r *http.Request) bool { return true }}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("upgrade error: %v", err)
+			return
+		}
+		defer c.Close()
+		for first := true; ; first = false {
+			_, data, err := c.ReadMessage()
+			if err != nil {
+				return
+			}
+			received, err := (&StompClient{splitter: &rawFrameSplitter{}}).readFrames(append([]byte("a"), data...))
+			if err != nil || len(received) != 1 {
+				t.Errorf("can't read %q: %v", data, err)
+				return
+			}
+			frame := received[0]
+			frames <- frame
+			switch {
+			case first:
+				_ = c.WriteMessage(websocket.TextMessage, []byte("o"))
+				_ = c.WriteMessage(websocket.TextMessage, []byte(connected))
+			case frame.Command == SUBSCRIBE && message != "":
+				_ = c.WriteMessage(websocket.TextMessage, []byte(message))
+			}
+		}
+	}))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func TestVersionNegotiation(t *testing.T) {
+	tests := []struct {
+		name          string
+		opts          []ConnectOption
+		connected     string
+		acceptVersion string
+		version       string
+		expectedErr   error
+	}{
+		{name: "default", connected: connectedTestFrame, acceptVersion: "1.2,1.1,1.0", version: "1.2"},
+		{name: "configured", opts: []ConnectOption{WithAcceptVersions("1.1", "1.0")},
+			connected: `a["CONNECTED\nversion:1.1\n\n\u0000"]`, acceptVersion: "1.1,1.0", version: "1.1"},
+		{name: "no version header", connected: `a["CONNECTED\n\n\u0000"]`, acceptVersion: "1.2,1.1,1.0", version: "1.0"},
+		{name: "version not offered", opts: []ConnectOption{WithAcceptVersions("1.1")},
+			connected: connectedTestFrame, acceptVersion: "1.1", expectedErr: ErrUnsupportedVersion},
+		{name: "1.0 not offered", opts: []ConnectOption{WithAcceptVersions("1.2")},
+			connected: `a["CONNECTED\n\n\u0000"]`, acceptVersion: "1.2", expectedErr: ErrUnsupportedVersion},
+		{name: "unknown version offered", opts: []ConnectOption{WithAcceptVersions("1.2", "2.0")}, expectedErr: ErrUnsupportedVersion},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			frames := make(chan *Frame, 4)
+			ts := startVersionWSServer(t, tt.connected, "", frames)
+			client, err := ConnectWithToken(wsURL(ts), websocket.Dialer{}, "token", append(tt.opts, WithLogger(NopLogger()))...)
+			if tt.expectedErr != nil {
+				assert.ErrorIs(t, err, tt.expectedErr)
+				assert.False(t, retryable(err))
+			} else if assert.NoError(t, err) {
+				assert.Equal(t, tt.version, client.ProtocolVersion())
+				assert.Equal(t, tt.version, client.EffectiveConfig().Version)
+				_ = client.connection.Close()
+			}
+			if tt.acceptVersion != "" {
+				acceptVersion, _ := (<-frames).Contains("accept-version")
+				assert.Equal(t, tt.acceptVersion, acceptVersion)
+			}
+		})
+	}
+}
+
+func TestHeaderEscaping_RoundTrip(t *testing.T) {
+	frames := make(chan *Frame, 4)
+	message := `a["MESSAGE\nsubscription:id-3\ndestination:/queue/a\\cb\nx-a:1\\c2\\\\3\n\nhi\u0000"]`
+	ts := startVersionWSServer(t, connectedTestFrame, message, frames)
+	client, err := ConnectWithToken(wsURL(ts), websocket.Dialer{}, "token", WithLogger(NopLogger()), WithIDGenerator(&sequentialIDs{}))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer client.connection.Close()
+	<-frames // CONNECT
+
+	subscription, err := client.Subscribe("/queue/a:b")
+	if !assert.NoError(t, err) {
+		return
+	}
+	destination, _ := (<-frames).Contains(Destination)
+	assert.Equal(t, `/queue/a\cb`, destination)
+	frame := <-subscription.FrameCh
+	destination, _ = frame.Contains(Destination)
+	assert.Equal(t, "/queue/a:b", destination)
+	value, _ := frame.Contains("x-a")
+	assert.Equal(t, `1:2\3`, value)
+}